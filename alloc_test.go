@@ -0,0 +1,116 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+)
+
+// allocBudget describes the maximum number of allocations that a single
+// run of fn is allowed to perform. Exceeding the budget is treated as a
+// regression: if a change legitimately needs more allocations, update
+// the budget in the same change so that it gets reviewed
+type allocBudget struct {
+	name string
+	max  float64
+	fn   func() error
+}
+
+func TestAllocBudget(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not reliable under the race detector")
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	// The rollback buffer is reused across values
+	guarded := msgpack.NewEncoder(&buf, msgpack.WithRollbackBuffer(1024))
+
+	encoded := func(v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal %#v: %s", v, err)
+		}
+		return append([]byte(nil), b...)
+	}
+
+	var rdr bytes.Reader
+	dec := msgpack.NewDecoder(&rdr)
+	decodeFrom := func(data []byte, fn func() error) func() error {
+		return func() error {
+			rdr.Reset(data)
+			dec.Reset(&rdr)
+			return fn()
+		}
+	}
+
+	var i64 int64
+	var u64 uint64
+	var f64 float64
+	var s string
+	var b bool
+	var st dummyStruct
+	var empty omitEmptyStruct
+	bytesBuf := make([]byte, 64)
+
+	intData := encoded(int64(-12345678))
+	uintData := encoded(uint64(12345678))
+	floatData := encoded(float64(3.14))
+	stringData := encoded("Hello, World!")
+	boolData := encoded(true)
+	bytesData := encoded([]byte("Hello, World!"))
+	structData := encoded(dummyStruct{Message: "Hello, World!"})
+
+	mapb := msgpack.NewMapBuilder()
+	mapb.AddString("message", "Hello, World!")
+	mapb.AddInt64("count", 12345678)
+	mapb.AddNil("nothing")
+
+	budgets := []allocBudget{
+		{name: "EncodeInt64", max: 0, fn: func() error { buf.Reset(); return enc.EncodeInt64(-12345678) }},
+		{name: "EncodeUint64", max: 0, fn: func() error { buf.Reset(); return enc.EncodeUint64(12345678) }},
+		{name: "EncodeFloat64", max: 0, fn: func() error { buf.Reset(); return enc.EncodeFloat64(3.14) }},
+		{name: "EncodeString", max: 1, fn: func() error { buf.Reset(); return enc.EncodeString("Hello, World!") }},
+		{name: "EncodeBool", max: 0, fn: func() error { buf.Reset(); return enc.EncodeBool(true) }},
+		{name: "DecodeInt64", max: 0, fn: decodeFrom(intData, func() error { return dec.DecodeInt64(&i64) })},
+		{name: "DecodeUint64", max: 0, fn: decodeFrom(uintData, func() error { return dec.DecodeUint64(&u64) })},
+		{name: "DecodeFloat64", max: 0, fn: decodeFrom(floatData, func() error { return dec.DecodeFloat64(&f64) })},
+		{name: "DecodeString", max: 1, fn: decodeFrom(stringData, func() error { return dec.DecodeString(&s) })},
+		{name: "DecodeBool", max: 0, fn: decodeFrom(boolData, func() error { return dec.DecodeBool(&b) })},
+		{name: "DecodeBytesInto", max: 0, fn: decodeFrom(bytesData, func() error { _, err := dec.DecodeBytesInto(bytesBuf); return err })},
+		{name: "GetDecoder", max: 0, fn: func() error {
+			rdr.Reset(intData)
+			d := msgpack.GetDecoder(&rdr)
+			defer msgpack.PutDecoder(d)
+			return d.DecodeInt64(&i64)
+		}},
+		{name: "Encoder.Reset", max: 0, fn: func() error { buf.Reset(); enc.Reset(&buf); return enc.EncodeInt64(-12345678) }},
+		{name: "Marshal struct", max: 1, fn: func() error { _, err := msgpack.Marshal(dummyStruct{Message: "Hello, World!"}); return err }},
+		{name: "Unmarshal struct", max: 5, fn: func() error { return msgpack.Unmarshal(structData, &st) }},
+		{name: "Encode struct", max: 4, fn: func() error { buf.Reset(); return enc.Encode(&st) }},
+		{name: "Encode struct with rollback", max: 4, fn: func() error { buf.Reset(); return guarded.Encode(&st) }},
+		{name: "Encode omitempty struct", max: 2, fn: func() error { buf.Reset(); return enc.Encode(&empty) }},
+		{name: "Decode struct", max: 5, fn: decodeFrom(structData, func() error { return dec.Decode(&st) })},
+		{name: "Skip struct", max: 0, fn: decodeFrom(structData, dec.Skip)},
+		{name: "MapBuilder typed entries", max: 7, fn: func() error { buf.Reset(); return mapb.Encode(&buf) }},
+	}
+
+	for _, budget := range budgets {
+		budget := budget
+		t.Run(budget.name, func(t *testing.T) {
+			var err error
+			allocs := testing.AllocsPerRun(100, func() {
+				if e := budget.fn(); e != nil {
+					err = e
+				}
+			})
+			if err != nil {
+				t.Fatalf("operation failed: %s", err)
+			}
+			if allocs > budget.max {
+				t.Errorf("%s: %.0f allocs/op exceeds budget of %.0f", budget.name, allocs, budget.max)
+			}
+		})
+	}
+}
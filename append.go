@@ -0,0 +1,182 @@
+package msgpack
+
+import (
+	"math"
+)
+
+// The Append functions encode a single value or header at the end of
+// dst, and return the extended slice, like strconv.AppendInt. They
+// never allocate unless dst needs to grow, which makes them suitable
+// for building messages in hot paths where even a pooled Encoder is too
+// much overhead:
+//
+//	buf = msgpack.AppendMapHeader(buf[:0], 2)
+//	buf = msgpack.AppendString(buf, "id")
+//	buf = msgpack.AppendInt(buf, id)
+//	buf = msgpack.AppendString(buf, "name")
+//	buf = msgpack.AppendString(buf, name)
+//
+// Integers are written in the smallest representation that holds them,
+// like EncodeCompactInt and EncodeCompactUint do. Strings, byte slices,
+// arrays, maps and extensions that are longer than math.MaxUint32 cannot
+// be represented in msgpack, and cause a panic
+
+// AppendNil appends Nil to dst
+func AppendNil(dst []byte) []byte {
+	return append(dst, Nil.Byte())
+}
+
+// AppendBool appends True or False to dst
+func AppendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, True.Byte())
+	}
+	return append(dst, False.Byte())
+}
+
+// AppendInt appends v to dst, as a fixnum, or as Int8, Int16, Int32 or
+// Int64
+func AppendInt(dst []byte, v int64) []byte {
+	switch {
+	case inPositiveFixNumRange(v), inNegativeFixNumRange(v):
+		return append(dst, byte(v))
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return append(dst, Int8.Byte(), byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return appendUint16(append(dst, Int16.Byte()), uint16(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return appendUint32(append(dst, Int32.Byte()), uint32(v))
+	default:
+		return appendUint64(append(dst, Int64.Byte()), uint64(v))
+	}
+}
+
+// AppendUint appends v to dst, as a positive fixnum, or as Uint8,
+// Uint16, Uint32 or Uint64
+func AppendUint(dst []byte, v uint64) []byte {
+	switch {
+	case v <= uint64(MaxPositiveFixNum):
+		return append(dst, byte(v))
+	case v <= math.MaxUint8:
+		return append(dst, Uint8.Byte(), byte(v))
+	case v <= math.MaxUint16:
+		return appendUint16(append(dst, Uint16.Byte()), uint16(v))
+	case v <= math.MaxUint32:
+		return appendUint32(append(dst, Uint32.Byte()), uint32(v))
+	default:
+		return appendUint64(append(dst, Uint64.Byte()), v)
+	}
+}
+
+// AppendFloat32 appends v to dst as a Float
+func AppendFloat32(dst []byte, v float32) []byte {
+	return appendUint32(append(dst, Float.Byte()), math.Float32bits(v))
+}
+
+// AppendFloat64 appends v to dst as a Double
+func AppendFloat64(dst []byte, v float64) []byte {
+	return appendUint64(append(dst, Double.Byte()), math.Float64bits(v))
+}
+
+// AppendString appends s to dst, as a FixStr, Str8, Str16 or Str32
+func AppendString(dst []byte, s string) []byte {
+	l := len(s)
+	switch {
+	case l <= MaxFixStrLen:
+		dst = append(dst, FixStr0.Byte()|byte(l))
+	case l <= math.MaxUint8:
+		dst = append(dst, Str8.Byte(), byte(l))
+	case l <= math.MaxUint16:
+		dst = appendUint16(append(dst, Str16.Byte()), uint16(l))
+	default:
+		dst = appendUint32(append(dst, Str32.Byte()), appendLength("string", l))
+	}
+	return append(dst, s...)
+}
+
+// AppendBytes appends b to dst, as a Bin8, Bin16 or Bin32
+func AppendBytes(dst []byte, b []byte) []byte {
+	l := len(b)
+	switch {
+	case l <= math.MaxUint8:
+		dst = append(dst, Bin8.Byte(), byte(l))
+	case l <= math.MaxUint16:
+		dst = appendUint16(append(dst, Bin16.Byte()), uint16(l))
+	default:
+		dst = appendUint32(append(dst, Bin32.Byte()), appendLength("byte slice", l))
+	}
+	return append(dst, b...)
+}
+
+// AppendArrayHeader appends the header of an array of n elements to
+// dst. The elements must be appended next
+func AppendArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n <= MaxFixArrayElements:
+		return append(dst, FixArray0.Byte()+byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(dst, Array16.Byte()), uint16(n))
+	default:
+		return appendUint32(append(dst, Array32.Byte()), appendLength("array", n))
+	}
+}
+
+// AppendMapHeader appends the header of a map of n key/value pairs to
+// dst. The keys and values must be appended next, alternately
+func AppendMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n <= MaxFixMapElements:
+		return append(dst, FixMap0.Byte()+byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(dst, Map16.Byte()), uint16(n))
+	default:
+		return appendUint32(append(dst, Map32.Byte()), appendLength("map", n))
+	}
+}
+
+// AppendExtHeader appends the header of an extension of type typ, whose
+// payload is n bytes long, to dst. The payload must be appended next
+func AppendExtHeader(dst []byte, typ int8, n int) []byte {
+	switch n {
+	case 1:
+		return append(dst, FixExt1.Byte(), byte(typ))
+	case 2:
+		return append(dst, FixExt2.Byte(), byte(typ))
+	case 4:
+		return append(dst, FixExt4.Byte(), byte(typ))
+	case 8:
+		return append(dst, FixExt8.Byte(), byte(typ))
+	case 16:
+		return append(dst, FixExt16.Byte(), byte(typ))
+	}
+
+	switch {
+	case n <= math.MaxUint8:
+		dst = append(dst, Ext8.Byte(), byte(n))
+	case n <= math.MaxUint16:
+		dst = appendUint16(append(dst, Ext16.Byte()), uint16(n))
+	default:
+		dst = appendUint32(append(dst, Ext32.Byte()), appendLength("extension", n))
+	}
+	return append(dst, byte(typ))
+}
+
+// appendLength returns l as a uint32, or panics if it does not fit
+func appendLength(what string, l int) uint32 {
+	if int64(l) > math.MaxUint32 {
+		panic("msgpack: " + what + " is too long to be encoded")
+	}
+	return uint32(l)
+}
+
+func appendUint16(dst []byte, v uint16) []byte {
+	return append(dst, byte(v>>8), byte(v))
+}
+
+func appendUint32(dst []byte, v uint32) []byte {
+	return append(dst, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(dst []byte, v uint64) []byte {
+	return append(dst, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
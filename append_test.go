@@ -0,0 +1,129 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppend(t *testing.T) {
+	t.Run("integers", func(t *testing.T) {
+		ints := []int64{0, 1, 127, 128, -1, -32, -33, -128, -129, math.MaxInt16, math.MinInt16 - 1, math.MaxInt32 + 1, math.MinInt64}
+		for _, v := range ints {
+			var buf bytes.Buffer
+			if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeCompactInt(v), "EncodeCompactInt should succeed") {
+				return
+			}
+			if !assert.Equal(t, buf.Bytes(), msgpack.AppendInt(nil, v), "AppendInt(%d) should match EncodeCompactInt", v) {
+				return
+			}
+		}
+
+		uints := []uint64{0, 127, 128, 255, 256, math.MaxUint16 + 1, math.MaxUint32 + 1, math.MaxUint64}
+		for _, v := range uints {
+			var buf bytes.Buffer
+			if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeCompactUint(v), "EncodeCompactUint should succeed") {
+				return
+			}
+			if !assert.Equal(t, buf.Bytes(), msgpack.AppendUint(nil, v), "AppendUint(%d) should match EncodeCompactUint", v) {
+				return
+			}
+		}
+	})
+	t.Run("values", func(t *testing.T) {
+		inputs := []struct {
+			value    interface{}
+			appended []byte
+		}{
+			{nil, msgpack.AppendNil(nil)},
+			{true, msgpack.AppendBool(nil, true)},
+			{false, msgpack.AppendBool(nil, false)},
+			{float32(1.5), msgpack.AppendFloat32(nil, 1.5)},
+			{float64(1.5), msgpack.AppendFloat64(nil, 1.5)},
+			{"", msgpack.AppendString(nil, "")},
+			{"foo", msgpack.AppendString(nil, "foo")},
+			{string(bytes.Repeat([]byte{'x'}, 200)), msgpack.AppendString(nil, string(bytes.Repeat([]byte{'x'}, 200)))},
+			{string(bytes.Repeat([]byte{'x'}, 70000)), msgpack.AppendString(nil, string(bytes.Repeat([]byte{'x'}, 70000)))},
+			{[]byte{1, 2, 3}, msgpack.AppendBytes(nil, []byte{1, 2, 3})},
+			{bytes.Repeat([]byte{1}, 300), msgpack.AppendBytes(nil, bytes.Repeat([]byte{1}, 300))},
+		}
+		for _, input := range inputs {
+			var buf bytes.Buffer
+			if !assert.NoError(t, msgpack.NewEncoder(&buf).Encode(input.value), "Encode should succeed") {
+				return
+			}
+			if !assert.Equal(t, buf.Bytes(), input.appended, "output for %T should match Encode", input.value) {
+				return
+			}
+		}
+	})
+	t.Run("headers", func(t *testing.T) {
+		for _, n := range []int{0, 15, 16, math.MaxUint16, math.MaxUint16 + 1} {
+			var l int
+			if !assert.NoError(t, msgpack.NewDecoder(bytes.NewReader(msgpack.AppendArrayHeader(nil, n))).DecodeArrayLength(&l), "DecodeArrayLength should succeed") {
+				return
+			}
+			if !assert.Equal(t, n, l, "array length should match") {
+				return
+			}
+			if !assert.NoError(t, msgpack.NewDecoder(bytes.NewReader(msgpack.AppendMapHeader(nil, n))).DecodeMapLength(&l), "DecodeMapLength should succeed") {
+				return
+			}
+			if !assert.Equal(t, n, l, "map length should match") {
+				return
+			}
+		}
+
+		buf := msgpack.AppendMapHeader(nil, 2)
+		buf = msgpack.AppendString(buf, "id")
+		buf = msgpack.AppendInt(buf, 42)
+		buf = msgpack.AppendString(buf, "tags")
+		buf = msgpack.AppendArrayHeader(buf, 2)
+		buf = msgpack.AppendString(buf, "a")
+		buf = msgpack.AppendNil(buf)
+
+		var decoded map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(buf, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, map[string]interface{}{"id": int8(42), "tags": []interface{}{"a", nil}}, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("extensions", func(t *testing.T) {
+		for _, n := range []int{0, 1, 2, 3, 4, 8, 16, 17, 300, 70000} {
+			b := msgpack.AppendExtHeader(nil, 12, n)
+			b = append(b, bytes.Repeat([]byte{'x'}, n)...)
+
+			var decoded blobExt
+			if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal of %d bytes should succeed", n) {
+				return
+			}
+			if !assert.Len(t, decoded.Data, n, "payload should be %d bytes", n) {
+				return
+			}
+		}
+	})
+	t.Run("allocations", func(t *testing.T) {
+		if raceEnabled {
+			t.Skip("allocation counts are not reliable under the race detector")
+		}
+
+		buf := make([]byte, 0, 256)
+		allocs := testing.AllocsPerRun(100, func() {
+			b := msgpack.AppendMapHeader(buf[:0], 3)
+			b = msgpack.AppendString(b, "id")
+			b = msgpack.AppendUint(b, 12345678)
+			b = msgpack.AppendString(b, "score")
+			b = msgpack.AppendFloat64(b, 3.14)
+			b = msgpack.AppendString(b, "ok")
+			b = msgpack.AppendBool(b, true)
+		})
+		if !assert.Equal(t, float64(0), allocs, "appending to a slice with enough capacity should not allocate") {
+			return
+		}
+	})
+}
@@ -28,18 +28,20 @@ func WriteArrayHeader(dst io.Writer, c int) error {
 		w = NewWriter(dst)
 	}
 
+	var err error
 	switch {
 	case c < 16:
-		w.WriteByte(FixArray0.Byte() + byte(c))
+		err = w.WriteByte(FixArray0.Byte() + byte(c))
 	case c < math.MaxUint16:
-		w.WriteByte(Array16.Byte())
-		w.WriteUint16(uint16(c))
-	case c < math.MaxUint32:
-		w.WriteByte(Array32.Byte())
-		w.WriteUint32(uint32(c))
+		err = w.WriteByteUint16(Array16.Byte(), uint16(c))
+	case int64(c) < math.MaxUint32:
+		err = w.WriteByteUint32(Array32.Byte(), uint32(c))
 	default:
 		return errors.Errorf(`msgpack: array element count out of range (%d)`, c)
 	}
+	if err != nil {
+		return errors.Wrap(err, `array builder: failed to write array header`)
+	}
 	return nil
 }
 
@@ -0,0 +1,86 @@
+package msgpack_test
+
+import (
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type asArrayRequest struct {
+	_      struct{}      `msgpack:",asarray"`
+	Method string        `msgpack:"method"`
+	ID     int           `msgpack:"id,omitempty"`
+	Params []interface{} `msgpack:"params"`
+	Meta   *asArrayMeta  `msgpack:"meta"`
+}
+
+type asArrayMeta struct {
+	_     struct{} `msgpack:",asarray"`
+	Trace string   `msgpack:"trace"`
+}
+
+func TestAsArray(t *testing.T) {
+	t.Run("encode", func(t *testing.T) {
+		b, err := msgpack.Marshal(asArrayRequest{Method: "add", Params: []interface{}{1, 2}, Meta: &asArrayMeta{Trace: "abc"}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		// omitempty is ignored, so that positions do not shift
+		expected, err := msgpack.Marshal([]interface{}{"add", 0, []interface{}{1, 2}, []interface{}{"abc"}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, expected, b, "struct should be encoded as an array of its fields") {
+			return
+		}
+
+		var decoded asArrayRequest
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, "add", decoded.Method, "method should match") || !assert.Len(t, decoded.Params, 2, "params should match") || !assert.Equal(t, "abc", decoded.Meta.Trace, "nested struct should match") {
+			return
+		}
+	})
+	t.Run("decode map", func(t *testing.T) {
+		b, err := msgpack.Marshal(map[string]interface{}{"method": "add", "id": 3, "meta": map[string]interface{}{"trace": "abc"}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded asArrayRequest
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, "add", decoded.Method, "method should match") || !assert.Equal(t, 3, decoded.ID, "id should match") || !assert.Equal(t, "abc", decoded.Meta.Trace, "nested struct should match") {
+			return
+		}
+	})
+	t.Run("decode shorter and longer arrays", func(t *testing.T) {
+		b, err := msgpack.Marshal([]interface{}{"add", 3})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		decoded := asArrayRequest{Params: []interface{}{"untouched"}}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, 3, decoded.ID, "id should match") || !assert.Equal(t, []interface{}{"untouched"}, decoded.Params, "missing fields should be untouched") {
+			return
+		}
+
+		b, err = msgpack.Marshal([]interface{}{"add", 3, nil, nil, map[string]interface{}{"extra": true}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should skip extra elements") {
+			return
+		}
+		// Nil leaves fields untouched, as it does in maps
+		if !assert.Equal(t, []interface{}{"untouched"}, decoded.Params, "params should be untouched") || !assert.Nil(t, decoded.Meta, "meta should be untouched") {
+			return
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package msgpack_test
+
+import (
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	if err := msgpack.RegisterExt(13, msgpack.Bitset(nil)); err != nil {
+		panic(err)
+	}
+}
+
+func TestBitset(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		for _, n := range []int{0, 1, 7, 8, 9, 64, 1000} {
+			v := make(msgpack.Bitset, n)
+			for i := range v {
+				v[i] = i%3 == 0
+			}
+
+			b, err := msgpack.Marshal(v)
+			if !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+
+			var decoded msgpack.Bitset
+			if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, v, decoded, "%d values should round trip", n) {
+				return
+			}
+		}
+	})
+	t.Run("wire format", func(t *testing.T) {
+		b, err := msgpack.Marshal(msgpack.Bitset{true, false, true, true, false, false, false, false, true})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.Ext8.Byte(), 3, 13, 7, 0x0d, 0x01}, b, "output should match") {
+			return
+		}
+	})
+	t.Run("struct field", func(t *testing.T) {
+		type flags struct {
+			Name  string
+			Flags msgpack.Bitset
+		}
+		v := flags{Name: "foo", Flags: msgpack.Bitset{true, false, true}}
+
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded flags
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("invalid payload", func(t *testing.T) {
+		var decoded msgpack.Bitset
+		if !assert.Error(t, msgpack.Unmarshal([]byte{msgpack.FixExt2.Byte(), 13, 8, 0xff}, &decoded), "Unmarshal should fail") {
+			return
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package msgpack
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CanonicalizeStruct returns the canonical encoding of v, which must be
+// a struct or a pointer to a struct. The canonical encoding is meant
+// to be used where the encoded bytes need to be reproducible, such as
+// when computing a hash or a signature over a struct.
+//
+// The canonical form follows these rules, and is guaranteed to never
+// change across versions of this library:
+//
+//   - Structs are encoded as maps. Fields are named and skipped
+//     according to their struct tags (including omitempty), and the
+//     keys are sorted in byte-wise order. Fields tagged with keyasint
+//     use integer keys, which come before the others, in ascending
+//     order. Unexported fields are ignored
+//   - Maps must have string keys, which are sorted in byte-wise order
+//   - Integers of any width are encoded in the smallest possible form.
+//     Non-negative values always use the positive fixnum/uint family,
+//     and negative values the negative fixnum/int family
+//   - float32 and float64 are encoded as float 32 and float 64
+//     respectively, and are never converted to integers
+//   - Strings, []byte, arrays, slices and maps use the smallest
+//     possible header. Arrays of bytes, such as [32]byte, are
+//     encoded as arrays of integers, not as binaries
+//   - nil pointers, interfaces, slices and maps are encoded as nil
+//   - time.Time is encoded as an array of two integers holding the
+//     seconds since the Unix epoch and the nanoseconds
+//
+// Custom serialization (EncodeMsgpacker, extensions, MsgpackFielder)
+// is NOT used, as the output of such methods cannot be guaranteed to
+// be stable. Values that cannot be represented canonically, such as
+// types implementing EncodeMsgpacker, result in an error.
+//
+// CanonicalizeStruct takes no options: the output must not depend on
+// how the caller is configured, so fields are always named by their
+// msgpack struct tags, and the encoding options are never applied.
+func CanonicalizeStruct(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.Errorf(`msgpack: argument to CanonicalizeStruct must be a struct (not %s)`, reflect.TypeOf(v))
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	if err := e.encodeCanonical(rv); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to canonicalize struct`)
+	}
+	return buf.Bytes(), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (e *Encoder) encodeCanonical(rv reflect.Value) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return e.EncodeNil()
+		}
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		return e.EncodeNil()
+	}
+
+	if rv.Type() == timeType {
+		t := rv.Interface().(time.Time)
+		if err := e.writeCanonicalHeader(FixArray0, Array16, Array32, 2); err != nil {
+			return err
+		}
+		if err := e.encodeCanonicalInt(t.Unix()); err != nil {
+			return err
+		}
+		return e.encodeCompactUint(uint64(t.Nanosecond()))
+	}
+
+	if isEncodeMsgpacker(rv.Type()) || reflect.PtrTo(rv.Type()).Implements(encodeMsgpackerType) {
+		return errors.Errorf(`msgpack: type %s uses custom serialization, and cannot be canonicalized`, rv.Type())
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return e.EncodeBool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.encodeCanonicalInt(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return e.encodeCompactUint(rv.Uint())
+	case reflect.Float32:
+		return e.EncodeFloat32(float32(rv.Float()))
+	case reflect.Float64:
+		return e.EncodeFloat64(rv.Float())
+	case reflect.String:
+		return e.EncodeString(rv.String())
+	case reflect.Slice:
+		if rv.IsNil() {
+			return e.EncodeNil()
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return e.EncodeBytes(rv.Bytes())
+		}
+		return e.encodeCanonicalArray(rv)
+	case reflect.Array:
+		// Unlike []byte, byte arrays are arrays of integers in the
+		// canonical form, which predates encoding them as Bin
+		return e.encodeCanonicalArray(rv)
+	case reflect.Map:
+		return e.encodeCanonicalMap(rv)
+	case reflect.Struct:
+		return e.encodeCanonicalStruct(rv)
+	}
+
+	return errors.Errorf(`msgpack: type %s cannot be canonicalized`, rv.Type())
+}
+
+func (e *Encoder) encodeCanonicalInt(v int64) error {
+	if v >= 0 {
+		return e.encodeCompactUint(uint64(v))
+	}
+
+	switch {
+	case v >= -32:
+		return e.dst.WriteByte(byte(v))
+	case v >= math.MinInt8:
+		return e.dst.WriteByteUint8(Int8.Byte(), uint8(v))
+	case v >= math.MinInt16:
+		return e.dst.WriteByteUint16(Int16.Byte(), uint16(v))
+	case v >= math.MinInt32:
+		return e.dst.WriteByteUint32(Int32.Byte(), uint32(v))
+	default:
+		return e.dst.WriteByteUint64(Int64.Byte(), uint64(v))
+	}
+}
+
+func (e *Encoder) writeCanonicalHeader(fix, code16, code32 Code, n int) error {
+	switch {
+	case n < 16:
+		return e.dst.WriteByte(fix.Byte() + byte(n))
+	case n <= math.MaxUint16:
+		return e.dst.WriteByteUint16(code16.Byte(), uint16(n))
+	case int64(n) <= math.MaxUint32:
+		return e.dst.WriteByteUint32(code32.Byte(), uint32(n))
+	}
+	return errors.Errorf(`msgpack: element count out of range (%d)`, n)
+}
+
+func (e *Encoder) encodeCanonicalArray(rv reflect.Value) error {
+	if err := e.writeCanonicalHeader(FixArray0, Array16, Array32, rv.Len()); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write array header`)
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if err := e.encodeCanonical(rv.Index(i)); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode array element %d`, i)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeCanonicalMap(rv reflect.Value) error {
+	if rv.IsNil() {
+		return e.EncodeNil()
+	}
+
+	if rv.Type().Key().Kind() != reflect.String {
+		return errors.Errorf(`msgpack: keys to maps must be strings (not %s)`, rv.Type().Key())
+	}
+
+	keys := make([]string, 0, rv.Len())
+	values := make(map[string]reflect.Value, rv.Len())
+	for _, key := range rv.MapKeys() {
+		keys = append(keys, key.String())
+		values[key.String()] = rv.MapIndex(key)
+	}
+	return e.encodeCanonicalEntries(keys, values)
+}
+
+func (e *Encoder) encodeCanonicalStruct(rv reflect.Value) error {
+	rt := rv.Type()
+
+	var keys []string
+	values := make(map[string]reflect.Value)
+	var intKeys []int64
+	var intValues map[int64]reflect.Value
+	for _, sf := range e.options.structPlanFor(rt).fields {
+		name := sf.name
+		field := rv.Field(sf.index)
+		if sf.omitempty {
+			// IsZero methods are not consulted, so that the canonical
+			// form does not change
+			if isZeroValue(field) {
+				continue
+			}
+		}
+
+		if sf.keyAsInt {
+			if _, ok := intValues[sf.intKey]; ok {
+				return errors.Errorf(`msgpack: duplicate field key %d in %s`, sf.intKey, rt)
+			}
+			if intValues == nil {
+				intValues = make(map[int64]reflect.Value)
+			}
+			intKeys = append(intKeys, sf.intKey)
+			intValues[sf.intKey] = field
+			continue
+		}
+
+		if _, ok := values[name]; ok {
+			return errors.Errorf(`msgpack: duplicate field name %s in %s`, name, rt)
+		}
+		keys = append(keys, name)
+		values[name] = field
+	}
+	if len(intKeys) == 0 {
+		return e.encodeCanonicalEntries(keys, values)
+	}
+
+	// Integer keys come first, in ascending order
+	sort.Slice(intKeys, func(i, j int) bool { return intKeys[i] < intKeys[j] })
+	sort.Strings(keys)
+
+	if err := e.writeCanonicalHeader(FixMap0, Map16, Map32, len(intKeys)+len(keys)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
+	for _, key := range intKeys {
+		if err := e.encodeCanonicalInt(key); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode map key %d`, key)
+		}
+		if err := e.encodeCanonical(intValues[key]); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode value for %d`, key)
+		}
+	}
+	return e.writeCanonicalEntries(keys, values)
+}
+
+// encodeCanonicalEntries sorts keys, and writes the resulting map
+func (e *Encoder) encodeCanonicalEntries(keys []string, values map[string]reflect.Value) error {
+	sort.Strings(keys)
+
+	if err := e.writeCanonicalHeader(FixMap0, Map16, Map32, len(keys)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
+	return e.writeCanonicalEntries(keys, values)
+}
+
+// writeCanonicalEntries writes the entries of a map, whose keys have
+// already been sorted
+func (e *Encoder) writeCanonicalEntries(keys []string, values map[string]reflect.Value) error {
+	for _, key := range keys {
+		if err := e.EncodeString(key); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode map key %s`, key)
+		}
+		if err := e.encodeCanonical(values[key]); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode value for %s`, key)
+		}
+	}
+	return nil
+}
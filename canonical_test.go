@@ -0,0 +1,195 @@
+package msgpack_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type canonicalStruct struct {
+	Zeta    string            `msgpack:"zeta"`
+	Alpha   int64             `msgpack:"alpha"`
+	Small   uint8             `msgpack:"small"`
+	Neg     int32             `msgpack:"neg"`
+	Big     uint64            `msgpack:"big"`
+	Float   float64           `msgpack:"float"`
+	Bytes   []byte            `msgpack:"bytes"`
+	List    []int             `msgpack:"list"`
+	Labels  map[string]string `msgpack:"labels"`
+	Time    time.Time         `msgpack:"time"`
+	Nothing *string           `msgpack:"nothing"`
+	Empty   string            `msgpack:"empty,omitempty"`
+	Ignored string            `msgpack:"-"`
+}
+
+// canonicalStructReordered has the same fields as canonicalStruct
+// declared in a different order, using different integer widths
+type canonicalStructReordered struct {
+	Nothing *string           `msgpack:"nothing"`
+	Time    time.Time         `msgpack:"time"`
+	Labels  map[string]string `msgpack:"labels"`
+	List    []int8            `msgpack:"list"`
+	Bytes   []byte            `msgpack:"bytes"`
+	Float   float64           `msgpack:"float"`
+	Big     int64             `msgpack:"big"`
+	Neg     int               `msgpack:"neg"`
+	Small   int64             `msgpack:"small"`
+	Alpha   uint16            `msgpack:"alpha"`
+	Zeta    string            `msgpack:"zeta"`
+}
+
+// canonicalGolden is the canonical encoding of canonicalValue. It must
+// NEVER change: if this test fails, the change that caused it breaks
+// every signature computed over a canonicalized struct
+const canonicalGolden = `8b` +
+	`a5616c706861` + `01` + // "alpha": 1
+	`a3626967` + `cd1234` + // "big": 0x1234
+	`a56279746573` + `c403010203` + // "bytes": bin [1, 2, 3]
+	`a5666c6f6174` + `cb3ff8000000000000` + // "float": 1.5
+	`a66c6162656c73` + `82a161a131a162a132` + // "labels": {"a": "1", "b": "2"}
+	`a46c697374` + `93ffd0807f` + // "list": [-1, -128, 127]
+	`a36e6567` + `e0` + // "neg": -32
+	`a76e6f7468696e67` + `c0` + // "nothing": nil
+	`a5736d616c6c` + `cc80` + // "small": 128
+	`a474696d65` + `92ce5f5e1000ce3b9ac9ff` + // "time": [1600000000, 999999999]
+	`a47a657461` + `a3666f6f` // "zeta": "foo"
+
+var canonicalTime = time.Unix(1600000000, 999999999)
+
+func TestCanonicalizeStruct(t *testing.T) {
+	t.Run("golden", func(t *testing.T) {
+		v := canonicalStruct{
+			Zeta:    "foo",
+			Alpha:   1,
+			Small:   128,
+			Neg:     -32,
+			Big:     0x1234,
+			Float:   1.5,
+			Bytes:   []byte{1, 2, 3},
+			List:    []int{-1, -128, 127},
+			Labels:  map[string]string{"b": "2", "a": "1"},
+			Time:    canonicalTime,
+			Ignored: "ignored",
+		}
+
+		b, err := msgpack.CanonicalizeStruct(&v)
+		if !assert.NoError(t, err, "CanonicalizeStruct should succeed") {
+			return
+		}
+		if !assert.Equal(t, canonicalGolden, hex.EncodeToString(b), "output should match the golden value") {
+			return
+		}
+	})
+	t.Run("independent of field order and integer widths", func(t *testing.T) {
+		v := canonicalStructReordered{
+			Zeta:   "foo",
+			Alpha:  1,
+			Small:  128,
+			Neg:    -32,
+			Big:    0x1234,
+			Float:  1.5,
+			Bytes:  []byte{1, 2, 3},
+			List:   []int8{-1, -128, 127},
+			Labels: map[string]string{"a": "1", "b": "2"},
+			Time:   canonicalTime,
+		}
+
+		b, err := msgpack.CanonicalizeStruct(v)
+		if !assert.NoError(t, err, "CanonicalizeStruct should succeed") {
+			return
+		}
+		if !assert.Equal(t, canonicalGolden, hex.EncodeToString(b), "output should match the golden value") {
+			return
+		}
+	})
+	t.Run("kinds", func(t *testing.T) {
+		// Each value is encoded as the single field of a struct, whose
+		// key is "v" (a176)
+		type field struct {
+			V interface{} `msgpack:"v"`
+		}
+		var nilString *string
+		long := strings.Repeat("a", 32)
+		items := make([]int, 16)
+
+		testcases := []struct {
+			Name     string
+			Value    interface{}
+			Expected string
+		}{
+			{Name: "struct", Value: struct {
+				B      int `msgpack:"b"`
+				A      int `msgpack:"a"`
+				Empty  int `msgpack:"empty,omitempty"`
+				Int    int `msgpack:"1,keyasint"`
+				hidden int
+			}{B: 2, A: 1, Int: 3, hidden: 4}, Expected: `83` + `0103` + `a16101` + `a16202`},
+			{Name: "map", Value: map[string]int{"b": 2, "a": 1}, Expected: `82a16101a16202`},
+			{Name: "positive fixnum", Value: int64(127), Expected: `7f`},
+			{Name: "uint8", Value: int16(128), Expected: `cc80`},
+			{Name: "uint16", Value: int(256), Expected: `cd0100`},
+			{Name: "uint32", Value: uint64(1 << 16), Expected: `ce00010000`},
+			{Name: "uint64", Value: int64(1 << 32), Expected: `cf0000000100000000`},
+			{Name: "negative fixnum", Value: int64(-32), Expected: `e0`},
+			{Name: "int8", Value: int64(-33), Expected: `d0df`},
+			{Name: "int16", Value: int64(-129), Expected: `d1ff7f`},
+			{Name: "int32", Value: int64(-32769), Expected: `d2ffff7fff`},
+			{Name: "int64", Value: int64(-1<<31 - 1), Expected: `d3ffffffff7fffffff`},
+			{Name: "float32", Value: float32(2), Expected: `ca40000000`},
+			{Name: "float64", Value: float64(2), Expected: `cb4000000000000000`},
+			{Name: "fixstr", Value: "", Expected: `a0`},
+			{Name: "str8", Value: long, Expected: `d920` + hex.EncodeToString([]byte(long))},
+			{Name: "bin8", Value: []byte{}, Expected: `c400`},
+			{Name: "array", Value: [2]int{1, 2}, Expected: `920102`},
+			{Name: "byte array", Value: [2]byte{1, 2}, Expected: `920102`},
+			{Name: "fixarray", Value: []string{"a"}, Expected: `91a161`},
+			{Name: "array16", Value: items, Expected: `dc0010` + strings.Repeat(`00`, 16)},
+			{Name: "nil pointer", Value: nilString, Expected: `c0`},
+			{Name: "nil interface", Value: nil, Expected: `c0`},
+			{Name: "nil slice", Value: []int(nil), Expected: `c0`},
+			{Name: "nil map", Value: map[string]int(nil), Expected: `c0`},
+			{Name: "time", Value: time.Unix(1, 2), Expected: `920102`},
+		}
+
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				b, err := msgpack.CanonicalizeStruct(field{V: tc.Value})
+				if !assert.NoError(t, err, "CanonicalizeStruct should succeed") {
+					return
+				}
+				if !assert.Equal(t, `81a176`+tc.Expected, hex.EncodeToString(b), "output should match the golden value") {
+					return
+				}
+			})
+		}
+	})
+	t.Run("not a struct", func(t *testing.T) {
+		_, err := msgpack.CanonicalizeStruct(map[string]string{})
+		if !assert.Error(t, err, "CanonicalizeStruct should fail") {
+			return
+		}
+	})
+	t.Run("custom serialization", func(t *testing.T) {
+		v := struct {
+			Time EventTime
+		}{}
+		_, err := msgpack.CanonicalizeStruct(v)
+		if !assert.Error(t, err, "CanonicalizeStruct should fail") {
+			return
+		}
+	})
+	t.Run("non-string map keys", func(t *testing.T) {
+		v := struct {
+			M map[int]string
+		}{M: map[int]string{1: "foo"}}
+		_, err := msgpack.CanonicalizeStruct(v)
+		if !assert.Error(t, err, "CanonicalizeStruct should fail") {
+			return
+		}
+	})
+}
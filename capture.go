@@ -0,0 +1,322 @@
+package msgpack
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FrameDirection tells whether a captured frame was sent or received
+type FrameDirection int
+
+const (
+	// FrameSent is the direction of frames written by an Encoder
+	FrameSent FrameDirection = iota + 1
+	// FrameReceived is the direction of frames read by a Decoder
+	FrameReceived
+)
+
+func (d FrameDirection) String() string {
+	switch d {
+	case FrameSent:
+		return "sent"
+	case FrameReceived:
+		return "received"
+	}
+	return "unknown"
+}
+
+// Each captured frame is stored as a msgpack array of 3 elements:
+// [timestamp (unix nanoseconds), direction, frame (bin)]
+const captureFields = 3
+
+// Frame is a single message captured by a Recorder
+type Frame struct {
+	Time      time.Time
+	Direction FrameDirection
+	// Data is the msgpack encoded message
+	Data []byte
+}
+
+// Recorder captures the messages that go through Encoders and
+// Decoders, along with the time at which they were sent or received,
+// so that real traffic can be replayed later for debugging or load
+// testing (see Replayer). A Recorder may be shared by any number of
+// Encoders and Decoders, across goroutines.
+//
+//	rec := msgpack.NewRecorder(captureFile)
+//	enc := rec.Encoder(conn)
+//	dec := rec.Decoder(conn)
+type Recorder struct {
+	mu    sync.Mutex
+	enc   *Encoder
+	err   error
+	clock Clock
+}
+
+// RecorderOption is an option that can be passed to NewRecorder
+type RecorderOption func(*Recorder)
+
+// WithRecorderClock specifies the Clock used to timestamp the frames
+// recorded by RecordingEncoder and RecordingDecoder. The default is
+// SystemClock
+func WithRecorderClock(clock Clock) RecorderOption {
+	return func(r *Recorder) {
+		r.clock = clock
+	}
+}
+
+// NewRecorder creates a new Recorder that writes its capture to w
+func NewRecorder(w io.Writer, options ...RecorderOption) *Recorder {
+	r := &Recorder{
+		enc:   NewEncoder(w),
+		clock: SystemClock,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// Record writes a single frame to the capture. Captured frames are
+// usually recorded by RecordingEncoder and RecordingDecoder
+func (r *Recorder) Record(f Frame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.writeFrame(f); err != nil {
+		// The capture is corrupted once a frame has been partially
+		// written, so do not write anything else
+		r.err = errors.Wrap(err, `msgpack: failed to write captured frame`)
+		return r.err
+	}
+	return nil
+}
+
+func (r *Recorder) writeFrame(f Frame) error {
+	if err := r.enc.EncodeArrayHeader(captureFields); err != nil {
+		return err
+	}
+	if err := r.enc.EncodeInt64(f.Time.UnixNano()); err != nil {
+		return err
+	}
+	if err := r.enc.EncodeInt(int(f.Direction)); err != nil {
+		return err
+	}
+	return r.enc.EncodeBytes(f.Data)
+}
+
+// RecordingEncoder is an Encoder that records each message that it
+// writes
+type RecordingEncoder struct {
+	rec *Recorder
+	dst io.Writer
+	buf bytes.Buffer
+	enc *Encoder
+}
+
+// Encoder creates a new RecordingEncoder that writes to w, and records
+// each message to r
+func (r *Recorder) Encoder(w io.Writer, options ...Option) *RecordingEncoder {
+	e := &RecordingEncoder{
+		rec: r,
+		dst: w,
+	}
+	e.enc = NewEncoder(&e.buf, options...)
+	return e
+}
+
+// Encode writes v to the underlying io.Writer, and records it. A
+// message that could not be written is not recorded
+func (e *RecordingEncoder) Encode(v interface{}) error {
+	e.buf.Reset()
+	if err := e.enc.Encode(v); err != nil {
+		return err
+	}
+
+	now := e.rec.clock.Now()
+	if _, err := e.dst.Write(e.buf.Bytes()); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write message`)
+	}
+	return e.rec.Record(Frame{Time: now, Direction: FrameSent, Data: e.buf.Bytes()})
+}
+
+// RecordingDecoder is a Decoder that records each message that it
+// reads
+type RecordingDecoder struct {
+	rec     *Recorder
+	src     *Decoder
+	buf     bytes.Buffer
+	options []Option
+}
+
+// Decoder creates a new RecordingDecoder that reads from rd, and
+// records each message to r
+func (r *Recorder) Decoder(rd io.Reader, options ...Option) *RecordingDecoder {
+	return &RecordingDecoder{
+		rec:     r,
+		src:     NewDecoder(rd, options...),
+		options: options,
+	}
+}
+
+// Decode reads the next message, records it, and decodes it into v.
+// The message is recorded even if it cannot be decoded into v, as
+// long as it is a complete msgpack value
+func (d *RecordingDecoder) Decode(v interface{}) error {
+	d.buf.Reset()
+	if err := d.src.copyValue(&d.buf); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read message`)
+	}
+
+	if err := d.rec.Record(Frame{Time: d.rec.clock.Now(), Direction: FrameReceived, Data: d.buf.Bytes()}); err != nil {
+		return err
+	}
+	return NewDecoder(bytes.NewReader(d.buf.Bytes()), d.options...).Decode(v)
+}
+
+// Replayer reads frames captured by a Recorder, and feeds them back
+// with the same timing as when they were captured, or faster
+type Replayer struct {
+	dec   *Decoder
+	speed float64
+	clock Clock
+	// first and start are the times of the first frame, and the time
+	// at which it was returned
+	first time.Time
+	start time.Time
+}
+
+// ReplayOption is an option that can be passed to NewReplayer
+type ReplayOption func(*Replayer)
+
+// WithReplaySpeed specifies how much faster than the original the
+// frames are replayed: 2 replays them twice as fast, 0.5 at half the
+// speed. If speed is zero or negative, the frames are replayed as
+// fast as possible. The default is 1
+func WithReplaySpeed(speed float64) ReplayOption {
+	return func(r *Replayer) {
+		r.speed = speed
+	}
+}
+
+// WithReplayClock specifies the Clock used to pace the replay. The
+// default is SystemClock
+func WithReplayClock(clock Clock) ReplayOption {
+	return func(r *Replayer) {
+		r.clock = clock
+	}
+}
+
+// NewReplayer creates a new Replayer that reads the capture from r
+func NewReplayer(r io.Reader, options ...ReplayOption) *Replayer {
+	rp := &Replayer{
+		dec:   NewDecoder(r),
+		speed: 1,
+		clock: SystemClock,
+	}
+	for _, option := range options {
+		option(rp)
+	}
+	return rp
+}
+
+// Next reads the next frame into f, waiting until it is due. It
+// returns io.EOF at the end of the capture
+func (r *Replayer) Next(ctx context.Context, f *Frame) error {
+	if _, err := r.dec.raw.Peek(1); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return errors.Wrap(err, `msgpack: failed to read captured frame`)
+	}
+
+	if err := r.readFrame(f); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read captured frame`)
+	}
+
+	if r.start.IsZero() {
+		r.first = f.Time
+		r.start = r.clock.Now()
+		return nil
+	}
+	if r.speed <= 0 {
+		return nil
+	}
+
+	due := r.start.Add(time.Duration(float64(f.Time.Sub(r.first)) / r.speed))
+	wait := due.Sub(r.clock.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	t := r.clock.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C():
+		return nil
+	}
+}
+
+func (r *Replayer) readFrame(f *Frame) error {
+	var l int
+	if err := r.dec.DecodeArrayLength(&l); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode frame header`)
+	}
+	if l != captureFields {
+		return errors.Errorf(`msgpack: invalid number of fields in captured frame (%d)`, l)
+	}
+
+	var ts int64
+	if err := r.dec.DecodeInt64(&ts); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode frame timestamp`)
+	}
+	var dir int
+	if err := r.dec.DecodeInt(&dir); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode frame direction`)
+	}
+	var data []byte
+	if err := r.dec.DecodeBytes(&data); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode frame data`)
+	}
+
+	f.Time = time.Unix(0, ts)
+	f.Direction = FrameDirection(dir)
+	f.Data = data
+	return nil
+}
+
+// ReplayTo writes the frames that were captured in the given direction
+// to w, with their original timing (adjusted by WithReplaySpeed), until
+// the end of the capture. It returns the number of frames written. To
+// load test a server with the traffic that it received, replay the
+// FrameReceived frames to a connection to it
+func (r *Replayer) ReplayTo(ctx context.Context, w io.Writer, dir FrameDirection) (int, error) {
+	var count int
+	for {
+		var f Frame
+		if err := r.Next(ctx, &f); err != nil {
+			if err == io.EOF {
+				return count, nil
+			}
+			return count, err
+		}
+		if f.Direction != dir {
+			continue
+		}
+
+		if _, err := w.Write(f.Data); err != nil {
+			return count, errors.Wrap(err, `msgpack: failed to write replayed frame`)
+		}
+		count++
+	}
+}
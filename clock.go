@@ -0,0 +1,45 @@
+package msgpack
+
+import "time"
+
+// Clock is the source of time for the time dependent features of this
+// package, such as heartbeats, backoff between retries, and capture
+// timestamps. The default is SystemClock. Tests can inject their own
+// implementation (such as msgpacktest.Clock) to control time
+// deterministically, instead of sleeping
+type Clock interface {
+	Now() time.Time
+	// NewTimer creates a Timer that fires once d has elapsed
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event created by a Clock, like time.Timer
+type Timer interface {
+	// C returns the channel that receives the time when the timer
+	// fires
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the
+	// timer has already fired or been stopped
+	Stop() bool
+}
+
+// SystemClock is the Clock that uses the time package
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
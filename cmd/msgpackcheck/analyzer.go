@@ -0,0 +1,144 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Analyzer reports non-pointer values passed to the decoding functions
+// of github.com/lestrrat-go/msgpack
+var Analyzer = &analysis.Analyzer{
+	Name:     "msgpackcheck",
+	Doc:      "report non-pointer values passed to msgpack decoding functions",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+const msgpackPath = "github.com/lestrrat-go/msgpack"
+
+// decodeFunc identifies a function, or a method if recv is not empty,
+// that decodes into one of its arguments
+type decodeFunc struct {
+	pkg  string
+	recv string
+	name string
+}
+
+// decodeFuncs maps the functions that decode into one of their
+// arguments to the index of that argument
+var decodeFuncs = map[decodeFunc]int{
+	{pkg: msgpackPath, name: "Unmarshal"}:                           1,
+	{pkg: msgpackPath, name: "FromMap"}:                             1,
+	{pkg: msgpackPath, name: "Verify"}:                              2,
+	{pkg: msgpackPath, recv: "Decoder", name: "Decode"}:             0,
+	{pkg: msgpackPath, recv: "Decoder", name: "DecodeArray"}:        0,
+	{pkg: msgpackPath, recv: "Decoder", name: "DecodeAppend"}:       0,
+	{pkg: msgpackPath, recv: "Decoder", name: "DecodeStruct"}:       0,
+	{pkg: msgpackPath, recv: "Decoder", name: "DecodeSparseArray"}:  0,
+	{pkg: msgpackPath, recv: "RecordingDecoder", name: "Decode"}:    0,
+	{pkg: msgpackPath, recv: "SealedDecoder", name: "Decode"}:       0,
+	{pkg: msgpackPath, recv: "IndexedReader", name: "Decode"}:       1,
+	{pkg: msgpackPath, recv: "IndexedReader", name: "DecodeKey"}:    1,
+	{pkg: msgpackPath, recv: "Index", name: "Decode"}:               2,
+	{pkg: msgpackPath, recv: "Conn", name: "Recv"}:                  1,
+	{pkg: msgpackPath, recv: "ReconnectingConn", name: "Recv"}:      1,
+	{pkg: msgpackPath, recv: "Stream", name: "Recv"}:                1,
+	{pkg: msgpackPath + "/journal", recv: "Record", name: "Decode"}: 0,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		fn := typeutil.StaticCallee(pass.TypesInfo, call)
+		if fn == nil || fn.Pkg() == nil {
+			return
+		}
+
+		key := decodeFunc{pkg: fn.Pkg().Path(), name: fn.Name()}
+		name := fn.Pkg().Name() + "." + fn.Name()
+		if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+			t := recv.Type()
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+			named, ok := t.(*types.Named)
+			if !ok {
+				return
+			}
+			key.recv = named.Obj().Name()
+			name = key.recv + "." + fn.Name()
+		}
+
+		i, ok := decodeFuncs[key]
+		if !ok || i >= len(call.Args) {
+			return
+		}
+		checkTarget(pass, name, call.Args[i])
+	})
+	return nil, nil
+}
+
+// checkTarget reports arg, the value that the function called name
+// decodes into, if it cannot be a non-nil pointer
+func checkTarget(pass *analysis.Pass, name string, arg ast.Expr) {
+	tv, ok := pass.TypesInfo.Types[arg]
+	if !ok {
+		return
+	}
+	if tv.IsNil() {
+		pass.Reportf(arg.Pos(), "call of %s passes nil as the value to decode into", name)
+		return
+	}
+
+	// Interfaces (and type parameters, whose underlying type is their
+	// constraint) may hold a pointer, which is only known at run time
+	switch tv.Type.Underlying().(type) {
+	case *types.Pointer, *types.Interface:
+		return
+	}
+
+	diag := analysis.Diagnostic{
+		Pos:     arg.Pos(),
+		End:     arg.End(),
+		Message: "call of " + name + " passes non-pointer " + types.TypeString(tv.Type, types.RelativeTo(pass.Pkg)) + " as the value to decode into",
+	}
+	if isAddressable(pass, arg) {
+		diag.SuggestedFixes = []analysis.SuggestedFix{{
+			Message: "Pass a pointer",
+			TextEdits: []analysis.TextEdit{{
+				Pos:     arg.Pos(),
+				End:     arg.Pos(),
+				NewText: []byte("&"),
+			}},
+		}}
+	}
+	pass.Report(diag)
+}
+
+// isAddressable reports whether &arg is valid, for the simple cases of
+// variables, fields of variables, and composite literals
+func isAddressable(pass *analysis.Pass, arg ast.Expr) bool {
+	switch arg := ast.Unparen(arg).(type) {
+	case *ast.Ident:
+		_, ok := pass.TypesInfo.Uses[arg].(*types.Var)
+		return ok
+	case *ast.SelectorExpr:
+		sel, ok := pass.TypesInfo.Selections[arg]
+		if !ok || sel.Kind() != types.FieldVal {
+			return false
+		}
+		if _, ok := sel.Recv().Underlying().(*types.Pointer); ok {
+			return true
+		}
+		return isAddressable(pass, arg.X)
+	case *ast.CompositeLit:
+		return true
+	}
+	return false
+}
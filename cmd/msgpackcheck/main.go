@@ -0,0 +1,19 @@
+// Command msgpackcheck reports calls to the decoding functions of
+// github.com/lestrrat-go/msgpack, such as Unmarshal and Decoder.Decode,
+// that are passed a value that is not a pointer. Such calls compile,
+// but always fail at run time with an *msgpack.InvalidDecodeError.
+//
+// Run it on its own:
+//
+//	msgpackcheck ./...
+//
+// or as part of go vet:
+//
+//	go vet -vettool=$(which msgpackcheck) ./...
+package main
+
+import "golang.org/x/tools/go/analysis/singlechecker"
+
+func main() {
+	singlechecker.Main(Analyzer)
+}
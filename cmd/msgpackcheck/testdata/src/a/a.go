@@ -0,0 +1,41 @@
+package a
+
+import (
+	"github.com/lestrrat-go/msgpack"
+	"github.com/lestrrat-go/msgpack/journal"
+)
+
+type point struct {
+	X, Y int
+}
+
+type holder struct {
+	p point
+}
+
+func decode(dec *msgpack.Decoder, data []byte, r journal.Record, v interface{}) {
+	var p point
+	dec.Decode(p) // want `call of Decoder.Decode passes non-pointer point as the value to decode into`
+	dec.Decode(&p)
+	msgpack.Unmarshal(data, p) // want `call of msgpack.Unmarshal passes non-pointer point as the value to decode into`
+	msgpack.Unmarshal(data, &p)
+	msgpack.Unmarshal(data, nil)     // want `call of msgpack.Unmarshal passes nil as the value to decode into`
+	msgpack.Unmarshal(data, point{}) // want `call of msgpack.Unmarshal passes non-pointer point as the value to decode into`
+	r.Decode(p)                      // want `call of Record.Decode passes non-pointer point as the value to decode into`
+
+	var h holder
+	dec.Decode(h.p)        // want `call of Decoder.Decode passes non-pointer point as the value to decode into`
+	dec.Decode(newPoint()) // want `call of Decoder.Decode passes non-pointer point as the value to decode into`
+
+	// Interfaces may hold pointers
+	dec.Decode(v)
+	msgpack.Marshal(p)
+}
+
+func decodeAny[T any](dec *msgpack.Decoder, v T) {
+	dec.Decode(v)
+}
+
+func newPoint() point {
+	return point{}
+}
@@ -0,0 +1,5 @@
+package journal
+
+type Record struct{}
+
+func (r Record) Decode(v interface{}) error { return nil }
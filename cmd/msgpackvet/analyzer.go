@@ -0,0 +1,255 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// Analyzer checks the structs that have at least one field with a
+// msgpack struct tag. Structs without tags are not checked, as they
+// are not necessarily meant to be encoded
+var Analyzer = &analysis.Analyzer{
+	Name:     "msgpackvet",
+	Doc:      "check struct tags and field types of structs encoded with msgpack",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// tagNames holds the struct tags that are consulted, in order, like
+// msgpack.WithStructTags. The default matches that of the msgpack
+// package
+var tagNames = "msgpack,msg"
+
+func init() {
+	Analyzer.Flags.StringVar(&tagNames, "structtags", tagNames, "comma separated list of struct tags to consult")
+}
+
+// encoderMethods are the methods through which a type provides its own
+// msgpack representation: EncodeMsgpacker, Marshaler, MsgpMarshaler
+// and Snapshotter
+var encoderMethods = []string{"EncodeMsgpack", "MarshalMsgpack", "MarshalMsg", "MsgpackSnapshot"}
+
+// builtinTypes are the named types that the Encoder handles even though
+// their underlying type is a basic one
+var builtinTypes = map[string]struct{}{
+	"time.Duration":            {},
+	"encoding/json.Number":     {},
+	"encoding/json.RawMessage": {},
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	tags := strings.Split(tagNames, ",")
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	inspect.Preorder([]ast.Node{(*ast.StructType)(nil)}, func(n ast.Node) {
+		st, ok := pass.TypesInfo.Types[n.(*ast.StructType)].Type.(*types.Struct)
+		if !ok {
+			return
+		}
+		checkStruct(pass, st, tags)
+	})
+	return nil, nil
+}
+
+// lookupTag returns the value of the first of tags that is set on a
+// field, as the msgpack package does
+func lookupTag(tag string, tags []string) (string, bool) {
+	for _, name := range tags {
+		if v, ok := reflect.StructTag(tag).Lookup(name); ok && v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func checkStruct(pass *analysis.Pass, st *types.Struct, tags []string) {
+	var tagged bool
+	for i := 0; i < st.NumFields(); i++ {
+		if _, ok := lookupTag(st.Tag(i), tags); ok {
+			tagged = true
+			break
+		}
+	}
+	if !tagged {
+		return
+	}
+
+	names := make(map[string]*types.Var)
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		tag, hasTag := lookupTag(st.Tag(i), tags)
+
+		if field.Name() == "_" {
+			if hasTag {
+				checkBlankOptions(pass, field, tag)
+			}
+			continue
+		}
+		if !field.Exported() {
+			if hasTag {
+				pass.Reportf(field.Pos(), "msgpack tag on unexported field %s has no effect", field.Name())
+			}
+			continue
+		}
+
+		name := field.Name()
+		if hasTag {
+			l := strings.Split(tag, ",")
+			if l[0] == "-" {
+				continue
+			}
+			if l[0] != "" {
+				name = l[0]
+			}
+			if checkOptions(pass, field, name, l[1:]) {
+				// Integer keys only collide if they have the same value
+				k, _ := strconv.ParseInt(name, 10, 64)
+				name = strconv.FormatInt(k, 10)
+			}
+		}
+
+		if prev, ok := names[name]; ok {
+			pass.Reportf(field.Pos(), "field %s uses the msgpack name %q, already used by field %s", field.Name(), name, prev.Name())
+		} else {
+			names[name] = field
+		}
+
+		if bad := unencodable(field.Type(), false, make(map[types.Type]struct{})); bad != nil {
+			if types.Identical(bad, field.Type()) {
+				pass.Reportf(field.Pos(), "field %s has type %s, which msgpack cannot encode", field.Name(), typeString(pass, bad))
+			} else {
+				pass.Reportf(field.Pos(), "field %s has type %s, which msgpack cannot encode because of %s", field.Name(), typeString(pass, field.Type()), typeString(pass, bad))
+			}
+		}
+	}
+}
+
+// checkBlankOptions checks the tag of a blank (_) field, which only
+// accepts asarray
+func checkBlankOptions(pass *analysis.Pass, field *types.Var, tag string) {
+	for _, option := range strings.Split(tag, ",")[1:] {
+		if option != "asarray" && option != "" {
+			pass.Reportf(field.Pos(), "msgpack tag option %q has no effect on a blank field, which only accepts asarray", option)
+		}
+	}
+}
+
+// checkOptions checks the options in the tag of field, whose msgpack
+// name is name. It returns true if the field has an integer key
+func checkOptions(pass *analysis.Pass, field *types.Var, name string, options []string) bool {
+	var keyAsInt bool
+	for _, option := range options {
+		switch option {
+		case "", "omitempty", "pairs":
+		case "keyasint":
+			if _, err := strconv.ParseInt(name, 10, 64); err != nil {
+				pass.Reportf(field.Pos(), "msgpack tag option keyasint has no effect on field %s, whose name %q is not an integer", field.Name(), name)
+				continue
+			}
+			keyAsInt = true
+		case "emptyasnil":
+			if !isEmptyAsNilType(field.Type()) {
+				pass.Reportf(field.Pos(), "msgpack tag option emptyasnil has no effect on field %s of type %s, it only applies to *string and *time.Time", field.Name(), typeString(pass, field.Type()))
+			}
+		case "asarray":
+			pass.Reportf(field.Pos(), "msgpack tag option asarray has no effect on field %s, it must be set on a blank (_) field", field.Name())
+		default:
+			if strings.HasPrefix(option, "decoder=") {
+				if option == "decoder=" {
+					pass.Reportf(field.Pos(), "msgpack tag option decoder= on field %s is missing the name of the decoder", field.Name())
+				}
+				continue
+			}
+			pass.Reportf(field.Pos(), "unknown msgpack tag option %q on field %s", option, field.Name())
+		}
+	}
+	return keyAsInt
+}
+
+func isEmptyAsNilType(t types.Type) bool {
+	ptr, ok := t.Underlying().(*types.Pointer)
+	if !ok {
+		return false
+	}
+	if basic, ok := ptr.Elem().Underlying().(*types.Basic); ok && basic.Kind() == types.String {
+		return true
+	}
+	return qualifiedName(ptr.Elem()) == "time.Time"
+}
+
+// unencodable returns the type within t that the Encoder cannot encode,
+// or nil if there is none. viaPtr is set if t is pointed to, in which
+// case the methods of *t are available as well
+func unencodable(t types.Type, viaPtr bool, seen map[types.Type]struct{}) types.Type {
+	if _, ok := seen[t]; ok {
+		return nil
+	}
+	seen[t] = struct{}{}
+
+	if named, ok := types.Unalias(t).(*types.Named); ok {
+		if hasEncoderMethod(named, viaPtr) {
+			return nil
+		}
+		if _, ok := builtinTypes[qualifiedName(named)]; ok {
+			return nil
+		}
+		// The Encoder only knows about the builtin types themselves:
+		// named types based on them are rejected
+		if _, ok := named.Underlying().(*types.Basic); ok {
+			return named
+		}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Kind() == types.Uintptr, u.Kind() == types.UnsafePointer, u.Info()&types.IsComplex != 0:
+			return t
+		}
+	case *types.Pointer:
+		return unencodable(u.Elem(), true, seen)
+	case *types.Slice:
+		return unencodable(u.Elem(), false, seen)
+	case *types.Array:
+		return unencodable(u.Elem(), false, seen)
+	case *types.Map:
+		return unencodable(u.Elem(), false, seen)
+	case *types.Chan, *types.Signature:
+		return t
+	}
+	return nil
+}
+
+func hasEncoderMethod(named *types.Named, viaPtr bool) bool {
+	var t types.Type = named
+	if viaPtr {
+		t = types.NewPointer(named)
+	}
+	mset := types.NewMethodSet(t)
+	for _, name := range encoderMethods {
+		if mset.Lookup(named.Obj().Pkg(), name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifiedName returns the name of t prefixed with the path of its
+// package, or an empty string if t is not a named type
+func qualifiedName(t types.Type) string {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return ""
+	}
+	return named.Obj().Pkg().Path() + "." + named.Obj().Name()
+}
+
+func typeString(pass *analysis.Pass, t types.Type) string {
+	return types.TypeString(t, types.RelativeTo(pass.Pkg))
+}
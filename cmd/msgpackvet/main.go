@@ -0,0 +1,24 @@
+// Command msgpackvet reports mistakes in the struct tags and field types
+// of structs that are meant to be encoded with
+// github.com/lestrrat-go/msgpack: duplicate field names, tags on
+// unexported fields (which are ignored), invalid tag options, and
+// fields whose type cannot be encoded. These would otherwise only show
+// up at run time, as errors or as silently missing fields.
+//
+// Run it on its own:
+//
+//	msgpackvet ./...
+//
+// or as part of go vet:
+//
+//	go vet -vettool=$(which msgpackvet) ./...
+//
+// Use -structtags to change the struct tags that are consulted, as with
+// msgpack.WithStructTags
+package main
+
+import "golang.org/x/tools/go/analysis/singlechecker"
+
+func main() {
+	singlechecker.Main(Analyzer)
+}
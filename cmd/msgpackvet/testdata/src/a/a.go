@@ -0,0 +1,80 @@
+package a
+
+import (
+	"encoding/json"
+	"time"
+	"unsafe"
+)
+
+type Status string
+
+type Code int
+
+// MarshalMsgpack makes Code encodable
+func (c Code) MarshalMsgpack() ([]byte, error) { return []byte{byte(c)}, nil }
+
+type Level int
+
+// MarshalMsgpack is only available through pointers
+func (l *Level) MarshalMsgpack() ([]byte, error) { return []byte{byte(*l)}, nil }
+
+type IDs []string
+
+type Untagged struct {
+	private int
+	Updates chan int
+}
+
+type Fields struct {
+	Name      string `msgpack:"name"`
+	Alias     string `msgpack:"name"` // want `field Alias uses the msgpack name "name", already used by field Name`
+	Name2     string
+	Other     string `msgpack:"Name2"` // want `field Other uses the msgpack name "Name2", already used by field Name2`
+	Skipped   string `msgpack:"-"`
+	Skipped2  string `msgpack:"-"`
+	internal  string `msgpack:"internal"` // want `msgpack tag on unexported field internal has no effect`
+	Legacy    string `msg:"legacy"`
+	Legacy2   string `msg:"legacy"` // want `field Legacy2 uses the msgpack name "legacy", already used by field Legacy`
+	Preferred string `msgpack:"preferred" msg:"legacy"`
+}
+
+type Options struct {
+	_     struct{}       `msgpack:",asarray,omitempty"` // want `msgpack tag option "omitempty" has no effect on a blank field, which only accepts asarray`
+	A     string         `msgpack:"a,omitempty"`
+	B     string         `msgpack:"b,omitemtpy"` // want `unknown msgpack tag option "omitemtpy" on field B`
+	C     *string        `msgpack:"c,emptyasnil"`
+	D     *time.Time     `msgpack:"d,emptyasnil"`
+	E     string         `msgpack:"e,emptyasnil"` // want `msgpack tag option emptyasnil has no effect on field E of type string, it only applies to \*string and \*time.Time`
+	F     []string       `msgpack:"f,asarray"`    // want `msgpack tag option asarray has no effect on field F, it must be set on a blank \(_\) field`
+	G     time.Time      `msgpack:"g,decoder=unixms"`
+	H     time.Time      `msgpack:"h,decoder="` // want `msgpack tag option decoder= on field H is missing the name of the decoder`
+	Attrs map[string]int `msgpack:"attrs,pairs"`
+}
+
+type IntKeys struct {
+	A string `msgpack:"1,keyasint"`
+	B string `msgpack:"2,keyasint"`
+	C string `msgpack:"02,keyasint"` // want `field C uses the msgpack name "2", already used by field B`
+	D string `msgpack:"d,keyasint"`  // want `msgpack tag option keyasint has no effect on field D, whose name "d" is not an integer`
+	E string `msgpack:"-1,keyasint,omitempty"`
+}
+
+type Types struct {
+	Ch       chan int            `msgpack:"ch"`       // want `field Ch has type chan int, which msgpack cannot encode`
+	Fn       func()              `msgpack:"fn"`       // want `field Fn has type func\(\), which msgpack cannot encode`
+	Cplx     complex128          `msgpack:"cplx"`     // want `field Cplx has type complex128, which msgpack cannot encode`
+	Ptr      unsafe.Pointer      `msgpack:"ptr"`      // want `field Ptr has type unsafe.Pointer, which msgpack cannot encode`
+	Status   Status              `msgpack:"status"`   // want `field Status has type Status, which msgpack cannot encode`
+	Statuses map[string][]Status `msgpack:"statuses"` // want `field Statuses has type map\[string\]\[\]Status, which msgpack cannot encode because of Status`
+	Code     Code                `msgpack:"code"`
+	Level    Level               `msgpack:"level"` // want `field Level has type Level, which msgpack cannot encode`
+	LevelPtr *Level              `msgpack:"level_ptr"`
+	IDs      IDs                 `msgpack:"ids"`
+	Timeout  time.Duration       `msgpack:"timeout"`
+	Number   json.Number         `msgpack:"number"`
+	Any      interface{}         `msgpack:"any"`
+	Ignored  chan int            `msgpack:"-"`
+	Nested   struct {
+		Ch chan int `msgpack:"ch"` // want `field Ch has type chan int, which msgpack cannot encode`
+	} `msgpack:"nested"`
+}
@@ -0,0 +1,115 @@
+package msgpack_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type guardedCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *guardedCounter) MsgpackSnapshot() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := make(map[string]interface{}, len(c.counts))
+	for k, v := range c.counts {
+		m[k] = v
+	}
+	return m
+}
+
+func TestSyncMap(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		var m sync.Map
+		m.Store("foo", "bar")
+		m.Store("baz", int64(100))
+
+		b, err := msgpack.Marshal(&m)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal into map should succeed") {
+			return
+		}
+		if !assert.Equal(t, map[string]interface{}{"foo": "bar", "baz": int64(100)}, decoded, "values should match") {
+			return
+		}
+
+		var decodedSync sync.Map
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decodedSync), "Unmarshal into sync.Map should succeed") {
+			return
+		}
+		for k, v := range decoded {
+			x, ok := decodedSync.Load(k)
+			if !assert.True(t, ok, "key %s should exist", k) {
+				return
+			}
+			if !assert.Equal(t, v, x, "value for %s should match", k) {
+				return
+			}
+		}
+	})
+	t.Run("non-string keys", func(t *testing.T) {
+		var m sync.Map
+		m.Store(1, "foo")
+		_, err := msgpack.Marshal(&m)
+		if !assert.Error(t, err, "Marshal should fail") {
+			return
+		}
+	})
+}
+
+func TestAtomicValue(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		var v atomic.Value
+		b, err := msgpack.Marshal(&v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.Nil.Byte()}, b, "output should match") {
+			return
+		}
+	})
+	t.Run("round trip", func(t *testing.T) {
+		var v atomic.Value
+		v.Store("Hello, World!")
+		b, err := msgpack.Marshal(&v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded atomic.Value
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, "Hello, World!", decoded.Load(), "values should match") {
+			return
+		}
+	})
+}
+
+func TestSnapshotter(t *testing.T) {
+	c := &guardedCounter{counts: map[string]int64{"foo": 1000}}
+
+	b, err := msgpack.Marshal(c)
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	var decoded map[string]interface{}
+	if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{"foo": int64(1000)}, decoded, "values should match") {
+		return
+	}
+}
@@ -0,0 +1,731 @@
+package msgpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrConnClosed is returned from Conn methods after the connection
+// has been closed via Conn.Close
+var ErrConnClosed = errors.New(`msgpack: connection closed`)
+
+// ErrHeartbeatTimeout is returned from Conn.Heartbeat when nothing
+// has been received from the peer within the specified timeout
+var ErrHeartbeatTimeout = errors.New(`msgpack: heartbeat timed out`)
+
+// ConnControlExtType is the extension type reserved for control frames
+// (ping/pong) exchanged by Conn. Control frames are handled by Conn
+// itself, and are never returned from Recv. Do not register your own
+// extensions using this type if you use Conn
+const ConnControlExtType = -128
+
+// controlExtTypeByte is ConnControlExtType, as it appears on the wire
+const controlExtTypeByte = byte(ConnControlExtType & 0xff)
+
+const (
+	controlPing byte = iota + 1
+	controlPong
+	controlSequence
+)
+
+func controlFrame(kind byte) []byte {
+	return []byte{FixExt1.Byte(), controlExtTypeByte, kind}
+}
+
+// sequenceFrameLen is the length of a sequence frame:
+// Ext8, length, type, kind, and the 8 byte sequence number
+const sequenceFrameLen = 12
+
+func appendSequenceFrame(buf []byte, seq uint64) []byte {
+	buf = append(buf, Ext8.Byte(), 9, controlExtTypeByte, controlSequence)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	return append(buf, b[:]...)
+}
+
+// isSequenceFrame reports if msg is a sequence frame, and if so,
+// returns the sequence number that it holds
+func isSequenceFrame(msg []byte) (uint64, bool) {
+	if len(msg) != sequenceFrameLen || msg[0] != Ext8.Byte() || msg[1] != 9 || msg[2] != controlExtTypeByte || msg[3] != controlSequence {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(msg[4:]), true
+}
+
+// isControlFrame reports if msg is a control frame, and if so,
+// returns its kind
+func isControlFrame(msg []byte) (byte, bool) {
+	if len(msg) != 3 || msg[0] != FixExt1.Byte() || msg[1] != controlExtTypeByte {
+		return 0, false
+	}
+	return msg[2], true
+}
+
+// Conn provides full-duplex messaging over a single io.ReadWriter,
+// such as a net.Conn or a pair of io.Pipes. Each message is a single
+// complete msgpack value.
+//
+// Unlike Encoder and Decoder, Conn is safe to use from multiple
+// goroutines: Send calls are serialized, and messages are read by a
+// dedicated goroutine and handed to Recv calls in the order they
+// were received.
+type Conn struct {
+	rw  io.ReadWriter
+	enc *Encoder
+	dec *Decoder
+
+	// wsem is a semaphore that guards writes. We use a channel
+	// instead of a sync.Mutex so that waiting for the right to write
+	// can be cancelled via a context
+	wsem chan struct{}
+	wbuf bytes.Buffer
+
+	incoming        chan []byte
+	maxInflight     int
+	maxMessageBytes int64
+	done            chan struct{}
+	closeOnce       sync.Once
+	// readDone is closed when the read loop exits
+	readDone chan struct{}
+	// pongs wakes up the goroutine that replies to pings. It holds a
+	// single slot, so that pongs for pings received while a pong is
+	// pending are coalesced into it
+	pongs chan struct{}
+
+	muErr sync.Mutex
+	err   error
+
+	muHandlers  sync.RWMutex
+	pingHandler func()
+	pongHandler func()
+
+	// stampSequence and seq are used for outgoing messages. seq is
+	// guarded by wsem
+	stampSequence bool
+	seq           uint64
+	// lastSeq is the sequence number of the last message received,
+	// and is only used from the read loop
+	lastSeq     uint64
+	onGap       func(expected, got uint64)
+	onDuplicate func(seq uint64)
+
+	// muStats guards stats, lastSeen, sending and drained. lastSeen is
+	// the time at which the last frame (of any kind) was received from
+	// the peer, and sending is the number of calls to Send in progress.
+	// drained is set by Shutdown, and closed once sending drops to zero
+	muStats  sync.Mutex
+	stats    ConnStats
+	lastSeen time.Time
+	sending  int
+	drained  chan struct{}
+
+	clock Clock
+}
+
+// ConnStats holds the counters for a Conn. Control frames are
+// included in the byte counts, but not in the message counts
+type ConnStats struct {
+	MessagesIn  int64
+	MessagesOut int64
+	BytesIn     int64
+	BytesOut    int64
+	// Backlog is the number of messages that have been read from the
+	// connection, but have not been consumed by Recv yet
+	Backlog int
+	// Duplicates is the number of messages that were dropped because
+	// their sequence number had already been seen, and Missing is the
+	// number of messages that were skipped over by gaps in the
+	// sequence. See WithSequenceNumbers
+	Duplicates int64
+	Missing    int64
+}
+
+// ConnOption is an option that can be passed to NewConn
+type ConnOption func(*Conn)
+
+// WithMaxInflight specifies the maximum number of messages that are
+// read ahead from the connection before they are consumed by Recv.
+// Once the limit is reached, the Conn stops reading from the
+// connection until Recv is called, so that a slow consumer applies
+// back pressure on the producer (e.g. via TCP flow control) instead
+// of having messages pile up in memory.
+//
+// The default is 1, meaning only the message that is waiting to be
+// handed to Recv is buffered
+func WithMaxInflight(n int) ConnOption {
+	return func(c *Conn) {
+		if n < 1 {
+			n = 1
+		}
+		c.maxInflight = n
+	}
+}
+
+// DefaultMaxMessageBytes is the size limit for a single message read
+// by a Conn or a Mux, unless another is specified via
+// WithConnMaxMessageBytes or WithMuxMaxMessageBytes
+const DefaultMaxMessageBytes = 16 * 1024 * 1024
+
+// WithConnMaxMessageBytes limits the size of a single message read
+// from the peer, like WithMaxMessageBytes does for a Decoder. A peer
+// that sends a larger message, or declares one that would not fit,
+// causes the read loop to stop with an error whose cause is
+// ErrMessageTooLarge. If n is zero, there is no limit. The default is
+// DefaultMaxMessageBytes
+func WithConnMaxMessageBytes(n int64) ConnOption {
+	return func(c *Conn) {
+		c.maxMessageBytes = n
+	}
+}
+
+// WithSequenceNumbers stamps each message sent by the Conn with a
+// sequence number, starting from 1. Sequence numbers are sent in a
+// control frame that precedes the message.
+//
+// Conn always checks the sequence numbers it receives, regardless of
+// this option: a message whose sequence number is not greater than the
+// previous one is a duplicate, and is dropped, and a sequence number
+// that skips ahead means that messages were lost. Both are reported
+// via Stats, and via WithDuplicateHandler and WithGapHandler.
+// Sequence numbers are scoped to a single connection
+func WithSequenceNumbers() ConnOption {
+	return func(c *Conn) {
+		c.stampSequence = true
+	}
+}
+
+// WithGapHandler specifies a function to be called when the sequence
+// numbers received from the peer skip ahead. expected is the sequence
+// number that should have been received, and got is the one that was.
+// The handler is called from the goroutine that reads messages, so it
+// should return quickly
+func WithGapHandler(fn func(expected, got uint64)) ConnOption {
+	return func(c *Conn) {
+		c.onGap = fn
+	}
+}
+
+// WithDuplicateHandler specifies a function to be called when a
+// message with a sequence number that has already been seen is
+// received, and dropped. The handler is called from the goroutine that
+// reads messages, so it should return quickly
+func WithDuplicateHandler(fn func(seq uint64)) ConnOption {
+	return func(c *Conn) {
+		c.onDuplicate = fn
+	}
+}
+
+// WithConnClock specifies the Clock used for heartbeats, and for
+// LastSeen. The default is SystemClock
+func WithConnClock(clock Clock) ConnOption {
+	return func(c *Conn) {
+		c.clock = clock
+	}
+}
+
+// NewConn creates a new Conn, and starts the goroutine that reads
+// messages from rw. The goroutine exits when rw returns an error
+// (including io.EOF), or when Close is called.
+func NewConn(rw io.ReadWriter, options ...ConnOption) *Conn {
+	c := &Conn{
+		rw:              rw,
+		wsem:            make(chan struct{}, 1),
+		done:            make(chan struct{}),
+		readDone:        make(chan struct{}),
+		pongs:           make(chan struct{}, 1),
+		maxInflight:     1,
+		maxMessageBytes: DefaultMaxMessageBytes,
+		clock:           SystemClock,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	c.dec = NewDecoder(rw, WithMaxMessageBytes(c.maxMessageBytes))
+	c.lastSeen = c.clock.Now()
+	// The read loop always holds on to one message while it waits
+	// for room in the channel
+	c.incoming = make(chan []byte, c.maxInflight-1)
+	c.enc = NewEncoder(&c.wbuf)
+
+	go c.readLoop()
+	go c.pongLoop()
+	return c
+}
+
+// pongLoop replies to the pings signaled via pongs, so that a peer that
+// is slow to read does not block the read loop, however many pings it
+// sends
+func (c *Conn) pongLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.pongs:
+		}
+		c.writeFrame(context.Background(), controlFrame(controlPong))
+	}
+}
+
+func (c *Conn) readLoop() {
+	defer close(c.readDone)
+	defer close(c.incoming)
+
+	for {
+		// Check for a clean EOF before we start reading a message,
+		// so that we can tell it apart from a truncated message
+		if _, err := c.dec.raw.Peek(1); err != nil {
+			c.setErr(err)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := c.dec.copyMessage(&buf); err != nil {
+			c.setErr(errors.Wrap(err, `msgpack: failed to read message`))
+			return
+		}
+
+		kind, isControl := isControlFrame(buf.Bytes())
+		seq, isSequence := isSequenceFrame(buf.Bytes())
+		if isSequence {
+			isControl = true
+		}
+
+		c.muStats.Lock()
+		c.lastSeen = c.clock.Now()
+		c.stats.BytesIn += int64(buf.Len())
+		if !isControl {
+			c.stats.MessagesIn++
+		}
+		c.muStats.Unlock()
+
+		if isSequence {
+			// The sequence frame is immediately followed by the
+			// message that it applies to
+			if !c.checkSequence(seq) {
+				if err := c.dec.copyMessage(nil); err != nil {
+					c.setErr(errors.Wrap(err, `msgpack: failed to skip duplicate message`))
+					return
+				}
+			}
+			continue
+		}
+
+		if isControl {
+			c.handleControl(kind)
+			continue
+		}
+
+		c.muStats.Lock()
+		c.stats.Backlog++
+		c.muStats.Unlock()
+
+		select {
+		case <-c.done:
+			return
+		case c.incoming <- buf.Bytes():
+		}
+	}
+}
+
+// checkSequence checks the sequence number of the next message, and
+// reports if the message should be kept
+func (c *Conn) checkSequence(seq uint64) bool {
+	last := c.lastSeq
+	if seq <= last {
+		c.muStats.Lock()
+		c.stats.Duplicates++
+		c.muStats.Unlock()
+		if c.onDuplicate != nil {
+			c.onDuplicate(seq)
+		}
+		return false
+	}
+
+	c.lastSeq = seq
+	if seq != last+1 {
+		c.muStats.Lock()
+		c.stats.Missing += int64(seq - last - 1)
+		c.muStats.Unlock()
+		if c.onGap != nil {
+			c.onGap(last+1, seq)
+		}
+	}
+	return true
+}
+
+func (c *Conn) handleControl(kind byte) {
+	c.muHandlers.RLock()
+	var h func()
+	switch kind {
+	case controlPing:
+		h = c.pingHandler
+	case controlPong:
+		h = c.pongHandler
+	}
+	c.muHandlers.RUnlock()
+
+	if kind == controlPing {
+		select {
+		case c.pongs <- struct{}{}:
+		default:
+			// A pong is already pending
+		}
+	}
+
+	if h != nil {
+		h()
+	}
+}
+
+// SetPingHandler sets a function to be called whenever a ping is
+// received from the peer. Conn always replies to pings with a pong,
+// regardless of whether a handler is set, although pings received
+// while a pong is waiting to be written share that pong. The handler is called from
+// the goroutine that reads messages, so it should return quickly
+func (c *Conn) SetPingHandler(h func()) {
+	c.muHandlers.Lock()
+	c.pingHandler = h
+	c.muHandlers.Unlock()
+}
+
+// SetPongHandler sets a function to be called whenever a pong is
+// received from the peer. The handler is called from the goroutine
+// that reads messages, so it should return quickly
+func (c *Conn) SetPongHandler(h func()) {
+	c.muHandlers.Lock()
+	c.pongHandler = h
+	c.muHandlers.Unlock()
+}
+
+// LastSeen returns the time at which the last frame (either a message
+// or a control frame) was received from the peer. Before anything is
+// received, this is the time at which the Conn was created
+func (c *Conn) LastSeen() time.Time {
+	c.muStats.Lock()
+	defer c.muStats.Unlock()
+	return c.lastSeen
+}
+
+// Stats returns a snapshot of the counters for this Conn
+func (c *Conn) Stats() ConnStats {
+	c.muStats.Lock()
+	defer c.muStats.Unlock()
+	return c.stats
+}
+
+// Ping sends a ping control frame to the peer. The peer's Conn replies
+// with a pong, which can be observed via SetPongHandler
+func (c *Conn) Ping(ctx context.Context) error {
+	return c.writeFrame(ctx, controlFrame(controlPing))
+}
+
+// Heartbeat sends a ping every interval, until the context is
+// cancelled or the Conn is closed. If nothing is received from the
+// peer for longer than timeout, ErrHeartbeatTimeout is returned.
+// Heartbeat does not close the Conn: it is up to the caller to
+// decide what to do with a dead peer.
+//
+//	go func() {
+//	  if err := conn.Heartbeat(ctx, 10*time.Second, 30*time.Second); err == msgpack.ErrHeartbeatTimeout {
+//	    conn.Close()
+//	  }
+//	}()
+func (c *Conn) Heartbeat(ctx context.Context, interval, timeout time.Duration) error {
+	for {
+		t := c.clock.NewTimer(interval)
+		select {
+		case <-c.done:
+			t.Stop()
+			return ErrConnClosed
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C():
+		}
+
+		if c.clock.Now().Sub(c.LastSeen()) > timeout {
+			return ErrHeartbeatTimeout
+		}
+
+		if err := c.Ping(ctx); err != nil {
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case err == ErrConnClosed:
+				return err
+			}
+			return errors.Wrap(err, `msgpack: failed to send ping`)
+		}
+	}
+}
+
+func (c *Conn) setErr(err error) {
+	c.muErr.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.muErr.Unlock()
+}
+
+// Err returns the error that caused the read loop to stop, if any.
+// If the peer closed the connection cleanly, io.EOF is returned
+func (c *Conn) Err() error {
+	c.muErr.Lock()
+	defer c.muErr.Unlock()
+	return c.err
+}
+
+// Done returns a channel that is closed when Close is called
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Conn) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Send encodes v and writes it to the underlying connection as a
+// single message. The message is fully encoded before anything is
+// written, so an encoding error never leaves a partial message on
+// the wire.
+//
+// The context can be used to give up waiting for other goroutines
+// that are currently sending. Once writing has started, it will run
+// to completion (or until the underlying io.Writer returns an error).
+func (c *Conn) Send(ctx context.Context, v interface{}) error {
+	if c.isClosed() {
+		return ErrConnClosed
+	}
+	if err := c.acquireSend(ctx); err != nil {
+		return err
+	}
+	defer c.releaseSend()
+
+	c.wbuf.Reset()
+	if err := c.enc.Encode(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode message`)
+	}
+
+	if err := c.writeMessage(c.wbuf.Bytes()); err != nil {
+		return err
+	}
+
+	c.muStats.Lock()
+	c.stats.MessagesOut++
+	c.muStats.Unlock()
+	return nil
+}
+
+// sendEncoded is like Send, but writes a message that has already
+// been encoded
+func (c *Conn) sendEncoded(ctx context.Context, msg []byte) error {
+	if c.isClosed() {
+		return ErrConnClosed
+	}
+	if err := c.acquireSend(ctx); err != nil {
+		return err
+	}
+	defer c.releaseSend()
+
+	if err := c.writeMessage(msg); err != nil {
+		return err
+	}
+
+	c.muStats.Lock()
+	c.stats.MessagesOut++
+	c.muStats.Unlock()
+	return nil
+}
+
+// writeFrame writes a pre-encoded frame
+func (c *Conn) writeFrame(ctx context.Context, frame []byte) error {
+	if c.isClosed() {
+		return ErrConnClosed
+	}
+
+	select {
+	case <-c.done:
+		return ErrConnClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case c.wsem <- struct{}{}:
+	}
+	defer func() { <-c.wsem }()
+
+	return c.write(frame)
+}
+
+// writeMessage writes an encoded message, preceded by its sequence
+// frame if sequence numbers are enabled. It must be called while
+// holding wsem
+func (c *Conn) writeMessage(msg []byte) error {
+	if !c.stampSequence {
+		return c.write(msg)
+	}
+
+	// Write both in one go, so that the sequence frame is never
+	// separated from its message
+	c.seq++
+	frame := make([]byte, 0, sequenceFrameLen+len(msg))
+	frame = appendSequenceFrame(frame, c.seq)
+	return c.write(append(frame, msg...))
+}
+
+// write must be called while holding wsem
+func (c *Conn) write(frame []byte) error {
+	n, err := c.rw.Write(frame)
+
+	c.muStats.Lock()
+	c.stats.BytesOut += int64(n)
+	c.muStats.Unlock()
+
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to write message`)
+	}
+	return nil
+}
+
+// Recv waits for the next message, and decodes it into v. If the
+// context is cancelled before a message arrives, ctx.Err() is
+// returned, and the message (if any) is left for the next call
+// to Recv.
+//
+// If the read loop has stopped, the error that caused it to stop
+// is returned. This is io.EOF when the peer closed the connection
+// cleanly.
+func (c *Conn) Recv(ctx context.Context, v interface{}) error {
+	if c.isClosed() {
+		return ErrConnClosed
+	}
+
+	select {
+	case <-c.done:
+		return ErrConnClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case msg, ok := <-c.incoming:
+		if !ok {
+			return c.Err()
+		}
+
+		c.muStats.Lock()
+		c.stats.Backlog--
+		c.muStats.Unlock()
+
+		if err := NewDecoder(bytes.NewReader(msg)).Decode(v); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode message`)
+		}
+		return nil
+	}
+}
+
+// Close stops the Conn. If the underlying io.ReadWriter is also an
+// io.Closer, it is closed as well, which unblocks the read loop.
+// Close may be called multiple times: only the first call has any
+// effect.
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if closer, ok := c.rw.(io.Closer); ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
+
+// acquireSend waits for the right to write a message. The caller is
+// counted as a pending send until it calls releaseSend, which it must
+// do if acquireSend succeeds
+func (c *Conn) acquireSend(ctx context.Context) error {
+	c.muStats.Lock()
+	if c.drained != nil {
+		c.muStats.Unlock()
+		return ErrConnClosed
+	}
+	c.sending++
+	c.muStats.Unlock()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		c.finishSend()
+		return ctx.Err()
+	case c.wsem <- struct{}{}:
+		// The Conn may have been closed while waiting, in which case
+		// nothing must be written
+		if !c.isClosed() {
+			return nil
+		}
+		<-c.wsem
+	}
+	c.finishSend()
+	return ErrConnClosed
+}
+
+// releaseSend is called once a send is complete. The send stops being
+// counted before wsem is released, so that Shutdown never counts a
+// send that is complete as dropped
+func (c *Conn) releaseSend() {
+	c.finishSend()
+	<-c.wsem
+}
+
+func (c *Conn) finishSend() {
+	c.muStats.Lock()
+	c.sending--
+	if c.sending == 0 && c.drained != nil {
+		close(c.drained)
+	}
+	c.muStats.Unlock()
+}
+
+// Shutdown gracefully stops the Conn: new calls to Send are rejected
+// with ErrConnClosed, and Shutdown waits for the messages that are
+// being sent, or waiting for their turn to be written, before calling
+// Close. If the context is cancelled before that, the Conn is closed
+// anyway, and ctx.Err() is returned.
+//
+// Shutdown returns the number of dropped messages: those of the calls
+// to Send that were still pending when the Conn was closed. These
+// calls return an error
+func (c *Conn) Shutdown(ctx context.Context) (int, error) {
+	c.muStats.Lock()
+	if c.drained == nil {
+		c.drained = make(chan struct{})
+		if c.sending == 0 {
+			close(c.drained)
+		}
+	}
+	drained := c.drained
+	c.muStats.Unlock()
+
+	select {
+	case <-drained:
+		return 0, c.Close()
+	case <-ctx.Done():
+	}
+
+	// Count and close at once, so that no pending send completes in
+	// between
+	c.muStats.Lock()
+	dropped := c.sending
+	err := c.Close()
+	c.muStats.Unlock()
+	if dropped == 0 {
+		// The last send completed as the context was cancelled
+		return 0, err
+	}
+	return dropped, ctx.Err()
+}
@@ -0,0 +1,598 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type connMessage struct {
+	ID      int64
+	Payload string
+}
+
+func TestConn(t *testing.T) {
+	t.Run("full duplex", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left)
+		c2 := msgpack.NewConn(right)
+		defer c1.Close()
+		defer c2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		const count = 10
+		var wg sync.WaitGroup
+		wg.Add(2)
+		for _, pair := range [][2]*msgpack.Conn{{c1, c2}, {c2, c1}} {
+			src := pair[0]
+			go func() {
+				defer wg.Done()
+				for i := 0; i < count; i++ {
+					if !assert.NoError(t, src.Send(ctx, connMessage{ID: int64(i), Payload: "Hello, World!"}), "Send should succeed") {
+						return
+					}
+				}
+			}()
+		}
+
+		for _, dst := range []*msgpack.Conn{c1, c2} {
+			for i := 0; i < count; i++ {
+				var msg connMessage
+				if !assert.NoError(t, dst.Recv(ctx, &msg), "Recv should succeed") {
+					return
+				}
+				if !assert.Equal(t, connMessage{ID: int64(i), Payload: "Hello, World!"}, msg, "messages should arrive in order") {
+					return
+				}
+			}
+		}
+		wg.Wait()
+	})
+	t.Run("concurrent senders", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left)
+		c2 := msgpack.NewConn(right)
+		defer c1.Close()
+		defer c2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		const senders = 8
+		for i := 0; i < senders; i++ {
+			go c1.Send(ctx, connMessage{ID: int64(i), Payload: "Hello, World!"})
+		}
+
+		seen := make(map[int64]struct{})
+		for i := 0; i < senders; i++ {
+			var msg connMessage
+			if !assert.NoError(t, c2.Recv(ctx, &msg), "Recv should succeed") {
+				return
+			}
+			seen[msg.ID] = struct{}{}
+		}
+		if !assert.Len(t, seen, senders, "all messages should be received intact") {
+			return
+		}
+	})
+	t.Run("cancel Recv", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left)
+		c2 := msgpack.NewConn(right)
+		defer c1.Close()
+		defer c2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		var msg connMessage
+		if !assert.Equal(t, context.DeadlineExceeded, c2.Recv(ctx, &msg), "Recv should return ctx.Err()") {
+			return
+		}
+
+		// The connection should still be usable
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		go c1.Send(ctx, connMessage{ID: 1})
+		if !assert.NoError(t, c2.Recv(ctx, &msg), "Recv should succeed") {
+			return
+		}
+		if !assert.Equal(t, int64(1), msg.ID, "message should match") {
+			return
+		}
+	})
+	t.Run("peer closed", func(t *testing.T) {
+		left, right := net.Pipe()
+		c := msgpack.NewConn(right)
+		defer c.Close()
+
+		left.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var msg connMessage
+		if !assert.Equal(t, io.EOF, c.Recv(ctx, &msg), "Recv should return io.EOF") {
+			return
+		}
+	})
+	t.Run("truncated message", func(t *testing.T) {
+		left, right := net.Pipe()
+		c := msgpack.NewConn(right)
+		defer c.Close()
+
+		go func() {
+			left.Write([]byte{msgpack.FixStr5.Byte(), 'a', 'b'})
+			left.Close()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var s string
+		err := c.Recv(ctx, &s)
+		if !assert.Error(t, err, "Recv should fail") {
+			return
+		}
+		if !assert.NotEqual(t, io.EOF, err, "error should not be a clean EOF") {
+			return
+		}
+	})
+	t.Run("oversized message", func(t *testing.T) {
+		testcases := []struct {
+			Name    string
+			Options []msgpack.ConnOption
+			Message []byte
+		}{
+			{Name: "WithConnMaxMessageBytes", Options: []msgpack.ConnOption{msgpack.WithConnMaxMessageBytes(16)}, Message: append([]byte{msgpack.Str8.Byte(), 32}, bytes.Repeat([]byte{'a'}, 32)...)},
+			// A Bin32 that declares 4GB, and holds nothing
+			{Name: "default limit", Message: []byte{msgpack.Bin32.Byte(), 0xff, 0xff, 0xff, 0xff}},
+		}
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				left, right := net.Pipe()
+				c := msgpack.NewConn(right, tc.Options...)
+				defer c.Close()
+				defer left.Close()
+
+				go left.Write(tc.Message)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				var v interface{}
+				err := c.Recv(ctx, &v)
+				if !assert.Equal(t, msgpack.ErrMessageTooLarge, errors.Cause(err), "Recv should fail (got %v)", err) {
+					return
+				}
+			})
+		}
+	})
+	t.Run("closed", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left)
+		c2 := msgpack.NewConn(right)
+		defer c2.Close()
+
+		if !assert.NoError(t, c1.Close(), "Close should succeed") {
+			return
+		}
+		if !assert.NoError(t, c1.Close(), "second Close should be a no-op") {
+			return
+		}
+
+		ctx := context.Background()
+		if !assert.Equal(t, msgpack.ErrConnClosed, c1.Send(ctx, 1), "Send should fail after Close") {
+			return
+		}
+		var v interface{}
+		if !assert.Equal(t, msgpack.ErrConnClosed, c1.Recv(ctx, &v), "Recv should fail after Close") {
+			return
+		}
+	})
+	t.Run("shutdown", func(t *testing.T) {
+		left, right := net.Pipe()
+		c := msgpack.NewConn(left)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Nobody reads from right yet, so the first Send blocks while
+		// writing, and the others while waiting for their turn
+		const count = 3
+		sent := make(chan error, count)
+		for i := 0; i < count; i++ {
+			go func() { sent <- c.Send(ctx, "foo") }()
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		type result struct {
+			dropped int
+			err     error
+		}
+		shutdown := make(chan result, 1)
+		go func() {
+			dropped, err := c.Shutdown(ctx)
+			shutdown <- result{dropped, err}
+		}()
+		time.Sleep(50 * time.Millisecond)
+		if !assert.Equal(t, msgpack.ErrConnClosed, c.Send(ctx, "bar"), "Send should fail once Shutdown started") {
+			return
+		}
+
+		dec := msgpack.NewDecoder(right)
+		for i := 0; i < count; i++ {
+			var s string
+			if !assert.NoError(t, dec.Decode(&s), "pending messages should be written") {
+				return
+			}
+			if !assert.NoError(t, <-sent, "Send should succeed") {
+				return
+			}
+		}
+		res := <-shutdown
+		if !assert.NoError(t, res.err, "Shutdown should succeed") {
+			return
+		}
+		if !assert.Equal(t, 0, res.dropped, "no messages should be dropped") {
+			return
+		}
+		if !assert.Equal(t, msgpack.ErrConnClosed, c.Send(ctx, "bar"), "Send should fail after Shutdown") {
+			return
+		}
+	})
+	t.Run("shutdown after sends", func(t *testing.T) {
+		left, right := net.Pipe()
+		defer right.Close()
+		c := msgpack.NewConn(left)
+		go io.Copy(ioutil.Discard, right)
+
+		for i := 0; i < 100; i++ {
+			if !assert.NoError(t, c.Send(context.Background(), i), "Send should succeed") {
+				return
+			}
+		}
+
+		// Completed sends are never counted, even if the context is
+		// already done
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		dropped, err := c.Shutdown(ctx)
+		if !assert.NoError(t, err, "Shutdown should succeed") {
+			return
+		}
+		if !assert.Equal(t, 0, dropped, "no messages should be dropped") {
+			return
+		}
+	})
+	t.Run("shutdown deadline", func(t *testing.T) {
+		left, right := net.Pipe()
+		defer right.Close()
+		c := msgpack.NewConn(left)
+
+		// Nobody ever reads from right: the first Send blocks while
+		// writing, and the others while waiting for their turn
+		const count = 5
+		sent := make(chan error, count)
+		for i := 0; i < count; i++ {
+			go func() { sent <- c.Send(context.Background(), "foo") }()
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		dropped, err := c.Shutdown(ctx)
+		if !assert.Equal(t, context.DeadlineExceeded, err, "Shutdown should give up at the deadline") {
+			return
+		}
+		if !assert.Equal(t, count, dropped, "all messages should be dropped") {
+			return
+		}
+		for i := 0; i < count; i++ {
+			if !assert.Error(t, <-sent, "Send should fail") {
+				return
+			}
+		}
+	})
+}
+
+func TestConnHeartbeat(t *testing.T) {
+	t.Run("ping/pong", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left)
+		c2 := msgpack.NewConn(right)
+		defer c1.Close()
+		defer c2.Close()
+
+		pinged := make(chan struct{}, 1)
+		ponged := make(chan struct{}, 1)
+		c2.SetPingHandler(func() { pinged <- struct{}{} })
+		c1.SetPongHandler(func() { ponged <- struct{}{} })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if !assert.NoError(t, c1.Ping(ctx), "Ping should succeed") {
+			return
+		}
+
+		for _, ch := range []chan struct{}{pinged, ponged} {
+			select {
+			case <-ctx.Done():
+				t.Errorf("timed out waiting for control frames")
+				return
+			case <-ch:
+			}
+		}
+
+		// Control frames must not be visible to Recv
+		go c1.Send(ctx, "Hello, World!")
+		var s string
+		if !assert.NoError(t, c2.Recv(ctx, &s), "Recv should succeed") {
+			return
+		}
+		if !assert.Equal(t, "Hello, World!", s, "Recv should return the message") {
+			return
+		}
+	})
+	t.Run("ping flood", func(t *testing.T) {
+		left, right := net.Pipe()
+		c := msgpack.NewConn(right)
+		defer c.Close()
+		defer left.Close()
+
+		const count = 1000
+		var pings int64
+		pinged := make(chan struct{})
+		c.SetPingHandler(func() {
+			if atomic.AddInt64(&pings, 1) == count {
+				close(pinged)
+			}
+		})
+
+		// Nobody reads the pongs while the pings are sent
+		ping := []byte{msgpack.FixExt1.Byte(), 0x80, 0x01}
+		go left.Write(bytes.Repeat(ping, count))
+
+		select {
+		case <-time.After(5 * time.Second):
+			t.Errorf("timed out waiting for pings")
+			return
+		case <-pinged:
+		}
+
+		var pongs int
+		buf := make([]byte, 3)
+		for {
+			left.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			if _, err := io.ReadFull(left, buf); err != nil {
+				break
+			}
+			pongs++
+		}
+		// One pong was being written, and the others share a single one
+		if !assert.True(t, pongs >= 1 && pongs <= 2, "pongs should be coalesced (got %d)", pongs) {
+			return
+		}
+	})
+	t.Run("alive peer", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left)
+		c2 := msgpack.NewConn(right)
+		defer c1.Close()
+		defer c2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		err := c1.Heartbeat(ctx, 10*time.Millisecond, 100*time.Millisecond)
+		if !assert.Equal(t, context.DeadlineExceeded, err, "Heartbeat should run until the context is cancelled") {
+			return
+		}
+	})
+	t.Run("dead peer", func(t *testing.T) {
+		left, right := net.Pipe()
+		c := msgpack.NewConn(left)
+		defer c.Close()
+
+		// The peer reads, but never responds
+		go io.Copy(ioutil.Discard, right)
+		defer right.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := c.Heartbeat(ctx, 10*time.Millisecond, 50*time.Millisecond)
+		if !assert.Equal(t, msgpack.ErrHeartbeatTimeout, err, "Heartbeat should time out") {
+			return
+		}
+	})
+}
+
+func TestConnStats(t *testing.T) {
+	t.Run("counters", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left)
+		c2 := msgpack.NewConn(right)
+		defer c1.Close()
+		defer c2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		const count = 3
+		sendDone := make(chan struct{})
+		go func() {
+			defer close(sendDone)
+			for i := 0; i < count; i++ {
+				c1.Send(ctx, "Hello, World!")
+			}
+		}()
+
+		for i := 0; i < count; i++ {
+			var s string
+			if !assert.NoError(t, c2.Recv(ctx, &s), "Recv should succeed") {
+				return
+			}
+		}
+		<-sendDone
+
+		encoded, err := msgpack.Marshal("Hello, World!")
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		size := int64(len(encoded))
+
+		if !assert.Equal(t, msgpack.ConnStats{MessagesIn: count, BytesIn: count * size}, c2.Stats(), "receiver stats should match") {
+			return
+		}
+		if !assert.Equal(t, msgpack.ConnStats{MessagesOut: count, BytesOut: count * size}, c1.Stats(), "sender stats should match") {
+			return
+		}
+	})
+	t.Run("max inflight", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left)
+		c2 := msgpack.NewConn(right, msgpack.WithMaxInflight(2))
+		defer c1.Close()
+		defer c2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		const count = 5
+		sent := make(chan struct{}, count)
+		go func() {
+			for i := 0; i < count; i++ {
+				if err := c1.Send(ctx, int64(i)); err != nil {
+					return
+				}
+				sent <- struct{}{}
+			}
+		}()
+
+		// Without anybody calling Recv, the producer must be blocked
+		// once the receiver has read ahead as much as it is allowed to
+		time.Sleep(100 * time.Millisecond)
+		if !assert.Equal(t, 2, c2.Stats().Backlog, "backlog should be capped") {
+			return
+		}
+		if !assert.True(t, len(sent) < count, "producer should be blocked") {
+			return
+		}
+
+		for i := 0; i < count; i++ {
+			var v int64
+			if !assert.NoError(t, c2.Recv(ctx, &v), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, int64(i), v, "messages should arrive in order") {
+				return
+			}
+		}
+		if !assert.Equal(t, 0, c2.Stats().Backlog, "backlog should be drained") {
+			return
+		}
+	})
+}
+
+func TestConnSequenceNumbers(t *testing.T) {
+	t.Run("in order", func(t *testing.T) {
+		left, right := net.Pipe()
+		c1 := msgpack.NewConn(left, msgpack.WithSequenceNumbers())
+		c2 := msgpack.NewConn(right, msgpack.WithMaxInflight(4))
+		defer c1.Close()
+		defer c2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		for i := 0; i < 3; i++ {
+			if !assert.NoError(t, c1.Send(ctx, i), "Send should succeed") {
+				return
+			}
+			var v int
+			if !assert.NoError(t, c2.Recv(ctx, &v), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, i, v, "messages should match") {
+				return
+			}
+		}
+		if !assert.Equal(t, int64(3), c2.Stats().MessagesIn, "sequence frames should not be counted as messages") {
+			return
+		}
+	})
+	t.Run("gaps and duplicates", func(t *testing.T) {
+		left, right := net.Pipe()
+		var gaps [][2]uint64
+		var duplicates []uint64
+		c := msgpack.NewConn(right,
+			msgpack.WithMaxInflight(4),
+			msgpack.WithGapHandler(func(expected, got uint64) {
+				gaps = append(gaps, [2]uint64{expected, got})
+			}),
+			msgpack.WithDuplicateHandler(func(seq uint64) {
+				duplicates = append(duplicates, seq)
+			}),
+		)
+		defer c.Close()
+
+		// Sequence frames are written by hand, to simulate a sender that
+		// lost message 2, and resent message 4
+		go func() {
+			for _, seq := range []uint64{1, 3, 4, 4, 5} {
+				frame := []byte{msgpack.Ext8.Byte(), 9, byte(msgpack.ConnControlExtType & 0xff), 3, 0, 0, 0, 0, 0, 0, 0, byte(seq)}
+				msg, _ := msgpack.Marshal(int(seq))
+				left.Write(append(frame, msg...))
+			}
+			left.Close()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var received []int
+		for {
+			var v int
+			err := c.Recv(ctx, &v)
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err, "Recv should succeed") {
+				return
+			}
+			received = append(received, v)
+		}
+
+		if !assert.Equal(t, []int{1, 3, 4, 5}, received, "duplicates should be dropped") {
+			return
+		}
+		if !assert.Equal(t, [][2]uint64{{2, 3}}, gaps, "gap should be reported") {
+			return
+		}
+		if !assert.Equal(t, []uint64{4}, duplicates, "duplicate should be reported") {
+			return
+		}
+		stats := c.Stats()
+		if !assert.Equal(t, int64(1), stats.Duplicates, "Duplicates should match") {
+			return
+		}
+		if !assert.Equal(t, int64(1), stats.Missing, "Missing should match") {
+			return
+		}
+	})
+}
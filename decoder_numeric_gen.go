@@ -4,6 +4,7 @@ package msgpack
 
 import (
 	"math"
+	"reflect"
 
 	"github.com/pkg/errors"
 )
@@ -14,7 +15,7 @@ func (d *Decoder) DecodeInt(v *int) error {
 		return errors.Wrap(err, `msgpack: failed to read code for Int64`)
 	}
 	if IsFixNumFamily(Code(code)) {
-		*v = int(code)
+		*v = int(int8(code))
 		return nil
 	}
 	switch Code(code) {
@@ -23,31 +24,38 @@ func (d *Decoder) DecodeInt(v *int) error {
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int`)
 		}
-		*v = int(x)
+		*v = int(int64(x))
 		return nil
 	case Int32:
 		x, err := d.src.ReadUint32()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int`)
 		}
-		*v = int(x)
+		*v = int(int32(x))
 		return nil
 	case Int16:
 		x, err := d.src.ReadUint16()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int`)
 		}
-		*v = int(x)
+		*v = int(int16(x))
 		return nil
 	case Int8:
 		x, err := d.src.ReadUint8()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int`)
 		}
+		*v = int(int8(x))
+		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Int)
+		if err != nil {
+			return err
+		}
 		*v = int(x)
 		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for int`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for int`, Code(code)))
 }
 
 func (d *Decoder) DecodeInt8(v *int8) error {
@@ -56,7 +64,7 @@ func (d *Decoder) DecodeInt8(v *int8) error {
 		return errors.Wrap(err, `msgpack: failed to read code for Int8`)
 	}
 	if IsFixNumFamily(Code(code)) {
-		*v = int8(code)
+		*v = int8(int8(code))
 		return nil
 	}
 	switch Code(code) {
@@ -65,10 +73,17 @@ func (d *Decoder) DecodeInt8(v *int8) error {
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int8`)
 		}
+		*v = int8(int8(x))
+		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Int8)
+		if err != nil {
+			return err
+		}
 		*v = int8(x)
 		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for int8`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for int8`, Code(code)))
 }
 
 func (d *Decoder) DecodeInt16(v *int16) error {
@@ -77,7 +92,7 @@ func (d *Decoder) DecodeInt16(v *int16) error {
 		return errors.Wrap(err, `msgpack: failed to read code for Int16`)
 	}
 	if IsFixNumFamily(Code(code)) {
-		*v = int16(code)
+		*v = int16(int8(code))
 		return nil
 	}
 	switch Code(code) {
@@ -86,17 +101,24 @@ func (d *Decoder) DecodeInt16(v *int16) error {
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int16`)
 		}
-		*v = int16(x)
+		*v = int16(int16(x))
 		return nil
 	case Int8:
 		x, err := d.src.ReadUint8()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int16`)
 		}
+		*v = int16(int8(x))
+		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Int16)
+		if err != nil {
+			return err
+		}
 		*v = int16(x)
 		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for int16`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for int16`, Code(code)))
 }
 
 func (d *Decoder) DecodeInt32(v *int32) error {
@@ -105,7 +127,7 @@ func (d *Decoder) DecodeInt32(v *int32) error {
 		return errors.Wrap(err, `msgpack: failed to read code for Int32`)
 	}
 	if IsFixNumFamily(Code(code)) {
-		*v = int32(code)
+		*v = int32(int8(code))
 		return nil
 	}
 	switch Code(code) {
@@ -114,24 +136,31 @@ func (d *Decoder) DecodeInt32(v *int32) error {
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int32`)
 		}
-		*v = int32(x)
+		*v = int32(int32(x))
 		return nil
 	case Int16:
 		x, err := d.src.ReadUint16()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int32`)
 		}
-		*v = int32(x)
+		*v = int32(int16(x))
 		return nil
 	case Int8:
 		x, err := d.src.ReadUint8()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int32`)
 		}
+		*v = int32(int8(x))
+		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Int32)
+		if err != nil {
+			return err
+		}
 		*v = int32(x)
 		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for int32`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for int32`, Code(code)))
 }
 
 func (d *Decoder) DecodeInt64(v *int64) error {
@@ -140,7 +169,7 @@ func (d *Decoder) DecodeInt64(v *int64) error {
 		return errors.Wrap(err, `msgpack: failed to read code for Int64`)
 	}
 	if IsFixNumFamily(Code(code)) {
-		*v = int64(code)
+		*v = int64(int8(code))
 		return nil
 	}
 	switch Code(code) {
@@ -149,31 +178,38 @@ func (d *Decoder) DecodeInt64(v *int64) error {
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int64`)
 		}
-		*v = int64(x)
+		*v = int64(int64(x))
 		return nil
 	case Int32:
 		x, err := d.src.ReadUint32()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int64`)
 		}
-		*v = int64(x)
+		*v = int64(int32(x))
 		return nil
 	case Int16:
 		x, err := d.src.ReadUint16()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int64`)
 		}
-		*v = int64(x)
+		*v = int64(int16(x))
 		return nil
 	case Int8:
 		x, err := d.src.ReadUint8()
 		if err != nil {
 			return errors.Wrap(err, `msgpack: failed to read payload for int64`)
 		}
+		*v = int64(int8(x))
+		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Int64)
+		if err != nil {
+			return err
+		}
 		*v = int64(x)
 		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for int64`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for int64`, Code(code)))
 }
 
 func (d *Decoder) DecodeUint(v *uint) error {
@@ -181,7 +217,7 @@ func (d *Decoder) DecodeUint(v *uint) error {
 	if err != nil {
 		return errors.Wrap(err, `msgpack: failed to read code for Uint64`)
 	}
-	if IsFixNumFamily(Code(code)) {
+	if IsPositiveFixNum(Code(code)) {
 		*v = uint(code)
 		return nil
 	}
@@ -214,8 +250,15 @@ func (d *Decoder) DecodeUint(v *uint) error {
 		}
 		*v = uint(x)
 		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Uint)
+		if err != nil {
+			return err
+		}
+		*v = uint(x)
+		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for uint`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for uint`, Code(code)))
 }
 
 func (d *Decoder) DecodeUint8(v *uint8) error {
@@ -223,7 +266,7 @@ func (d *Decoder) DecodeUint8(v *uint8) error {
 	if err != nil {
 		return errors.Wrap(err, `msgpack: failed to read code for Uint8`)
 	}
-	if IsFixNumFamily(Code(code)) {
+	if IsPositiveFixNum(Code(code)) {
 		*v = uint8(code)
 		return nil
 	}
@@ -235,8 +278,15 @@ func (d *Decoder) DecodeUint8(v *uint8) error {
 		}
 		*v = uint8(x)
 		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Uint8)
+		if err != nil {
+			return err
+		}
+		*v = uint8(x)
+		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for uint8`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for uint8`, Code(code)))
 }
 
 func (d *Decoder) DecodeUint16(v *uint16) error {
@@ -244,7 +294,7 @@ func (d *Decoder) DecodeUint16(v *uint16) error {
 	if err != nil {
 		return errors.Wrap(err, `msgpack: failed to read code for Uint16`)
 	}
-	if IsFixNumFamily(Code(code)) {
+	if IsPositiveFixNum(Code(code)) {
 		*v = uint16(code)
 		return nil
 	}
@@ -263,8 +313,15 @@ func (d *Decoder) DecodeUint16(v *uint16) error {
 		}
 		*v = uint16(x)
 		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Uint16)
+		if err != nil {
+			return err
+		}
+		*v = uint16(x)
+		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for uint16`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for uint16`, Code(code)))
 }
 
 func (d *Decoder) DecodeUint32(v *uint32) error {
@@ -272,7 +329,7 @@ func (d *Decoder) DecodeUint32(v *uint32) error {
 	if err != nil {
 		return errors.Wrap(err, `msgpack: failed to read code for Uint32`)
 	}
-	if IsFixNumFamily(Code(code)) {
+	if IsPositiveFixNum(Code(code)) {
 		*v = uint32(code)
 		return nil
 	}
@@ -298,8 +355,15 @@ func (d *Decoder) DecodeUint32(v *uint32) error {
 		}
 		*v = uint32(x)
 		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Uint32)
+		if err != nil {
+			return err
+		}
+		*v = uint32(x)
+		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for uint32`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for uint32`, Code(code)))
 }
 
 func (d *Decoder) DecodeUint64(v *uint64) error {
@@ -307,7 +371,7 @@ func (d *Decoder) DecodeUint64(v *uint64) error {
 	if err != nil {
 		return errors.Wrap(err, `msgpack: failed to read code for Uint64`)
 	}
-	if IsFixNumFamily(Code(code)) {
+	if IsPositiveFixNum(Code(code)) {
 		*v = uint64(code)
 		return nil
 	}
@@ -340,8 +404,15 @@ func (d *Decoder) DecodeUint64(v *uint64) error {
 		}
 		*v = uint64(x)
 		return nil
+	case Float, Double:
+		x, err := d.decodeFloatAsInteger(Code(code), reflect.Uint64)
+		if err != nil {
+			return err
+		}
+		*v = uint64(x)
+		return nil
 	}
-	return errors.Errorf(`msgpack: invalid numeric type %s for uint64`, Code(code))
+	return d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %s for uint64`, Code(code)))
 }
 
 func (d *Decoder) DecodeFloat32(v *float32) error {
@@ -351,7 +422,7 @@ func (d *Decoder) DecodeFloat32(v *float32) error {
 	}
 
 	if code != Float.Byte() {
-		return errors.Errorf(`msgpack: expected Float, got %s`, Code(code))
+		return d.invalidCode(Code(code), errors.Errorf(`msgpack: expected Float, got %s`, Code(code)))
 	}
 
 	*v = math.Float32frombits(x)
@@ -365,7 +436,7 @@ func (d *Decoder) DecodeFloat64(v *float64) error {
 	}
 
 	if code != Double.Byte() {
-		return errors.Errorf(`msgpack: expected Double, got %s`, Code(code))
+		return d.invalidCode(Code(code), errors.Errorf(`msgpack: expected Double, got %s`, Code(code)))
 	}
 
 	*v = math.Float64frombits(x)
@@ -8,8 +8,10 @@ import (
 	"math"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -112,7 +114,7 @@ func TestDecodeNil(t *testing.T) {
 		}
 	})
 	t.Run("decode via Decoder (interface{})", func(t *testing.T) {
-		var v interface{} = 0xdeadcafe
+		var v interface{} = int64(0xdeadcafe)
 		decodeMatch(t, bytes.NewBuffer(b), &v, e)
 	})
 }
@@ -226,6 +228,42 @@ func TestDecodeInt64(t *testing.T) {
 	decodeTestMethod(t, msgpack.Int64, "DecodeInt64", b, e)
 }
 
+func TestDecodeFixNum(t *testing.T) {
+	t.Run("positive", func(t *testing.T) {
+		for _, v := range []interface{}{new(int), new(int8), new(int16), new(int32), new(int64), new(uint), new(uint8), new(uint16), new(uint32), new(uint64)} {
+			if !assert.NoError(t, msgpack.Unmarshal([]byte{0x7f}, v), "Unmarshal into %T should succeed", v) {
+				return
+			}
+			if !assert.Equal(t, "127", fmt.Sprint(reflect.ValueOf(v).Elem().Interface()), "value for %T should match", v) {
+				return
+			}
+		}
+	})
+	t.Run("negative", func(t *testing.T) {
+		for _, v := range []interface{}{new(int), new(int8), new(int16), new(int32), new(int64)} {
+			if !assert.NoError(t, msgpack.Unmarshal([]byte{0xe0}, v), "Unmarshal into %T should succeed", v) {
+				return
+			}
+			if !assert.Equal(t, "-32", fmt.Sprint(reflect.ValueOf(v).Elem().Interface()), "value for %T should match", v) {
+				return
+			}
+		}
+		var u uint8
+		if !assert.Error(t, msgpack.Unmarshal([]byte{0xff}, &u), "Unmarshal into uint8 should fail") {
+			return
+		}
+	})
+	t.Run("interface", func(t *testing.T) {
+		var l []interface{}
+		if !assert.NoError(t, msgpack.Unmarshal([]byte{0x93, 0x01, 0xff, 0xc0}, &l), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []interface{}{int8(1), int8(-1), nil}, l, "values should match") {
+			return
+		}
+	})
+}
+
 func TestDecodeStr8(t *testing.T) {
 	var l = math.MaxUint8
 	var e = makeString(l)
@@ -323,6 +361,219 @@ func TestDecodeArray(t *testing.T) {
 	}
 }
 
+func TestDecodeTypedSlice(t *testing.T) {
+	type intList []int
+	type item struct {
+		Name string
+	}
+
+	marshal := func(t *testing.T, v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal %#v: %s", v, err)
+		}
+		return append([]byte(nil), b...)
+	}
+
+	t.Run("narrower integer codes", func(t *testing.T) {
+		b := marshal(t, []interface{}{int8(1), int16(300), int64(-3)})
+		unmarshalMatch(t, b, &[]int{}, []int{1, 300, -3})
+		unmarshalMatch(t, b, &intList{}, intList{1, 300, -3})
+	})
+	t.Run("structs", func(t *testing.T) {
+		b := marshal(t, []item{{Name: "foo"}, {Name: "bar"}})
+		unmarshalMatch(t, b, &[]item{}, []item{{Name: "foo"}, {Name: "bar"}})
+		unmarshalMatch(t, b, &[]*item{}, []*item{{Name: "foo"}, {Name: "bar"}})
+	})
+	t.Run("nested", func(t *testing.T) {
+		b := marshal(t, [][]string{{"a"}, {"b", "c"}})
+		unmarshalMatch(t, b, &[][]string{}, [][]string{{"a"}, {"b", "c"}})
+	})
+	t.Run("nil elements", func(t *testing.T) {
+		s := "foo"
+		b := marshal(t, []interface{}{"foo", nil})
+		unmarshalMatch(t, b, &[]*string{}, []*string{&s, nil})
+
+		b = marshal(t, []interface{}{nil, 1})
+		unmarshalMatch(t, b, &[]int{}, []int{0, 1})
+	})
+	t.Run("nil slice", func(t *testing.T) {
+		b := marshal(t, nil)
+		unmarshalMatch(t, b, &[]int{1, 2}, []int(nil))
+	})
+	t.Run("bytes from array", func(t *testing.T) {
+		b := marshal(t, []interface{}{uint8(1), uint8(2), uint8(255)})
+		unmarshalMatch(t, b, &[]byte{}, []byte{1, 2, 255})
+	})
+}
+
+func TestDecodeFixedArray(t *testing.T) {
+	marshal := func(t *testing.T, v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal %#v: %s", v, err)
+		}
+		return append([]byte(nil), b...)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		unmarshalMatch(t, marshal(t, [4]float64{1, 2, 3, 4}), &[4]float64{}, [4]float64{1, 2, 3, 4})
+		unmarshalMatch(t, marshal(t, [2][2]int64{{1, 2}, {3, 4}}), &[2][2]int64{}, [2][2]int64{{1, 2}, {3, 4}})
+
+		type point struct {
+			XY [2]float64
+		}
+		unmarshalMatch(t, marshal(t, point{XY: [2]float64{1, 2}}), &point{}, point{XY: [2]float64{1, 2}})
+	})
+	t.Run("length mismatch", func(t *testing.T) {
+		var v [4]float64
+		if !assert.Error(t, msgpack.Unmarshal(marshal(t, []float64{1, 2, 3}), &v), "Unmarshal should fail") {
+			return
+		}
+	})
+	t.Run("WithTruncateArrays", func(t *testing.T) {
+		var v [2]float64
+		if !assert.NoError(t, msgpack.Unmarshal(marshal(t, []float64{1, 2, 3}), &v, msgpack.WithTruncateArrays()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, [2]float64{1, 2}, v, "extra elements should be skipped") {
+			return
+		}
+
+		w := [4]float64{9, 9, 9, 9}
+		if !assert.NoError(t, msgpack.Unmarshal(marshal(t, []float64{1, 2, 3}), &w, msgpack.WithTruncateArrays()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, [4]float64{1, 2, 3, 0}, w, "missing elements should be zero") {
+			return
+		}
+
+		var b [2]byte
+		if !assert.NoError(t, msgpack.Unmarshal(marshal(t, []byte{1, 2, 3}), &b, msgpack.WithTruncateArrays()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, [2]byte{1, 2}, b, "extra bytes should be skipped") {
+			return
+		}
+	})
+}
+
+func TestDecodeTypedMap(t *testing.T) {
+	type color string
+	type item struct {
+		Name string
+	}
+
+	marshal := func(t *testing.T, v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal %#v: %s", v, err)
+		}
+		return append([]byte(nil), b...)
+	}
+
+	t.Run("scalar values", func(t *testing.T) {
+		unmarshalMatch(t, marshal(t, map[string]string{"foo": "bar"}), &map[string]string{}, map[string]string{"foo": "bar"})
+		unmarshalMatch(t, marshal(t, map[string]int64{"foo": 1, "bar": -2}), &map[string]int64{}, map[string]int64{"foo": 1, "bar": -2})
+	})
+	t.Run("struct values", func(t *testing.T) {
+		b := marshal(t, map[string]item{"a": {Name: "foo"}})
+		unmarshalMatch(t, b, &map[string]item{}, map[string]item{"a": {Name: "foo"}})
+		unmarshalMatch(t, b, &map[string]*item{}, map[string]*item{"a": {Name: "foo"}})
+	})
+	t.Run("nested", func(t *testing.T) {
+		b := marshal(t, map[string][]string{"a": {"b", "c"}})
+		unmarshalMatch(t, b, &map[string][]string{}, map[string][]string{"a": {"b", "c"}})
+
+		b = marshal(t, map[string]map[string]int64{"a": {"b": 1}})
+		unmarshalMatch(t, b, &map[string]map[string]int64{}, map[string]map[string]int64{"a": {"b": 1}})
+	})
+	t.Run("named key type", func(t *testing.T) {
+		b := marshal(t, map[string]int64{"red": 1})
+		unmarshalMatch(t, b, &map[color]int64{}, map[color]int64{"red": 1})
+	})
+	t.Run("nil values", func(t *testing.T) {
+		b := marshal(t, map[string]interface{}{"a": nil})
+		unmarshalMatch(t, b, &map[string]*item{}, map[string]*item{"a": nil})
+	})
+	t.Run("nil map", func(t *testing.T) {
+		unmarshalMatch(t, marshal(t, nil), &map[string]int64{"a": 1}, map[string]int64(nil))
+	})
+	t.Run("struct field", func(t *testing.T) {
+		type counts struct {
+			Counts map[string]int64
+		}
+		b := marshal(t, counts{Counts: map[string]int64{"foo": 1}})
+		unmarshalMatch(t, b, &counts{}, counts{Counts: map[string]int64{"foo": 1}})
+	})
+	t.Run("mismatched value", func(t *testing.T) {
+		b := marshal(t, map[string]interface{}{"a": "foo"})
+		var m map[string]int64
+		if !assert.Error(t, msgpack.Unmarshal(b, &m), "Unmarshal should fail") {
+			return
+		}
+	})
+}
+
+func TestNonStringMapKeys(t *testing.T) {
+	type color string
+
+	marshal := func(t *testing.T, v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal %#v: %s", v, err)
+		}
+		return append([]byte(nil), b...)
+	}
+
+	t.Run("typed maps", func(t *testing.T) {
+		unmarshalMatch(t, marshal(t, map[int]string{1: "foo", -2: "bar"}), &map[int]string{}, map[int]string{1: "foo", -2: "bar"})
+		unmarshalMatch(t, marshal(t, map[uint16]bool{300: true}), &map[uint16]bool{}, map[uint16]bool{300: true})
+		unmarshalMatch(t, marshal(t, map[float64]string{1.5: "foo"}), &map[float64]string{}, map[float64]string{1.5: "foo"})
+		unmarshalMatch(t, marshal(t, map[bool]int64{true: 1}), &map[bool]int64{}, map[bool]int64{true: 1})
+		unmarshalMatch(t, marshal(t, map[[2]byte]string{{1, 2}: "foo"}), &map[[2]byte]string{}, map[[2]byte]string{{1, 2}: "foo"})
+		unmarshalMatch(t, marshal(t, map[color]string{"red": "foo"}), &map[color]string{}, map[color]string{"red": "foo"})
+	})
+	t.Run("bin keys into string keys", func(t *testing.T) {
+		b := []byte{msgpack.FixMap1.Byte(), msgpack.Bin8.Byte(), 3, 'f', 'o', 'o', 1}
+		unmarshalMatch(t, b, &map[string]int64{}, map[string]int64{"foo": 1})
+	})
+	t.Run("interface keys", func(t *testing.T) {
+		b := marshal(t, map[interface{}]interface{}{int64(1): "foo", "bar": true})
+		unmarshalMatch(t, b, &map[interface{}]interface{}{}, map[interface{}]interface{}{int64(1): "foo", "bar": true})
+	})
+	t.Run("WithNonStringMapKeys", func(t *testing.T) {
+		b := marshal(t, map[string]interface{}{"nested": map[int64]string{1: "foo"}})
+
+		var v interface{}
+		if !assert.Error(t, msgpack.Unmarshal(b, &v), "Unmarshal without the option should fail") {
+			return
+		}
+
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v, msgpack.WithNonStringMapKeys()), "Unmarshal should succeed") {
+			return
+		}
+		expected := map[string]interface{}{"nested": map[interface{}]interface{}{int64(1): "foo"}}
+		if !assert.Equal(t, expected, v, "string keyed maps should be map[string]interface{}") {
+			return
+		}
+	})
+	t.Run("unhashable key", func(t *testing.T) {
+		b := []byte{msgpack.FixMap1.Byte(), msgpack.FixArray1.Byte(), 1, 1}
+
+		var v interface{}
+		if !assert.Error(t, msgpack.Unmarshal(b, &v, msgpack.WithNonStringMapKeys()), "Unmarshal should fail") {
+			return
+		}
+	})
+	t.Run("unsupported key type", func(t *testing.T) {
+		_, err := msgpack.Marshal(map[*int]string{nil: "foo"})
+		if !assert.Error(t, err, "Marshal should fail") {
+			return
+		}
+	})
+}
+
 func TestDecodeNestedStruct(t *testing.T) {
 	t.Run("regular case", func(t *testing.T) {
 		var e *nestedOuter = &nestedOuter{
@@ -364,3 +615,867 @@ func TestDecodeNestedStruct(t *testing.T) {
 		}
 	})
 }
+
+func TestDecodeIntoExistingInterface(t *testing.T) {
+	b, err := msgpack.Marshal(dummyStruct{Message: "Hello, World!"})
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	t.Run("pointer in interface{}", func(t *testing.T) {
+		target := &dummyStruct{}
+		var v interface{} = target
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.True(t, v.(*dummyStruct) == target, "interface should still hold the original pointer") {
+			return
+		}
+		if !assert.Equal(t, "Hello, World!", target.Message, "value should be decoded in place") {
+			return
+		}
+	})
+	t.Run("non-pointer in interface{}", func(t *testing.T) {
+		var v interface{} = dummyStruct{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+		// Non-pointer values cannot be modified in place, so they are
+		// replaced by a new value of the same type
+		if !assert.Equal(t, dummyStruct{Message: "Hello, World!"}, v, "value should be replaced") {
+			return
+		}
+	})
+	t.Run("nil", func(t *testing.T) {
+		target := &dummyStruct{Message: "untouched"}
+		var v interface{} = target
+		if !assert.NoError(t, msgpack.Unmarshal([]byte{msgpack.Nil.Byte()}, &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Nil(t, v, "interface should be set to nil") {
+			return
+		}
+		if !assert.Equal(t, "untouched", target.Message, "original value should be untouched") {
+			return
+		}
+	})
+	t.Run("struct field", func(t *testing.T) {
+		type envelope struct {
+			Kind string
+			Body interface{}
+		}
+
+		b, err := msgpack.Marshal(envelope{Kind: "dummy", Body: dummyStruct{Message: "Hello, World!"}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		body := &dummyStruct{}
+		v := envelope{Body: body}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.True(t, v.Body.(*dummyStruct) == body, "field should still hold the original pointer") {
+			return
+		}
+		if !assert.Equal(t, "Hello, World!", body.Message, "value should be decoded in place") {
+			return
+		}
+	})
+}
+
+func TestDecodeReservedCode(t *testing.T) {
+	t.Run("typed error", func(t *testing.T) {
+		for _, v := range []interface{}{new(interface{}), new(int64), new(string), new([]byte), new(bool), new([]int), new(map[string]int), new(msgpack.Value)} {
+			dec := msgpack.NewDecoder(bytes.NewReader([]byte{0x01, 0xc1}))
+			var first int
+			if !assert.NoError(t, dec.Decode(&first), "Decode should succeed") {
+				return
+			}
+
+			err := dec.Decode(v)
+			rerr, ok := errors.Cause(err).(*msgpack.ReservedCodeError)
+			if !assert.True(t, ok, "error should be a ReservedCodeError for %T (got %v)", v, err) {
+				return
+			}
+			if !assert.Equal(t, int64(1), rerr.Offset, "offset should point to the reserved byte for %T", v) {
+				return
+			}
+		}
+	})
+	t.Run("resync", func(t *testing.T) {
+		dec := msgpack.NewDecoder(bytes.NewReader([]byte{0x01, 0xc1, 0xc1, 0xc1, 0x02}), msgpack.WithResyncOnReservedCode())
+
+		var v int
+		if !assert.NoError(t, dec.Decode(&v), "Decode should succeed") {
+			return
+		}
+		var iface interface{}
+		err := dec.Decode(&iface)
+		rerr, ok := errors.Cause(err).(*msgpack.ReservedCodeError)
+		if !assert.True(t, ok, "error should be a ReservedCodeError (got %v)", err) {
+			return
+		}
+		if !assert.Equal(t, 2, rerr.Skipped, "the following reserved bytes should be skipped") {
+			return
+		}
+		if !assert.NoError(t, dec.Decode(&v), "Decode should succeed after resync") {
+			return
+		}
+		if !assert.Equal(t, 2, v, "value after the reserved bytes should be decoded") {
+			return
+		}
+	})
+}
+
+func TestUnmarshalTrailingBytes(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03}
+	t.Run("default", func(t *testing.T) {
+		var v int
+		err := msgpack.Unmarshal(data, &v)
+		terr, ok := errors.Cause(err).(*msgpack.TrailingBytesError)
+		if !assert.True(t, ok, "error should be a TrailingBytesError (got %v)", err) {
+			return
+		}
+		if !assert.Equal(t, 2, terr.Count, "count should match") {
+			return
+		}
+	})
+	t.Run("WithAllowTrailingBytes", func(t *testing.T) {
+		var v int
+		if !assert.NoError(t, msgpack.Unmarshal(data, &v, msgpack.WithAllowTrailingBytes()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, 1, v, "value should match") {
+			return
+		}
+	})
+}
+
+func TestWithAllocator(t *testing.T) {
+	var requested []int
+	alloc := func(n int) []byte {
+		requested = append(requested, n)
+		return make([]byte, n, n+16)
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for _, v := range [][]byte{bytes.Repeat([]byte{'x'}, 10), bytes.Repeat([]byte{'y'}, 1000)} {
+		if !assert.NoError(t, enc.Encode(v), "Encode should succeed") {
+			return
+		}
+	}
+
+	dec := msgpack.NewDecoder(&buf, msgpack.WithAllocator(100, alloc))
+	var small []byte
+	if !assert.NoError(t, dec.Decode(&small), "Decode should succeed") {
+		return
+	}
+	var large interface{}
+	if !assert.NoError(t, dec.Decode(&large), "Decode should succeed") {
+		return
+	}
+	if !assert.Equal(t, []int{1000}, requested, "only the large payload should be allocated via the allocator") {
+		return
+	}
+	if !assert.Equal(t, bytes.Repeat([]byte{'y'}, 1000), large, "value should match") {
+		return
+	}
+
+	t.Run("allocator returns too little", func(t *testing.T) {
+		b, err := msgpack.Marshal(bytes.Repeat([]byte{'x'}, 10))
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var v []byte
+		err = msgpack.Unmarshal(b, &v, msgpack.WithAllocator(0, func(n int) []byte { return nil }))
+		if !assert.Error(t, err, "Unmarshal should fail") {
+			return
+		}
+	})
+}
+
+func TestDecodeFloatAsInteger(t *testing.T) {
+	double := func(f float64) []byte {
+		b := make([]byte, 9)
+		b[0] = msgpack.Double.Byte()
+		binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
+		return b
+	}
+
+	t.Run("integral values", func(t *testing.T) {
+		var i int
+		unmarshalMatch(t, double(3), &i, 3)
+		var u8 uint8
+		unmarshalMatch(t, double(255), &u8, uint8(255))
+		var i64 int64
+		unmarshalMatch(t, []byte{msgpack.Float.Byte(), 0xc0, 0x40, 0x00, 0x00}, &i64, int64(-3))
+	})
+	t.Run("lossy values", func(t *testing.T) {
+		inputs := []struct {
+			src []byte
+			v   interface{}
+		}{
+			{double(3.7), new(int)},
+			{double(-0.5), new(int64)},
+			{double(256), new(uint8)},
+			{double(-1), new(uint)},
+			{double(math.Ldexp(1, 63)), new(int64)},
+			{double(math.NaN()), new(int32)},
+			{double(math.Inf(1)), new(uint64)},
+		}
+		for _, input := range inputs {
+			err := msgpack.Unmarshal(input.src, input.v)
+			if !assert.Error(t, err, "Unmarshal into %T should fail", input.v) {
+				return
+			}
+			_, ok := errors.Cause(err).(*msgpack.LossyConversionError)
+			if !assert.True(t, ok, "error should be a LossyConversionError for %T (got %v)", input.v, err) {
+				return
+			}
+		}
+	})
+	t.Run("named types", func(t *testing.T) {
+		type count int
+		var c count
+		if !assert.Error(t, msgpack.Unmarshal(double(3.7), &c), "Unmarshal should fail") {
+			return
+		}
+		if !assert.NoError(t, msgpack.Unmarshal(double(3.7), &c, msgpack.WithTruncateFloats()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, count(3), c, "value should be truncated") {
+			return
+		}
+	})
+	t.Run("truncate", func(t *testing.T) {
+		inputs := []struct {
+			f        float64
+			expected int
+		}{
+			{3.7, 3},
+			{-3.7, -3},
+			{0.2, 0},
+		}
+		for _, input := range inputs {
+			var i int
+			if !assert.NoError(t, msgpack.Unmarshal(double(input.f), &i, msgpack.WithTruncateFloats()), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, input.expected, i, "value should be truncated") {
+				return
+			}
+		}
+
+		var u8 uint8
+		if !assert.Error(t, msgpack.Unmarshal(double(300.5), &u8, msgpack.WithTruncateFloats()), "out of range values should still fail") {
+			return
+		}
+	})
+}
+
+func TestDecodeBytesInto(t *testing.T) {
+	var src bytes.Buffer
+	enc := msgpack.NewEncoder(&src)
+	for _, v := range [][]byte{[]byte("foo"), bytes.Repeat([]byte{'x'}, 300), bytes.Repeat([]byte{'y'}, 70000)} {
+		if !assert.NoError(t, enc.EncodeBytes(v), "EncodeBytes should succeed") {
+			return
+		}
+	}
+	if !assert.NoError(t, enc.EncodeString("bar"), "EncodeString should succeed") {
+		return
+	}
+
+	dec := msgpack.NewDecoder(&src)
+	buf := make([]byte, 1024)
+
+	n, err := dec.DecodeBytesInto(buf)
+	if !assert.NoError(t, err, "DecodeBytesInto should succeed") {
+		return
+	}
+	if !assert.Equal(t, []byte("foo"), buf[:n], "value should match") {
+		return
+	}
+
+	n, err = dec.DecodeBytesInto(buf)
+	if !assert.NoError(t, err, "DecodeBytesInto should succeed") {
+		return
+	}
+	if !assert.Equal(t, bytes.Repeat([]byte{'x'}, 300), buf[:n], "value should match") {
+		return
+	}
+
+	// The buffer is too small: nothing should be consumed, so that the
+	// value can be read with a larger buffer
+	n, err = dec.DecodeBytesInto(buf)
+	if !assert.Equal(t, io.ErrShortBuffer, errors.Cause(err), "DecodeBytesInto should fail with io.ErrShortBuffer") {
+		return
+	}
+	if !assert.Equal(t, 70000, n, "the required length should be returned") {
+		return
+	}
+	buf = make([]byte, n)
+	n, err = dec.DecodeBytesInto(buf)
+	if !assert.NoError(t, err, "DecodeBytesInto should succeed") {
+		return
+	}
+	if !assert.Equal(t, bytes.Repeat([]byte{'y'}, 70000), buf[:n], "value should match") {
+		return
+	}
+
+	if _, err := dec.DecodeBytesInto(buf); !assert.Error(t, err, "DecodeBytesInto should fail for strings") {
+		return
+	}
+}
+
+func TestSkip(t *testing.T) {
+	var src bytes.Buffer
+	enc := msgpack.NewEncoder(&src)
+	values := []interface{}{
+		map[string]interface{}{"foo": []interface{}{int8(1), "bar", map[string]interface{}{"baz": nil}}},
+		bytes.Repeat([]byte{'x'}, 300),
+		time.Unix(1500000000, 5),
+		3.14,
+		"after",
+	}
+	for _, v := range values {
+		if !assert.NoError(t, enc.Encode(v), "Encode should succeed") {
+			return
+		}
+	}
+
+	dec := msgpack.NewDecoder(&src)
+	for i := 0; i < len(values)-1; i++ {
+		if !assert.NoError(t, dec.Skip(), "Skip should succeed for value %d", i) {
+			return
+		}
+	}
+
+	var s string
+	if !assert.NoError(t, dec.Decode(&s), "Decode should succeed") {
+		return
+	}
+	if !assert.Equal(t, "after", s, "the value after the skipped ones should be decoded") {
+		return
+	}
+	if !assert.Error(t, dec.Skip(), "Skip should fail at the end of the stream") {
+		return
+	}
+
+	truncated := msgpack.NewDecoder(bytes.NewReader([]byte{msgpack.FixArray2.Byte(), 0x01}))
+	if !assert.Error(t, truncated.Skip(), "Skip should fail for truncated values") {
+		return
+	}
+
+	// Deeply nested values do not exhaust the stack
+	deep := append(bytes.Repeat([]byte{msgpack.FixArray1.Byte()}, 1<<24), 0x01, msgpack.FixStr0.Byte()+1, 'x')
+	dec = msgpack.NewDecoder(bytes.NewReader(deep))
+	if !assert.NoError(t, dec.Skip(), "Skip should succeed for deeply nested values") {
+		return
+	}
+	if !assert.NoError(t, dec.Decode(&s), "Decode should succeed") || !assert.Equal(t, "x", s, "the value after the skipped one should be decoded") {
+		return
+	}
+
+	dec = msgpack.NewDecoder(bytes.NewReader(deep), msgpack.WithMaxDepth(100))
+	if !assert.Equal(t, msgpack.ErrMaxDepth, errors.Cause(dec.Skip()), "Skip should honor WithMaxDepth") {
+		return
+	}
+
+	// Skipping a value within the limit leaves the depth as it was
+	nested := []byte{msgpack.FixArray2.Byte(), msgpack.FixArray1.Byte(), msgpack.FixArray0.Byte(), msgpack.FixMap0.Byte()}
+	dec = msgpack.NewDecoder(bytes.NewReader(append(nested, nested...)), msgpack.WithMaxDepth(3))
+	for i := 0; i < 2; i++ {
+		if !assert.NoError(t, dec.Skip(), "Skip should succeed for value %d", i) {
+			return
+		}
+	}
+}
+
+func TestIsNextNil(t *testing.T) {
+	dec := msgpack.NewDecoder(bytes.NewReader([]byte{msgpack.Nil.Byte(), msgpack.FixStr0.Byte() + 1, 'x'}))
+
+	isNil, err := dec.IsNextNil()
+	if !assert.NoError(t, err, "IsNextNil should succeed") {
+		return
+	}
+	if !assert.True(t, isNil, "the first value should be nil") {
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		isNil, err = dec.IsNextNil()
+		if !assert.NoError(t, err, "IsNextNil should succeed") {
+			return
+		}
+		if !assert.False(t, isNil, "the second value should not be nil") {
+			return
+		}
+	}
+
+	var s string
+	if !assert.NoError(t, dec.DecodeString(&s), "non-nil values should not be consumed") {
+		return
+	}
+	if !assert.Equal(t, "x", s, "value should match") {
+		return
+	}
+
+	if _, err := dec.IsNextNil(); !assert.Error(t, err, "IsNextNil should fail at the end of the stream") {
+		return
+	}
+}
+
+func TestDecodeHeaders(t *testing.T) {
+	var data []byte
+	data = msgpack.AppendArrayHeader(data, 20)
+	for i := 0; i < 20; i++ {
+		data = msgpack.AppendInt(data, int64(i))
+	}
+	data = msgpack.AppendMapHeader(data, 1)
+	data = msgpack.AppendString(data, "foo")
+	data = msgpack.AppendString(data, "bar")
+	data = msgpack.AppendNil(data)
+	data = msgpack.AppendNil(data)
+	// An unregistered extension type, followed by a value to make sure
+	// that the payload can be discarded
+	data = msgpack.AppendExtHeader(data, 99, 3)
+	data = append(data, 1, 2, 3)
+	data = msgpack.AppendExtHeader(data, msgpack.TimestampExtType, 4)
+	data = append(data, 0, 0, 0, 1)
+	data = msgpack.AppendBool(data, true)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+
+	n, err := dec.DecodeArrayHeader()
+	if !assert.NoError(t, err, "DecodeArrayHeader should succeed") {
+		return
+	}
+	if !assert.Equal(t, 20, n, "array length should match") {
+		return
+	}
+	for i := 0; i < n; i++ {
+		var v int
+		if !assert.NoError(t, dec.Decode(&v), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, i, v, "element should match") {
+			return
+		}
+	}
+
+	n, err = dec.DecodeMapHeader()
+	if !assert.NoError(t, err, "DecodeMapHeader should succeed") {
+		return
+	}
+	if !assert.Equal(t, 1, n, "map length should match") {
+		return
+	}
+	var key, value string
+	if !assert.NoError(t, dec.DecodeString(&key), "DecodeString should succeed") {
+		return
+	}
+	if !assert.NoError(t, dec.DecodeString(&value), "DecodeString should succeed") {
+		return
+	}
+	if !assert.Equal(t, "foo", key, "key should match") || !assert.Equal(t, "bar", value, "value should match") {
+		return
+	}
+
+	n, err = dec.DecodeArrayHeader()
+	if !assert.NoError(t, err, "DecodeArrayHeader should succeed") || !assert.Equal(t, -1, n, "nil should be reported as -1") {
+		return
+	}
+	n, err = dec.DecodeMapHeader()
+	if !assert.NoError(t, err, "DecodeMapHeader should succeed") || !assert.Equal(t, -1, n, "nil should be reported as -1") {
+		return
+	}
+
+	typ, length, err := dec.DecodeExtHeader()
+	if !assert.NoError(t, err, "DecodeExtHeader should succeed") {
+		return
+	}
+	if !assert.Equal(t, 99, typ, "ext type should match") || !assert.Equal(t, 3, length, "ext length should match") {
+		return
+	}
+	if !assert.NoError(t, dec.Sub(length).Finish(), "payload should be discarded") {
+		return
+	}
+
+	typ, length, err = dec.DecodeExtHeader()
+	if !assert.NoError(t, err, "DecodeExtHeader should succeed") {
+		return
+	}
+	if !assert.Equal(t, msgpack.TimestampExtType, typ, "ext type should be signed") || !assert.Equal(t, 4, length, "ext length should match") {
+		return
+	}
+	if !assert.NoError(t, dec.Sub(length).Finish(), "payload should be discarded") {
+		return
+	}
+
+	var b bool
+	if !assert.NoError(t, dec.DecodeBool(&b), "DecodeBool should succeed") || !assert.True(t, b, "value should match") {
+		return
+	}
+
+	t.Run("invalid input", func(t *testing.T) {
+		dec := msgpack.NewDecoder(bytes.NewReader([]byte{msgpack.True.Byte()}))
+		if _, err := dec.DecodeArrayHeader(); !assert.Error(t, err, "DecodeArrayHeader should fail for a bool") {
+			return
+		}
+		dec = msgpack.NewDecoder(bytes.NewReader([]byte{msgpack.FixArray0.Byte()}))
+		if _, err := dec.DecodeMapHeader(); !assert.Error(t, err, "DecodeMapHeader should fail for an array") {
+			return
+		}
+		dec = msgpack.NewDecoder(bytes.NewReader([]byte{msgpack.FixExt1.Byte()}))
+		if _, _, err := dec.DecodeExtHeader(); !assert.Error(t, err, "DecodeExtHeader should fail without a type") {
+			return
+		}
+	})
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestMore(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for i := 0; i < 3; i++ {
+		if !assert.NoError(t, enc.Encode(map[string]int{"seq": i}), "Encode should succeed") {
+			return
+		}
+	}
+
+	dec := msgpack.NewDecoder(&buf)
+	var count int
+	for dec.More() {
+		var v map[string]int
+		if !assert.NoError(t, dec.Decode(&v), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, count, v["seq"], "values should be read in order") {
+			return
+		}
+		count++
+	}
+	if !assert.Equal(t, 3, count, "all values should be read") {
+		return
+	}
+
+	var v interface{}
+	if !assert.Equal(t, io.EOF, dec.Decode(&v), "Decode should return io.EOF at the end of the stream") {
+		return
+	}
+
+	t.Run("empty stream", func(t *testing.T) {
+		dec := msgpack.NewDecoder(bytes.NewReader(nil))
+		if !assert.False(t, dec.More(), "More should return false") {
+			return
+		}
+		var v interface{}
+		if !assert.Equal(t, io.EOF, dec.Decode(&v), "Decode should return io.EOF") {
+			return
+		}
+	})
+	t.Run("truncated value", func(t *testing.T) {
+		dec := msgpack.NewDecoder(bytes.NewReader([]byte{msgpack.FixArray2.Byte(), 0x01}))
+		if !assert.True(t, dec.More(), "More should return true") {
+			return
+		}
+		var v interface{}
+		err := dec.Decode(&v)
+		if !assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err), "Decode should return io.ErrUnexpectedEOF (got %v)", err) {
+			return
+		}
+	})
+	t.Run("read error", func(t *testing.T) {
+		readErr := errors.New("read failed")
+		dec := msgpack.NewDecoder(&failingReader{err: readErr})
+		if !assert.False(t, dec.More(), "More should return false") {
+			return
+		}
+		var v interface{}
+		if !assert.Equal(t, readErr, errors.Cause(dec.Decode(&v)), "Decode should report the error") {
+			return
+		}
+	})
+}
+
+type pointerInner struct {
+	A int `msgpack:"a"`
+}
+
+type pointerOuter struct {
+	Int    **int            `msgpack:"int"`
+	String ***string        `msgpack:"string"`
+	Struct **pointerInner   `msgpack:"struct"`
+	Deep   ***pointerInner  `msgpack:"deep"`
+	List   []**int          `msgpack:"list"`
+	Map    map[string]**int `msgpack:"map"`
+}
+
+func TestDecodePointers(t *testing.T) {
+	t.Run("top-level", func(t *testing.T) {
+		b, err := msgpack.Marshal(5)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var v ***int
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, 5, ***v, "value should match") {
+			return
+		}
+
+		b, err = msgpack.Marshal(pointerInner{A: 1})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var s **pointerInner
+		if !assert.NoError(t, msgpack.Unmarshal(b, &s), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, pointerInner{A: 1}, **s, "value should match") {
+			return
+		}
+	})
+	t.Run("nested", func(t *testing.T) {
+		b, err := msgpack.Marshal(map[string]interface{}{
+			"int":    1,
+			"string": "foo",
+			"struct": map[string]interface{}{"a": 2},
+			"deep":   map[string]interface{}{"a": 3},
+			"list":   []interface{}{4, nil},
+			"map":    map[string]interface{}{"five": 5, "none": nil},
+		})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var v pointerOuter
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, 1, **v.Int, "int should match") {
+			return
+		}
+		if !assert.Equal(t, "foo", ***v.String, "string should match") {
+			return
+		}
+		if !assert.Equal(t, 2, (**v.Struct).A, "struct should match") {
+			return
+		}
+		if !assert.Equal(t, 3, (***v.Deep).A, "deep struct should match") {
+			return
+		}
+		if !assert.Len(t, v.List, 2, "list should have 2 elements") || !assert.Equal(t, 4, **v.List[0], "list element should match") || !assert.Nil(t, v.List[1], "nil list element should be nil") {
+			return
+		}
+		if !assert.Equal(t, 5, **v.Map["five"], "map value should match") || !assert.Nil(t, v.Map["none"], "nil map value should be nil") {
+			return
+		}
+
+		var arr [2]**int
+		b, err = msgpack.Marshal([]int{6, 7})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &arr), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []int{6, 7}, []int{**arr[0], **arr[1]}, "array elements should match") {
+			return
+		}
+	})
+	t.Run("existing pointers", func(t *testing.T) {
+		b, err := msgpack.Marshal(5)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		x := 1
+		px := &x
+		v := &px
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, 5, x, "existing value should be reused") {
+			return
+		}
+
+		b, err = msgpack.Marshal(nil)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Nil(t, v, "nil should clear the pointer") {
+			return
+		}
+	})
+}
+
+type strictInt8 int8
+
+type strictString string
+
+func TestDecoderOptions(t *testing.T) {
+	t.Run("WithStrictTypes", func(t *testing.T) {
+		b, err := msgpack.Marshal(3.0)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var i int
+		if !assert.NoError(t, msgpack.Unmarshal(b, &i), "Unmarshal without option should succeed") || !assert.Equal(t, 3, i, "value should match") {
+			return
+		}
+		err = msgpack.Unmarshal(b, &i, msgpack.WithStrictTypes())
+		if _, ok := errors.Cause(err).(*msgpack.StrictTypeError); !assert.True(t, ok, "float into int should be a StrictTypeError (got %v)", err) {
+			return
+		}
+
+		b, err = msgpack.Marshal(int64(300))
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var n strictInt8
+		err = msgpack.Unmarshal(b, &n, msgpack.WithStrictTypes())
+		if _, ok := errors.Cause(err).(*msgpack.StrictTypeError); !assert.True(t, ok, "overflowing integer should be a StrictTypeError (got %v)", err) {
+			return
+		}
+		var s strictString
+		err = msgpack.Unmarshal(b, &s, msgpack.WithStrictTypes())
+		if _, ok := errors.Cause(err).(*msgpack.StrictTypeError); !assert.True(t, ok, "integer into string should be a StrictTypeError (got %v)", err) {
+			return
+		}
+
+		b, err = msgpack.Marshal(int64(100))
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &n, msgpack.WithStrictTypes()), "integer that fits should be accepted") || !assert.Equal(t, strictInt8(100), n, "value should match") {
+			return
+		}
+		var v interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v, msgpack.WithStrictTypes()), "anything should be accepted into interface{}") {
+			return
+		}
+	})
+	t.Run("WithInterfaceIntsAsInt64", func(t *testing.T) {
+		b, err := msgpack.Marshal([]interface{}{int8(1), int16(-200), uint32(70000), uint64(math.MaxUint64), -5, 1.5})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var v []interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v, msgpack.WithInterfaceIntsAsInt64()), "Unmarshal should succeed") {
+			return
+		}
+		expected := []interface{}{int64(1), int64(-200), int64(70000), uint64(math.MaxUint64), int64(-5), 1.5}
+		if !assert.Equal(t, expected, v, "integers should be int64") {
+			return
+		}
+	})
+	t.Run("WithMaxDepth", func(t *testing.T) {
+		b, err := msgpack.Marshal(map[string]interface{}{"a": []interface{}{[]interface{}{1}}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var v interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v, msgpack.WithMaxDepth(3)), "value within the limit should be accepted") {
+			return
+		}
+		err = msgpack.Unmarshal(b, &v, msgpack.WithMaxDepth(2))
+		if !assert.Equal(t, msgpack.ErrMaxDepth, errors.Cause(err), "value over the limit should be rejected") {
+			return
+		}
+		var value msgpack.Value
+		err = msgpack.Unmarshal(b, &value, msgpack.WithMaxDepth(2))
+		if !assert.Equal(t, msgpack.ErrMaxDepth, errors.Cause(err), "value over the limit should be rejected by DecodeValue") {
+			return
+		}
+
+		// Pointers do not count as levels
+		b, err = msgpack.Marshal([]pointerInner{{A: 1}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var list []**pointerInner
+		if !assert.NoError(t, msgpack.Unmarshal(b, &list, msgpack.WithMaxDepth(2)), "Unmarshal should succeed") || !assert.Equal(t, 1, (**list[0]).A, "value should match") {
+			return
+		}
+
+		// The decoder is usable again after a value within the limit
+		dec := msgpack.NewDecoder(bytes.NewReader(append(b, b...)), msgpack.WithMaxDepth(2))
+		for i := 0; i < 2; i++ {
+			if !assert.NoError(t, dec.Decode(&list), "Decode should succeed") {
+				return
+			}
+		}
+
+		// Values that are skipped count as well, so that they cannot
+		// exhaust the stack either
+		deep := append([]byte{0x81, 0xa1, 'B'}, bytes.Repeat([]byte{0x91}, 1<<24)...)
+		var known struct{ A int }
+		err = msgpack.Unmarshal(deep, &known, msgpack.WithMaxDepth(100))
+		if !assert.Equal(t, msgpack.ErrMaxDepth, errors.Cause(err), "deeply nested unknown field should be rejected") {
+			return
+		}
+	})
+	t.Run("WithDisallowUnknownFields", func(t *testing.T) {
+		b, err := msgpack.Marshal(map[string]interface{}{"a": 1, "b": 2})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var v pointerInner
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal without option should succeed") {
+			return
+		}
+		err = msgpack.Unmarshal(b, &v, msgpack.WithDisallowUnknownFields())
+		uerr, ok := errors.Cause(err).(*msgpack.UnknownFieldError)
+		if !assert.True(t, ok, "error should be an UnknownFieldError (got %v)", err) {
+			return
+		}
+		if !assert.Equal(t, "b", uerr.Field, "field should match") || !assert.Equal(t, reflect.TypeOf(v), uerr.Type, "type should match") {
+			return
+		}
+	})
+}
+
+func TestInvalidDecodeTarget(t *testing.T) {
+	var nilPtr *dummyStruct
+	testcases := []struct {
+		Name     string
+		Target   interface{}
+		Type     reflect.Type
+		Contains string
+	}{
+		{Name: "nil", Target: nil, Type: nil, Contains: "such as &v"},
+		{Name: "non-pointer", Target: dummyStruct{}, Type: reflect.TypeOf(dummyStruct{}), Contains: "non-pointer"},
+		{Name: "nil pointer", Target: nilPtr, Type: reflect.TypeOf(nilPtr), Contains: "new(msgpack_test.dummyStruct)"},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			err := msgpack.Unmarshal([]byte{0x01}, tc.Target)
+			ierr, ok := errors.Cause(err).(*msgpack.InvalidDecodeError)
+			if !assert.True(t, ok, "error should be an InvalidDecodeError (got %v)", err) {
+				return
+			}
+			if !assert.Equal(t, tc.Type, ierr.Type, "type should match") {
+				return
+			}
+			if !assert.Contains(t, ierr.Error(), tc.Contains, "message should suggest a fix") {
+				return
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package msgpack_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveEcho accepts a single connection on l, and echoes back one
+// message
+func serveEcho(t *testing.T, l net.Listener) {
+	go func() {
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn := msgpack.NewConn(nc)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var v interface{}
+		if err := conn.Recv(ctx, &v); err != nil {
+			t.Logf("server failed to receive: %s", err)
+			return
+		}
+		if err := conn.Send(ctx, v); err != nil {
+			t.Logf("server failed to send: %s", err)
+		}
+	}()
+}
+
+func testEcho(t *testing.T, dial msgpack.DialFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rw, err := dial(ctx)
+	if !assert.NoError(t, err, "dial should succeed") {
+		return
+	}
+	conn := msgpack.NewConn(rw)
+	defer conn.Close()
+
+	if !assert.NoError(t, conn.Send(ctx, "hello"), "Send should succeed") {
+		return
+	}
+	var s string
+	if !assert.NoError(t, conn.Recv(ctx, &s), "Recv should succeed") {
+		return
+	}
+	if !assert.Equal(t, "hello", s, "message should be echoed back") {
+		return
+	}
+}
+
+func selfSignedCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestDialers(t *testing.T) {
+	t.Run("TCP", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err, "Listen should succeed") {
+			return
+		}
+		defer l.Close()
+		serveEcho(t, l)
+
+		testEcho(t, msgpack.TCPDialer(l.Addr().String(), msgpack.WithDialTimeout(time.Second)))
+	})
+	t.Run("Unix", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "msgpack-dial")
+		if !assert.NoError(t, err, "TempDir should succeed") {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "sock")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Skipf("Unix domain sockets are not available: %s", err)
+		}
+		defer l.Close()
+		serveEcho(t, l)
+
+		testEcho(t, msgpack.UnixDialer(path))
+	})
+	t.Run("TLS with client certificate", func(t *testing.T) {
+		cert, pool := selfSignedCertificate(t)
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+		})
+		if !assert.NoError(t, err, "Listen should succeed") {
+			return
+		}
+		defer l.Close()
+		serveEcho(t, l)
+
+		testEcho(t, msgpack.TLSDialer(l.Addr().String(), &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+		}))
+	})
+	t.Run("TLS with untrusted server", func(t *testing.T) {
+		cert, _ := selfSignedCertificate(t)
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+		if !assert.NoError(t, err, "Listen should succeed") {
+			return
+		}
+		defer l.Close()
+		go func() {
+			if nc, err := l.Accept(); err == nil {
+				nc.(*tls.Conn).Handshake()
+				nc.Close()
+			}
+		}()
+
+		_, err = msgpack.TLSDialer(l.Addr().String(), nil)(context.Background())
+		if !assert.Error(t, err, "handshake should fail") {
+			return
+		}
+	})
+}
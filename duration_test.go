@@ -0,0 +1,120 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration(t *testing.T) {
+	encode := func(v interface{}, options ...msgpack.Option) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := msgpack.NewEncoder(&buf, options...).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	t.Run("nanoseconds", func(t *testing.T) {
+		b, err := encode(1500 * time.Millisecond)
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+
+		var nanos int64
+		if !assert.NoError(t, msgpack.Unmarshal(b, &nanos), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, int64(1500000000), nanos, "value should be in nanoseconds") {
+			return
+		}
+
+		var decoded time.Duration
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, 1500*time.Millisecond, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("seconds", func(t *testing.T) {
+		b, err := encode(1500*time.Millisecond, msgpack.WithDurationAsSeconds())
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+
+		var seconds float64
+		if !assert.NoError(t, msgpack.Unmarshal(b, &seconds), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, 1.5, seconds, "value should be in seconds") {
+			return
+		}
+
+		var decoded time.Duration
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, 1500*time.Millisecond, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("struct field", func(t *testing.T) {
+		type job struct {
+			Name    string
+			Timeout time.Duration
+		}
+		v := job{Name: "foo", Timeout: -3 * time.Second}
+
+		for _, options := range [][]msgpack.Option{nil, {msgpack.WithDurationAsSeconds()}} {
+			b, err := encode(v, options...)
+			if !assert.NoError(t, err, "Encode should succeed") {
+				return
+			}
+
+			var decoded job
+			if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, v, decoded, "values should match") {
+				return
+			}
+		}
+	})
+	t.Run("foreign encodings", func(t *testing.T) {
+		inputs := []struct {
+			src      []byte
+			expected time.Duration
+		}{
+			{[]byte{0x05}, 5},
+			{[]byte{msgpack.Uint32.Byte(), 0x3b, 0x9a, 0xca, 0x00}, time.Second},
+			{[]byte{msgpack.Int8.Byte(), 0xfe}, -2},
+			{[]byte{msgpack.Float.Byte(), 0x3f, 0x00, 0x00, 0x00}, 500 * time.Millisecond},
+		}
+		for _, input := range inputs {
+			var decoded time.Duration
+			if !assert.NoError(t, msgpack.Unmarshal(input.src, &decoded), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, input.expected, decoded, "values should match") {
+				return
+			}
+		}
+	})
+	t.Run("out of range", func(t *testing.T) {
+		inputs := [][]byte{
+			{msgpack.Uint64.Byte(), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			{msgpack.Double.Byte(), 0x7f, 0xf0, 0, 0, 0, 0, 0, 0},
+			{msgpack.Double.Byte(), 0x7f, 0xf8, 0, 0, 0, 0, 0, 1},
+		}
+		for _, src := range inputs {
+			var decoded time.Duration
+			if !assert.Error(t, msgpack.Unmarshal(src, &decoded), "Unmarshal should fail") {
+				return
+			}
+		}
+	})
+}
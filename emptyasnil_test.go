@@ -0,0 +1,97 @@
+package msgpack_test
+
+import (
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type emptyAsNilTagged struct {
+	Name    *string    `msgpack:"name,emptyasnil"`
+	Deleted *time.Time `msgpack:"deleted,emptyasnil"`
+	Plain   *string    `msgpack:"plain"`
+}
+
+type emptyAsNilUntagged struct {
+	Name    *string    `msgpack:"name"`
+	Deleted *time.Time `msgpack:"deleted"`
+}
+
+func TestEmptyAsNil(t *testing.T) {
+	// What a PHP producer might send
+	data, err := msgpack.Marshal(map[string]interface{}{
+		"name":    "",
+		"deleted": "",
+		"plain":   "",
+	})
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	t.Run("tag", func(t *testing.T) {
+		var v emptyAsNilTagged
+		if !assert.NoError(t, msgpack.Unmarshal(data, &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Nil(t, v.Name, "empty string should be nil") {
+			return
+		}
+		if !assert.Nil(t, v.Deleted, "empty string should be a nil time") {
+			return
+		}
+		if !assert.NotNil(t, v.Plain, "untagged field should not be nil") {
+			return
+		}
+
+		// nil pointers are written as "" and the zero time
+		encoded, err := msgpack.Marshal(emptyAsNilTagged{})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		var m map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(encoded, &m), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, "", m["name"], "nil should be encoded as an empty string") {
+			return
+		}
+		if !assert.Nil(t, m["plain"], "untagged nil should be encoded as nil") {
+			return
+		}
+
+		var v2 emptyAsNilTagged
+		if !assert.NoError(t, msgpack.Unmarshal(encoded, &v2), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Nil(t, v2.Deleted, "zero time should be nil") {
+			return
+		}
+	})
+	t.Run("WithEmptyAsNil", func(t *testing.T) {
+		data, err := msgpack.Marshal(map[string]interface{}{"name": "", "deleted": time.Time{}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var v emptyAsNilUntagged
+		if !assert.NoError(t, msgpack.Unmarshal(data, &v, msgpack.WithEmptyAsNil()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Nil(t, v.Name, "empty string should be nil") {
+			return
+		}
+		if !assert.Nil(t, v.Deleted, "zero time should be nil") {
+			return
+		}
+
+		name := "alice"
+		if !assert.NoError(t, msgpack.Unmarshal([]byte{0x81, 0xa4, 'n', 'a', 'm', 'e', 0xa5, 'a', 'l', 'i', 'c', 'e'}, &v, msgpack.WithEmptyAsNil()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, &name, v.Name, "non-empty string should be kept") {
+			return
+		}
+	})
+}
@@ -1,41 +1,118 @@
 package msgpack
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
 // NewEncoder creates a new Encoder that writes serialized forms
-// to the specified io.Writer
+// to the specified io.Writer, configured with the given options
 //
 // Note that Encoders are NEVER meant to be shared concurrently
 // between goroutines. You DO NOT write serialized data concurrently
 // to the same destination.
-func NewEncoder(w io.Writer) *Encoder {
-	var dst Writer
+func NewEncoder(w io.Writer, options ...Option) *Encoder {
+	e := &Encoder{
+		options: newOptions(options),
+	}
+	e.Reset(w)
+	return e
+}
+
+// Reset makes the Encoder write to w, keeping its configuration. This
+// allows an Encoder to be reused instead of allocating a new one for
+// every destination, see also GetEncoder
+func (e *Encoder) Reset(w io.Writer) {
+	e.profiling = false
+	e.guarding = false
+	e.poisoned = nil
 	if x, ok := w.(Writer); ok {
-		dst = x
-	} else {
-		dst = NewWriter(w)
+		e.dst = x
+		return
 	}
 
-	return &Encoder{
-		dst: dst,
+	if e.own == nil {
+		e.own = NewWriter(w).(*writer)
+	} else {
+		e.own.dst = w
 	}
+	e.dst = e.own
+}
+
+// Options returns a snapshot of the configuration of this Encoder
+func (e *Encoder) Options() Options {
+	return e.options.clone()
 }
 
 func inPositiveFixNumRange(i int64) bool {
-	return i >= 0 && i <= 127
+	return i >= 0 && i <= MaxPositiveFixInt
 }
 
 func inNegativeFixNumRange(i int64) bool {
-	return i >= -31 && i <= -1
+	return i >= MinNegativeFixInt && i <= -1
+}
+
+// EncodeCompactInt encodes v in the smallest representation that holds
+// it: a fixnum, or Int8, Int16, Int32 or Int64. Unlike EncodeInt64,
+// which always writes the full width, the code depends on the value.
+// Non-negative values are not converted to the uint family, so that
+// they can be decoded back into signed types
+func (e *Encoder) EncodeCompactInt(v int64) error {
+	if err := e.encodeCompactInt(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write compact int`)
+	}
+	return nil
+}
+
+// EncodeCompactUint encodes v in the smallest representation that
+// holds it: a positive fixnum, or Uint8, Uint16, Uint32 or Uint64
+func (e *Encoder) EncodeCompactUint(v uint64) error {
+	if err := e.encodeCompactUint(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write compact uint`)
+	}
+	return nil
+}
+
+func (e *Encoder) encodeCompactInt(v int64) error {
+	switch {
+	case inPositiveFixNumRange(v):
+		return e.encodePositiveFixNum(uint8(v))
+	case inNegativeFixNumRange(v):
+		return e.encodeNegativeFixNum(int8(v))
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return e.dst.WriteByteUint8(Int8.Byte(), uint8(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return e.dst.WriteByteUint16(Int16.Byte(), uint16(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return e.dst.WriteByteUint32(Int32.Byte(), uint32(v))
+	default:
+		return e.dst.WriteByteUint64(Int64.Byte(), uint64(v))
+	}
+}
+
+func (e *Encoder) encodeCompactUint(v uint64) error {
+	switch {
+	case v <= uint64(MaxPositiveFixNum):
+		return e.encodePositiveFixNum(uint8(v))
+	case v <= math.MaxUint8:
+		return e.dst.WriteByteUint8(Uint8.Byte(), uint8(v))
+	case v <= math.MaxUint16:
+		return e.dst.WriteByteUint16(Uint16.Byte(), uint16(v))
+	case v <= math.MaxUint32:
+		return e.dst.WriteByteUint32(Uint32.Byte(), uint32(v))
+	default:
+		return e.dst.WriteByteUint64(Uint64.Byte(), v)
+	}
 }
 
 func isExtType(t reflect.Type) (int, bool) {
@@ -53,11 +130,20 @@ func isEncodeMsgpacker(t reflect.Type) bool {
 	return t.Implements(encodeMsgpackerType)
 }
 
+// Writer returns the Writer that the Encoder writes to. Bytes written
+// to it directly end up in the output as is, such as the payload that
+// follows EncodeStringHeader
 func (e *Encoder) Writer() Writer {
 	return e.dst
 }
 
 func (e *Encoder) encodeBuiltin(v interface{}) (error, bool) {
+	if e.options.CompactInts {
+		if err, ok := e.encodeCompactBuiltin(v); ok {
+			return err, true
+		}
+	}
+
 	switch v := v.(type) {
 	case string:
 		return e.EncodeString(v), true
@@ -89,12 +175,60 @@ func (e *Encoder) encodeBuiltin(v interface{}) (error, bool) {
 		return e.EncodeInt32(v), true
 	case int64:
 		return e.EncodeInt64(v), true
+	case time.Duration:
+		return e.EncodeDuration(v), true
+	case map[string]interface{}:
+		return e.encodeMapInterface(v), true
+	case json.RawMessage, json.Number, map[string]json.RawMessage:
+		return e.EncodeJSONValue(v), true
+	case *sync.Map:
+		return e.EncodeSyncMap(v), true
+	case *atomic.Value:
+		return e.EncodeAtomicValue(v), true
+	case Snapshotter:
+		return e.Encode(v.MsgpackSnapshot()), true
 	}
 
 	return nil, false
 }
 
+// encodeCompactBuiltin writes v in the smallest representation that
+// holds it, if it is an integer. See WithCompactInts
+func (e *Encoder) encodeCompactBuiltin(v interface{}) (error, bool) {
+	switch v := v.(type) {
+	case int:
+		return e.EncodeCompactInt(int64(v)), true
+	case int8:
+		return e.EncodeCompactInt(int64(v)), true
+	case int16:
+		return e.EncodeCompactInt(int64(v)), true
+	case int32:
+		return e.EncodeCompactInt(int64(v)), true
+	case int64:
+		return e.EncodeCompactInt(v), true
+	case uint:
+		return e.EncodeCompactUint(uint64(v)), true
+	case uint8:
+		return e.EncodeCompactUint(uint64(v)), true
+	case uint16:
+		return e.EncodeCompactUint(uint64(v)), true
+	case uint32:
+		return e.EncodeCompactUint(uint64(v)), true
+	case uint64:
+		return e.EncodeCompactUint(v), true
+	}
+	return nil, false
+}
+
 func (e *Encoder) Encode(v interface{}) error {
+	if (e.options.RollbackBufferSize > 0 || e.options.PoisonOnPartialValue) && !e.guarding {
+		return e.encodeGuarded(v)
+	}
+
+	if e.options.Profiler != nil && !e.profiling {
+		return e.encodeProfiled(v)
+	}
+
 	if err, ok := e.encodeBuiltin(v); ok {
 		return err
 	}
@@ -107,19 +241,41 @@ func (e *Encoder) Encode(v interface{}) error {
 		}
 	}
 
+	// MsgpackFielder may be implemented with a pointer receiver, in
+	// which case we need to remember it before we dereference rv
+	var fielder MsgpackFielder
 INDIRECT:
 	for {
 		if !rv.IsValid() {
 			return e.EncodeNil()
 		}
 
+		if fielder == nil && rv.Type().Implements(msgpackFielderType) && (rv.Kind() != reflect.Ptr || !rv.IsNil()) {
+			fielder = rv.Interface().(MsgpackFielder)
+		}
+
 		if _, ok := isExtType(rv.Type()); ok {
 			return e.EncodeExt(rv.Interface().(EncodeMsgpacker))
 		}
 
+		// A pointer to an extension type also implements EncodeMsgpacker,
+		// but it needs the extension header, so it must be dereferenced
+		// before we check for EncodeMsgpacker
+		if rv.Kind() == reflect.Ptr {
+			if _, ok := isExtType(rv.Type().Elem()); ok {
+				rv = rv.Elem()
+				continue
+			}
+		}
+
 		if ok := isEncodeMsgpacker(rv.Type()); ok {
 			return rv.Interface().(EncodeMsgpacker).EncodeMsgpack(e)
 		}
+
+		if err, ok := e.encodeForeign(rv); ok {
+			return err
+		}
+
 		switch rv.Kind() {
 		case reflect.Ptr, reflect.Interface:
 			rv = rv.Elem()
@@ -136,9 +292,17 @@ INDIRECT:
 	switch rv.Kind() {
 	case reflect.Slice:
 		return e.EncodeArray(v)
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && !e.options.ByteArrayAsArray {
+			return e.encodeByteArray(rv)
+		}
+		return e.EncodeArray(v)
 	case reflect.Map:
 		return e.EncodeMap(v)
 	case reflect.Struct:
+		if fielder != nil {
+			return e.encodeStruct(rv, fielder)
+		}
 		return e.EncodeStruct(v)
 	}
 
@@ -167,10 +331,10 @@ func (e *Encoder) EncodeBool(b bool) error {
 	return e.dst.WriteByte(code.Byte())
 }
 
+// EncodePositiveFixNum writes i as a single byte positive FixNum. An
+// error is returned, and nothing is written, if i is larger than 127
 func (e *Encoder) EncodePositiveFixNum(i uint8) error {
-	panic(fmt.Sprintf("fuck fixnum i = %d, max = %d", i, uint8(MaxPositiveFixNum)))
-
-	if i > uint8(MaxPositiveFixNum) || i < 0 {
+	if i > uint8(MaxPositiveFixNum) {
 		return errors.Errorf(`msgpack: value %d is not in range for positive FixNum (127 >= x >= 0)`, i)
 	}
 
@@ -181,8 +345,8 @@ func (e *Encoder) EncodePositiveFixNum(i uint8) error {
 }
 
 func (e *Encoder) EncodeNegativeFixNum(i int8) error {
-	if i < -31 || i >= 0 {
-		return errors.Errorf(`msgpack: value %d is not in range for positive FixNum (0 > x >= -31)`, i)
+	if i < -32 || i >= 0 {
+		return errors.Errorf(`msgpack: value %d is not in range for negative FixNum (0 > x >= -32)`, i)
 	}
 
 	if err := e.dst.WriteByte(byte(i)); err != nil {
@@ -194,6 +358,18 @@ func (e *Encoder) EncodeNegativeFixNum(i int8) error {
 func (e *Encoder) EncodeBytes(b []byte) error {
 	l := len(b)
 
+	// The old specification has no Bin family, so byte slices are
+	// written as raw, just like strings
+	if e.options.LegacyRaw {
+		if err := e.writeStrHeader(l); err != nil {
+			return errors.Wrap(err, `msgpack: failed to write []byte preamble`)
+		}
+		if _, err := e.dst.Write(b); err != nil {
+			return errors.Wrap(err, `msgpack: failed to write []byte payload`)
+		}
+		return nil
+	}
+
 	var w int
 	var code Code
 	switch {
@@ -203,7 +379,7 @@ func (e *Encoder) EncodeBytes(b []byte) error {
 	case l <= math.MaxUint16:
 		code = Bin16
 		w = 2
-	case l <= math.MaxUint32:
+	case int64(l) <= math.MaxUint32:
 		code = Bin32
 		w = 4
 	default:
@@ -213,30 +389,74 @@ func (e *Encoder) EncodeBytes(b []byte) error {
 	if err := e.writePreamble(code, w, l); err != nil {
 		return errors.Wrap(err, `msgpack: failed to write []byte preamble`)
 	}
-	e.dst.Write(b)
+	if _, err := e.dst.Write(b); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write []byte payload`)
+	}
 	return nil
 }
 
+// encodeByteArray writes rv, a [N]byte, as Bin
+func (e *Encoder) encodeByteArray(rv reflect.Value) error {
+	if rv.CanAddr() {
+		return e.EncodeBytes(rv.Slice(0, rv.Len()).Bytes())
+	}
+
+	b := make([]byte, rv.Len())
+	reflect.Copy(reflect.ValueOf(b), rv)
+	return e.EncodeBytes(b)
+}
+
 func (e *Encoder) EncodeString(s string) error {
-	l := len(s)
+	if err := e.writeStrHeader(len(s)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write string preamble`)
+	}
+
+	if _, err := e.dst.WriteString(s); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write string payload`)
+	}
+	return nil
+}
+
+// EncodeStringHeader writes the header of a string of n bytes. The n
+// bytes of the string must then be written to Writer, which allows a
+// string whose length is known upfront, such as a rendered template or
+// a file, to be streamed into the output instead of being built in
+// memory first:
+//
+//	if err := enc.EncodeStringHeader(int(fi.Size())); err != nil {
+//		return err
+//	}
+//	if _, err := io.CopyN(enc.Writer(), f, fi.Size()); err != nil {
+//		return err
+//	}
+//
+// Writing fewer or more than n bytes corrupts the output
+func (e *Encoder) EncodeStringHeader(n int) error {
+	if n < 0 {
+		return errors.Errorf(`msgpack: invalid string length %d`, n)
+	}
+	if err := e.writeStrHeader(n); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write string preamble`)
+	}
+	return nil
+}
+
+// writeStrHeader writes the code and the length of a string of l bytes.
+// Str8 does not exist in the old specification, so with WithLegacyRaw,
+// strings that do not fit in a FixStr use Str16 (raw16) instead
+func (e *Encoder) writeStrHeader(l int) error {
 	switch {
-	case l < 32:
-		e.dst.WriteByte(FixStr0.Byte() | uint8(l))
-	case l <= math.MaxUint8:
-		e.dst.WriteByte(Str8.Byte())
-		e.dst.WriteUint8(uint8(l))
+	case l <= MaxFixStrLen:
+		return e.dst.WriteByte(FixStr0.Byte() | uint8(l))
+	case l <= math.MaxUint8 && !e.options.LegacyRaw:
+		return e.dst.WriteByteUint8(Str8.Byte(), uint8(l))
 	case l <= math.MaxUint16:
-		e.dst.WriteByte(Str16.Byte())
-		e.dst.WriteUint16(uint16(l))
-	case l <= math.MaxUint32:
-		e.dst.WriteByte(Str32.Byte())
-		e.dst.WriteUint32(uint32(l))
+		return e.dst.WriteByteUint16(Str16.Byte(), uint16(l))
+	case int64(l) <= math.MaxUint32:
+		return e.dst.WriteByteUint32(Str32.Byte(), uint32(l))
 	default:
 		return errors.Errorf(`msgpack: string is too long (len=%d)`, l)
 	}
-
-	e.dst.WriteString(s)
-	return nil
 }
 
 func (e *Encoder) writePreamble(code Code, w int, l int) error {
@@ -276,13 +496,33 @@ func (e *Encoder) EncodeArray(v interface{}) error {
 		return errors.Errorf(`msgpack: argument must be an array or a slice`)
 	}
 
+	if e.options.NilEmptyCollections && rv.Kind() == reflect.Slice && rv.Len() == 0 {
+		return e.EncodeNil()
+	}
+
 	if err := e.EncodeArrayHeader(rv.Len()); err != nil {
 		return err
 	}
 
+	// The fast paths below only apply to slices
+	if rv.Kind() == reflect.Array {
+		return e.encodeArrayElements(rv)
+	}
+
 	switch rv.Type().Elem().Kind() {
 	case reflect.String:
-		return e.encodeArrayString(rv.Convert(reflect.TypeOf([]string{})).Interface())
+		if l, ok := v.([]string); ok {
+			return e.encodeArrayString(l)
+		}
+		// Named string slice types (e.g. type list []string). Avoid
+		// reflect.Value.Convert on slices, as it is not available on
+		// all platforms (e.g. TinyGo)
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.EncodeString(rv.Index(i).String()); err != nil {
+				return errors.Wrapf(err, `failed to encode value for element %d`, i)
+			}
+		}
+		return nil
 	case reflect.Bool:
 		return e.encodeArrayBool(v)
 	case reflect.Int:
@@ -311,6 +551,10 @@ func (e *Encoder) EncodeArray(v interface{}) error {
 		return e.encodeArrayFloat64(v)
 	}
 
+	return e.encodeArrayElements(rv)
+}
+
+func (e *Encoder) encodeArrayElements(rv reflect.Value) error {
 	for i := 0; i < rv.Len(); i++ {
 		if err := e.Encode(rv.Index(i).Interface()); err != nil {
 			return errors.Wrap(err, `msgpack: failed to write array payload`)
@@ -320,6 +564,12 @@ func (e *Encoder) EncodeArray(v interface{}) error {
 }
 
 func (e *Encoder) EncodeMap(v interface{}) error {
+	// map[string]interface{} is by far the most common map type that
+	// we see (dynamic documents), so avoid reflect altogether
+	if m, ok := v.(map[string]interface{}); ok {
+		return e.encodeMapInterface(m)
+	}
+
 	rv := reflect.ValueOf(v)
 
 	if !rv.IsValid() {
@@ -336,18 +586,22 @@ func (e *Encoder) EncodeMap(v interface{}) error {
 		return errors.Errorf(`msgpack: argument to EncodeMap must be a map (not %s)`, typ)
 	}
 
-	if rv.IsNil() {
+	if rv.IsNil() || (e.options.NilEmptyCollections && rv.Len() == 0) {
 		return e.EncodeNil()
 	}
 
-	if rv.Type().Key().Kind() != reflect.String {
-		return errors.Errorf(`msgpack: keys to maps must be strings (not %s)`, rv.Type().Key())
+	// The fast paths below only handle plain string keys, written as a
+	// map in random order
+	if rv.Type().Key() != stringType || e.options.MapsAsPairs || e.options.SortMapKeys {
+		return e.encodeMapKeys(rv)
 	}
 
 	// XXX We do NOT use MapBuilder's convenience methods except for the
 	// WriteHeader bit, purely for performance reasons.
 	keys := rv.MapKeys()
-	WriteMapHeader(e.dst, len(keys))
+	if err := WriteMapHeader(e.dst, len(keys)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
 
 	// These are silly fast paths for common cases
 	switch rv.Type().Elem().Kind() {
@@ -393,34 +647,199 @@ func (e *Encoder) EncodeMap(v interface{}) error {
 	return nil
 }
 
-var tags = []string{`msgpack`, `msg`}
+var stringType = reflect.TypeOf("")
+
+// encodeMapKeys writes rv, a map whose keys are not plain strings. Keys
+// may be booleans, numbers, strings, arrays (such as [16]byte) or
+// interfaces that hold any of these
+func (e *Encoder) encodeMapKeys(rv reflect.Value) error {
+	switch rv.Type().Key().Kind() {
+	case reflect.Bool, reflect.String, reflect.Array, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		return errors.Errorf(`msgpack: unsupported map key type %s`, rv.Type().Key())
+	}
 
-func parseMsgpackTag(rv reflect.StructField) (string, bool) {
-	var name = rv.Name
-	var omitempty bool
+	keys := rv.MapKeys()
+	if e.options.SortMapKeys {
+		sortMapKeys(keys)
+	}
+	if err := e.writeMapHeader(len(keys)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
+
+	for _, key := range keys {
+		if err := e.writePairHeader(); err != nil {
+			return err
+		}
+		if err := e.encodeMapKey(key); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode map key %v`, key.Interface())
+		}
+		if err := e.Encode(rv.MapIndex(key).Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode map value for %v`, key.Interface())
+		}
+	}
+	return nil
+}
+
+// sortMapKeys sorts keys, the keys of a map, for WithSortedMapKeys
+func sortMapKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		}
+		return fmt.Sprintf("%#v", a.Interface()) < fmt.Sprintf("%#v", b.Interface())
+	})
+}
+
+// encodeMapKey writes key according to its kind, so that keys of named
+// types (type color string, and so on) are supported
+func (e *Encoder) encodeMapKey(key reflect.Value) error {
+	switch key.Kind() {
+	case reflect.Bool:
+		return e.EncodeBool(key.Bool())
+	case reflect.String:
+		return e.EncodeString(key.String())
+	case reflect.Int:
+		return e.EncodeInt(int(key.Int()))
+	case reflect.Int8:
+		return e.EncodeInt8(int8(key.Int()))
+	case reflect.Int16:
+		return e.EncodeInt16(int16(key.Int()))
+	case reflect.Int32:
+		return e.EncodeInt32(int32(key.Int()))
+	case reflect.Int64:
+		return e.EncodeInt64(key.Int())
+	case reflect.Uint:
+		return e.EncodeUint(uint(key.Uint()))
+	case reflect.Uint8:
+		return e.EncodeUint8(uint8(key.Uint()))
+	case reflect.Uint16:
+		return e.EncodeUint16(uint16(key.Uint()))
+	case reflect.Uint32:
+		return e.EncodeUint32(uint32(key.Uint()))
+	case reflect.Uint64:
+		return e.EncodeUint64(key.Uint())
+	case reflect.Float32:
+		return e.EncodeFloat32(float32(key.Float()))
+	case reflect.Float64:
+		return e.EncodeFloat64(key.Float())
+	}
+	return e.Encode(key.Interface())
+}
+
+func (e *Encoder) encodeMapInterface(m map[string]interface{}) error {
+	if m == nil || (e.options.NilEmptyCollections && len(m) == 0) {
+		return e.EncodeNil()
+	}
+
+	if e.options.SortMapKeys {
+		return e.encodeMapKeys(reflect.ValueOf(m))
+	}
+
+	if err := e.writeMapHeader(len(m)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
+
+	for k, v := range m {
+		if err := e.writePairHeader(); err != nil {
+			return err
+		}
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode map key`)
+		}
+
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode map value for %s`, k)
+		}
+	}
+	return nil
+}
+
+// fieldTag holds the settings of a struct field that are specified in
+// its struct tag
+type fieldTag struct {
+	name       string
+	omitempty  bool
+	emptyAsNil bool
+	pairs      bool
+	// asArray is only meaningful on the blank (_) field that marks a
+	// struct to be encoded as an array
+	asArray bool
+	// keyAsInt is set by keyasint, which writes the name as an integer
+	// key
+	keyAsInt bool
+	// decoder is the name of the FieldDecoder given via decoder=name
+	decoder string
+}
+
+func parseMsgpackTag(rv reflect.StructField, tags []string) fieldTag {
+	var ft = fieldTag{name: rv.Name}
 
-	// We will support both msg and msgpack tags, the former
-	// is used by tinylib/msgp, and the latter vmihailenco/msgpack
 LOOP:
 	for _, tagName := range tags {
 		if tag, ok := rv.Tag.Lookup(tagName); ok && tag != "" {
 			l := strings.Split(tag, ",")
 			if len(l) > 0 && l[0] != "" {
-				name = l[0]
+				ft.name = l[0]
 			}
 
-			if len(l) > 1 && l[1] == "omitempty" {
-				omitempty = true
+			for _, option := range l[1:] {
+				switch option {
+				case "omitempty":
+					ft.omitempty = true
+				case "emptyasnil":
+					ft.emptyAsNil = true
+				case "pairs":
+					ft.pairs = true
+				case "asarray":
+					ft.asArray = true
+				case "keyasint":
+					ft.keyAsInt = true
+				default:
+					if strings.HasPrefix(option, "decoder=") {
+						ft.decoder = strings.TrimPrefix(option, "decoder=")
+					}
+				}
 			}
 			break LOOP
 		}
 	}
-	return name, omitempty
+	return ft
 }
 
-// EncodeTime encodes time.Time as a sequence of two integers
+// EncodeTime encodes time.Time using the timestamp extension defined
+// by the msgpack specification (see TimestampExtType). If the Encoder
+// was created with WithTimeAsArray, it is encoded as an array of two
+// integers (seconds and nanoseconds) instead. With
+// WithTimestampResolution, t is truncated to the resolution first
 func (e *Encoder) EncodeTime(t time.Time) error {
-	e.dst.WriteByte(FixArray0.Byte() + byte(2))
+	if d := e.options.TimestampResolution; d > 0 {
+		t = t.Truncate(d)
+	}
+
+	if !e.options.TimeAsArray {
+		if err := e.encodeTimestamp(t); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode time.Time`)
+		}
+		return nil
+	}
+
+	if err := e.dst.WriteByte(FixArray0.Byte() + byte(2)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write array header for time.Time`)
+	}
 	if err := e.EncodeInt64(t.Unix()); err != nil {
 		return errors.Wrap(err, `msgpack: failed to encode seconds for time.Time`)
 	}
@@ -453,36 +872,126 @@ func (e *Encoder) EncodeStruct(v interface{}) error {
 	if rv.Kind() != reflect.Struct {
 		return errors.Errorf(`msgpack: argument to EncodeStruct must be a struct (not %s)`, rv.Type())
 	}
-	mapb := NewMapBuilder()
+
+	fielder, _ := v.(MsgpackFielder)
+	return e.encodeStruct(rv, fielder)
+}
+
+func (e *Encoder) encodeStruct(rv reflect.Value, fielder MsgpackFielder) error {
+	// We need to know the number of fields before we can write the
+	// map header, so collect the fields first. The values are encoded
+	// using this encoder (as opposed to using a MapBuilder, which
+	// creates its own encoder)
+	var keys []string
+	var values []reflect.Value
+	// pairs holds the indices in keys of the fields tagged with pairs
+	var pairs map[int]struct{}
+	// intKeys maps the indices in keys of the fields tagged with
+	// keyasint to their integer keys
+	var intKeys map[int]int64
 
 	rt := rv.Type()
-	for i := 0; i < rt.NumField(); i++ {
-		ft := rt.Field(i)
-		if ft.PkgPath != "" {
-			continue
+	plan := e.options.structPlanFor(rt)
+	if plan.asArray {
+		return e.encodeStructAsArray(rv, plan, fielder)
+	}
+	for _, sf := range plan.fields {
+		field := rv.Field(sf.index)
+		if sf.omitempty {
+			if isEmptyValue(field, sf.isZero) {
+				continue
+			}
+		}
+		if (sf.emptyAsNil || e.options.EmptyAsNil) && field.IsNil() && isEmptyAsNilType(field.Type()) {
+			// Write "" or the zero time instead of nil
+			field = reflect.Zero(field.Type().Elem())
 		}
 
-		name, omitempty := parseMsgpackTag(ft)
-		if name == "-" {
-			continue
+		if sf.pairs {
+			if pairs == nil {
+				pairs = make(map[int]struct{})
+			}
+			pairs[len(keys)] = struct{}{}
+		}
+		if sf.keyAsInt {
+			if intKeys == nil {
+				intKeys = make(map[int]int64)
+			}
+			intKeys[len(keys)] = sf.intKey
 		}
+		keys = append(keys, sf.name)
+		values = append(values, field)
+	}
 
-		field := rv.Field(i)
-		if omitempty {
-			if reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+	if fielder != nil {
+		names := make(map[string]struct{}, len(keys))
+		for i, name := range keys {
+			// Integer keys cannot conflict with string ones
+			if _, ok := intKeys[i]; ok {
 				continue
 			}
+			names[name] = struct{}{}
+		}
+
+		extra := fielder.MsgpackFields()
+		extraKeys := make([]string, 0, len(extra))
+		for k := range extra {
+			if _, ok := names[k]; ok {
+				return errors.Errorf(`msgpack: field %s returned by MsgpackFields conflicts with a field in %s`, k, rt)
+			}
+			extraKeys = append(extraKeys, k)
+		}
+		// Keep the output stable
+		sort.Strings(extraKeys)
+		for _, k := range extraKeys {
+			keys = append(keys, k)
+			values = append(values, reflect.ValueOf(extra[k]))
 		}
+	}
 
-		mapb.Add(name, field.Interface())
+	if err := e.writeMapHeader(len(keys)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
 	}
 
-	if err := mapb.Encode(e.dst); err != nil {
-		return errors.Wrap(err, `msgpack: failed to write map payload`)
+	for i, key := range keys {
+		if err := e.writePairHeader(); err != nil {
+			return err
+		}
+		if k, ok := intKeys[i]; ok {
+			// Use the smallest form, as saving space is the point
+			if err := e.encodeCanonicalInt(k); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to encode struct key %s`, key)
+			}
+		} else if err := e.EncodeString(key); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode struct key %s`, key)
+		}
+
+		if _, ok := pairs[i]; ok {
+			if err := e.encodeAsPairs(values[i]); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to encode struct field %s`, key)
+			}
+			continue
+		}
+		if err := e.encodeStructField(values[i]); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode struct field %s`, key)
+		}
 	}
 	return nil
 }
 
+func (e *Encoder) encodeStructField(rv reflect.Value) error {
+	if !rv.IsValid() {
+		return e.EncodeNil()
+	}
+
+	// Fast path for fields whose type is registered as an extension.
+	// Pointers to extension types are handled in Encode
+	if _, ok := isExtType(rv.Type()); ok {
+		return e.EncodeExt(rv.Interface().(EncodeMsgpacker))
+	}
+	return e.Encode(rv.Interface())
+}
+
 func (e *Encoder) EncodeExtType(v EncodeMsgpacker) error {
 	t := reflect.TypeOf(v)
 
@@ -502,21 +1011,21 @@ func (e *Encoder) EncodeExtType(v EncodeMsgpacker) error {
 
 func (e *Encoder) EncodeExt(v EncodeMsgpacker) error {
 	w := newAppendingWriter(9)
-	elocal := NewEncoder(w)
+	elocal := &Encoder{dst: w, options: e.options}
 
 	if err := v.EncodeMsgpack(elocal); err != nil {
 		return errors.Wrapf(err, `msgpack: failed during call to EncodeMsgpack for %s`, reflect.TypeOf(v))
 	}
 
 	buf := w.Bytes()
-	e.EncodeExtHeader(len(buf))
-	e.EncodeExtType(v)
-	for b := buf; len(b) > 0; {
-		n, err := e.dst.Write(buf)
-		b = b[n:]
-		if err != nil {
-			return errors.Wrap(err, `msgpack: failed to write extension payload`)
-		}
+	if err := e.EncodeExtHeader(len(buf)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write extension header`)
+	}
+	if err := e.EncodeExtType(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write extension type`)
+	}
+	if _, err := e.dst.Write(buf); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write extension payload`)
 	}
 
 	return nil
@@ -552,7 +1061,7 @@ func (e *Encoder) EncodeExtHeader(l int) error {
 		if err := e.dst.WriteByteUint16(Ext16.Byte(), uint16(l)); err != nil {
 			return errors.Wrap(err, `msgpack: failed to write ext16 code and payload length`)
 		}
-	case l <= math.MaxUint32:
+	case int64(l) <= math.MaxUint32:
 		if err := e.dst.WriteByteUint32(Ext32.Byte(), uint32(l)); err != nil {
 			return errors.Wrap(err, `msgpack: failed to write ext32 code and payload length`)
 		}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
+	"sort"
 	"testing"
+	"time"
 
 	msgpack "github.com/lestrrat-go/msgpack"
 	"github.com/stretchr/testify/assert"
@@ -378,6 +381,26 @@ func TestEncodePositiveFixNum(t *testing.T) {
 			}
 		})
 	}
+	t.Run("out of range", func(t *testing.T) {
+		for _, i := range []uint8{uint8(msgpack.MaxPositiveFixNum) + 1, math.MaxUint8} {
+			var buf bytes.Buffer
+			if !assert.Error(t, msgpack.NewEncoder(&buf).EncodePositiveFixNum(i), "EncodePositiveFixNum(%d) should fail", i) {
+				return
+			}
+			if !assert.Zero(t, buf.Len(), "nothing should be written") {
+				return
+			}
+		}
+	})
+	t.Run("in range", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodePositiveFixNum(uint8(msgpack.MaxPositiveFixNum)), "EncodePositiveFixNum should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{0x7f}, buf.Bytes(), "output should match") {
+			return
+		}
+	})
 }
 
 func TestEncodeNegativeFixNum(t *testing.T) {
@@ -813,6 +836,81 @@ func TestEncodeStruct(t *testing.T) {
 	})
 }
 
+type omitEmptyVersion struct {
+	Major, Minor int
+}
+
+// IsZero treats any version 0.x as unset
+func (v omitEmptyVersion) IsZero() bool {
+	return v.Major == 0
+}
+
+type omitEmptyStruct struct {
+	Time    time.Time             `msgpack:"time,omitempty"`
+	Version omitEmptyVersion      `msgpack:"version,omitempty"`
+	Ptr     *int                  `msgpack:"ptr,omitempty"`
+	Map     map[string]int        `msgpack:"map,omitempty"`
+	Slice   []int                 `msgpack:"slice,omitempty"`
+	Any     interface{}           `msgpack:"any,omitempty"`
+	Array   [2]int                `msgpack:"array,omitempty"`
+	Nested  struct{ A, B string } `msgpack:"nested,omitempty"`
+}
+
+func TestOmitEmpty(t *testing.T) {
+	keys := func(v interface{}) ([]string, error) {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]interface{}
+		if err := msgpack.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		var l []string
+		for k := range m {
+			l = append(l, k)
+		}
+		sort.Strings(l)
+		return l, nil
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		// A zero time in another location is not equal to time.Time{},
+		// but its IsZero method says that it is zero
+		v := omitEmptyStruct{
+			Time:    time.Time{}.In(time.FixedZone("JST", 9*60*60)),
+			Version: omitEmptyVersion{Minor: 3},
+		}
+		l, err := keys(v)
+		if !assert.NoError(t, err, "round trip should succeed") {
+			return
+		}
+		if !assert.Empty(t, l, "all fields should be omitted") {
+			return
+		}
+	})
+	t.Run("not empty", func(t *testing.T) {
+		var zero int
+		v := omitEmptyStruct{
+			Time:    time.Unix(1, 0),
+			Version: omitEmptyVersion{Major: 1},
+			Ptr:     &zero,
+			Map:     map[string]int{},
+			Slice:   []int{},
+			Any:     0,
+			Array:   [2]int{0, 1},
+		}
+		v.Nested.B = "b"
+		l, err := keys(v)
+		if !assert.NoError(t, err, "round trip should succeed") {
+			return
+		}
+		if !assert.Equal(t, []string{"any", "array", "map", "nested", "ptr", "slice", "time", "version"}, l, "no field should be omitted") {
+			return
+		}
+	})
+}
+
 func TestEncodeArray(t *testing.T) {
 	var buf bytes.Buffer
 	arrayb := msgpack.NewArrayBuilder()
@@ -836,3 +934,831 @@ func TestEncodeArray(t *testing.T) {
 		}
 	})
 }
+
+func TestEncodeMapInterface(t *testing.T) {
+	t.Run("single entry", func(t *testing.T) {
+		v := map[string]interface{}{"foo": "bar"}
+
+		mapb := msgpack.NewMapBuilder()
+		mapb.Add("foo", "bar")
+		e, err := mapb.Bytes()
+		if !assert.NoError(t, err, "MapBuilder.Bytes() should succeed") {
+			return
+		}
+
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeMap(v), "EncodeMap should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, e, buf.Bytes(), "Output should match") {
+			return
+		}
+	})
+	t.Run("nil map", func(t *testing.T) {
+		var v map[string]interface{}
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).Encode(v), "Encode should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, []byte{msgpack.Nil.Byte()}, buf.Bytes(), "Output should match") {
+			return
+		}
+	})
+	t.Run("nested values", func(t *testing.T) {
+		v := map[string]interface{}{
+			"string": "Hello, World!",
+			"int":    int64(100),
+			"array":  []interface{}{"foo", int64(1)},
+			"map":    map[string]interface{}{"bar": "baz"},
+			"nil":    nil,
+		}
+
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var r map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &r), "Unmarshal should succeed") {
+			return
+		}
+
+		if !assert.Len(t, r, len(v), "decoded map should have the same number of keys") {
+			return
+		}
+
+		if !assert.Equal(t, "Hello, World!", r["string"], "string value should match") {
+			return
+		}
+
+		if !assert.Equal(t, map[string]interface{}{"bar": "baz"}, r["map"], "map value should match") {
+			return
+		}
+	})
+}
+
+func TestMapBuilder(t *testing.T) {
+	t.Run("typed entries", func(t *testing.T) {
+		raw, err := msgpack.Marshal([]interface{}{"a", "b"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		raw = append([]byte(nil), raw...)
+
+		mapb := msgpack.NewMapBuilder()
+		mapb.AddString("string", "Hello, World!")
+		mapb.AddInt64("int64", -12345678)
+		mapb.AddBytes("bytes", []byte{0x1, 0x2, 0x3})
+		mapb.AddNil("nil")
+		mapb.AddRaw("raw", raw)
+		e, err := mapb.Bytes()
+		if !assert.NoError(t, err, "MapBuilder.Bytes() should succeed") {
+			return
+		}
+
+		var m map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(e, &m), "Unmarshal should succeed") {
+			return
+		}
+
+		expected := map[string]interface{}{
+			"string": "Hello, World!",
+			"int64":  int64(-12345678),
+			"bytes":  []byte{0x1, 0x2, 0x3},
+			"nil":    nil,
+			"raw":    []interface{}{"a", "b"},
+		}
+		if !assert.Equal(t, expected, m, "values should match") {
+			return
+		}
+	})
+	t.Run("typed entries match Add", func(t *testing.T) {
+		typed := msgpack.NewMapBuilder()
+		typed.AddString("string", "Hello, World!")
+		typed.AddInt64("int64", 100)
+		typed.AddBytes("bytes", []byte("foo"))
+		typed.AddNil("nil")
+
+		generic := msgpack.NewMapBuilder()
+		generic.Add("string", "Hello, World!")
+		generic.Add("int64", int64(100))
+		generic.Add("bytes", []byte("foo"))
+		generic.Add("nil", nil)
+
+		b1, err := typed.Bytes()
+		if !assert.NoError(t, err, "MapBuilder.Bytes() should succeed") {
+			return
+		}
+		b2, err := generic.Bytes()
+		if !assert.NoError(t, err, "MapBuilder.Bytes() should succeed") {
+			return
+		}
+		if !assert.Equal(t, b2, b1, "output should match") {
+			return
+		}
+	})
+	t.Run("nil values", func(t *testing.T) {
+		var p *dummyStruct
+		var s []string
+		var m map[string]int
+
+		mapb := msgpack.NewMapBuilder()
+		mapb.Add("pointer", p)
+		mapb.Add("slice", s)
+		mapb.Add("map", m)
+		e, err := mapb.Bytes()
+		if !assert.NoError(t, err, "MapBuilder.Bytes() should succeed") {
+			return
+		}
+
+		nilb := msgpack.Nil.Byte()
+		expected := []byte{msgpack.FixMap0.Byte() + 3, msgpack.FixStr0.Byte() + 7}
+		expected = append(expected, "pointer"...)
+		expected = append(expected, nilb, msgpack.FixStr0.Byte()+5)
+		expected = append(expected, "slice"...)
+		expected = append(expected, nilb, msgpack.FixStr0.Byte()+3)
+		expected = append(expected, "map"...)
+		expected = append(expected, nilb)
+		if !assert.Equal(t, expected, e, "nil values should be encoded as nil") {
+			return
+		}
+	})
+	t.Run("unsupported value", func(t *testing.T) {
+		mapb := msgpack.NewMapBuilder()
+		mapb.AddString("foo", "bar")
+		mapb.Add("ch", make(chan struct{}))
+
+		var buf bytes.Buffer
+		err := mapb.Encode(&buf)
+		if !assert.Error(t, err, "Encode should fail") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), "ch", "error should mention the key") {
+			return
+		}
+		if !assert.Equal(t, 0, buf.Len(), "nothing should be written") {
+			return
+		}
+	})
+	t.Run("Reset", func(t *testing.T) {
+		mapb := msgpack.NewMapBuilder()
+		mapb.AddString("foo", "bar")
+		mapb.Reset()
+		if !assert.Equal(t, 0, mapb.Count(), "Count should be 0") {
+			return
+		}
+		e, err := mapb.Bytes()
+		if !assert.NoError(t, err, "MapBuilder.Bytes() should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.FixMap0.Byte()}, e, "output should be an empty map") {
+			return
+		}
+	})
+}
+
+type privateStateStruct struct {
+	Name    string
+	counter int64
+	secret  string
+}
+
+func (s *privateStateStruct) MsgpackFields() map[string]interface{} {
+	return map[string]interface{}{
+		"counter": s.counter,
+		"secret":  s.secret,
+	}
+}
+
+func (s *privateStateStruct) SetMsgpackFields(m map[string]interface{}) {
+	s.counter, _ = m["counter"].(int64)
+	s.secret, _ = m["secret"].(string)
+}
+
+type conflictingFieldsStruct struct {
+	Name string
+}
+
+func (s conflictingFieldsStruct) MsgpackFields() map[string]interface{} {
+	return map[string]interface{}{"Name": "conflict"}
+}
+
+func TestMsgpackFields(t *testing.T) {
+	t.Run("encode", func(t *testing.T) {
+		v := &privateStateStruct{Name: "foo", counter: 1000, secret: "bar"}
+
+		mapb := msgpack.NewMapBuilder()
+		mapb.Add("Name", "foo")
+		mapb.Add("counter", int64(1000))
+		mapb.Add("secret", "bar")
+		e, err := mapb.Bytes()
+		if !assert.NoError(t, err, "MapBuilder.Bytes() should succeed") {
+			return
+		}
+
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, e, b, "Output should match") {
+			return
+		}
+	})
+	t.Run("round trip", func(t *testing.T) {
+		v := &privateStateStruct{Name: "foo", counter: 1000, secret: "bar"}
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded privateStateStruct
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, v, &decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("unknown keys without setter", func(t *testing.T) {
+		b, err := msgpack.Marshal(&privateStateStruct{Name: "foo", counter: 1000, secret: "bar"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded conflictingFieldsStruct
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, "foo", decoded.Name, "exported fields should be decoded") {
+			return
+		}
+	})
+	t.Run("conflicting keys", func(t *testing.T) {
+		_, err := msgpack.Marshal(conflictingFieldsStruct{Name: "foo"})
+		if !assert.Error(t, err, "Marshal should fail") {
+			return
+		}
+	})
+}
+
+func TestEncodeCompactInt(t *testing.T) {
+	for _, tc := range []struct {
+		value    int64
+		expected []byte
+	}{
+		{value: 0, expected: []byte{0x00}},
+		{value: 127, expected: []byte{0x7f}},
+		{value: -1, expected: []byte{0xff}},
+		{value: -32, expected: []byte{0xe0}},
+		{value: -33, expected: []byte{msgpack.Int8.Byte(), 0xdf}},
+		{value: 128, expected: []byte{msgpack.Int16.Byte(), 0x00, 0x80}},
+		{value: math.MinInt16, expected: []byte{msgpack.Int16.Byte(), 0x80, 0x00}},
+		{value: math.MaxInt32, expected: []byte{msgpack.Int32.Byte(), 0x7f, 0xff, 0xff, 0xff}},
+		{value: math.MinInt64, expected: []byte{msgpack.Int64.Byte(), 0x80, 0, 0, 0, 0, 0, 0, 0}},
+	} {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeCompactInt(tc.value), "EncodeCompactInt should succeed") {
+			return
+		}
+		if !assert.Equal(t, tc.expected, buf.Bytes(), "output for %d should match", tc.value) {
+			return
+		}
+
+		var v int64
+		if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, tc.value, v, "value should round trip") {
+			return
+		}
+	}
+}
+
+func TestEncodeCompactUint(t *testing.T) {
+	for _, tc := range []struct {
+		value    uint64
+		expected []byte
+	}{
+		{value: 0, expected: []byte{0x00}},
+		{value: 127, expected: []byte{0x7f}},
+		{value: 128, expected: []byte{msgpack.Uint8.Byte(), 0x80}},
+		{value: math.MaxUint16, expected: []byte{msgpack.Uint16.Byte(), 0xff, 0xff}},
+		{value: math.MaxUint16 + 1, expected: []byte{msgpack.Uint32.Byte(), 0x00, 0x01, 0x00, 0x00}},
+		{value: math.MaxUint64, expected: []byte{msgpack.Uint64.Byte(), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	} {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeCompactUint(tc.value), "EncodeCompactUint should succeed") {
+			return
+		}
+		if !assert.Equal(t, tc.expected, buf.Bytes(), "output for %d should match", tc.value) {
+			return
+		}
+
+		var v uint64
+		if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &v), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, tc.value, v, "value should round trip") {
+			return
+		}
+	}
+}
+
+func TestEncodeByteArray(t *testing.T) {
+	type digest struct {
+		Sum [4]byte
+	}
+
+	t.Run("as Bin", func(t *testing.T) {
+		v := [4]byte{1, 2, 3, 200}
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.Bin8.Byte(), 4, 1, 2, 3, 200}, b, "output should match") {
+			return
+		}
+
+		var decoded [4]byte
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "value should round trip") {
+			return
+		}
+	})
+	t.Run("struct field", func(t *testing.T) {
+		v := digest{Sum: [4]byte{1, 2, 3, 4}}
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded digest
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "value should round trip") {
+			return
+		}
+	})
+	t.Run("WithByteArrayAsArray", func(t *testing.T) {
+		var buf bytes.Buffer
+		v := [4]byte{1, 2, 3, 200}
+		if !assert.NoError(t, msgpack.NewEncoder(&buf, msgpack.WithByteArrayAsArray()).Encode(v), "Encode should succeed") {
+			return
+		}
+		if !assert.Equal(t, msgpack.FixArray4, msgpack.Code(buf.Bytes()[0]), "value should be encoded as an array") {
+			return
+		}
+
+		var decoded [4]byte
+		if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "value should round trip") {
+			return
+		}
+	})
+	t.Run("length mismatch", func(t *testing.T) {
+		b, err := msgpack.Marshal([]byte{1, 2, 3})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded [4]byte
+		if !assert.Error(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should fail") {
+			return
+		}
+
+		b, err = msgpack.Marshal([]int{1, 2, 3, 4, 5})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Error(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should fail") {
+			return
+		}
+	})
+	t.Run("other arrays", func(t *testing.T) {
+		v := [3]string{"foo", "bar", "baz"}
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded [3]string
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "value should round trip") {
+			return
+		}
+	})
+}
+
+func TestLegacyRaw(t *testing.T) {
+	encode := func(v interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := msgpack.NewEncoder(&buf, msgpack.WithLegacyRaw()).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	t.Run("strings", func(t *testing.T) {
+		inputs := []struct {
+			length int
+			header []byte
+		}{
+			{5, []byte{msgpack.FixStr5.Byte()}},
+			{200, []byte{msgpack.Str16.Byte(), 0, 200}},
+			{70000, []byte{msgpack.Str32.Byte(), 0, 1, 0x11, 0x70}},
+		}
+		for _, input := range inputs {
+			s := string(bytes.Repeat([]byte{'x'}, input.length))
+			b, err := encode(s)
+			if !assert.NoError(t, err, "Encode should succeed") {
+				return
+			}
+			if !assert.Equal(t, input.header, b[:len(input.header)], "header for %d bytes should match", input.length) {
+				return
+			}
+
+			var decoded string
+			if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, s, decoded, "value should round trip") {
+				return
+			}
+		}
+	})
+	t.Run("byte slices", func(t *testing.T) {
+		type blob struct {
+			Data []byte
+			Sum  [2]byte
+		}
+		v := blob{Data: []byte{1, 2, 3}, Sum: [2]byte{4, 5}}
+		b, err := encode(v)
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+		for _, c := range b {
+			if !assert.False(t, msgpack.IsBinFamily(msgpack.Code(c)), "output should not contain Bin codes") {
+				return
+			}
+		}
+
+		var decoded blob
+		if !assert.NoError(t, msgpack.NewDecoder(bytes.NewReader(b), msgpack.WithLegacyRaw()).Decode(&decoded), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "value should round trip") {
+			return
+		}
+	})
+	t.Run("Bin as string", func(t *testing.T) {
+		src := []byte{msgpack.Bin8.Byte(), 3, 'f', 'o', 'o'}
+
+		var decoded interface{}
+		if !assert.NoError(t, msgpack.NewDecoder(bytes.NewReader(src), msgpack.WithLegacyRaw()).Decode(&decoded), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, "foo", decoded, "Bin should be decoded as a string") {
+			return
+		}
+
+		var s string
+		if !assert.NoError(t, msgpack.NewDecoder(bytes.NewReader(src), msgpack.WithLegacyRaw()).Decode(&s), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, "foo", s, "Bin should be decoded as a string") {
+			return
+		}
+	})
+}
+
+func TestMarshalOwnership(t *testing.T) {
+	first, err := msgpack.Marshal("first")
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := msgpack.Marshal("another value"); !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+	}
+
+	var s string
+	if !assert.NoError(t, msgpack.Unmarshal(first, &s), "Unmarshal should succeed") {
+		return
+	}
+	if !assert.Equal(t, "first", s, "result of Marshal should not be overwritten by later calls") {
+		return
+	}
+}
+
+type pairsInner struct {
+	Name string `msgpack:"name"`
+}
+
+type pairsOuter struct {
+	Attrs map[string]int `msgpack:"attrs,pairs"`
+	Inner *pairsInner    `msgpack:"inner,pairs"`
+	Plain map[string]int `msgpack:"plain"`
+}
+
+func TestMapsAsPairs(t *testing.T) {
+	encode := func(v interface{}, options ...msgpack.Option) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := msgpack.NewEncoder(&buf, options...).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	t.Run("maps", func(t *testing.T) {
+		inputs := []interface{}{
+			map[string]int{"foo": 1},
+			map[string]interface{}{"foo": 1},
+			map[int]string{1: "foo"},
+		}
+		for _, input := range inputs {
+			b, err := encode(input, msgpack.WithMapsAsPairs())
+			if !assert.NoError(t, err, "Encode should succeed") {
+				return
+			}
+
+			var decoded interface{}
+			if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.Len(t, decoded, 1, "map should be written as an array of pairs") {
+				return
+			}
+			pair, ok := decoded.([]interface{})[0].([]interface{})
+			if !assert.True(t, ok, "entry should be an array") || !assert.Len(t, pair, 2, "entry should be a pair") {
+				return
+			}
+		}
+
+		b, err := encode(map[string]int{"foo": 1, "bar": 2}, msgpack.WithMapsAsPairs())
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+		var decoded map[string]int
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded, msgpack.WithMapsAsPairs()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, map[string]int{"foo": 1, "bar": 2}, decoded, "map should round trip") {
+			return
+		}
+		var generic map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &generic, msgpack.WithMapsAsPairs()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Len(t, generic, 2, "map should round trip") {
+			return
+		}
+		if !assert.Error(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should fail without WithMapsAsPairs") {
+			return
+		}
+
+		// Regular maps are still accepted
+		b, err = msgpack.Marshal(map[string]int{"foo": 1})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		decoded = nil
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded, msgpack.WithMapsAsPairs()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, map[string]int{"foo": 1}, decoded, "map should match") {
+			return
+		}
+	})
+	t.Run("structs", func(t *testing.T) {
+		v := pairsInner{Name: "foo"}
+		b, err := encode(v, msgpack.WithMapsAsPairs())
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.FixArray1.Byte(), msgpack.FixArray2.Byte()}, b[:2], "struct should be written as an array of pairs") {
+			return
+		}
+
+		var decoded pairsInner
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded, msgpack.WithMapsAsPairs()), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "struct should round trip") {
+			return
+		}
+	})
+	t.Run("tag", func(t *testing.T) {
+		v := pairsOuter{
+			Attrs: map[string]int{"foo": 1},
+			Inner: &pairsInner{Name: "bar"},
+			Plain: map[string]int{"baz": 2},
+		}
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var generic map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &generic), "Unmarshal should succeed") {
+			return
+		}
+		if _, ok := generic["attrs"].([]interface{}); !assert.True(t, ok, "attrs should be written as an array of pairs") {
+			return
+		}
+		if _, ok := generic["inner"].([]interface{}); !assert.True(t, ok, "inner should be written as an array of pairs") {
+			return
+		}
+		if _, ok := generic["plain"].(map[string]interface{}); !assert.True(t, ok, "plain should be written as a map") {
+			return
+		}
+
+		var decoded pairsOuter
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "struct should round trip") {
+			return
+		}
+	})
+	t.Run("invalid pairs", func(t *testing.T) {
+		b := []byte{msgpack.FixArray1.Byte(), msgpack.FixArray0.Byte() + 3, msgpack.FixStr0.Byte() + 1, 'a', 0x01, 0x02}
+		var decoded map[string]int
+		if !assert.Error(t, msgpack.Unmarshal(b, &decoded, msgpack.WithMapsAsPairs()), "Unmarshal should fail for a non-pair entry") {
+			return
+		}
+	})
+}
+
+func TestEncoderOptions(t *testing.T) {
+	encode := func(v interface{}, options ...msgpack.Option) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := msgpack.NewEncoder(&buf, options...).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	t.Run("WithSortedMapKeys", func(t *testing.T) {
+		inputs := []struct {
+			value    interface{}
+			expected interface{}
+		}{
+			{map[string]int{"c": 3, "a": 1, "b": 2}, []interface{}{"a", "b", "c"}},
+			{map[string]interface{}{"c": 3, "a": 1, "b": 2}, []interface{}{"a", "b", "c"}},
+			{map[int]string{10: "x", -5: "y", 3: "z"}, []interface{}{int8(-5), int64(3), int64(10)}},
+			{map[bool]int{true: 1, false: 0}, []interface{}{false, true}},
+		}
+		for _, input := range inputs {
+			// Go randomizes map iteration, so a few runs would catch an
+			// unsorted output
+			for i := 0; i < 10; i++ {
+				b, err := encode(input.value, msgpack.WithSortedMapKeys())
+				if !assert.NoError(t, err, "Encode should succeed") {
+					return
+				}
+
+				dec := msgpack.NewDecoder(bytes.NewReader(b))
+				n, err := dec.DecodeMapHeader()
+				if !assert.NoError(t, err, "DecodeMapHeader should succeed") {
+					return
+				}
+				var keys []interface{}
+				for j := 0; j < n; j++ {
+					var key interface{}
+					if !assert.NoError(t, dec.Decode(&key), "Decode should succeed") || !assert.NoError(t, dec.Skip(), "Skip should succeed") {
+						return
+					}
+					keys = append(keys, key)
+				}
+				if !assert.Equal(t, input.expected, keys, "keys of %T should be sorted", input.value) {
+					return
+				}
+			}
+		}
+	})
+	t.Run("WithCompactInts", func(t *testing.T) {
+		inputs := []struct {
+			value    interface{}
+			expected []byte
+		}{
+			{int64(1), []byte{0x01}},
+			{int64(-1), []byte{0xff}},
+			{int(200), []byte{msgpack.Int16.Byte(), 0x00, 0xc8}},
+			{int32(-200), []byte{msgpack.Int16.Byte(), 0xff, 0x38}},
+			{uint64(200), []byte{msgpack.Uint8.Byte(), 0xc8}},
+			{uint32(70000), []byte{msgpack.Uint32.Byte(), 0x00, 0x01, 0x11, 0x70}},
+		}
+		for _, input := range inputs {
+			b, err := encode(input.value, msgpack.WithCompactInts())
+			if !assert.NoError(t, err, "Encode should succeed") {
+				return
+			}
+			if !assert.Equal(t, input.expected, b, "%T(%v) should be compact", input.value, input.value) {
+				return
+			}
+		}
+
+		b, err := encode(struct {
+			ID int64 `msgpack:"id"`
+		}{ID: 5}, msgpack.WithCompactInts())
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.FixMap1.Byte(), msgpack.FixStr0.Byte() + 2, 'i', 'd', 0x05}, b, "struct fields should be compact") {
+			return
+		}
+		var decoded struct {
+			ID int64 `msgpack:"id"`
+		}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") || !assert.Equal(t, int64(5), decoded.ID, "value should round trip") {
+			return
+		}
+	})
+	t.Run("WithNilEmptyCollections", func(t *testing.T) {
+		inputs := []interface{}{
+			[]int{}, []int(nil), []string{}, map[string]int{}, map[string]int(nil), map[string]interface{}{}, map[int]int{},
+		}
+		for _, input := range inputs {
+			b, err := encode(input, msgpack.WithNilEmptyCollections())
+			if !assert.NoError(t, err, "Encode should succeed") {
+				return
+			}
+			if !assert.Equal(t, []byte{msgpack.Nil.Byte()}, b, "%#v should be written as Nil", input) {
+				return
+			}
+		}
+
+		b, err := encode([]string{"a"}, msgpack.WithNilEmptyCollections())
+		if !assert.NoError(t, err, "Encode should succeed") || !assert.Equal(t, []byte{msgpack.FixArray1.Byte(), msgpack.FixStr0.Byte() + 1, 'a'}, b, "non-empty slices should not be affected") {
+			return
+		}
+		b, err = encode([]byte{}, msgpack.WithNilEmptyCollections())
+		if !assert.NoError(t, err, "Encode should succeed") || !assert.Equal(t, []byte{msgpack.Bin8.Byte(), 0x00}, b, "byte slices should not be affected") {
+			return
+		}
+	})
+	t.Run("WithTimestampResolution", func(t *testing.T) {
+		tm := time.Unix(1500000000, 123456789).UTC()
+		b, err := encode(tm, msgpack.WithTimestampResolution(time.Second))
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+		if !assert.Equal(t, msgpack.FixExt4.Byte(), b[0], "time should use the 4 byte form") {
+			return
+		}
+
+		var decoded time.Time
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") || !assert.True(t, tm.Truncate(time.Second).Equal(decoded), "time should be truncated") {
+			return
+		}
+
+		b, err = encode(tm, msgpack.WithTimestampResolution(time.Millisecond))
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") || !assert.Equal(t, 123000000, decoded.Nanosecond(), "time should be truncated to milliseconds") {
+			return
+		}
+	})
+}
+
+func TestEncodeStringHeader(t *testing.T) {
+	for _, n := range []int{0, 5, 200, 70000} {
+		payload := bytes.Repeat([]byte{'x'}, n)
+
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		if !assert.NoError(t, enc.EncodeStringHeader(n), "EncodeStringHeader should succeed") {
+			return
+		}
+		if _, err := io.Copy(enc.Writer(), bytes.NewReader(payload)); !assert.NoError(t, err, "writing the payload should succeed") {
+			return
+		}
+
+		expected, err := msgpack.Marshal(string(payload))
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, expected, buf.Bytes(), "output for %d bytes should match EncodeString", n) {
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if !assert.Error(t, msgpack.NewEncoder(&buf).EncodeStringHeader(-1), "EncodeStringHeader should fail for negative lengths") {
+		return
+	}
+}
@@ -0,0 +1,120 @@
+package msgpack
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Type is a coarse classification of msgpack values, as used by
+// Decoder.Expect. Types can be combined using |, to accept any of
+// them:
+//
+//	dec.Expect(msgpack.MapType | msgpack.NilType)
+type Type uint16
+
+const (
+	NilType Type = 1 << iota
+	BoolType
+	// IntType covers all integers, signed or unsigned
+	IntType
+	FloatType
+	StringType
+	BinaryType
+	ArrayType
+	MapType
+	ExtType
+
+	// InvalidType is the type of codes that are never used
+	InvalidType Type = 0
+)
+
+var typeNames = []struct {
+	typ  Type
+	name string
+}{
+	{NilType, "nil"},
+	{BoolType, "bool"},
+	{IntType, "int"},
+	{FloatType, "float"},
+	{StringType, "string"},
+	{BinaryType, "binary"},
+	{ArrayType, "array"},
+	{MapType, "map"},
+	{ExtType, "ext"},
+}
+
+func (t Type) String() string {
+	var names []string
+	for _, tn := range typeNames {
+		if t&tn.typ != 0 {
+			names = append(names, tn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "invalid"
+	}
+	return strings.Join(names, " or ")
+}
+
+// TypeOf returns the type of the values that start with code
+func TypeOf(code Code) Type {
+	switch {
+	case code == Nil:
+		return NilType
+	case code == True, code == False:
+		return BoolType
+	case IsPositiveFixNum(code), IsNegativeFixNum(code),
+		code == Uint8, code == Uint16, code == Uint32, code == Uint64,
+		code == Int8, code == Int16, code == Int32, code == Int64:
+		return IntType
+	case code == Float, code == Double:
+		return FloatType
+	case IsStrFamily(code):
+		return StringType
+	case IsBinFamily(code):
+		return BinaryType
+	case IsArrayFamily(code):
+		return ArrayType
+	case IsMapFamily(code):
+		return MapType
+	case IsExtFamily(code):
+		return ExtType
+	}
+	return InvalidType
+}
+
+// PeekType returns the type of the next value, without consuming it
+func (d *Decoder) PeekType() (Type, error) {
+	code, err := d.PeekCode()
+	if err != nil {
+		return InvalidType, err
+	}
+	return TypeOf(code), nil
+}
+
+// Expect checks that the next value is of type t (or, if t combines
+// several types, of one of them), without consuming it. Use it at
+// protocol boundaries to fail early with a clear error, instead of
+// whatever error decoding into the wrong Go value would produce.
+// If the type does not match, an *UnexpectedTypeError is returned:
+//
+//	if err := dec.Expect(msgpack.MapType); err != nil {
+//	  return errors.Wrap(err, `invalid request header`)
+//	  // invalid request header: msgpack: expected map, got array
+//	}
+func (d *Decoder) Expect(t Type) error {
+	code, err := d.PeekCode()
+	if err != nil {
+		return errors.Wrapf(err, `msgpack: failed to read %s`, t)
+	}
+
+	if actual := TypeOf(code); actual&t == 0 {
+		return &UnexpectedTypeError{
+			Expected: t,
+			Actual:   actual,
+			Code:     code,
+		}
+	}
+	return nil
+}
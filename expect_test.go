@@ -0,0 +1,72 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecoderExpect(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for _, v := range []interface{}{[]string{"foo"}, nil, int64(1000)} {
+		if !assert.NoError(t, enc.Encode(v), "Encode should succeed") {
+			return
+		}
+	}
+
+	dec := msgpack.NewDecoder(&buf)
+	err := dec.Expect(msgpack.MapType)
+	if !assert.Error(t, err, "Expect should fail for an array") {
+		return
+	}
+	if !assert.Equal(t, "msgpack: expected map, got array (FixArray1)", err.Error(), "error message should match") {
+		return
+	}
+	typeErr, ok := errors.Cause(err).(*msgpack.UnexpectedTypeError)
+	if !assert.True(t, ok, "error should be an UnexpectedTypeError") {
+		return
+	}
+	if !assert.Equal(t, msgpack.ArrayType, typeErr.Actual, "actual type should match") {
+		return
+	}
+
+	// The value has not been consumed
+	if !assert.NoError(t, dec.Expect(msgpack.ArrayType), "Expect should succeed for an array") {
+		return
+	}
+	var l []string
+	if !assert.NoError(t, dec.Decode(&l), "Decode should succeed") {
+		return
+	}
+
+	if !assert.NoError(t, dec.Expect(msgpack.MapType|msgpack.NilType), "Expect should accept any of the combined types") {
+		return
+	}
+	if !assert.NoError(t, dec.DecodeNil(nil), "DecodeNil should succeed") {
+		return
+	}
+
+	typ, err := dec.PeekType()
+	if !assert.NoError(t, err, "PeekType should succeed") {
+		return
+	}
+	if !assert.Equal(t, msgpack.IntType, typ, "type should be int") {
+		return
+	}
+	err = dec.Expect(msgpack.StringType | msgpack.BinaryType)
+	if !assert.EqualError(t, err, "msgpack: expected string or binary, got int (Int64)", "error message should list the expected types") {
+		return
+	}
+	var i int64
+	if !assert.NoError(t, dec.Decode(&i), "Decode should succeed") {
+		return
+	}
+
+	if !assert.Error(t, dec.Expect(msgpack.MapType), "Expect should fail at the end of the stream") {
+		return
+	}
+}
@@ -14,6 +14,7 @@ var extEncodeRegistry = make(map[reflect.Type]int)
 
 var decodeMsgpackerType = reflect.TypeOf((*DecodeMsgpacker)(nil)).Elem()
 var encodeMsgpackerType = reflect.TypeOf((*EncodeMsgpacker)(nil)).Elem()
+var msgpackFielderType = reflect.TypeOf((*MsgpackFielder)(nil)).Elem()
 
 func RegisterExt(typ int, v interface{}) error {
 	rt := reflect.TypeOf(v)
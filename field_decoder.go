@@ -0,0 +1,110 @@
+package msgpack
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FieldDecoder decodes the next value into v, a pointer to a struct
+// field. FieldDecoders are registered by name via RegisterFieldDecoder,
+// and are used for the fields whose struct tag has the decoder=name
+// option:
+//
+//	type Event struct {
+//		CreatedAt time.Time `msgpack:"created_at,decoder=unixms"`
+//	}
+//
+// They are meant to absorb formats used by other producers, which do
+// not match the Go type of the field, at the codec layer
+type FieldDecoder func(d *Decoder, v interface{}) error
+
+var muFieldDecoders sync.RWMutex
+var fieldDecoders = map[string]FieldDecoder{
+	"unix":   decodeUnixTime(time.Second),
+	"unixms": decodeUnixTime(time.Millisecond),
+}
+
+// RegisterFieldDecoder registers fn under name, for use with the
+// decoder=name struct tag option. Registering a name again replaces the
+// previous FieldDecoder.
+//
+// The following FieldDecoders are registered by default:
+//
+//	unix    decodes a number of seconds since the Unix epoch into a time.Time
+//	unixms  decodes a number of milliseconds since the Unix epoch into a time.Time
+func RegisterFieldDecoder(name string, fn FieldDecoder) error {
+	if name == "" {
+		return errors.New(`msgpack: field decoder name must not be empty`)
+	}
+	if fn == nil {
+		return errors.Errorf(`msgpack: field decoder %s must not be nil`, name)
+	}
+
+	muFieldDecoders.Lock()
+	fieldDecoders[name] = fn
+	muFieldDecoders.Unlock()
+	return nil
+}
+
+// decodeWithFieldDecoder decodes the next value into f, a struct field,
+// using the FieldDecoder registered under name
+func (d *Decoder) decodeWithFieldDecoder(name string, f reflect.Value) error {
+	muFieldDecoders.RLock()
+	fn, ok := fieldDecoders[name]
+	muFieldDecoders.RUnlock()
+	if !ok {
+		return errors.Errorf(`msgpack: unknown field decoder %s`, name)
+	}
+
+	// Pointer fields are allocated, so that FieldDecoders only need to
+	// know about the type itself
+	ptr := f.Addr()
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		ptr = f
+	}
+	return fn(d, ptr.Interface())
+}
+
+// decodeUnixTime returns a FieldDecoder that decodes an integer holding
+// a number of units since the Unix epoch into a time.Time
+func decodeUnixTime(unit time.Duration) FieldDecoder {
+	return func(d *Decoder, v interface{}) error {
+		t, ok := v.(*time.Time)
+		if !ok {
+			return errors.Errorf(`msgpack: expected *time.Time (not %T)`, v)
+		}
+
+		code, err := d.PeekCode()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to peek code`)
+		}
+
+		var n int64
+		switch code {
+		case Uint8, Uint16, Uint32, Uint64:
+			var u uint64
+			if err := d.DecodeUint64(&u); err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode timestamp`)
+			}
+			if u > math.MaxInt64 {
+				return errors.Errorf(`msgpack: timestamp %d is out of range`, u)
+			}
+			n = int64(u)
+		default:
+			if err := d.DecodeInt64(&n); err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode timestamp`)
+			}
+		}
+
+		per := int64(time.Second / unit)
+		*t = time.Unix(n/per, (n%per)*int64(unit))
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package msgpack_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldDecoder(t *testing.T) {
+	t.Run("unixms", func(t *testing.T) {
+		type event struct {
+			Name      string     `msgpack:"name"`
+			CreatedAt time.Time  `msgpack:"created_at,decoder=unixms"`
+			UpdatedAt *time.Time `msgpack:"updated_at,decoder=unix"`
+		}
+
+		b, err := msgpack.Marshal(map[string]interface{}{
+			"name":       "foo",
+			"created_at": uint64(1500000000123),
+			"updated_at": int64(1500000000),
+		})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded event
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, "foo", decoded.Name, "name should match") {
+			return
+		}
+		if !assert.True(t, time.Unix(1500000000, 123000000).Equal(decoded.CreatedAt), "created_at should match (got %s)", decoded.CreatedAt) {
+			return
+		}
+		if !assert.NotNil(t, decoded.UpdatedAt, "updated_at should be allocated") {
+			return
+		}
+		if !assert.True(t, time.Unix(1500000000, 0).Equal(*decoded.UpdatedAt), "updated_at should match (got %s)", decoded.UpdatedAt) {
+			return
+		}
+	})
+	t.Run("registered", func(t *testing.T) {
+		err := msgpack.RegisterFieldDecoder("upper", func(d *msgpack.Decoder, v interface{}) error {
+			var s string
+			if err := d.DecodeString(&s); err != nil {
+				return err
+			}
+			*(v.(*string)) = strings.ToUpper(s)
+			return nil
+		})
+		if !assert.NoError(t, err, "RegisterFieldDecoder should succeed") {
+			return
+		}
+
+		type code struct {
+			Value string `msgpack:"value,decoder=upper"`
+		}
+		b, err := msgpack.Marshal(code{Value: "abc"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded code
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, "ABC", decoded.Value, "value should be decoded by the field decoder") {
+			return
+		}
+	})
+	t.Run("unknown decoder", func(t *testing.T) {
+		type unknown struct {
+			Value int `msgpack:"value,decoder=nonexistent"`
+		}
+		b, err := msgpack.Marshal(map[string]interface{}{"value": 1})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded unknown
+		if !assert.Error(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should fail") {
+			return
+		}
+	})
+	t.Run("invalid registration", func(t *testing.T) {
+		if !assert.Error(t, msgpack.RegisterFieldDecoder("", func(*msgpack.Decoder, interface{}) error { return nil }), "empty names should be rejected") {
+			return
+		}
+		if !assert.Error(t, msgpack.RegisterFieldDecoder("nil", nil), "nil functions should be rejected") {
+			return
+		}
+	})
+}
@@ -0,0 +1,81 @@
+//go:build go1.21
+// +build go1.21
+
+// The go.mod of this module predates generics, and only Go 1.21 and
+// later allow a build constraint to raise the language version of a
+// single file. Hence the go1.21 (as opposed to go1.18) constraint
+
+package msgpack
+
+import (
+	"github.com/pkg/errors"
+)
+
+// UnmarshalAs deserializes data into a new value of type T. As with
+// Unmarshal, data must contain exactly one value
+//
+//	point, err := msgpack.UnmarshalAs[Point](data)
+func UnmarshalAs[T any](data []byte, options ...Option) (T, error) {
+	var v T
+	if err := Unmarshal(data, &v, options...); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// DecodeAs decodes the next value from d into a new value of type T
+func DecodeAs[T any](d *Decoder) (T, error) {
+	var v T
+	if err := d.Decode(&v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// DecodeSlice decodes the next value from d, which must be an array
+// (or nil), into a []T
+func DecodeSlice[T any](d *Decoder) ([]T, error) {
+	if d.isNil() {
+		return nil, d.DecodeNil(nil)
+	}
+
+	var size int
+	if err := d.DecodeArrayLength(&size); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to decode array length`)
+	}
+
+	list := make([]T, size)
+	for i := range list {
+		if err := d.Decode(&list[i]); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to decode array element %d`, i)
+		}
+	}
+	return list, nil
+}
+
+// DecodeStringMap decodes the next value from d, which must be a map
+// with string keys (or nil), into a map[string]V
+func DecodeStringMap[V any](d *Decoder) (map[string]V, error) {
+	var size int
+	if err := d.DecodeMapLength(&size); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to decode map length`)
+	}
+	if size == -1 {
+		return nil, nil
+	}
+
+	m := make(map[string]V, size)
+	for i := 0; i < size; i++ {
+		var key string
+		if err := d.DecodeString(&key); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to decode map key at index %d`, i)
+		}
+
+		var value V
+		if err := d.Decode(&value); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to decode map value for key %s`, key)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
@@ -0,0 +1,116 @@
+//go:build go1.21
+// +build go1.21
+
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type genericPoint struct {
+	X int64 `msgpack:"x"`
+	Y int64 `msgpack:"y"`
+}
+
+// genericObject is a named map[string]any
+type genericObject map[string]any
+
+func TestGenericHelpers(t *testing.T) {
+	t.Run("UnmarshalAs", func(t *testing.T) {
+		data, err := msgpack.Marshal(genericPoint{X: 100, Y: 200})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		point, err := msgpack.UnmarshalAs[genericPoint](data)
+		if !assert.NoError(t, err, "UnmarshalAs should succeed") {
+			return
+		}
+		if !assert.Equal(t, genericPoint{X: 100, Y: 200}, point, "values should match") {
+			return
+		}
+	})
+	t.Run("DecodeAs", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).Encode(genericObject{"foo": "bar"}), "Encode should succeed") {
+			return
+		}
+
+		obj, err := msgpack.DecodeAs[genericObject](msgpack.NewDecoder(&buf))
+		if !assert.NoError(t, err, "DecodeAs should succeed") {
+			return
+		}
+		if !assert.Equal(t, genericObject{"foo": "bar"}, obj, "values should match") {
+			return
+		}
+	})
+	t.Run("DecodeSlice", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		if !assert.NoError(t, enc.Encode([]genericPoint{{X: 100, Y: 200}, {X: 300, Y: 400}}), "Encode should succeed") {
+			return
+		}
+		if !assert.NoError(t, enc.EncodeNil(), "EncodeNil should succeed") {
+			return
+		}
+
+		dec := msgpack.NewDecoder(&buf)
+		points, err := msgpack.DecodeSlice[genericPoint](dec)
+		if !assert.NoError(t, err, "DecodeSlice should succeed") {
+			return
+		}
+		if !assert.Equal(t, []genericPoint{{X: 100, Y: 200}, {X: 300, Y: 400}}, points, "values should match") {
+			return
+		}
+
+		points, err = msgpack.DecodeSlice[genericPoint](dec)
+		if !assert.NoError(t, err, "DecodeSlice should succeed for nil") {
+			return
+		}
+		if !assert.Nil(t, points, "nil should be decoded as a nil slice") {
+			return
+		}
+	})
+	t.Run("DecodeStringMap", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		if !assert.NoError(t, enc.Encode(map[string]interface{}{"a": int64(1000), "b": int64(2000)}), "Encode should succeed") {
+			return
+		}
+		if !assert.NoError(t, enc.Encode("not a map"), "Encode should succeed") {
+			return
+		}
+
+		dec := msgpack.NewDecoder(&buf)
+		m, err := msgpack.DecodeStringMap[int](dec)
+		if !assert.NoError(t, err, "DecodeStringMap should succeed") {
+			return
+		}
+		if !assert.Equal(t, map[string]int{"a": 1000, "b": 2000}, m, "values should match") {
+			return
+		}
+
+		_, err = msgpack.DecodeStringMap[int](dec)
+		if !assert.Error(t, err, "DecodeStringMap should fail for a string") {
+			return
+		}
+	})
+	t.Run("DecodeAny", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).Encode(map[string]any{"foo": []any{"bar", int64(1000)}}), "Encode should succeed") {
+			return
+		}
+
+		v, err := msgpack.NewDecoder(&buf).DecodeAny()
+		if !assert.NoError(t, err, "DecodeAny should succeed") {
+			return
+		}
+		if !assert.Equal(t, map[string]any{"foo": []any{"bar", int64(1000)}}, v, "values should match") {
+			return
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexedFile(t *testing.T) {
+	var buf bytes.Buffer
+	w := msgpack.NewIndexedWriter(&buf)
+	for _, s := range []string{"uno", "dos", "tres"} {
+		if !assert.NoError(t, w.Encode(s), "Encode should succeed") {
+			return
+		}
+	}
+	if !assert.NoError(t, w.EncodeWithKey("greeting", dummyStruct{Message: "Hello, World!"}), "EncodeWithKey should succeed") {
+		return
+	}
+	if !assert.Error(t, w.EncodeWithKey("greeting", "duplicate"), "EncodeWithKey should fail for duplicate keys") {
+		return
+	}
+	if !assert.NoError(t, w.Close(), "Close should succeed") {
+		return
+	}
+	if !assert.Error(t, w.Encode("foo"), "Encode should fail after Close") {
+		return
+	}
+
+	data := buf.Bytes()
+	r, err := msgpack.NewIndexedReader(bytes.NewReader(data), int64(len(data)))
+	if !assert.NoError(t, err, "NewIndexedReader should succeed") {
+		return
+	}
+
+	if !assert.Equal(t, 4, r.Len(), "Len should match") {
+		return
+	}
+
+	t.Run("Decode", func(t *testing.T) {
+		var s string
+		if !assert.NoError(t, r.Decode(1, &s), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, "dos", s, "value should match") {
+			return
+		}
+	})
+	t.Run("DecodeKey", func(t *testing.T) {
+		var v dummyStruct
+		if !assert.NoError(t, r.DecodeKey("greeting", &v), "DecodeKey should succeed") {
+			return
+		}
+		if !assert.Equal(t, "Hello, World!", v.Message, "value should match") {
+			return
+		}
+		if !assert.Error(t, r.DecodeKey("nonexistent", &v), "DecodeKey should fail for unknown keys") {
+			return
+		}
+	})
+	t.Run("file is a valid msgpack stream", func(t *testing.T) {
+		idx, err := msgpack.BuildIndex(bytes.NewReader(data))
+		if !assert.NoError(t, err, "BuildIndex should succeed") {
+			return
+		}
+		// 4 records + footer + footer offset + magic
+		if !assert.Len(t, idx, 7, "stream should contain 7 values") {
+			return
+		}
+		if !assert.Equal(t, r.Index(), idx[:4], "offsets should match") {
+			return
+		}
+	})
+	t.Run("invalid file", func(t *testing.T) {
+		_, err := msgpack.NewIndexedReader(bytes.NewReader(data[:len(data)-1]), int64(len(data)-1))
+		if !assert.Error(t, err, "NewIndexedReader should fail") {
+			return
+		}
+	})
+	t.Run("footer is deterministic", func(t *testing.T) {
+		write := func() []byte {
+			var buf bytes.Buffer
+			w := msgpack.NewIndexedWriter(&buf)
+			for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+				if !assert.NoError(t, w.EncodeWithKey(key, key), "EncodeWithKey should succeed") {
+					return nil
+				}
+			}
+			if !assert.NoError(t, w.Close(), "Close should succeed") {
+				return nil
+			}
+			return buf.Bytes()
+		}
+
+		expected := write()
+		for i := 0; i < 10; i++ {
+			if !assert.Equal(t, expected, write(), "output should match") {
+				return
+			}
+		}
+	})
+	t.Run("forged footer lengths", func(t *testing.T) {
+		trailer := []byte{msgpack.Uint64.Byte(), 0, 0, 0, 0, 0, 0, 0, 0, msgpack.FixStr0.Byte() + 4, 'M', 'P', 'I', 'X'}
+		footers := map[string][]byte{
+			"offsets": {msgpack.FixArray0.Byte() + 2, msgpack.Array32.Byte(), 0x7f, 0xff, 0xff, 0xff},
+			"keys":    {msgpack.FixArray0.Byte() + 2, msgpack.FixArray0.Byte(), msgpack.Map32.Byte(), 0x7f, 0xff, 0xff, 0xff},
+		}
+		for name, footer := range footers {
+			footer := footer
+			t.Run(name, func(t *testing.T) {
+				data := append(append([]byte(nil), footer...), trailer...)
+				_, err := msgpack.NewIndexedReader(bytes.NewReader(data), int64(len(data)))
+				if !assert.Error(t, err, "NewIndexedReader should fail") {
+					return
+				}
+			})
+		}
+	})
+}
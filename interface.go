@@ -14,110 +14,176 @@ const MinNegativeFixNum = byte(0xe0)
 type Code byte
 
 const (
-	InvalidCode     Code = 0
-	FixMap0         Code = 0x80
-	FixMap1         Code = 0x81
-	FixMap2         Code = 0x82
-	FixMap3         Code = 0x83
-	FixMap4         Code = 0x84
-	FixMap5         Code = 0x85
-	FixMap6         Code = 0x86
-	FixMap7         Code = 0x87
-	FixMap8         Code = 0x88
-	FixMap9         Code = 0x89
-	FixMap10        Code = 0x8a
-	FixMap11        Code = 0x8b
-	FixMap12        Code = 0x8c
-	FixMap13        Code = 0x8d
-	FixMap14        Code = 0x8e
-	FixMap15        Code = 0x8f
-	FixArray0       Code = 0x90
-	FixArray1       Code = 0x91
-	FixArray2       Code = 0x92
-	FixArray3       Code = 0x93
-	FixArray4       Code = 0x94
-	FixArray5       Code = 0x95
-	FixArray6       Code = 0x96
-	FixArray7       Code = 0x97
-	FixArray8       Code = 0x98
-	FixArray9       Code = 0x99
-	FixArray10      Code = 0x9a
-	FixArray11      Code = 0x9b
-	FixArray12      Code = 0x9c
-	FixArray13      Code = 0x9d
-	FixArray14      Code = 0x9e
-	FixArray15      Code = 0x9f
-	NegFixedNumLow  Code = 0xe0
-	FixStr0         Code = 0xa0
-	FixStr1         Code = 0xa1
-	FixStr2         Code = 0xa2
-	FixStr3         Code = 0xa3
-	FixStr4         Code = 0xa4
-	FixStr5         Code = 0xa5
-	FixStr6         Code = 0xa6
-	FixStr7         Code = 0xa7
-	FixStr8         Code = 0xa8
-	FixStr9         Code = 0xa9
-	FixStr10        Code = 0xaa
-	FixStr11        Code = 0xab
-	FixStr12        Code = 0xac
-	FixStr13        Code = 0xad
-	FixStr14        Code = 0xae
-	FixStr15        Code = 0xaf
-	FixStr16        Code = 0xb0
-	FixStr17        Code = 0xb1
-	FixStr18        Code = 0xb2
-	FixStr19        Code = 0xb3
-	FixStr20        Code = 0xb4
-	FixStr21        Code = 0xb5
-	FixStr22        Code = 0xb6
-	FixStr23        Code = 0xb7
-	FixStr24        Code = 0xb8
-	FixStr25        Code = 0xb9
-	FixStr26        Code = 0xba
-	FixStr27        Code = 0xbb
-	FixStr28        Code = 0xbc
-	FixStr29        Code = 0xbd
-	FixStr30        Code = 0xbe
-	FixStr31        Code = 0xbf
-	Nil             Code = 0xc0
-	False           Code = 0xc2
-	True            Code = 0xc3
-	Bin8            Code = 0xc4
-	Bin16           Code = 0xc5
-	Bin32           Code = 0xc6
-	Ext8            Code = 0xc7
-	Ext16           Code = 0xc8
-	Ext32           Code = 0xc9
-	Float           Code = 0xca
-	Double          Code = 0xcb
-	Uint8           Code = 0xcc
-	Uint16          Code = 0xcd
-	Uint32          Code = 0xce
-	Uint64          Code = 0xcf
-	Int8            Code = 0xd0
-	Int16           Code = 0xd1
-	Int32           Code = 0xd2
-	Int64           Code = 0xd3
-	FixExt1         Code = 0xd4
-	FixExt2         Code = 0xd5
-	FixExt4         Code = 0xd6
-	FixExt8         Code = 0xd7
-	FixExt16        Code = 0xd8
-	Str8            Code = 0xd9
-	Str16           Code = 0xda
-	Str32           Code = 0xdb
-	Array16         Code = 0xdc
-	Array32         Code = 0xdd
-	Map16           Code = 0xde
-	Map32           Code = 0xdf
-	FixedArrayMask  Code = 0xf
+	InvalidCode    Code = 0
+	FixMap0        Code = 0x80
+	FixMap1        Code = 0x81
+	FixMap2        Code = 0x82
+	FixMap3        Code = 0x83
+	FixMap4        Code = 0x84
+	FixMap5        Code = 0x85
+	FixMap6        Code = 0x86
+	FixMap7        Code = 0x87
+	FixMap8        Code = 0x88
+	FixMap9        Code = 0x89
+	FixMap10       Code = 0x8a
+	FixMap11       Code = 0x8b
+	FixMap12       Code = 0x8c
+	FixMap13       Code = 0x8d
+	FixMap14       Code = 0x8e
+	FixMap15       Code = 0x8f
+	FixArray0      Code = 0x90
+	FixArray1      Code = 0x91
+	FixArray2      Code = 0x92
+	FixArray3      Code = 0x93
+	FixArray4      Code = 0x94
+	FixArray5      Code = 0x95
+	FixArray6      Code = 0x96
+	FixArray7      Code = 0x97
+	FixArray8      Code = 0x98
+	FixArray9      Code = 0x99
+	FixArray10     Code = 0x9a
+	FixArray11     Code = 0x9b
+	FixArray12     Code = 0x9c
+	FixArray13     Code = 0x9d
+	FixArray14     Code = 0x9e
+	FixArray15     Code = 0x9f
+	NegFixedNumLow Code = 0xe0
+	FixStr0        Code = 0xa0
+	FixStr1        Code = 0xa1
+	FixStr2        Code = 0xa2
+	FixStr3        Code = 0xa3
+	FixStr4        Code = 0xa4
+	FixStr5        Code = 0xa5
+	FixStr6        Code = 0xa6
+	FixStr7        Code = 0xa7
+	FixStr8        Code = 0xa8
+	FixStr9        Code = 0xa9
+	FixStr10       Code = 0xaa
+	FixStr11       Code = 0xab
+	FixStr12       Code = 0xac
+	FixStr13       Code = 0xad
+	FixStr14       Code = 0xae
+	FixStr15       Code = 0xaf
+	FixStr16       Code = 0xb0
+	FixStr17       Code = 0xb1
+	FixStr18       Code = 0xb2
+	FixStr19       Code = 0xb3
+	FixStr20       Code = 0xb4
+	FixStr21       Code = 0xb5
+	FixStr22       Code = 0xb6
+	FixStr23       Code = 0xb7
+	FixStr24       Code = 0xb8
+	FixStr25       Code = 0xb9
+	FixStr26       Code = 0xba
+	FixStr27       Code = 0xbb
+	FixStr28       Code = 0xbc
+	FixStr29       Code = 0xbd
+	FixStr30       Code = 0xbe
+	FixStr31       Code = 0xbf
+	Nil            Code = 0xc0
+	False          Code = 0xc2
+	True           Code = 0xc3
+	Bin8           Code = 0xc4
+	Bin16          Code = 0xc5
+	Bin32          Code = 0xc6
+	Ext8           Code = 0xc7
+	Ext16          Code = 0xc8
+	Ext32          Code = 0xc9
+	Float          Code = 0xca
+	Double         Code = 0xcb
+	Uint8          Code = 0xcc
+	Uint16         Code = 0xcd
+	Uint32         Code = 0xce
+	Uint64         Code = 0xcf
+	Int8           Code = 0xd0
+	Int16          Code = 0xd1
+	Int32          Code = 0xd2
+	Int64          Code = 0xd3
+	FixExt1        Code = 0xd4
+	FixExt2        Code = 0xd5
+	FixExt4        Code = 0xd6
+	FixExt8        Code = 0xd7
+	FixExt16       Code = 0xd8
+	Str8           Code = 0xd9
+	Str16          Code = 0xda
+	Str32          Code = 0xdb
+	Array16        Code = 0xdc
+	Array32        Code = 0xdd
+	Map16          Code = 0xde
+	Map32          Code = 0xdf
+	FixedArrayMask Code = 0xf
 )
 
+// InvalidDecodeError is returned when the target of Decode cannot hold
+// the decoded value: it is nil (Type is nil), it is not a pointer, or
+// it is a nil pointer. The message suggests how to fix the call.
+// cmd/msgpackcheck reports such calls before they run
 type InvalidDecodeError struct {
 	Type reflect.Type
 }
 
+// LengthOverflowError is returned when the length of a string,
+// byte slice, array, map, or extension read from the wire cannot be
+// represented as an int on the current platform (e.g. a Str32
+// longer than math.MaxInt32 on 32-bit platforms)
+type LengthOverflowError struct {
+	Code   Code
+	Length int64
+}
+
+// LossyConversionError is returned when a float is decoded into an
+// integer type that cannot hold it exactly, such as 3.7 into an int or
+// 1e10 into an int32. See WithTruncateFloats
+type LossyConversionError struct {
+	Value float64
+	Kind  reflect.Kind
+}
+
+// ReservedCodeError is returned when the decoder encounters 0xc1,
+// the one byte that the msgpack specification marks as "never used".
+// It usually means that the stream is corrupted, or that the decoder
+// is out of sync with it
+type ReservedCodeError struct {
+	// Offset is the position of the reserved byte in the stream, or -1
+	// if it is not known (as in sub-decoders created via Sub)
+	Offset int64
+	// Skipped is the number of reserved bytes following it that were
+	// skipped. See WithResyncOnReservedCode
+	Skipped int
+}
+
+// StrictTypeError is returned by Decoders created with WithStrictTypes
+// when the next value would have to be converted to be stored in the
+// target, such as a float into an integer, an integer into a string, or
+// an Int64 that does not fit in an int8
+type StrictTypeError struct {
+	Code Code
+	Kind reflect.Kind
+}
+
+// TrailingBytesError is returned by Unmarshal when the data contains
+// more bytes after the first complete value. See WithAllowTrailingBytes
+type TrailingBytesError struct {
+	// Count is the number of bytes after the value
+	Count int
+}
+
+// UnexpectedTypeError is returned by Decoder.Expect when the next
+// value is not of the expected type
+type UnexpectedTypeError struct {
+	Expected Type
+	Actual   Type
+	Code     Code
+}
+
+// UnknownFieldError is returned by Decoders created with
+// WithDisallowUnknownFields when a map decoded into a struct has a key
+// that does not match any of its fields
+type UnknownFieldError struct {
+	Type  reflect.Type
+	Field string
+}
+
 // EncodeMsgpacker is an interface for those objects that provide
 // their own serialization. The objects are responsible for providing
 // the complete msgpack payload, including the code, payload length
@@ -133,6 +199,24 @@ type DecodeMsgpacker interface {
 	DecodeMsgpack(*Decoder) error
 }
 
+// MsgpackFielder is an interface for struct types that need to
+// serialize state that is not available through exported fields.
+// The returned key/value pairs are encoded as extra fields of the
+// struct, after the exported fields. Keys must not collide with the
+// names of the exported fields
+type MsgpackFielder interface {
+	MsgpackFields() map[string]interface{}
+}
+
+// MsgpackFieldSetter is the decoding counterpart of MsgpackFielder.
+// When decoding into a struct that implements this interface, all
+// keys that do not correspond to an exported field are decoded as
+// interface{} values, and passed to SetMsgpackFields once the
+// struct has been decoded
+type MsgpackFieldSetter interface {
+	SetMsgpackFields(map[string]interface{})
+}
+
 // ArrayBuilder is used to build a msgpack array
 type ArrayBuilder interface {
 	Add(interface{})
@@ -145,6 +229,11 @@ type ArrayBuilder interface {
 // MapBuilder is used to build a msgpack map
 type MapBuilder interface {
 	Add(string, interface{})
+	AddString(string, string)
+	AddInt64(string, int64)
+	AddBytes(string, []byte)
+	AddNil(string)
+	AddRaw(string, []byte)
 	Bytes() ([]byte, error)
 	Count() int
 	Encode(io.Writer) error
@@ -190,11 +279,45 @@ type Reader interface {
 // an io.Writer
 type Encoder struct {
 	dst Writer
+	// own is the Writer that the Encoder created to wrap a plain
+	// io.Writer, so that Reset can reuse it. It is nil otherwise
+	own     *writer
+	options Options
+	// profiling is set while a value is being encoded on behalf of
+	// options.Profiler, so that nested values are not recorded
+	profiling bool
+	// guarding is set while a value is being encoded through rollback,
+	// so that nested values are not guarded on their own. poisoned is
+	// set once a value failed after part of it was written. See
+	// WithRollbackBuffer and WithPoisonOnPartialValue
+	guarding bool
+	rollback *rollbackWriter
+	poisoned error
 }
 
 // Encoder reads serialized data from a source pointed to by
 // an io.Reader
 type Decoder struct {
-	raw *bufio.Reader
-	src Reader
+	raw     *bufio.Reader
+	src     Reader
+	options Options
+	// limit is only set for decoders created via Sub
+	limit *io.LimitedReader
+	// profiling is set while a value is being decoded on behalf of
+	// options.Profiler, so that nested values are not recorded
+	profiling bool
+	// counter keeps track of offsets. It points to count, except for
+	// sub-decoders, where it is nil. inMessage is set while a
+	// top-level value is being decoded, and messageEnd is where the
+	// value must end
+	counter    *countingReader
+	count      countingReader
+	inMessage  bool
+	messageEnd int64
+	// path holds the keys that lead to the value being decoded. It is
+	// only maintained if ExpectedSizes is set
+	path []string
+	// depth is the number of arrays and maps that enclose the value
+	// being decoded. It is only maintained if MaxDepth is set
+	depth int
 }
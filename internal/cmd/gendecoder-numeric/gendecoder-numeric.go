@@ -36,6 +36,7 @@ func generateNumericDecoders() error {
 	buf.WriteString("\n\n// Auto-generated by internal/cmd/gendecoder-numeric/gendecoder-numeric.go. DO NOT EDIT!")
 	buf.WriteString("\n\nimport (")
 	buf.WriteString("\n\"math\"")
+	buf.WriteString("\n\"reflect\"")
 	buf.WriteString("\n\n\"github.com/pkg/errors\"")
 	buf.WriteString("\n)")
 
@@ -103,8 +104,15 @@ func generateIntegerTypes(dst io.Writer) error {
 		fmt.Fprintf(dst, "\nif err != nil {")
 		fmt.Fprintf(dst, "\nreturn errors.Wrap(err, `msgpack: failed to read code for %s`)", data.Code)
 		fmt.Fprintf(dst, "\n}")
-		fmt.Fprintf(dst, "\nif IsFixNumFamily(Code(code)) {")
-		fmt.Fprintf(dst, "\n*v = %s(code)", typ)
+		// Negative fixnums do not fit in unsigned types, and need to be
+		// sign extended for signed types
+		if data.Unsigned {
+			fmt.Fprintf(dst, "\nif IsPositiveFixNum(Code(code)) {")
+			fmt.Fprintf(dst, "\n*v = %s(code)", typ)
+		} else {
+			fmt.Fprintf(dst, "\nif IsFixNumFamily(Code(code)) {")
+			fmt.Fprintf(dst, "\n*v = %s(int8(code))", typ)
+		}
 		fmt.Fprintf(dst, "\nreturn nil")
 		fmt.Fprintf(dst, "\n}")
 		// We need to allow numbers with lower bit sizes that fit in this type
@@ -121,11 +129,25 @@ func generateIntegerTypes(dst io.Writer) error {
 			fmt.Fprintf(dst, "\nif err != nil {")
 			fmt.Fprintf(dst, "\nreturn errors.Wrap(err, `msgpack: failed to read payload for %s`)", typ)
 			fmt.Fprintf(dst, "\n}")
-			fmt.Fprintf(dst, "\n*v = %s(x)", typ)
+			if data.Unsigned {
+				fmt.Fprintf(dst, "\n*v = %s(x)", typ)
+			} else {
+				// Sign extend values of narrower codes
+				fmt.Fprintf(dst, "\n*v = %s(int%d(x))", typ, size)
+			}
 			fmt.Fprintf(dst, "\nreturn nil")
 		}
+		// Floats are accepted as long as they hold an integer that fits
+		// in this type, or WithTruncateFloats is in effect
+		fmt.Fprintf(dst, "\ncase Float, Double:")
+		fmt.Fprintf(dst, "\nx, err := d.decodeFloatAsInteger(Code(code), reflect.%s)", util.Ucfirst(typ.String()))
+		fmt.Fprintf(dst, "\nif err != nil {")
+		fmt.Fprintf(dst, "\nreturn err")
+		fmt.Fprintf(dst, "\n}")
+		fmt.Fprintf(dst, "\n*v = %s(x)", typ)
+		fmt.Fprintf(dst, "\nreturn nil")
 		fmt.Fprintf(dst, "\n}") // end switch Code(code)
-		fmt.Fprintf(dst, "\nreturn errors.Errorf(`msgpack: invalid numeric type %%s for %s`, Code(code))", typ)
+		fmt.Fprintf(dst, "\nreturn d.invalidCode(Code(code), errors.Errorf(`msgpack: invalid numeric type %%s for %s`, Code(code)))", typ)
 		fmt.Fprintf(dst, "\n}")
 	}
 	return nil
@@ -155,7 +177,7 @@ func generateFloatTypes(dst io.Writer) error {
 		fmt.Fprintf(dst, "\nreturn errors.Wrap(err, `msgpack: failed to read %s`)", typ)
 		fmt.Fprintf(dst, "\n}")
 		fmt.Fprintf(dst, "\n\nif code != %s.Byte() {", data.Code)
-		fmt.Fprintf(dst, "\nreturn errors.Errorf(`msgpack: expected %s, got %%s`, Code(code))", data.Code)
+		fmt.Fprintf(dst, "\nreturn d.invalidCode(Code(code), errors.Errorf(`msgpack: expected %s, got %%s`, Code(code)))", data.Code)
 		fmt.Fprintf(dst, "\n}")
 		fmt.Fprintf(dst, "\n\n*v = math.Float%dfrombits(x)", data.Bits)
 		fmt.Fprintf(dst, "\nreturn nil")
@@ -0,0 +1,143 @@
+package journal
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+)
+
+// BlobRefExtType is the msgpack extension type used to reference a
+// deduplicated blob from within a record payload. The extension payload
+// is the SHA-256 hash of the blob. Journals written with WithBlobDedup
+// must not use this extension type for anything else
+const BlobRefExtType = 127
+
+// Blobs are stored as a msgpack array of 2 elements, before the first
+// record that references them: [hash (bin), data (bin)]
+const blobFields = 2
+
+type blobHash [sha256.Size]byte
+
+// rewriteValues copies the msgpack value at the beginning of src to
+// dst, replacing leaf values for which fn returns true. fn is called
+// with the complete leaf value, including its header of hdr bytes.
+// Nested values are tracked with a counter instead of recursion, so
+// that deeply nested payloads cannot exhaust the stack. The remainder
+// of src is returned
+func rewriteValues(dst *bytes.Buffer, src []byte, fn func(dst *bytes.Buffer, code msgpack.Code, hdr int, value []byte) (bool, error)) ([]byte, error) {
+	rest := src
+	pending := uint64(1)
+	for pending > 0 {
+		// Every value takes at least one byte
+		if pending > uint64(len(rest)) {
+			return nil, errors.New(`journal: unexpected end of payload`)
+		}
+
+		hdr, size, children, err := msgpack.ScanHeader(rest)
+		if err != nil {
+			return nil, errors.Wrap(err, `journal: invalid value in payload`)
+		}
+
+		value := rest[:hdr+size]
+		rest = rest[hdr+size:]
+		pending = pending - 1 + children
+		if children > 0 {
+			dst.Write(value)
+			continue
+		}
+
+		replaced, err := fn(dst, msgpack.Code(value[0]), hdr, value)
+		if err != nil {
+			return nil, err
+		}
+		if !replaced {
+			dst.Write(value)
+		}
+	}
+	return rest, nil
+}
+
+func isBin(c msgpack.Code) bool {
+	return c == msgpack.Bin8 || c == msgpack.Bin16 || c == msgpack.Bin32
+}
+
+// blobRef returns the hash referenced by value, if it is a blob reference
+func blobRef(code msgpack.Code, hdr int, value []byte) (blobHash, bool) {
+	var h blobHash
+	if code != msgpack.Ext8 || len(value) != hdr+len(h) || int8(value[hdr-1]) != BlobRefExtType {
+		return h, false
+	}
+	copy(h[:], value[hdr:])
+	return h, true
+}
+
+func writeBlobRef(dst *bytes.Buffer, h blobHash) {
+	dst.WriteByte(msgpack.Ext8.Byte())
+	dst.WriteByte(byte(len(h)))
+	dst.WriteByte(byte(BlobRefExtType))
+	dst.Write(h[:])
+}
+
+// dedupPayload replaces bin values of at least threshold bytes in
+// payload with blob references. Blobs that are not in seen are
+// returned, and must be written before the record
+func dedupPayload(payload []byte, threshold int, seen map[blobHash]struct{}) ([]byte, []blobHash, [][]byte, error) {
+	var hashes []blobHash
+	var blobs [][]byte
+	pending := make(map[blobHash]struct{})
+	var buf bytes.Buffer
+	rest, err := rewriteValues(&buf, payload, func(dst *bytes.Buffer, code msgpack.Code, hdr int, value []byte) (bool, error) {
+		if !isBin(code) || len(value)-hdr < threshold {
+			return false, nil
+		}
+
+		data := value[hdr:]
+		h := blobHash(sha256.Sum256(data))
+		_, written := seen[h]
+		_, ok := pending[h]
+		if !written && !ok {
+			pending[h] = struct{}{}
+			hashes = append(hashes, h)
+			blobs = append(blobs, data)
+		}
+		writeBlobRef(dst, h)
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, `journal: failed to deduplicate record payload`)
+	}
+	if len(rest) > 0 {
+		return nil, nil, nil, errors.New(`journal: trailing data after record payload`)
+	}
+	return buf.Bytes(), hashes, blobs, nil
+}
+
+// resolvePayload replaces blob references in payload with the blobs
+// that they refer to
+func resolvePayload(payload []byte, blobs map[blobHash][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	rest, err := rewriteValues(&buf, payload, func(dst *bytes.Buffer, code msgpack.Code, hdr int, value []byte) (bool, error) {
+		h, ok := blobRef(code, hdr, value)
+		if !ok {
+			return false, nil
+		}
+
+		data, ok := blobs[h]
+		if !ok {
+			return false, errors.Errorf(`journal: reference to unknown blob %x`, h[:])
+		}
+		if err := msgpack.NewEncoder(dst).EncodeBytes(data); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, `journal: failed to resolve blob references`)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New(`journal: trailing data after record payload`)
+	}
+	return buf.Bytes(), nil
+}
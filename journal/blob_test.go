@@ -0,0 +1,154 @@
+package journal_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/lestrrat-go/msgpack/journal"
+	"github.com/stretchr/testify/assert"
+)
+
+type logEntry struct {
+	Message    string
+	Attachment []byte
+}
+
+func TestBlobDedup(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	attachment := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	other := bytes.Repeat([]byte("fedcba9876543210"), 1024)
+
+	entries := []logEntry{
+		{Message: "first", Attachment: attachment},
+		{Message: "second", Attachment: attachment},
+		{Message: "third", Attachment: other},
+		{Message: "small", Attachment: []byte("tiny")},
+		{Message: "fourth", Attachment: attachment},
+	}
+
+	write := func(t *testing.T, options ...journal.Option) []byte {
+		var buf bytes.Buffer
+		w := journal.NewWriter(&buf, options...)
+		for _, entry := range entries {
+			if !assert.NoError(t, w.Append(journal.Metadata{Timestamp: now}, entry), "Append should succeed") {
+				return nil
+			}
+		}
+		return buf.Bytes()
+	}
+
+	readAll := func(t *testing.T, data []byte) []logEntry {
+		var result []logEntry
+		r := journal.NewReader(bytes.NewReader(data))
+		for {
+			var rec journal.Record
+			if err := r.Next(&rec); err != nil {
+				if !assert.Equal(t, io.EOF, err, "Next should return io.EOF") {
+					return nil
+				}
+				return result
+			}
+
+			var entry logEntry
+			if !assert.NoError(t, rec.Decode(&entry), "Decode should succeed") {
+				return nil
+			}
+			result = append(result, entry)
+		}
+	}
+
+	plain := write(t)
+	deduped := write(t, journal.WithBlobDedup(1024))
+
+	t.Run("space savings", func(t *testing.T) {
+		// Each blob is stored once instead of once per record
+		if !assert.True(t, len(deduped)*10 < len(plain)*6, "deduplicated journal should be much smaller (%d vs %d)", len(deduped), len(plain)) {
+			return
+		}
+		if !assert.Equal(t, 1, bytes.Count(deduped, attachment), "attachment should be stored once") {
+			return
+		}
+		if !assert.Equal(t, 1, bytes.Count(deduped, other), "other attachment should be stored once") {
+			return
+		}
+	})
+	t.Run("transparent reads", func(t *testing.T) {
+		if !assert.Equal(t, entries, readAll(t, deduped), "entries should match") {
+			return
+		}
+	})
+	t.Run("replay", func(t *testing.T) {
+		r := journal.NewReplayer(bytes.NewReader(deduped), journal.Filter{})
+		var count int
+		for {
+			var rec journal.Record
+			if err := r.Next(&rec); err != nil {
+				break
+			}
+			var entry logEntry
+			if !assert.NoError(t, rec.Decode(&entry), "Decode should succeed") {
+				return
+			}
+			if !assert.Equal(t, entries[count], entry, "entry should match") {
+				return
+			}
+			count++
+		}
+		if !assert.Equal(t, len(entries), count, "all entries should be replayed") {
+			return
+		}
+	})
+	t.Run("compact", func(t *testing.T) {
+		var inflated bytes.Buffer
+		if _, _, err := journal.Compact(&inflated, bytes.NewReader(deduped), now); !assert.NoError(t, err, "Compact should succeed") {
+			return
+		}
+		if !assert.Equal(t, plain, inflated.Bytes(), "compacting without dedup should inline blobs") {
+			return
+		}
+
+		var compacted bytes.Buffer
+		if _, _, err := journal.Compact(&compacted, bytes.NewReader(plain), now, journal.WithBlobDedup(1024)); !assert.NoError(t, err, "Compact should succeed") {
+			return
+		}
+		if !assert.Equal(t, deduped, compacted.Bytes(), "compacting with dedup should deduplicate blobs") {
+			return
+		}
+	})
+	t.Run("deep nesting", func(t *testing.T) {
+		const depth = 1000000
+		payload := append(bytes.Repeat([]byte{msgpack.FixArray1.Byte()}, depth), msgpack.Nil.Byte())
+
+		var buf bytes.Buffer
+		w := journal.NewWriter(&buf, journal.WithBlobDedup(1024))
+		if !assert.NoError(t, w.AppendRecord(journal.Record{Metadata: journal.Metadata{Timestamp: now}, Payload: payload}), "AppendRecord should succeed") {
+			return
+		}
+		if !assert.Error(t, w.AppendRecord(journal.Record{Metadata: journal.Metadata{Timestamp: now}, Payload: payload[:depth]}), "AppendRecord should fail when the innermost value is missing") {
+			return
+		}
+
+		r := journal.NewReader(&buf)
+		var rec journal.Record
+		if !assert.NoError(t, r.Next(&rec), "Next should succeed") {
+			return
+		}
+		if !assert.Equal(t, payload, rec.Payload, "payload should match") {
+			return
+		}
+	})
+	t.Run("corrupted blob", func(t *testing.T) {
+		corrupted := append([]byte(nil), deduped...)
+		i := bytes.Index(corrupted, attachment)
+		corrupted[i] ^= 0xff
+
+		r := journal.NewReader(bytes.NewReader(corrupted))
+		var rec journal.Record
+		if !assert.Error(t, r.Next(&rec), "Next should fail") {
+			return
+		}
+	})
+}
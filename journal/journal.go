@@ -0,0 +1,278 @@
+// Package journal implements an append-only log of msgpack encoded
+// records, where each record carries a small metadata header
+// (timestamp, TTL, and attempt count). This is the typical building
+// block for disk-backed retry queues.
+package journal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+)
+
+// Each record is stored as a msgpack array of 4 elements:
+// [timestamp (unix nanoseconds), TTL (nanoseconds), attempts, payload (bin)]
+const recordFields = 4
+
+// Metadata is the per-record metadata
+type Metadata struct {
+	// Timestamp is the time when the record was created
+	Timestamp time.Time
+	// TTL is the duration after Timestamp after which the record is
+	// considered to be expired. Zero means the record never expires
+	TTL time.Duration
+	// Attempts is the number of times the record has been processed
+	Attempts int
+}
+
+// Expired returns true if the record has expired at the given time
+func (m Metadata) Expired(now time.Time) bool {
+	if m.TTL <= 0 {
+		return false
+	}
+	return !now.Before(m.Timestamp.Add(m.TTL))
+}
+
+// Record is a single entry in the journal
+type Record struct {
+	Metadata
+	// Payload is the msgpack encoded user data
+	Payload []byte
+}
+
+// Decode decodes the payload of the record into v
+func (r Record) Decode(v interface{}) error {
+	if err := msgpack.Unmarshal(r.Payload, v); err != nil {
+		return errors.Wrap(err, `journal: failed to decode record payload`)
+	}
+	return nil
+}
+
+// Writer appends records to a journal
+type Writer struct {
+	enc           *msgpack.Encoder
+	blobThreshold int
+	blobs         map[blobHash]struct{}
+}
+
+// Option configures a Writer
+type Option func(*Writer)
+
+// WithBlobDedup enables deduplication of large binary values. Binary
+// values of at least threshold bytes anywhere in a record payload are
+// stored only once per journal, and are replaced by a reference (an
+// extension of type BlobRefExtType holding the SHA-256 hash of the
+// value) in the record. Reader resolves the references transparently.
+//
+// This is useful for log pipelines that attach the same large blobs to
+// many records. Note that a Reader keeps every blob that it has seen in
+// memory, as any later record may refer to it
+func WithBlobDedup(threshold int) Option {
+	return func(w *Writer) {
+		if threshold < 1 {
+			threshold = 1
+		}
+		w.blobThreshold = threshold
+	}
+}
+
+// NewWriter creates a new Writer that writes to w
+func NewWriter(w io.Writer, options ...Option) *Writer {
+	jw := &Writer{
+		enc: msgpack.NewEncoder(w),
+	}
+	for _, option := range options {
+		option(jw)
+	}
+	if jw.blobThreshold > 0 {
+		jw.blobs = make(map[blobHash]struct{})
+	}
+	return jw
+}
+
+// Append encodes v and appends it to the journal, along with meta
+func (w *Writer) Append(meta Metadata, v interface{}) error {
+	payload, err := msgpack.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, `journal: failed to encode record payload`)
+	}
+
+	return w.AppendRecord(Record{Metadata: meta, Payload: payload})
+}
+
+// AppendRecord appends a record whose payload has already been encoded
+func (w *Writer) AppendRecord(r Record) error {
+	payload := r.Payload
+	if w.blobThreshold > 0 {
+		deduped, hashes, blobs, err := dedupPayload(payload, w.blobThreshold, w.blobs)
+		if err != nil {
+			return err
+		}
+		for i, h := range hashes {
+			if err := w.appendBlob(h, blobs[i]); err != nil {
+				return err
+			}
+			w.blobs[h] = struct{}{}
+		}
+		payload = deduped
+	}
+
+	if err := w.enc.EncodeArrayHeader(recordFields); err != nil {
+		return errors.Wrap(err, `journal: failed to encode record header`)
+	}
+	if err := w.enc.EncodeInt64(r.Timestamp.UnixNano()); err != nil {
+		return errors.Wrap(err, `journal: failed to encode record timestamp`)
+	}
+	if err := w.enc.EncodeInt64(int64(r.TTL)); err != nil {
+		return errors.Wrap(err, `journal: failed to encode record TTL`)
+	}
+	if err := w.enc.EncodeInt64(int64(r.Attempts)); err != nil {
+		return errors.Wrap(err, `journal: failed to encode record attempts`)
+	}
+	if err := w.enc.EncodeBytes(payload); err != nil {
+		return errors.Wrap(err, `journal: failed to encode record payload`)
+	}
+	return nil
+}
+
+func (w *Writer) appendBlob(h blobHash, data []byte) error {
+	if err := w.enc.EncodeArrayHeader(blobFields); err != nil {
+		return errors.Wrap(err, `journal: failed to encode blob header`)
+	}
+	if err := w.enc.EncodeBytes(h[:]); err != nil {
+		return errors.Wrap(err, `journal: failed to encode blob hash`)
+	}
+	if err := w.enc.EncodeBytes(data); err != nil {
+		return errors.Wrap(err, `journal: failed to encode blob`)
+	}
+	return nil
+}
+
+// Reader reads records from a journal
+type Reader struct {
+	dec   *msgpack.Decoder
+	blobs map[blobHash][]byte
+}
+
+// NewReader creates a new Reader that reads from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		dec: msgpack.NewDecoder(r),
+	}
+}
+
+// Next reads the next record from the journal. io.EOF is returned
+// when there are no more records. References to deduplicated blobs
+// (see WithBlobDedup) are resolved before the record is returned
+func (r *Reader) Next(rec *Record) error {
+	for {
+		if _, err := r.dec.PeekCode(); err != nil {
+			if errors.Cause(err) == io.EOF {
+				return io.EOF
+			}
+			return errors.Wrap(err, `journal: failed to read record`)
+		}
+
+		var l int
+		if err := r.dec.DecodeArrayLength(&l); err != nil {
+			return errors.Wrap(err, `journal: failed to decode record header`)
+		}
+
+		switch l {
+		case recordFields:
+			return r.readRecord(rec)
+		case blobFields:
+			if err := r.readBlob(); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf(`journal: invalid record length %d (expected %d)`, l, recordFields)
+		}
+	}
+}
+
+func (r *Reader) readBlob() error {
+	var hash, data []byte
+	if err := r.dec.DecodeBytes(&hash); err != nil {
+		return errors.Wrap(err, `journal: failed to decode blob hash`)
+	}
+	if err := r.dec.DecodeBytes(&data); err != nil {
+		return errors.Wrap(err, `journal: failed to decode blob`)
+	}
+
+	h := blobHash(sha256.Sum256(data))
+	if !bytes.Equal(hash, h[:]) {
+		return errors.Errorf(`journal: blob does not match its hash %x`, hash)
+	}
+
+	if r.blobs == nil {
+		r.blobs = make(map[blobHash][]byte)
+	}
+	r.blobs[h] = data
+	return nil
+}
+
+func (r *Reader) readRecord(rec *Record) error {
+	var ts, ttl, attempts int64
+	if err := r.dec.DecodeInt64(&ts); err != nil {
+		return errors.Wrap(err, `journal: failed to decode record timestamp`)
+	}
+	if err := r.dec.DecodeInt64(&ttl); err != nil {
+		return errors.Wrap(err, `journal: failed to decode record TTL`)
+	}
+	if err := r.dec.DecodeInt64(&attempts); err != nil {
+		return errors.Wrap(err, `journal: failed to decode record attempts`)
+	}
+
+	var payload []byte
+	if err := r.dec.DecodeBytes(&payload); err != nil {
+		return errors.Wrap(err, `journal: failed to decode record payload`)
+	}
+
+	if len(r.blobs) > 0 {
+		resolved, err := resolvePayload(payload, r.blobs)
+		if err != nil {
+			return err
+		}
+		payload = resolved
+	}
+
+	rec.Timestamp = time.Unix(0, ts)
+	rec.TTL = time.Duration(ttl)
+	rec.Attempts = int(attempts)
+	rec.Payload = payload
+	return nil
+}
+
+// Compact copies the records in src to dst, dropping those that have
+// expired at the given time. It returns the number of records that
+// were kept and dropped. The options are used to configure the Writer
+// for dst, so blobs are only deduplicated in dst if WithBlobDedup is
+// given, regardless of how src was written
+func Compact(dst io.Writer, src io.Reader, now time.Time, options ...Option) (kept int, dropped int, err error) {
+	r := NewReader(src)
+	w := NewWriter(dst, options...)
+	for {
+		var rec Record
+		if err := r.Next(&rec); err != nil {
+			if err == io.EOF {
+				return kept, dropped, nil
+			}
+			return kept, dropped, errors.Wrap(err, `journal: failed to read record during compaction`)
+		}
+
+		if rec.Expired(now) {
+			dropped++
+			continue
+		}
+
+		if err := w.AppendRecord(rec); err != nil {
+			return kept, dropped, errors.Wrap(err, `journal: failed to write record during compaction`)
+		}
+		kept++
+	}
+}
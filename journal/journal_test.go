@@ -0,0 +1,120 @@
+package journal_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/lestrrat-go/msgpack/journal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	var buf bytes.Buffer
+	w := journal.NewWriter(&buf)
+	records := []struct {
+		Meta    journal.Metadata
+		Payload string
+	}{
+		{Meta: journal.Metadata{Timestamp: now.Add(-time.Hour), TTL: time.Minute}, Payload: "expired"},
+		{Meta: journal.Metadata{Timestamp: now.Add(-time.Hour)}, Payload: "no ttl"},
+		{Meta: journal.Metadata{Timestamp: now, TTL: time.Minute, Attempts: 3}, Payload: "fresh"},
+	}
+	for _, rec := range records {
+		if !assert.NoError(t, w.Append(rec.Meta, rec.Payload), "Append should succeed") {
+			return
+		}
+	}
+
+	t.Run("read", func(t *testing.T) {
+		r := journal.NewReader(bytes.NewReader(buf.Bytes()))
+		for _, expected := range records {
+			var rec journal.Record
+			if !assert.NoError(t, r.Next(&rec), "Next should succeed") {
+				return
+			}
+
+			if !assert.True(t, expected.Meta.Timestamp.Equal(rec.Timestamp), "Timestamp should match") {
+				return
+			}
+			if !assert.Equal(t, expected.Meta.TTL, rec.TTL, "TTL should match") {
+				return
+			}
+			if !assert.Equal(t, expected.Meta.Attempts, rec.Attempts, "Attempts should match") {
+				return
+			}
+
+			var s string
+			if !assert.NoError(t, rec.Decode(&s), "Decode should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected.Payload, s, "Payload should match") {
+				return
+			}
+		}
+
+		var rec journal.Record
+		if !assert.Equal(t, io.EOF, r.Next(&rec), "Next should return io.EOF") {
+			return
+		}
+	})
+	t.Run("read one byte at a time", func(t *testing.T) {
+		r := journal.NewReader(iotest.OneByteReader(bytes.NewReader(buf.Bytes())))
+		for _, expected := range records {
+			var rec journal.Record
+			if !assert.NoError(t, r.Next(&rec), "Next should succeed") {
+				return
+			}
+
+			var s string
+			if !assert.NoError(t, rec.Decode(&s), "Decode should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected.Payload, s, "Payload should match") {
+				return
+			}
+		}
+
+		var rec journal.Record
+		if !assert.Equal(t, io.EOF, r.Next(&rec), "Next should return io.EOF") {
+			return
+		}
+	})
+	t.Run("compact", func(t *testing.T) {
+		var dst bytes.Buffer
+		kept, dropped, err := journal.Compact(&dst, bytes.NewReader(buf.Bytes()), now)
+		if !assert.NoError(t, err, "Compact should succeed") {
+			return
+		}
+		if !assert.Equal(t, 2, kept, "2 records should be kept") {
+			return
+		}
+		if !assert.Equal(t, 1, dropped, "1 record should be dropped") {
+			return
+		}
+
+		var payloads []string
+		r := journal.NewReader(&dst)
+		for {
+			var rec journal.Record
+			if err := r.Next(&rec); err != nil {
+				if !assert.Equal(t, io.EOF, err, "Next should return io.EOF") {
+					return
+				}
+				break
+			}
+			var s string
+			if !assert.NoError(t, rec.Decode(&s), "Decode should succeed") {
+				return
+			}
+			payloads = append(payloads, s)
+		}
+		if !assert.Equal(t, []string{"no ttl", "fresh"}, payloads, "remaining payloads should match") {
+			return
+		}
+	})
+}
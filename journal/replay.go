@@ -0,0 +1,79 @@
+package journal
+
+import (
+	"io"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+)
+
+// Filter describes which records a Replayer should return
+type Filter struct {
+	// Since, if non-zero, excludes records whose timestamp is before it
+	Since time.Time
+	// Until, if non-zero, excludes records whose timestamp is at or after it
+	Until time.Time
+	// Keys lists the keys of the record payload (which must be a map)
+	// that are passed to Predicate. Other keys are never decoded
+	Keys []string
+	// Predicate, if non-nil, is called with the values for Keys that
+	// exist in the record payload. Records for which Predicate
+	// returns false are excluded
+	Predicate func(map[string]*msgpack.Value) bool
+}
+
+// Replayer reads records from a journal, returning only those that
+// match a Filter. Records are filtered on their metadata first, and
+// the payload is only partially decoded when a Predicate is given,
+// so that backfill jobs do not pay the cost of decoding records that
+// they are going to discard anyway
+type Replayer struct {
+	src    *Reader
+	filter Filter
+}
+
+// NewReplayer creates a new Replayer reading from r
+func NewReplayer(r io.Reader, filter Filter) *Replayer {
+	return &Replayer{
+		src:    NewReader(r),
+		filter: filter,
+	}
+}
+
+func (f Filter) matchTime(ts time.Time) bool {
+	if !f.Since.IsZero() && ts.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !ts.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Next reads the next matching record. io.EOF is returned when
+// there are no more records
+func (r *Replayer) Next(rec *Record) error {
+	for {
+		if err := r.src.Next(rec); err != nil {
+			return err
+		}
+
+		if !r.filter.matchTime(rec.Timestamp) {
+			continue
+		}
+
+		if r.filter.Predicate == nil {
+			return nil
+		}
+
+		values, err := msgpack.LookupKeys(rec.Payload, r.filter.Keys...)
+		if err != nil {
+			return errors.Wrap(err, `journal: failed to look up keys in record payload`)
+		}
+
+		if r.filter.Predicate(values) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package journal_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/lestrrat-go/msgpack/journal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayer(t *testing.T) {
+	base := time.Unix(1234567890, 0)
+
+	var buf bytes.Buffer
+	w := journal.NewWriter(&buf)
+	for i, level := range []string{"info", "error", "info", "error", "error"} {
+		meta := journal.Metadata{Timestamp: base.Add(time.Duration(i) * time.Minute)}
+		payload := map[string]interface{}{
+			"level": level,
+			"seq":   int64(i),
+		}
+		if !assert.NoError(t, w.Append(meta, payload), "Append should succeed") {
+			return
+		}
+	}
+
+	replay := func(t *testing.T, filter journal.Filter) []int64 {
+		var list []int64
+		r := journal.NewReplayer(bytes.NewReader(buf.Bytes()), filter)
+		for {
+			var rec journal.Record
+			if err := r.Next(&rec); err != nil {
+				assert.Equal(t, io.EOF, err, "Next should return io.EOF")
+				return list
+			}
+
+			var payload map[string]interface{}
+			if !assert.NoError(t, rec.Decode(&payload), "Decode should succeed") {
+				return nil
+			}
+			list = append(list, payload["seq"].(int64))
+		}
+	}
+
+	t.Run("no filter", func(t *testing.T) {
+		if !assert.Equal(t, []int64{0, 1, 2, 3, 4}, replay(t, journal.Filter{}), "all records should be returned") {
+			return
+		}
+	})
+	t.Run("time range", func(t *testing.T) {
+		filter := journal.Filter{
+			Since: base.Add(time.Minute),
+			Until: base.Add(3 * time.Minute),
+		}
+		if !assert.Equal(t, []int64{1, 2}, replay(t, filter), "records in range should be returned") {
+			return
+		}
+	})
+	t.Run("predicate", func(t *testing.T) {
+		filter := journal.Filter{
+			Since: base.Add(2 * time.Minute),
+			Keys:  []string{"level"},
+			Predicate: func(values map[string]*msgpack.Value) bool {
+				if _, ok := values["seq"]; ok {
+					t.Errorf("unselected key should not be decoded")
+				}
+				s, _ := values["level"].Str()
+				return s == "error"
+			},
+		}
+		if !assert.Equal(t, []int64{3, 4}, replay(t, filter), "matching records should be returned") {
+			return
+		}
+	})
+}
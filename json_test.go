@@ -0,0 +1,125 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeJSONValue(t *testing.T) {
+	t.Run("json.Number", func(t *testing.T) {
+		var list = []struct {
+			Number   json.Number
+			Expected interface{}
+		}{
+			{Number: json.Number("100"), Expected: int64(100)},
+			{Number: json.Number("-100"), Expected: int64(-100)},
+			{Number: json.Number("18446744073709551615"), Expected: uint64(math.MaxUint64)},
+			{Number: json.Number("1.5"), Expected: float64(1.5)},
+			{Number: json.Number("1e3"), Expected: float64(1000)},
+		}
+
+		for _, data := range list {
+			t.Run(data.Number.String(), func(t *testing.T) {
+				var expected bytes.Buffer
+				if !assert.NoError(t, msgpack.NewEncoder(&expected).Encode(data.Expected), "Encode should succeed") {
+					return
+				}
+
+				var buf bytes.Buffer
+				if !assert.NoError(t, msgpack.NewEncoder(&buf).Encode(data.Number), "Encode should succeed") {
+					return
+				}
+
+				if !assert.Equal(t, expected.Bytes(), buf.Bytes(), "Output should match") {
+					return
+				}
+			})
+		}
+	})
+	t.Run("invalid json.Number", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.Error(t, msgpack.NewEncoder(&buf).EncodeJSONValue(json.Number("foo")), "EncodeJSONValue should fail") {
+			return
+		}
+	})
+	t.Run("json.RawMessage", func(t *testing.T) {
+		raw := json.RawMessage(`{"foo": [1, 2.5, "three", true, null]}`)
+
+		b, err := msgpack.Marshal(raw)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var v map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+
+		expected := map[string]interface{}{
+			"foo": []interface{}{int64(1), float64(2.5), "three", true, nil},
+		}
+		if !assert.Equal(t, expected, v, "value should match") {
+			return
+		}
+	})
+	t.Run("json.RawMessage with trailing data", func(t *testing.T) {
+		for _, raw := range []string{`{"a":1} garbage`, `1 2`, `"foo"}`, `[1] [2]`} {
+			raw := raw
+			t.Run(raw, func(t *testing.T) {
+				var buf bytes.Buffer
+				if !assert.Error(t, msgpack.NewEncoder(&buf).EncodeJSONValue(json.RawMessage(raw)), "EncodeJSONValue should fail") {
+					return
+				}
+			})
+		}
+	})
+	t.Run("json.RawMessage with trailing whitespace", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeJSONValue(json.RawMessage("1 \n\t")), "EncodeJSONValue should succeed") {
+			return
+		}
+
+		var v interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &v), "Unmarshal should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, int64(1), v, "value should match") {
+			return
+		}
+	})
+	t.Run("empty json.RawMessage", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeJSONValue(json.RawMessage(nil)), "EncodeJSONValue should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, []byte{msgpack.Nil.Byte()}, buf.Bytes(), "Output should match") {
+			return
+		}
+	})
+	t.Run("map[string]json.RawMessage", func(t *testing.T) {
+		m := map[string]json.RawMessage{
+			"foo": json.RawMessage(`"bar"`),
+		}
+
+		b, err := msgpack.Marshal(m)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var v map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, map[string]interface{}{"foo": "bar"}, v, "value should match") {
+			return
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package msgpack
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// decodeStructKey decodes the next struct key into key, and returns
+// the index of the field that it maps to, if any. Integer keys are
+// only accepted for structs that have fields tagged with keyasint. key
+// is then set to the decimal form of the integer, so that it can be
+// used in error messages and passed to MsgpackFieldSetter
+func (d *Decoder) decodeStructKey(plan *structPlan, key *string) (int, bool, error) {
+	if plan.byInt != nil {
+		code, err := d.PeekCode()
+		if err != nil {
+			return 0, false, errors.Wrap(err, `msgpack: failed to peek code`)
+		}
+
+		switch {
+		case IsFixNumFamily(code):
+			d.raw.ReadByte()
+			return lookupIntKey(plan, int64(int8(code)), key)
+		case code == Int8 || code == Int16 || code == Int32 || code == Int64:
+			var k int64
+			if err := d.DecodeInt64(&k); err != nil {
+				return 0, false, err
+			}
+			return lookupIntKey(plan, k, key)
+		case code == Uint8 || code == Uint16 || code == Uint32 || code == Uint64:
+			var k uint64
+			if err := d.DecodeUint64(&k); err != nil {
+				return 0, false, err
+			}
+			if k > math.MaxInt64 {
+				// Too large to be the key of any field
+				*key = strconv.FormatUint(k, 10)
+				return 0, false, nil
+			}
+			return lookupIntKey(plan, int64(k), key)
+		}
+	}
+
+	if err := d.Decode(key); err != nil {
+		return 0, false, err
+	}
+	fi, ok := plan.byName[*key]
+	return fi, ok, nil
+}
+
+func lookupIntKey(plan *structPlan, k int64, key *string) (int, bool, error) {
+	*key = strconv.FormatInt(k, 10)
+	fi, ok := plan.byInt[k]
+	return fi, ok, nil
+}
@@ -0,0 +1,91 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type keyAsIntReading struct {
+	Sensor string  `msgpack:"1,keyasint"`
+	Value  float64 `msgpack:"2,keyasint"`
+	Unit   string  `msgpack:"200,keyasint,omitempty"`
+	Note   string  `msgpack:"note,keyasint,omitempty"`
+}
+
+func TestKeyAsInt(t *testing.T) {
+	t.Run("encode", func(t *testing.T) {
+		b, err := msgpack.Marshal(keyAsIntReading{Sensor: "t1", Value: 1.5, Unit: "C", Note: "ok"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		expected := []byte{
+			0x84,
+			0x01, 0xa2, 't', '1',
+			0x02, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+			// Keys use the smallest form
+			0xcc, 0xc8, 0xa1, 'C',
+			// keyasint is ignored for names that are not integers
+			0xa4, 'n', 'o', 't', 'e', 0xa2, 'o', 'k',
+		}
+		if !assert.Equal(t, expected, b, "fields should be encoded with integer keys") {
+			return
+		}
+
+		var decoded keyAsIntReading
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, keyAsIntReading{Sensor: "t1", Value: 1.5, Unit: "C", Note: "ok"}, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("decode", func(t *testing.T) {
+		b, err := msgpack.Marshal(map[int64]interface{}{1: "t1", 200: "C", -1: "unknown", 1 << 40: "unknown"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded keyAsIntReading
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should skip unknown keys") {
+			return
+		}
+		if !assert.Equal(t, keyAsIntReading{Sensor: "t1", Unit: "C"}, decoded, "values should match") {
+			return
+		}
+
+		b, err = msgpack.Marshal(map[uint64]interface{}{2: 2.5, 1 << 63: "unknown"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		err = msgpack.NewDecoder(bytes.NewReader(b), msgpack.WithDisallowUnknownFields()).Decode(&decoded)
+		unknown, ok := errors.Cause(err).(*msgpack.UnknownFieldError)
+		if !assert.True(t, ok, "Decode should return an UnknownFieldError (got %v)", err) {
+			return
+		}
+		if !assert.Equal(t, "9223372036854775808", unknown.Field, "field should be the decimal key") {
+			return
+		}
+	})
+	t.Run("canonical", func(t *testing.T) {
+		b, err := msgpack.CanonicalizeStruct(keyAsIntReading{Sensor: "t1", Value: 2, Unit: "C", Note: "ok"})
+		if !assert.NoError(t, err, "CanonicalizeStruct should succeed") {
+			return
+		}
+
+		expected := []byte{
+			0x84,
+			0x01, 0xa2, 't', '1',
+			0x02, 0xcb, 0x40, 0, 0, 0, 0, 0, 0, 0,
+			0xcc, 0xc8, 0xa1, 'C',
+			0xa4, 'n', 'o', 't', 'e', 0xa2, 'o', 'k',
+		}
+		if !assert.Equal(t, expected, b, "integer keys should come first") {
+			return
+		}
+	})
+}
@@ -0,0 +1,38 @@
+//go:build 386 || arm || mips || mipsle
+// +build 386 arm mips mipsle
+
+package msgpack_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLengthOverflow(t *testing.T) {
+	for _, code := range []msgpack.Code{msgpack.Str32, msgpack.Bin32, msgpack.Array32, msgpack.Map32} {
+		t.Run(code.String(), func(t *testing.T) {
+			var b = make([]byte, 5)
+			b[0] = code.Byte()
+			binary.BigEndian.PutUint32(b[1:], 0xffffffff)
+
+			var v interface{}
+			err := msgpack.Unmarshal(b, &v)
+			if !assert.Error(t, err, "Unmarshal should fail") {
+				return
+			}
+
+			lerr, ok := errors.Cause(err).(*msgpack.LengthOverflowError)
+			if !assert.True(t, ok, "error should be a LengthOverflowError (got %T)", errors.Cause(err)) {
+				return
+			}
+
+			if !assert.Equal(t, int64(0xffffffff), lerr.Length, "Length should match") {
+				return
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package msgpack
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMessageTooLarge is returned when a value exceeds the limit set
+// via WithMaxMessageBytes
+var ErrMessageTooLarge = errors.New(`msgpack: message exceeds maximum size`)
+
+// WithMaxMessageBytes limits the number of bytes that a single call to
+// Decoder.Decode may consume, including all of the nested values. Use
+// it when reading from untrusted peers: strings, binaries, arrays, and
+// maps whose declared lengths cannot possibly fit in what is left of
+// the limit are rejected before anything is allocated, and the
+// Decoder never reads past the limit from the underlying io.Reader,
+// so a peer cannot keep a Decode busy by sending an endless stream of
+// nested values either.
+//
+// Once ErrMessageTooLarge has been returned, the Decoder is positioned
+// in the middle of the message, and cannot be used anymore.
+// If n is zero, there is no limit (Decoder only)
+func WithMaxMessageBytes(n int64) Option {
+	return func(o *Options) {
+		o.MaxMessageBytes = n
+	}
+}
+
+// ErrMaxDepth is returned when a value is nested in more arrays and
+// maps than allowed via WithMaxDepth
+var ErrMaxDepth = errors.New(`msgpack: value exceeds maximum nesting depth`)
+
+// WithMaxDepth limits the number of arrays and maps that a value may be
+// nested in, so that a peer cannot make Decode recurse until the stack
+// is exhausted: an array holding a single array, holding a single
+// array, and so on, takes only a byte per level. A value nested
+// deeper than n causes ErrMaxDepth. If n is zero, there is no limit
+// (Decoder only)
+func WithMaxDepth(n int) Option {
+	return func(o *Options) {
+		o.MaxDepth = n
+	}
+}
+
+// descend records that the next value, whose code is given, is being
+// decoded, if it is an array or a map and MaxDepth is set. It returns
+// an error if that would nest it too deep. If descend reports that it
+// descended, ascend must be called once the value is decoded
+func (d *Decoder) descend(code Code) (bool, error) {
+	if !IsArrayFamily(code) && !IsMapFamily(code) {
+		return false, nil
+	}
+	if d.depth >= d.options.MaxDepth {
+		return false, errors.Wrapf(ErrMaxDepth, `msgpack: %s nested more than %d levels deep`, code, d.options.MaxDepth)
+	}
+	d.depth++
+	return true, nil
+}
+
+func (d *Decoder) ascend() {
+	d.depth--
+}
+
+// decodeNested decodes the next value into v, keeping track of how
+// deep it is nested
+func (d *Decoder) decodeNested(v interface{}) error {
+	code, err := d.PeekCode()
+	if err != nil {
+		// Let decode report the error
+		return d.decode(v)
+	}
+	descended, err := d.descend(code)
+	if err != nil {
+		return err
+	}
+	err = d.decode(v)
+	if descended {
+		d.ascend()
+	}
+	return err
+}
+
+// countingReader counts the bytes read from the underlying io.Reader.
+// If limit is non-zero, it refuses to read past that many bytes
+type countingReader struct {
+	src   io.Reader
+	n     int64
+	limit int64
+}
+
+func (r *countingReader) Read(buf []byte) (int, error) {
+	if r.limit > 0 {
+		remaining := r.limit - r.n
+		if remaining <= 0 {
+			return 0, ErrMessageTooLarge
+		}
+		if int64(len(buf)) > remaining {
+			buf = buf[:remaining]
+		}
+	}
+
+	n, err := r.src.Read(buf)
+	r.n += int64(n)
+	return n, err
+}
+
+// consumed returns the number of bytes that the Decoder has consumed.
+// Not available for sub-decoders created via Sub
+func (d *Decoder) consumed() int64 {
+	return d.counter.n - int64(d.raw.Buffered())
+}
+
+// decodeMessage decodes a top-level value, enforcing the limit set via
+// WithMaxMessageBytes, and reporting failures to the Logger. If the
+// stream ends before the value starts, io.EOF is returned as is, and if
+// it ends in the middle of the value, io.ErrUnexpectedEOF
+func (d *Decoder) decodeMessage(v interface{}) error {
+	start := d.consumed()
+	if err := d.startMessage(); err != nil {
+		return err
+	}
+	err := d.finishMessage(d.Decode(v))
+	if err != nil && d.options.Logger != nil {
+		d.logDebug(`msgpack: failed to decode value`, "type", reflect.TypeOf(v), "start", start, "error", err)
+	}
+	return err
+}
+
+// copyMessage is like copyValue, but enforces the limit set via
+// WithMaxMessageBytes like decodeMessage does, so that the values read
+// by Conn and Mux are bounded as well
+func (d *Decoder) copyMessage(w io.Writer) error {
+	if err := d.startMessage(); err != nil {
+		return err
+	}
+	return d.finishMessage(d.copyValue(w))
+}
+
+// startMessage puts the limit set via WithMaxMessageBytes in place for
+// the next top-level value. It returns io.EOF if the stream ends before
+// the value starts
+func (d *Decoder) startMessage() error {
+	if d.options.MaxMessageBytes > 0 {
+		d.messageEnd = d.consumed() + d.options.MaxMessageBytes
+		d.counter.limit = d.messageEnd
+	}
+
+	// Check for a clean EOF before we start reading the message, so
+	// that we can tell it apart from a truncated message. This is done
+	// once the limit is in place, so that the read ahead respects it
+	if _, err := d.raw.Peek(1); err == io.EOF {
+		d.counter.limit = 0
+		return io.EOF
+	}
+	d.inMessage = true
+	d.path = d.path[:0]
+	return nil
+}
+
+// finishMessage lifts the limit put in place by startMessage, once the
+// value has been read, and returns the error to report for it
+func (d *Decoder) finishMessage(err error) error {
+	d.inMessage = false
+	d.counter.limit = 0
+
+	if err == nil && d.options.MaxMessageBytes > 0 && d.consumed() > d.messageEnd {
+		// The message was read from what was already buffered
+		err = ErrMessageTooLarge
+	}
+	if errors.Cause(err) == io.EOF {
+		err = errors.Wrap(io.ErrUnexpectedEOF, err.Error())
+	}
+	return err
+}
+
+// checkMessageBytes makes sure that n more bytes can be consumed
+// without exceeding the limit set via WithMaxMessageBytes
+func (d *Decoder) checkMessageBytes(code Code, n int64) error {
+	if !d.inMessage || d.options.MaxMessageBytes <= 0 {
+		return nil
+	}
+	if remaining := d.messageEnd - d.consumed(); n > remaining {
+		return errors.Wrapf(ErrMessageTooLarge, `msgpack: %s declares %d bytes or elements, but only %d bytes are left`, code, n, remaining)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// repeatReader endlessly produces the same byte
+type repeatReader struct {
+	b    byte
+	read int64
+}
+
+func (r *repeatReader) Read(buf []byte) (int, error) {
+	for i := range buf {
+		buf[i] = r.b
+	}
+	r.read += int64(len(buf))
+	return len(buf), nil
+}
+
+func TestWithMaxMessageBytes(t *testing.T) {
+	t.Run("messages within the limit", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		for i := 0; i < 100; i++ {
+			if !assert.NoError(t, enc.Encode([]int64{1000, 2000, 3000}), "Encode should succeed") {
+				return
+			}
+		}
+
+		// Read all messages, even though the limit is smaller than the
+		// whole stream
+		dec := msgpack.NewDecoder(&buf, msgpack.WithMaxMessageBytes(28))
+		for i := 0; i < 100; i++ {
+			var l []int64
+			if !assert.NoError(t, dec.Decode(&l), "Decode should succeed (message %d)", i) {
+				return
+			}
+			if !assert.Equal(t, []int64{1000, 2000, 3000}, l, "values should match") {
+				return
+			}
+		}
+	})
+	t.Run("declared lengths", func(t *testing.T) {
+		for _, data := range [][]byte{
+			{msgpack.Str32.Byte(), 0x40, 0, 0, 0},
+			{msgpack.Bin32.Byte(), 0x40, 0, 0, 0},
+			{msgpack.Array32.Byte(), 0x40, 0, 0, 0},
+			{msgpack.Map32.Byte(), 0x40, 0, 0, 0},
+			{msgpack.Ext32.Byte(), 0x40, 0, 0, 0},
+		} {
+			dec := msgpack.NewDecoder(bytes.NewReader(data), msgpack.WithMaxMessageBytes(1024))
+			var v interface{}
+			err := dec.Decode(&v)
+			if !assert.Equal(t, msgpack.ErrMessageTooLarge, errors.Cause(err), "Decode should fail for %s", msgpack.Code(data[0])) {
+				return
+			}
+		}
+	})
+	t.Run("nested values", func(t *testing.T) {
+		// Every container is small, but there is no end to them
+		src := &repeatReader{b: msgpack.FixArray1.Byte()}
+		dec := msgpack.NewDecoder(src, msgpack.WithMaxMessageBytes(1024))
+		var v interface{}
+		err := dec.Decode(&v)
+		if !assert.Equal(t, msgpack.ErrMessageTooLarge, errors.Cause(err), "Decode should fail") {
+			return
+		}
+		if !assert.Equal(t, int64(1024), src.read, "nothing past the limit should be read") {
+			return
+		}
+	})
+	t.Run("buffered values", func(t *testing.T) {
+		data, err := msgpack.Marshal([]int64{1000, 2000, 3000})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		dec := msgpack.NewDecoder(io.MultiReader(bytes.NewReader(data), bytes.NewReader(data)), msgpack.WithMaxMessageBytes(int64(len(data))-1))
+		var l []int64
+		err = dec.Decode(&l)
+		if !assert.Equal(t, msgpack.ErrMessageTooLarge, errors.Cause(err), "Decode should fail") {
+			return
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package msgpack
+
+// Logger receives diagnostic messages from a Decoder, such as failed
+// decodes and skipped fields, along with alternating keys and values
+// that describe them. The method set matches that of *slog.Logger,
+// so one can be passed as is:
+//
+//	dec := msgpack.NewDecoder(r, msgpack.WithLogger(slog.Default()))
+//
+// The messages are emitted at debug level, and are meant to help
+// diagnose problems in production without instrumenting every call
+// site. The keys used are "type" (a Go type), "offset" (the position
+// in the stream where the problem was found), "start" (the position of
+// the value that was being decoded), "field", "ext_type", and "error"
+type Logger interface {
+	Debug(msg string, args ...interface{})
+}
+
+// WithLogger specifies a Logger that receives diagnostic messages
+// (Decoder only)
+func WithLogger(l Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// logDebug sends a message to the Logger, adding the current offset if
+// known. Callers should check that a Logger has been set first, to
+// avoid building args for nothing
+func (d *Decoder) logDebug(msg string, args ...interface{}) {
+	if d.options.Logger == nil {
+		return
+	}
+	if d.counter != nil {
+		args = append(args, "offset", d.consumed())
+	}
+	d.options.Logger.Debug(msg, args...)
+}
@@ -0,0 +1,102 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type logEntry struct {
+	msg  string
+	args map[string]interface{}
+}
+
+type recordingLogger struct {
+	entries []logEntry
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) {
+	entry := logEntry{msg: msg, args: make(map[string]interface{})}
+	for i := 0; i+1 < len(args); i += 2 {
+		entry.args[fmt.Sprint(args[i])] = args[i+1]
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func TestWithLogger(t *testing.T) {
+	type Narrow struct {
+		Name string `msgpack:"name"`
+	}
+	type Wide struct {
+		Name  string `msgpack:"name"`
+		Extra string `msgpack:"extra"`
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if !assert.NoError(t, enc.Encode(Wide{Name: "foo", Extra: "bar"}), "Encode should succeed") {
+		return
+	}
+	if !assert.NoError(t, enc.Encode("not a struct"), "Encode should succeed") {
+		return
+	}
+
+	var logger recordingLogger
+	dec := msgpack.NewDecoder(&buf, msgpack.WithLogger(&logger))
+
+	var n Narrow
+	if !assert.NoError(t, dec.Decode(&n), "Decode should succeed") {
+		return
+	}
+	if !assert.Len(t, logger.entries, 1, "skipped field should be logged") {
+		return
+	}
+	entry := logger.entries[0]
+	if !assert.Equal(t, "msgpack: skipped unknown field", entry.msg, "message should match") {
+		return
+	}
+	if !assert.Equal(t, "extra", entry.args["field"], "field should be logged") {
+		return
+	}
+	// The offset of the value of the skipped field: the map header,
+	// "name", "foo", and "extra"
+	if !assert.Equal(t, int64(1+5+4+6), entry.args["offset"], "offset should be logged") {
+		return
+	}
+
+	if !assert.Error(t, dec.Decode(&n), "Decode should fail") {
+		return
+	}
+	if !assert.Len(t, logger.entries, 2, "failure should be logged") {
+		return
+	}
+	entry = logger.entries[1]
+	if !assert.Equal(t, "msgpack: failed to decode value", entry.msg, "message should match") {
+		return
+	}
+	if !assert.Equal(t, int64(1+5+4+6+4), entry.args["start"], "start of the value should be logged") {
+		return
+	}
+	if !assert.NotNil(t, entry.args["error"], "error should be logged") {
+		return
+	}
+}
+
+func TestWithLoggerExtension(t *testing.T) {
+	var logger recordingLogger
+	dec := msgpack.NewDecoder(bytes.NewReader([]byte{msgpack.FixExt1.Byte(), 0x7e, 0x00}), msgpack.WithLogger(&logger))
+
+	var v interface{}
+	if !assert.Error(t, dec.Decode(&v), "Decode should fail") {
+		return
+	}
+	if !assert.Len(t, logger.entries, 2, "unregistered extension and failure should be logged") {
+		return
+	}
+	if !assert.Equal(t, 0x7e, logger.entries[0].args["ext_type"], "extension type should be logged") {
+		return
+	}
+}
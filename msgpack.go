@@ -8,39 +8,105 @@ package msgpack
 import (
 	"bytes"
 	"sync"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 )
 
+// maxPooledBufferSize is the capacity above which the buffers used by
+// Marshal are not returned to the pool, so that a single large value
+// does not keep a large buffer alive
+const maxPooledBufferSize = 64 * 1024
+
+// marshalState is what Marshal keeps in its pool: the buffer that
+// values are encoded into, and the Encoder that writes to it
+type marshalState struct {
+	buf appendingWriter
+	enc Encoder
+}
+
 var pool = sync.Pool{
-	New: allocAppendingWriter,
+	New: allocMarshalState,
 }
 
-func allocAppendingWriter() interface{} {
-	return newAppendingWriter(9)
+func allocMarshalState() interface{} {
+	atomic.AddInt64(&marshalBufferAllocs, 1)
+	s := &marshalState{}
+	s.buf.buf = make([]byte, 0, 9)
+	s.enc.dst = &s.buf
+	return s
 }
 
-func releaseAppendingWriter(w *appendingWriter) {
-	w.buf = w.buf[0:0]
-	pool.Put(w)
+func releaseMarshalState(s *marshalState) {
+	if cap(s.buf.buf) > maxPooledBufferSize {
+		return
+	}
+	s.buf.buf = s.buf.buf[0:0]
+	pool.Put(s)
+}
+
+// unmarshalState is what Unmarshal keeps in its pool: a Decoder and
+// the reader over the data it decodes, so that the read buffer of the
+// Decoder is reused
+type unmarshalState struct {
+	data bytes.Reader
+	dec  *Decoder
+}
+
+var unmarshalPool = sync.Pool{
+	New: func() interface{} {
+		s := &unmarshalState{}
+		s.dec = NewDecoder(&s.data)
+		return s
+	},
+}
+
+func releaseUnmarshalState(s *unmarshalState) {
+	// Drop the references to the data and the options
+	s.data.Reset(nil)
+	s.dec.Reset(&s.data)
+	s.dec.options = Options{}
+	unmarshalPool.Put(s)
 }
 
 // Marshal takes a Go value and serializes it in msgpack format.
+// The Encoder and the buffer that are used are taken from a pool, and
+// the returned slice is a copy that the caller owns
 func Marshal(v interface{}) ([]byte, error) {
-	var buf = pool.Get().(*appendingWriter) // newAppendingWriter(9)
-	defer releaseAppendingWriter(buf)
-	if err := NewEncoder(buf).Encode(v); err != nil {
+	atomic.AddInt64(&marshalBufferGets, 1)
+	s := pool.Get().(*marshalState)
+	defer releaseMarshalState(s)
+	if err := s.enc.Encode(v); err != nil {
 		return nil, errors.Wrap(err, `failed to marshal`)
 	}
-	return buf.Bytes(), nil
+
+	b := make([]byte, len(s.buf.buf))
+	copy(b, s.buf.buf)
+	return b, nil
 }
 
 // Unmarshal takes a byte slice and a pointer to a Go value and
-// deserializes the Go value from the data in msgpack format.
-func Unmarshal(data []byte, v interface{}) error {
-	buf := bytes.NewBuffer(data)
-	if err := NewDecoder(buf).Decode(v); err != nil {
+// deserializes the Go value from the data in msgpack format. The
+// Decoder that is used is taken from a pool.
+//
+// data must contain exactly one value: if there are bytes left after
+// it, a *TrailingBytesError is returned, unless WithAllowTrailingBytes
+// is specified
+func Unmarshal(data []byte, v interface{}, options ...Option) error {
+	s := unmarshalPool.Get().(*unmarshalState)
+	defer releaseUnmarshalState(s)
+
+	s.data.Reset(data)
+	dec := s.dec
+	dec.options = newOptions(options)
+	dec.Reset(&s.data)
+	if err := dec.Decode(v); err != nil {
 		return errors.Wrap(err, `failed to unmarshal`)
 	}
+	if !dec.options.AllowTrailingBytes {
+		if n := dec.raw.Buffered() + s.data.Len(); n > 0 {
+			return &TrailingBytesError{Count: n}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,35 @@
+// Package msgpackexpvar publishes the internal statistics of the msgpack
+// package via expvar. It lives in a separate package because importing
+// expvar registers the /debug/vars handler on http.DefaultServeMux,
+// which not every program wants.
+package msgpackexpvar
+
+import (
+	"expvar"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+)
+
+// DefaultName is the name under which Publish registers the variable
+// if no name is given
+const DefaultName = "msgpack"
+
+// Func returns an expvar.Func that reports msgpack.Internals()
+func Func() expvar.Func {
+	return expvar.Func(func() interface{} {
+		return msgpack.Internals()
+	})
+}
+
+// Publish registers the internal statistics of the msgpack package as
+// an expvar variable. If name is empty, DefaultName is used. Like
+// expvar.Publish, it panics if the name is already registered
+//
+//	msgpackexpvar.Publish("")
+//	http.ListenAndServe(":6060", nil) // see /debug/vars
+func Publish(name string) {
+	if name == "" {
+		name = DefaultName
+	}
+	expvar.Publish(name, Func())
+}
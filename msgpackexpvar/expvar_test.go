@@ -0,0 +1,32 @@
+package msgpackexpvar_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/lestrrat-go/msgpack/msgpackexpvar"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	msgpackexpvar.Publish("")
+
+	v := expvar.Get(msgpackexpvar.DefaultName)
+	if !assert.NotNil(t, v, "variable should be published") {
+		return
+	}
+
+	if _, err := msgpack.Marshal("Hello, World!"); !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	var stats msgpack.InternalStats
+	if !assert.NoError(t, json.Unmarshal([]byte(v.String()), &stats), "variable should be valid JSON") {
+		return
+	}
+	if !assert.True(t, stats.MarshalBufferGets > 0, "stats should be reported") {
+		return
+	}
+}
@@ -0,0 +1,126 @@
+package msgpacktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+)
+
+// Clock is a msgpack.Clock whose time only moves when Advance is
+// called, so that tests of time dependent code (heartbeats, backoff,
+// replay pacing) are deterministic, and do not need to sleep.
+//
+//	clock := msgpacktest.NewClock(time.Unix(0, 0))
+//	w := msgpack.NewRetryWriter(dst, msgpack.WithRetryClock(clock))
+//	go w.Write(msg)
+//	clock.BlockUntil(1) // wait for the writer to back off
+//	clock.Advance(time.Second)
+type Clock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*timer
+}
+
+type timer struct {
+	clock *Clock
+	due   time.Time
+	c     chan time.Time
+}
+
+// NewClock creates a new Clock, set to now
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current time of the clock
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer creates a timer that fires once the clock has been advanced
+// by d. A timer for a zero or negative duration fires immediately
+func (c *Clock) NewTimer(d time.Duration) msgpack.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &timer{
+		clock: c,
+		due:   c.now.Add(d),
+		c:     make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, and fires the timers that are
+// due, in order
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].due.Before(c.timers[j].due)
+	})
+
+	var pending []*timer
+	for _, t := range c.timers {
+		if t.due.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- t.due
+	}
+	c.timers = pending
+	c.cond.Broadcast()
+}
+
+// Timers returns the number of timers that have not fired, nor been
+// stopped yet
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil waits until at least n timers are waiting to fire. Use it
+// to make sure that the code under test has started waiting before
+// calling Advance
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
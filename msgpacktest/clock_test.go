@@ -0,0 +1,127 @@
+package msgpacktest_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/lestrrat-go/msgpack/msgpacktest"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+// flakyWriter fails the first n writes with a timeout
+type flakyWriter struct {
+	n   int
+	buf bytes.Buffer
+}
+
+func (w *flakyWriter) Write(b []byte) (int, error) {
+	if w.n > 0 {
+		w.n--
+		return 0, timeoutError{}
+	}
+	return w.buf.Write(b)
+}
+
+func TestClock(t *testing.T) {
+	t.Run("timers", func(t *testing.T) {
+		start := time.Unix(1000, 0)
+		clock := msgpacktest.NewClock(start)
+
+		t1 := clock.NewTimer(2 * time.Second)
+		t2 := clock.NewTimer(time.Second)
+		t3 := clock.NewTimer(3 * time.Second)
+		if !assert.True(t, t3.Stop(), "Stop should succeed for a pending timer") {
+			return
+		}
+		if !assert.Equal(t, 2, clock.Timers(), "stopped timers should not be counted") {
+			return
+		}
+
+		clock.Advance(time.Second)
+		if !assert.Equal(t, start.Add(time.Second), <-t2.C(), "timer should fire at its due time") {
+			return
+		}
+		select {
+		case <-t1.C():
+			t.Errorf("timer should not fire early")
+			return
+		default:
+		}
+
+		clock.Advance(5 * time.Second)
+		if !assert.Equal(t, start.Add(2*time.Second), <-t1.C(), "timer should fire at its due time") {
+			return
+		}
+		if !assert.False(t, t1.Stop(), "Stop should fail for a timer that has fired") {
+			return
+		}
+		if !assert.Equal(t, start.Add(6*time.Second), clock.Now(), "Now should reflect Advance") {
+			return
+		}
+	})
+	t.Run("RetryWriter", func(t *testing.T) {
+		clock := msgpacktest.NewClock(time.Unix(0, 0))
+		dst := &flakyWriter{n: 2}
+		w := msgpack.NewRetryWriter(dst, msgpack.WithRetryClock(clock), msgpack.WithBackoff(time.Minute, time.Hour))
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := w.Write([]byte{0xc0})
+			done <- err
+		}()
+
+		// The backoff is a minute, and then two, but no real time
+		// needs to pass
+		for _, d := range []time.Duration{time.Minute, 2 * time.Minute} {
+			clock.BlockUntil(1)
+			clock.Advance(d)
+		}
+		if !assert.NoError(t, <-done, "Write should succeed after retrying") {
+			return
+		}
+		if !assert.Equal(t, []byte{0xc0}, dst.buf.Bytes(), "message should be written") {
+			return
+		}
+	})
+	t.Run("Recorder and Replayer", func(t *testing.T) {
+		start := time.Unix(1000, 0)
+		clock := msgpacktest.NewClock(start)
+
+		var capture, wire bytes.Buffer
+		enc := msgpack.NewRecorder(&capture, msgpack.WithRecorderClock(clock)).Encoder(&wire)
+		for _, s := range []string{"foo", "bar"} {
+			if !assert.NoError(t, enc.Encode(s), "Encode should succeed") {
+				return
+			}
+			clock.Advance(time.Hour)
+		}
+
+		r := msgpack.NewReplayer(bytes.NewReader(capture.Bytes()), msgpack.WithReplayClock(clock))
+		var f msgpack.Frame
+		if !assert.NoError(t, r.Next(context.Background(), &f), "Next should succeed") {
+			return
+		}
+		if !assert.Equal(t, start, f.Time, "frame should be stamped by the clock") {
+			return
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- r.Next(context.Background(), &f) }()
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+		if !assert.NoError(t, <-done, "Next should succeed") {
+			return
+		}
+		if !assert.Equal(t, start.Add(time.Hour), f.Time, "frame should be stamped by the clock") {
+			return
+		}
+	})
+}
@@ -0,0 +1,145 @@
+// Package msgpacktest provides utilities for testing code that uses
+// the msgpack package, such as custom EncodeMsgpack/DecodeMsgpack
+// implementations.
+package msgpacktest
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+)
+
+// Option configures the stream created by Loopback
+type Option func(*pipe)
+
+// WithChunkSize limits the number of bytes that are returned from each
+// call to Read on the decoding side, emulating data that arrives in
+// small pieces (e.g. split across TCP segments)
+func WithChunkSize(n int) Option {
+	return func(p *pipe) {
+		p.chunk = n
+	}
+}
+
+// WithLatency makes each call to Read on the decoding side wait for
+// the specified duration before returning data
+func WithLatency(d time.Duration) Option {
+	return func(p *pipe) {
+		p.latency = d
+	}
+}
+
+// Pair is a connected Encoder/Decoder pair. Everything that is
+// encoded using Encoder can be decoded using Decoder.
+//
+// Writes never block, so it is safe to call Encode and Decode from the
+// same goroutine. Reads block until enough data has been encoded, or
+// until Close is called.
+type Pair struct {
+	Encoder *msgpack.Encoder
+	Decoder *msgpack.Decoder
+	pipe    *pipe
+}
+
+// Loopback creates a new Pair, connected via an in-memory pipe
+func Loopback(options ...Option) *Pair {
+	p := &pipe{}
+	p.cond = sync.NewCond(&p.mu)
+	for _, option := range options {
+		option(p)
+	}
+
+	return &Pair{
+		Encoder: msgpack.NewEncoder(p),
+		Decoder: msgpack.NewDecoder(reader{p}),
+		pipe:    p,
+	}
+}
+
+// Close closes the encoding side of the pipe. Once the decoding side
+// has consumed all remaining data, reads return io.EOF
+func (p *Pair) Close() error {
+	return p.pipe.Close()
+}
+
+// RoundTrip encodes in, and decodes the result into out, using a
+// Pair created with the given options
+func RoundTrip(in, out interface{}, options ...Option) error {
+	p := Loopback(options...)
+	defer p.Close()
+
+	if err := p.Encoder.Encode(in); err != nil {
+		return errors.Wrap(err, `msgpacktest: failed to encode value`)
+	}
+	p.Close()
+
+	if err := p.Decoder.Decode(out); err != nil {
+		return errors.Wrap(err, `msgpacktest: failed to decode value`)
+	}
+	return nil
+}
+
+type pipe struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	closed  bool
+	chunk   int
+	latency time.Duration
+}
+
+func (p *pipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p.buf = append(p.buf, b...)
+	p.cond.Broadcast()
+	return len(b), nil
+}
+
+func (p *pipe) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *pipe) read(b []byte) (int, error) {
+	if p.latency > 0 {
+		time.Sleep(p.latency)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.buf) == 0 {
+		if p.closed {
+			return 0, io.EOF
+		}
+		p.cond.Wait()
+	}
+
+	if p.chunk > 0 && len(b) > p.chunk {
+		b = b[:p.chunk]
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+// reader is the decoding side of the pipe. It is a separate type so
+// that the decoder does not see pipe's Write method
+type reader struct {
+	p *pipe
+}
+
+func (r reader) Read(b []byte) (int, error) {
+	return r.p.read(b)
+}
@@ -0,0 +1,88 @@
+package msgpacktest_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/msgpack/msgpacktest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type loopbackStruct struct {
+	Name  string
+	Count int64
+	Tags  []string
+}
+
+func TestLoopback(t *testing.T) {
+	t.Run("same goroutine", func(t *testing.T) {
+		p := msgpacktest.Loopback()
+		defer p.Close()
+
+		if !assert.NoError(t, p.Encoder.Encode("Hello, World!"), "Encode should succeed") {
+			return
+		}
+
+		var s string
+		if !assert.NoError(t, p.Decoder.Decode(&s), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, "Hello, World!", s, "values should match") {
+			return
+		}
+	})
+	t.Run("EOF after Close", func(t *testing.T) {
+		p := msgpacktest.Loopback()
+		p.Encoder.Encode(int64(1))
+		p.Close()
+
+		var v int64
+		if !assert.NoError(t, p.Decoder.Decode(&v), "Decode should succeed") {
+			return
+		}
+		err := p.Decoder.Decode(&v)
+		if !assert.Equal(t, io.EOF, errors.Cause(err), "Decode should return io.EOF") {
+			return
+		}
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		p := msgpacktest.Loopback(msgpacktest.WithLatency(time.Millisecond), msgpacktest.WithChunkSize(3))
+		defer p.Close()
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			p.Encoder.Encode("Hello, World!")
+		}()
+
+		var s string
+		if !assert.NoError(t, p.Decoder.Decode(&s), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, "Hello, World!", s, "values should match") {
+			return
+		}
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := loopbackStruct{Name: "foo", Count: 100, Tags: []string{"uno", "dos"}}
+	for _, chunk := range []int{0, 1, 2, 5} {
+		var out loopbackStruct
+		if !assert.NoError(t, msgpacktest.RoundTrip(in, &out, msgpacktest.WithChunkSize(chunk)), "RoundTrip should succeed (chunk = %d)", chunk) {
+			return
+		}
+		if !assert.Equal(t, in, out, "values should match (chunk = %d)", chunk) {
+			return
+		}
+	}
+
+	var b []byte
+	if !assert.NoError(t, msgpacktest.RoundTrip([]byte("Hello, World!"), &b, msgpacktest.WithChunkSize(1)), "RoundTrip should succeed") {
+		return
+	}
+	if !assert.Equal(t, []byte("Hello, World!"), b, "values should match") {
+		return
+	}
+}
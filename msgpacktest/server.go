@@ -0,0 +1,136 @@
+package msgpacktest
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+)
+
+// ErrServerClosed is returned by Server.Dial and Server.Client once
+// the Server has been closed
+var ErrServerClosed = errors.New(`msgpacktest: server closed`)
+
+// Handler serves a single connection to a Server. The connection is
+// closed when the Handler returns, and ctx is cancelled when the Server
+// is closed
+type Handler func(ctx context.Context, conn *msgpack.Conn)
+
+// Server is an in-process server for testing code that talks to peers
+// over a msgpack.Conn, in the spirit of net/http/httptest. Connections
+// are in-memory pipes, so tests do not need to open sockets, and can
+// run in parallel without picking ports.
+//
+//	srv := msgpacktest.NewServer(func(ctx context.Context, conn *msgpack.Conn) {
+//		var req Request
+//		for conn.Recv(ctx, &req) == nil {
+//			conn.Send(ctx, handle(req))
+//		}
+//	})
+//	defer srv.Close()
+//
+//	client, err := srv.Client()
+type Server struct {
+	handler Handler
+	options []msgpack.ConnOption
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+	conns  map[net.Conn]struct{}
+}
+
+// NewServer creates a new Server, which serves each connection with h.
+// The options are applied to the server side of every connection
+func NewServer(h Handler, options ...msgpack.ConnOption) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		handler: h,
+		options: options,
+		ctx:     ctx,
+		cancel:  cancel,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Dial opens a new connection to the server, and returns the client
+// side of it. Its signature matches msgpack.DialFunc, so that it can be
+// passed to msgpack.NewReconnectingConn, or wrapped in a multiplexer
+// via msgpack.NewMux
+func (s *Server) Dial(ctx context.Context) (io.ReadWriteCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	client, server := net.Pipe()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		client.Close()
+		server.Close()
+		return nil, ErrServerClosed
+	}
+	s.conns[server] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go s.serve(server)
+	return client, nil
+}
+
+// Client opens a new connection to the server, and returns it as a
+// msgpack.Conn created with the given options. Close it once done
+func (s *Server) Client(options ...msgpack.ConnOption) (*msgpack.Conn, error) {
+	rw, err := s.Dial(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.NewConn(rw, options...), nil
+}
+
+func (s *Server) serve(nc net.Conn) {
+	defer s.wg.Done()
+
+	conn := msgpack.NewConn(nc, s.options...)
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, nc)
+		s.mu.Unlock()
+	}()
+	s.handler(s.ctx, conn)
+}
+
+// CloseClientConnections closes the connections that are currently
+// open, without closing the Server, to test how clients handle a peer
+// that goes away. Clients see their connection fail, and may dial again
+func (s *Server) CloseClientConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for nc := range s.conns {
+		nc.Close()
+	}
+}
+
+// Close closes all connections, cancels the context passed to the
+// handlers, and waits for them to return. Dialing a closed Server
+// fails with ErrServerClosed
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.cancel()
+	s.CloseClientConnections()
+	s.wg.Wait()
+}
@@ -0,0 +1,123 @@
+package msgpacktest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/lestrrat-go/msgpack/msgpacktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func echo(ctx context.Context, conn *msgpack.Conn) {
+	var v interface{}
+	for conn.Recv(ctx, &v) == nil {
+		if conn.Send(ctx, v) != nil {
+			return
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("echo", func(t *testing.T) {
+		srv := msgpacktest.NewServer(echo)
+		defer srv.Close()
+
+		for i := 0; i < 2; i++ {
+			client, err := srv.Client()
+			if !assert.NoError(t, err, "Client should succeed") {
+				return
+			}
+			defer client.Close()
+
+			if !assert.NoError(t, client.Send(ctx, loopbackStruct{Name: "foo", Count: int64(i), Tags: []string{"bar"}}), "Send should succeed") {
+				return
+			}
+			var decoded loopbackStruct
+			if !assert.NoError(t, client.Recv(ctx, &decoded), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, loopbackStruct{Name: "foo", Count: int64(i), Tags: []string{"bar"}}, decoded, "values should match") {
+				return
+			}
+		}
+	})
+	t.Run("handler return closes connection", func(t *testing.T) {
+		srv := msgpacktest.NewServer(func(ctx context.Context, conn *msgpack.Conn) {
+			conn.Send(ctx, "bye")
+		})
+		defer srv.Close()
+
+		client, err := srv.Client()
+		if !assert.NoError(t, err, "Client should succeed") {
+			return
+		}
+		defer client.Close()
+
+		var s string
+		if !assert.NoError(t, client.Recv(ctx, &s), "Recv should succeed") {
+			return
+		}
+		if !assert.Equal(t, "bye", s, "values should match") {
+			return
+		}
+		if !assert.Error(t, client.Recv(ctx, &s), "Recv should fail once the handler returns") {
+			return
+		}
+	})
+	t.Run("Close", func(t *testing.T) {
+		started := make(chan struct{})
+		srv := msgpacktest.NewServer(func(ctx context.Context, conn *msgpack.Conn) {
+			close(started)
+			<-ctx.Done()
+		})
+
+		client, err := srv.Client()
+		if !assert.NoError(t, err, "Client should succeed") {
+			return
+		}
+		defer client.Close()
+		<-started
+
+		// Close waits for the handler, which only returns once its
+		// context is cancelled
+		srv.Close()
+
+		var v interface{}
+		if !assert.Error(t, client.Recv(ctx, &v), "Recv should fail after Close") {
+			return
+		}
+		_, err = srv.Client()
+		if !assert.Equal(t, msgpacktest.ErrServerClosed, err, "Client should fail after Close") {
+			return
+		}
+	})
+	t.Run("reconnect", func(t *testing.T) {
+		srv := msgpacktest.NewServer(echo)
+		defer srv.Close()
+
+		rc := msgpack.NewReconnectingConn(srv.Dial, msgpack.WithReconnectBackoff(time.Millisecond, time.Millisecond))
+		defer rc.Close()
+
+		for i := 0; i < 2; i++ {
+			if !assert.NoError(t, rc.Send(ctx, i), "Send should succeed") {
+				return
+			}
+			var v int
+			if !assert.NoError(t, rc.Recv(ctx, &v), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, i, v, "values should match") {
+				return
+			}
+
+			// Drop the connection: the next message goes through a
+			// new one
+			srv.CloseClientConnections()
+		}
+	})
+}
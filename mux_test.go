@@ -0,0 +1,303 @@
+package msgpack_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMux(t *testing.T) {
+	t.Run("independent streams", func(t *testing.T) {
+		left, right := net.Pipe()
+		m1 := msgpack.NewMux(left, msgpack.WithStreamWindow(2))
+		m2 := msgpack.NewMux(right, msgpack.WithStreamWindow(2))
+		defer m1.Close()
+		defer m2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		control1, bulk1 := m1.Stream(0), m1.Stream(1)
+		control2, bulk2 := m2.Stream(0), m2.Stream(1)
+
+		// Nobody reads from the bulk stream yet, so the sender runs out
+		// of window after 2 messages...
+		const count = 10
+		sent := make(chan error, 1)
+		go func() {
+			for i := 0; i < count; i++ {
+				if err := bulk1.Send(ctx, connMessage{ID: int64(i), Payload: "bulk"}); err != nil {
+					sent <- err
+					return
+				}
+			}
+			sent <- bulk1.Close()
+		}()
+
+		// ...but the control stream keeps flowing in both directions
+		for i := 0; i < 3; i++ {
+			if !assert.NoError(t, control1.Send(ctx, connMessage{ID: int64(i), Payload: "ping"}), "Send should succeed") {
+				return
+			}
+			var msg connMessage
+			if !assert.NoError(t, control2.Recv(ctx, &msg), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, connMessage{ID: int64(i), Payload: "ping"}, msg, "messages should match") {
+				return
+			}
+			if !assert.NoError(t, control2.Send(ctx, msg), "Send should succeed") {
+				return
+			}
+			if !assert.NoError(t, control1.Recv(ctx, &msg), "Recv should succeed") {
+				return
+			}
+		}
+
+		select {
+		case err := <-sent:
+			t.Errorf("bulk sender should be blocked by flow control (%v)", err)
+			return
+		default:
+		}
+
+		for i := 0; i < count; i++ {
+			var msg connMessage
+			if !assert.NoError(t, bulk2.Recv(ctx, &msg), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, connMessage{ID: int64(i), Payload: "bulk"}, msg, "messages should arrive in order") {
+				return
+			}
+		}
+		if !assert.NoError(t, <-sent, "bulk sender should finish") {
+			return
+		}
+
+		var msg connMessage
+		if !assert.Equal(t, io.EOF, bulk2.Recv(ctx, &msg), "Recv should return io.EOF after the peer closes the stream") {
+			return
+		}
+		if !assert.Equal(t, msgpack.ErrStreamClosed, bulk1.Send(ctx, msg), "Send should fail after Close") {
+			return
+		}
+	})
+	t.Run("stream not opened by peer", func(t *testing.T) {
+		left, right := net.Pipe()
+		m1 := msgpack.NewMux(left)
+		m2 := msgpack.NewMux(right)
+		defer m1.Close()
+		defer m2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := m1.Stream(7).Send(ctx, "hello")
+		if !assert.Equal(t, context.DeadlineExceeded, err, "Send should wait for the peer to open the stream") {
+			return
+		}
+	})
+	t.Run("closed streams are forgotten", func(t *testing.T) {
+		left, right := net.Pipe()
+		m1 := msgpack.NewMux(left)
+		m2 := msgpack.NewMux(right)
+		defer m1.Close()
+		defer m2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		s1, s2 := m1.Stream(1), m2.Stream(1)
+		if !assert.NoError(t, s1.Send(ctx, "hello"), "Send should succeed") {
+			return
+		}
+		var msg string
+		if !assert.NoError(t, s2.Recv(ctx, &msg), "Recv should succeed") {
+			return
+		}
+		if !assert.NoError(t, s1.Close(), "Close should succeed") || !assert.NoError(t, s2.Close(), "Close should succeed") {
+			return
+		}
+
+		for _, tc := range []struct {
+			Mux    *msgpack.Mux
+			Stream *msgpack.Stream
+		}{{Mux: m1, Stream: s1}, {Mux: m2, Stream: s2}} {
+			for tc.Mux.Stream(1) == tc.Stream {
+				select {
+				case <-ctx.Done():
+					t.Errorf("stream should be forgotten once both sides closed it")
+					return
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}
+	})
+	t.Run("concurrent send and close", func(t *testing.T) {
+		for i := 0; i < 200; i++ {
+			if !testMuxSendClose(t) {
+				return
+			}
+		}
+	})
+	t.Run("protocol errors", func(t *testing.T) {
+		testcases := []struct {
+			Name  string
+			Frame []byte
+		}{
+			// A window frame for a stream that is not open is the peer
+			// opening it, but a close frame is not
+			{Name: "close frame for unknown stream", Frame: []byte{0x93, 0x05, 0x03, 0xc0}},
+			{Name: "negative window", Frame: []byte{0x93, 0x05, 0x02, 0xff}},
+			{Name: "stream opened twice", Frame: []byte{0x93, 0x05, 0x02, 0x04, 0x93, 0x05, 0x02, 0x04}},
+		}
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				left, right := net.Pipe()
+				m := msgpack.NewMux(left)
+				defer m.Close()
+				defer right.Close()
+
+				go right.Write(tc.Frame)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				for m.Err() == nil {
+					select {
+					case <-ctx.Done():
+						t.Errorf("Mux should stop")
+						return
+					case <-time.After(time.Millisecond):
+					}
+				}
+				if !assert.NotEqual(t, io.EOF, m.Err(), "Mux should stop with a protocol error") {
+					return
+				}
+			})
+		}
+	})
+	t.Run("oversized message", func(t *testing.T) {
+		left, right := net.Pipe()
+		m1 := msgpack.NewMux(left, msgpack.WithMuxMaxMessageBytes(16))
+		m2 := msgpack.NewMux(right)
+		defer m1.Close()
+		defer m2.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// The frame is never read in full, so Send does not return
+		s1, s2 := m1.Stream(1), m2.Stream(1)
+		go s2.Send(ctx, strings.Repeat("a", 32))
+
+		var msg string
+		err := s1.Recv(ctx, &msg)
+		if !assert.Equal(t, msgpack.ErrMessageTooLarge, errors.Cause(err), "Recv should fail (got %v)", err) {
+			return
+		}
+	})
+	t.Run("peer disconnects", func(t *testing.T) {
+		left, right := net.Pipe()
+		m1 := msgpack.NewMux(left)
+		s := m1.Stream(0)
+		defer m1.Close()
+
+		right.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var v interface{}
+		if !assert.Equal(t, io.EOF, s.Recv(ctx, &v), "Recv should report the error that stopped the Mux") {
+			return
+		}
+		if !assert.Equal(t, io.EOF, m1.Err(), "Err should return io.EOF") {
+			return
+		}
+	})
+}
+
+// testMuxSendClose closes a stream while messages are being sent on
+// it. The close frame must come after every data frame that was sent,
+// or the peer stops with a protocol error
+func testMuxSendClose(t *testing.T) bool {
+	left, right := net.Pipe()
+	m1 := msgpack.NewMux(left)
+	m2 := msgpack.NewMux(right)
+	defer m1.Close()
+	defer m2.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Wait for the window of the peer, so that the messages can be
+	// sent as soon as Send is called
+	s1, s2 := m1.Stream(1), m2.Stream(1)
+	var first int
+	if !assert.NoError(t, s1.Send(ctx, -1), "Send should succeed") || !assert.NoError(t, s2.Recv(ctx, &first), "Recv should succeed") {
+		return false
+	}
+
+	// Close runs as soon as a message has been sent, while the others
+	// are at various stages of Send: waiting for credit, between taking
+	// credit and writing their message, or writing it
+	const senders = 32
+	var sent int64
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if s1.Send(ctx, i) == nil {
+				atomic.AddInt64(&sent, 1)
+			}
+		}(i)
+	}
+	go func() {
+		for atomic.LoadInt64(&sent) == 0 && ctx.Err() == nil {
+			runtime.Gosched()
+		}
+		s1.Close()
+	}()
+
+	var received int64
+	for {
+		var v int
+		err := s2.Recv(ctx, &v)
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err, "Recv should succeed until the stream is closed") {
+			return false
+		}
+		received++
+	}
+
+	// If the peer stopped, the senders that are left are blocked
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("senders should not be blocked (peer error: %v)", m2.Err())
+		return false
+	}
+	if !assert.Equal(t, atomic.LoadInt64(&sent), received, "all messages sent should be received") {
+		return false
+	}
+	return assert.NoError(t, m2.Err(), "peer should not stop")
+}
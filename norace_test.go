@@ -0,0 +1,6 @@
+//go:build !race
+// +build !race
+
+package msgpack_test
+
+const raceEnabled = false
@@ -0,0 +1,115 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// partialCodec writes the array header and the first element of a
+// two element array before failing
+type partialCodec struct {
+	Fail bool
+}
+
+func (c partialCodec) EncodeMsgpack(e *msgpack.Encoder) error {
+	if err := e.EncodeArrayHeader(2); err != nil {
+		return err
+	}
+	if err := e.EncodeString("first"); err != nil {
+		return err
+	}
+	if c.Fail {
+		return errors.New(`codec failed`)
+	}
+	return e.EncodeString("second")
+}
+
+type partialStruct struct {
+	Name  string       `msgpack:"name"`
+	Codec partialCodec `msgpack:"codec"`
+}
+
+func TestPartialValue(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		var buf bytes.Buffer
+		e := msgpack.NewEncoder(&buf)
+		if !assert.Error(t, e.Encode(partialCodec{Fail: true}), "Encode should fail") {
+			return
+		}
+		if !assert.NotZero(t, buf.Len(), "partial output should be written") {
+			return
+		}
+	})
+	t.Run("rollback", func(t *testing.T) {
+		var buf bytes.Buffer
+		e := msgpack.NewEncoder(&buf, msgpack.WithRollbackBuffer(64), msgpack.WithPoisonOnPartialValue())
+
+		// The struct header comes before the failing field, and is
+		// dropped as well
+		if !assert.Error(t, e.Encode(partialStruct{Name: "foo", Codec: partialCodec{Fail: true}}), "Encode should fail") {
+			return
+		}
+		if !assert.Zero(t, buf.Len(), "partial output should be dropped") {
+			return
+		}
+		if !assert.NoError(t, e.Err(), "Encoder should not be poisoned") {
+			return
+		}
+
+		if !assert.NoError(t, e.Encode(partialStruct{Name: "foo"}), "Encode should succeed") {
+			return
+		}
+		var decoded map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, "foo", decoded["name"], "values should match") {
+			return
+		}
+	})
+	t.Run("poison", func(t *testing.T) {
+		var buf bytes.Buffer
+		// The value does not fit in the buffer, and is written as it
+		// is produced
+		e := msgpack.NewEncoder(&buf, msgpack.WithRollbackBuffer(4), msgpack.WithPoisonOnPartialValue())
+
+		err := e.Encode(partialCodec{Fail: true})
+		if !assert.Equal(t, msgpack.ErrStreamPoisoned, errors.Cause(err), "Encode should poison the stream") {
+			return
+		}
+		if !assert.Equal(t, msgpack.ErrStreamPoisoned, errors.Cause(e.Err()), "Err should report the poisoning") {
+			return
+		}
+		written := buf.Len()
+
+		if !assert.Equal(t, msgpack.ErrStreamPoisoned, errors.Cause(e.Encode("next")), "Encode should fail once poisoned") {
+			return
+		}
+		if !assert.Equal(t, msgpack.ErrStreamPoisoned, errors.Cause(e.EncodeString("next")), "low level methods should fail once poisoned") {
+			return
+		}
+		if !assert.Equal(t, written, buf.Len(), "nothing should be written once poisoned") {
+			return
+		}
+
+		buf.Reset()
+		e.Reset(&buf)
+		if !assert.NoError(t, e.Err(), "Reset should clear the poisoning") {
+			return
+		}
+		if !assert.NoError(t, e.Encode(partialCodec{}), "Encode should succeed") {
+			return
+		}
+		var decoded []string
+		if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []string{"first", "second"}, decoded, "values should match") {
+			return
+		}
+	})
+}
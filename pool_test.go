@@ -0,0 +1,116 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderReset(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	enc := msgpack.NewEncoder(&buf1)
+	if !assert.NoError(t, enc.Encode("foo"), "Encode should succeed") {
+		return
+	}
+
+	enc.Reset(&buf2)
+	if !assert.NoError(t, enc.Encode("bar"), "Encode should succeed") {
+		return
+	}
+
+	var s string
+	if !assert.NoError(t, msgpack.Unmarshal(buf1.Bytes(), &s), "Unmarshal should succeed") || !assert.Equal(t, "foo", s, "first value should be written to the first destination") {
+		return
+	}
+	if !assert.NoError(t, msgpack.Unmarshal(buf2.Bytes(), &s), "Unmarshal should succeed") || !assert.Equal(t, "bar", s, "second value should be written to the second destination") {
+		return
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	// The first source is not fully consumed, and what was buffered
+	// from it must not leak into the second one
+	dec := msgpack.NewDecoder(bytes.NewReader([]byte{0x01, 0x02}))
+	var v int
+	if !assert.NoError(t, dec.Decode(&v), "Decode should succeed") || !assert.Equal(t, 1, v, "value should match") {
+		return
+	}
+
+	dec.Reset(bytes.NewReader([]byte{0x03}))
+	if !assert.NoError(t, dec.Decode(&v), "Decode should succeed") || !assert.Equal(t, 3, v, "value should be read from the new source") {
+		return
+	}
+}
+
+func TestPool(t *testing.T) {
+	t.Run("Decoder", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			data, err := msgpack.Marshal(map[string]int{"seq": i})
+			if !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+
+			dec := msgpack.GetDecoder(bytes.NewReader(data))
+			var v map[string]int
+			err = dec.Decode(&v)
+			msgpack.PutDecoder(dec)
+			if !assert.NoError(t, err, "Decode should succeed") || !assert.Equal(t, i, v["seq"], "value should match") {
+				return
+			}
+		}
+	})
+	t.Run("Decoder options", func(t *testing.T) {
+		data, err := msgpack.Marshal("Hello, World!")
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		dec := msgpack.GetDecoder(bytes.NewReader(data), msgpack.WithMaxMessageBytes(4), msgpack.WithReadBufferSize(32))
+		var s string
+		err = dec.Decode(&s)
+		msgpack.PutDecoder(dec)
+		if !assert.Error(t, err, "Decode should fail with WithMaxMessageBytes") {
+			return
+		}
+
+		// Options must not carry over to the next user of the Decoder
+		dec = msgpack.GetDecoder(bytes.NewReader(data))
+		err = dec.Decode(&s)
+		msgpack.PutDecoder(dec)
+		if !assert.NoError(t, err, "Decode should succeed") || !assert.Equal(t, "Hello, World!", s, "value should match") {
+			return
+		}
+	})
+	t.Run("Encoder", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := msgpack.GetEncoder(&buf, msgpack.WithTimeAsArray())
+		err := enc.Encode("foo")
+		if !assert.True(t, enc.Options().TimeAsArray, "options should be applied") {
+			return
+		}
+		msgpack.PutEncoder(enc)
+		if !assert.NoError(t, err, "Encode should succeed") {
+			return
+		}
+
+		enc = msgpack.GetEncoder(&buf)
+		defer msgpack.PutEncoder(enc)
+		if !assert.False(t, enc.Options().TimeAsArray, "options should not carry over") {
+			return
+		}
+		if !assert.NoError(t, enc.Encode("bar"), "Encode should succeed") {
+			return
+		}
+
+		dec := msgpack.NewDecoder(&buf)
+		var s1, s2 string
+		if !assert.NoError(t, dec.Decode(&s1), "Decode should succeed") || !assert.NoError(t, dec.Decode(&s2), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, []string{"foo", "bar"}, []string{s1, s2}, "values should match") {
+			return
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package msgpack
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Profiler records how many values of each Go type were encoded and
+// decoded, and how long that took. It is opt-in: attach it to Encoders
+// and Decoders via WithProfiler. A single Profiler may be shared by
+// any number of Encoders and Decoders, across goroutines.
+//
+// Only the values passed to Encode and Decode are recorded. The time
+// spent on their fields and elements is attributed to them, so the
+// results show which message types dominate the time spent in the
+// codec.
+//
+//	p := msgpack.NewProfiler()
+//	enc := msgpack.NewEncoder(w, msgpack.WithProfiler(p))
+//	...
+//	for _, tp := range p.Profile() {
+//	  fmt.Printf("%s: %d encodes, %s\n", tp.Type, tp.Encodes, tp.EncodeTime)
+//	}
+type Profiler struct {
+	mu    sync.Mutex
+	types map[reflect.Type]*TypeProfile
+}
+
+// TypeProfile holds the statistics recorded by a Profiler for a single
+// Go type
+type TypeProfile struct {
+	// Type is the type of the values. For Decode, this is the type
+	// that the pointer points to. It is nil for untyped nil values
+	Type reflect.Type
+
+	Encodes    int64
+	EncodeTime time.Duration
+	Decodes    int64
+	DecodeTime time.Duration
+}
+
+// NewProfiler creates a new, empty Profiler
+func NewProfiler() *Profiler {
+	return &Profiler{
+		types: make(map[reflect.Type]*TypeProfile),
+	}
+}
+
+// WithProfiler specifies a Profiler that records the values that are
+// encoded or decoded
+func WithProfiler(p *Profiler) Option {
+	return func(o *Options) {
+		o.Profiler = p
+	}
+}
+
+func (p *Profiler) entry(rt reflect.Type) *TypeProfile {
+	tp, ok := p.types[rt]
+	if !ok {
+		tp = &TypeProfile{Type: rt}
+		p.types[rt] = tp
+	}
+	return tp
+}
+
+func (p *Profiler) recordEncode(rt reflect.Type, elapsed time.Duration) {
+	p.mu.Lock()
+	tp := p.entry(rt)
+	tp.Encodes++
+	tp.EncodeTime += elapsed
+	p.mu.Unlock()
+}
+
+func (p *Profiler) recordDecode(rt reflect.Type, elapsed time.Duration) {
+	p.mu.Lock()
+	tp := p.entry(rt)
+	tp.Decodes++
+	tp.DecodeTime += elapsed
+	p.mu.Unlock()
+}
+
+// Profile returns a snapshot of the statistics recorded so far, in
+// descending order of the total time spent on each type
+func (p *Profiler) Profile() []TypeProfile {
+	p.mu.Lock()
+	list := make([]TypeProfile, 0, len(p.types))
+	for _, tp := range p.types {
+		list = append(list, *tp)
+	}
+	p.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		ti := list[i].EncodeTime + list[i].DecodeTime
+		tj := list[j].EncodeTime + list[j].DecodeTime
+		if ti != tj {
+			return ti > tj
+		}
+		return typeName(list[i].Type) < typeName(list[j].Type)
+	})
+	return list
+}
+
+// Reset discards the statistics recorded so far
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	p.types = make(map[reflect.Type]*TypeProfile)
+	p.mu.Unlock()
+}
+
+func typeName(rt reflect.Type) string {
+	if rt == nil {
+		return "nil"
+	}
+	return rt.String()
+}
+
+func (e *Encoder) encodeProfiled(v interface{}) error {
+	e.profiling = true
+	start := time.Now()
+	err := e.Encode(v)
+	elapsed := time.Since(start)
+	e.profiling = false
+
+	e.options.Profiler.recordEncode(reflect.TypeOf(v), elapsed)
+	return err
+}
+
+func (d *Decoder) decodeProfiled(v interface{}) error {
+	d.profiling = true
+	start := time.Now()
+	err := d.Decode(v)
+	elapsed := time.Since(start)
+	d.profiling = false
+
+	rt := reflect.TypeOf(v)
+	if rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	d.options.Profiler.recordDecode(rt, elapsed)
+	return err
+}
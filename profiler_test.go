@@ -0,0 +1,105 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type profiledInner struct {
+	Value string `msgpack:"value"`
+}
+
+type profiledMessage struct {
+	Name  string          `msgpack:"name"`
+	Inner []profiledInner `msgpack:"inner"`
+}
+
+func TestProfiler(t *testing.T) {
+	p := msgpack.NewProfiler()
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf, msgpack.WithProfiler(p))
+	msg := profiledMessage{Name: "foo", Inner: []profiledInner{{Value: "bar"}}}
+	for i := 0; i < 3; i++ {
+		if !assert.NoError(t, enc.Encode(msg), "Encode should succeed") {
+			return
+		}
+	}
+	if !assert.NoError(t, enc.Encode("hello"), "Encode should succeed") {
+		return
+	}
+
+	dec := msgpack.NewDecoder(&buf, msgpack.WithProfiler(p))
+	for i := 0; i < 3; i++ {
+		var decoded profiledMessage
+		if !assert.NoError(t, dec.Decode(&decoded), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, msg, decoded, "values should match") {
+			return
+		}
+	}
+
+	profile := p.Profile()
+	types := make(map[reflect.Type]msgpack.TypeProfile)
+	for _, tp := range profile {
+		types[tp.Type] = tp
+	}
+
+	// Nested values are attributed to the top-level value
+	if !assert.Len(t, types, 2, "only top-level types should be recorded") {
+		return
+	}
+
+	tp, ok := types[reflect.TypeOf(msg)]
+	if !assert.True(t, ok, "message type should be recorded") {
+		return
+	}
+	if !assert.Equal(t, int64(3), tp.Encodes, "encodes should be counted") {
+		return
+	}
+	if !assert.Equal(t, int64(3), tp.Decodes, "decodes should be counted (using the pointed-to type)") {
+		return
+	}
+	if !assert.True(t, tp.EncodeTime > 0 && tp.DecodeTime > 0, "time should be recorded") {
+		return
+	}
+	if !assert.Equal(t, int64(1), types[reflect.TypeOf("")].Encodes, "string encodes should be counted") {
+		return
+	}
+
+	p.Reset()
+	if !assert.Empty(t, p.Profile(), "Reset should discard the statistics") {
+		return
+	}
+}
+
+func TestProfilerConcurrent(t *testing.T) {
+	p := msgpack.NewProfiler()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			enc := msgpack.NewEncoder(&bytes.Buffer{}, msgpack.WithProfiler(p))
+			for j := 0; j < 100; j++ {
+				_ = enc.Encode(profiledInner{Value: "foo"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	profile := p.Profile()
+	if !assert.Len(t, profile, 1, "a single type should be recorded") {
+		return
+	}
+	if !assert.Equal(t, int64(400), profile[0].Encodes, "all encodes should be counted") {
+		return
+	}
+}
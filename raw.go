@@ -0,0 +1,35 @@
+package msgpack
+
+import (
+	"github.com/pkg/errors"
+)
+
+// EncodeRaw writes b, which must hold exactly one already encoded
+// msgpack value, to the output as is. This allows routers and
+// aggregators to wrap messages, for example into an array or an
+// envelope, without decoding and re-encoding their contents:
+//
+//	enc.EncodeArrayHeader(len(msgs))
+//	for _, msg := range msgs {
+//		enc.EncodeRaw(msg)
+//	}
+//
+// b is checked before anything is written, so that a truncated or
+// malformed fragment cannot corrupt the output. Use EncodeRawTrusted to
+// skip the check for fragments that are known to be valid, such as
+// those produced by this process
+func (e *Encoder) EncodeRaw(b []byte) error {
+	if err := Validate(b); err != nil {
+		return errors.Wrap(err, `msgpack: invalid raw value`)
+	}
+	return e.EncodeRawTrusted(b)
+}
+
+// EncodeRawTrusted is like EncodeRaw, but writes b without checking
+// that it holds exactly one well-formed value
+func (e *Encoder) EncodeRawTrusted(b []byte) error {
+	if _, err := e.dst.Write(b); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write raw value`)
+	}
+	return nil
+}
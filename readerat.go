@@ -0,0 +1,63 @@
+package msgpack
+
+import (
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// NewReaderAtDecoder creates a new Decoder that reads serialized data
+// from ra, starting at offset off. Combined with an Index, this allows
+// tools to decode arbitrary records from large msgpack files without
+// scanning from the beginning of the file.
+func NewReaderAtDecoder(ra io.ReaderAt, off int64) *Decoder {
+	return NewDecoder(io.NewSectionReader(ra, off, math.MaxInt64-off))
+}
+
+// Index holds the byte offsets of the top-level messages in a
+// stream of back-to-back msgpack messages. The offsets are sorted
+// in ascending order.
+type Index []int64
+
+// BuildIndex scans the stream of back-to-back msgpack messages in r
+// and records the offset of each top-level message. Values are only
+// scanned, and no Go values are constructed during the process.
+func BuildIndex(r io.Reader) (Index, error) {
+	d := NewDecoder(r)
+
+	var idx Index
+	for {
+		// The Decoder counts the bytes that it consumes, leaving out
+		// those that are still sitting in its buffer
+		off := d.consumed()
+		if _, err := d.raw.Peek(1); err != nil {
+			if err == io.EOF {
+				return idx, nil
+			}
+			return nil, errors.Wrapf(err, `msgpack: failed to read message at offset %d`, off)
+		}
+
+		if err := d.skip(); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to scan message at offset %d`, off)
+		}
+		idx = append(idx, off)
+	}
+}
+
+// Len returns the number of messages in the index
+func (idx Index) Len() int {
+	return len(idx)
+}
+
+// Decode decodes the i-th message from ra into v
+func (idx Index) Decode(ra io.ReaderAt, i int, v interface{}) error {
+	if i < 0 || i >= len(idx) {
+		return errors.Errorf(`msgpack: index %d out of range (%d messages)`, i, len(idx))
+	}
+
+	if err := NewReaderAtDecoder(ra, idx[i]).Decode(v); err != nil {
+		return errors.Wrapf(err, `msgpack: failed to decode message %d`, i)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderAtDecoder(t *testing.T) {
+	var messages = []interface{}{
+		"Hello, World!",
+		map[string]interface{}{"foo": "bar", "list": []interface{}{"a", int64(1000), nil}},
+		[]byte("binary"),
+		float64(3.14),
+		dummyStruct{Message: "struct"},
+		[]string{"uno", "dos", "tres"},
+	}
+
+	var buf bytes.Buffer
+	var expected []int64
+	enc := msgpack.NewEncoder(&buf)
+	for _, msg := range messages {
+		expected = append(expected, int64(buf.Len()))
+		if !assert.NoError(t, enc.Encode(msg), "Encode should succeed") {
+			return
+		}
+	}
+
+	idx, err := msgpack.BuildIndex(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err, "BuildIndex should succeed") {
+		return
+	}
+
+	if !assert.Equal(t, msgpack.Index(expected), idx, "offsets should match") {
+		return
+	}
+
+	ra := bytes.NewReader(buf.Bytes())
+	t.Run("NewReaderAtDecoder", func(t *testing.T) {
+		var v []byte
+		if !assert.NoError(t, msgpack.NewReaderAtDecoder(ra, idx[2]).Decode(&v), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte("binary"), v, "value should match") {
+			return
+		}
+	})
+	t.Run("Index.Decode", func(t *testing.T) {
+		var v dummyStruct
+		if !assert.NoError(t, idx.Decode(ra, 4, &v), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, dummyStruct{Message: "struct"}, v, "value should match") {
+			return
+		}
+
+		var s string
+		if !assert.Error(t, idx.Decode(ra, idx.Len(), &s), "Decode should fail for out of range index") {
+			return
+		}
+	})
+	t.Run("truncated stream", func(t *testing.T) {
+		_, err := msgpack.BuildIndex(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+		if !assert.Error(t, err, "BuildIndex should fail") {
+			return
+		}
+	})
+	t.Run("messages straddling the read buffer", func(t *testing.T) {
+		// The default read buffer holds 4096 bytes: messages of 1500
+		// bytes cross its boundary, so that the offsets depend on the
+		// bytes that are buffered but not consumed yet
+		var buf bytes.Buffer
+		var expected []int64
+		enc := msgpack.NewEncoder(&buf)
+		for i := 0; i < 10; i++ {
+			expected = append(expected, int64(buf.Len()))
+			if !assert.NoError(t, enc.Encode(strings.Repeat(string(rune('a'+i)), 1500)), "Encode should succeed") {
+				return
+			}
+		}
+
+		for name, r := range map[string]io.Reader{
+			"bytes.Reader":  bytes.NewReader(buf.Bytes()),
+			"OneByteReader": iotest.OneByteReader(bytes.NewReader(buf.Bytes())),
+			"DataErrReader": iotest.DataErrReader(bytes.NewReader(buf.Bytes())),
+			"HalfReader":    iotest.HalfReader(bytes.NewReader(buf.Bytes())),
+		} {
+			r := r
+			t.Run(name, func(t *testing.T) {
+				idx, err := msgpack.BuildIndex(r)
+				if !assert.NoError(t, err, "BuildIndex should succeed") {
+					return
+				}
+				if !assert.Equal(t, msgpack.Index(expected), idx, "offsets should match") {
+					return
+				}
+
+				var v string
+				if !assert.NoError(t, idx.Decode(bytes.NewReader(buf.Bytes()), 3, &v), "Decode should succeed") {
+					return
+				}
+				if !assert.Equal(t, strings.Repeat("d", 1500), v, "value should match") {
+					return
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "broker unavailable" }
+func (temporaryError) Temporary() bool { return true }
+
+// hiccupWriter fails the first failures calls to Write with err, and
+// writes at most max bytes per call afterwards (if max > 0)
+type hiccupWriter struct {
+	buf      bytes.Buffer
+	failures int
+	err      error
+	max      int
+	calls    int
+}
+
+func (w *hiccupWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.failures > 0 {
+		w.failures--
+		return 0, w.err
+	}
+	if w.max > 0 && len(p) > w.max {
+		p = p[:w.max]
+	}
+	return w.buf.Write(p)
+}
+
+func encodeMessage(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRetryWriter(t *testing.T) {
+	fastBackoff := msgpack.WithBackoff(time.Millisecond, 2*time.Millisecond)
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		dst := &hiccupWriter{failures: 3, err: temporaryError{}}
+		w := msgpack.NewRetryWriter(dst, fastBackoff)
+
+		msg := encodeMessage(t, "Hello, World!")
+		n, err := w.Write(msg)
+		if !assert.NoError(t, err, "Write should succeed") {
+			return
+		}
+		if !assert.Equal(t, len(msg), n, "Write should report the full length") {
+			return
+		}
+		if !assert.Equal(t, msg, dst.buf.Bytes(), "message should be written") {
+			return
+		}
+		if !assert.Equal(t, 4, dst.calls, "Write should be attempted 4 times") {
+			return
+		}
+	})
+	t.Run("short writes", func(t *testing.T) {
+		dst := &hiccupWriter{max: 2}
+		w := msgpack.NewRetryWriter(dst, fastBackoff)
+
+		msg := encodeMessage(t, "Hello, World!")
+		if _, err := w.Write(msg); !assert.NoError(t, err, "Write should succeed") {
+			return
+		}
+		if !assert.Equal(t, msg, dst.buf.Bytes(), "message should be written") {
+			return
+		}
+	})
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		dst := &hiccupWriter{failures: 1, err: errors.New("permission denied")}
+		w := msgpack.NewRetryWriter(dst, fastBackoff)
+
+		if _, err := w.Write(encodeMessage(t, "Hello, World!")); !assert.Error(t, err, "Write should fail") {
+			return
+		}
+		if !assert.Equal(t, 1, dst.calls, "Write should be attempted once") {
+			return
+		}
+	})
+	t.Run("dropped messages", func(t *testing.T) {
+		dst := &hiccupWriter{failures: 100, err: temporaryError{}}
+
+		var dropped [][]byte
+		w := msgpack.NewRetryWriter(dst, fastBackoff, msgpack.WithMaxRetries(2), msgpack.WithDropHandler(func(msg []byte, err error) {
+			if !assert.Equal(t, temporaryError{}, errors.Cause(err), "drop handler should receive the error") {
+				return
+			}
+			dropped = append(dropped, msg)
+		}))
+
+		msg := encodeMessage(t, "Hello, World!")
+		n, err := w.Write(msg)
+		if !assert.NoError(t, err, "Write should report success for dropped messages") {
+			return
+		}
+		if !assert.Equal(t, len(msg), n, "Write should report the full length") {
+			return
+		}
+		if !assert.Equal(t, [][]byte{msg}, dropped, "message should be dropped") {
+			return
+		}
+		if !assert.Equal(t, 3, dst.calls, "Write should be attempted 3 times") {
+			return
+		}
+	})
+	t.Run("custom transient func", func(t *testing.T) {
+		permanent := errors.New("permission denied")
+		dst := &hiccupWriter{failures: 1, err: permanent}
+		w := msgpack.NewRetryWriter(dst, fastBackoff, msgpack.WithTransientFunc(func(err error) bool {
+			return errors.Cause(err) == permanent
+		}))
+
+		if _, err := w.Write(encodeMessage(t, "Hello, World!")); !assert.NoError(t, err, "Write should succeed") {
+			return
+		}
+	})
+	t.Run("close aborts backoff", func(t *testing.T) {
+		dst := &hiccupWriter{failures: 100, err: temporaryError{}}
+		w := msgpack.NewRetryWriter(dst, msgpack.WithBackoff(time.Hour, time.Hour))
+
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := w.Write(encodeMessage(t, "Hello, World!"))
+			errCh <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		w.Close()
+
+		select {
+		case err := <-errCh:
+			if !assert.Equal(t, msgpack.ErrRetryWriterClosed, err, "Write should be aborted") {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Write was not aborted")
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package msgpack
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// reuseSlice returns a slice of size elements of the type of rv, using
+// the backing array of rv if it is large enough. The reused elements
+// are reset to their zero value, so that nothing is left over from the
+// previous contents
+func reuseSlice(rv reflect.Value, size int) reflect.Value {
+	if rv.IsNil() || rv.Cap() < size {
+		return reflect.MakeSlice(rv.Type(), size, size)
+	}
+
+	slice := rv.Slice(0, size)
+	zero := reflect.Zero(rv.Type().Elem())
+	for i := 0; i < size; i++ {
+		slice.Index(i).Set(zero)
+	}
+	return slice
+}
+
+// growSlice returns rv extended by n zero elements. Like append, it
+// allocates a new backing array, with room to spare, only if rv does
+// not have enough capacity
+func growSlice(rv reflect.Value, n int) reflect.Value {
+	l := rv.Len()
+	if rv.Cap()-l >= n {
+		slice := rv.Slice(0, l+n)
+		zero := reflect.Zero(rv.Type().Elem())
+		for i := l; i < l+n; i++ {
+			slice.Index(i).Set(zero)
+		}
+		return slice
+	}
+
+	c := 2 * rv.Cap()
+	if c < l+n {
+		c = l + n
+	}
+	slice := reflect.MakeSlice(rv.Type(), l+n, c)
+	reflect.Copy(slice, rv)
+	return slice
+}
+
+// DecodeAppend decodes an array, and appends its elements to the slice
+// pointed to by v, instead of replacing its contents as DecodeArray
+// does. This allows accumulating the elements of many messages in a
+// single slice:
+//
+//	var events []Event
+//	for {
+//		if err := dec.DecodeAppend(&events); err != nil {
+//			...
+//		}
+//	}
+//
+// Nil appends nothing, and nil elements are appended as the zero value
+// of the element type, as DecodeArray does. If an element fails to decode, the slice is left
+// as it was
+func (d *Decoder) DecodeAppend(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.Errorf(`msgpack: DecodeAppend expected pointer to slice, got %T`, v)
+	}
+	rv = rv.Elem()
+
+	if d.isNil() {
+		return d.DecodeNil(nil)
+	}
+
+	var size int
+	if err := d.DecodeArrayLength(&size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode array length`)
+	}
+
+	l := rv.Len()
+	slice := growSlice(rv, size)
+	for i := 0; i < size; i++ {
+		// As in DecodeArray, nil elements are left as the zero value
+		// that growSlice set them to
+		if d.isNil() {
+			d.raw.ReadByte()
+			continue
+		}
+
+		e := slice.Index(l + i)
+		if e.Kind() == reflect.Ptr {
+			e.Set(reflect.New(e.Type().Elem()))
+		} else {
+			e = e.Addr()
+		}
+		if err := d.Decode(e.Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode array element %d`, i)
+		}
+	}
+
+	rv.Set(slice)
+	return nil
+}
@@ -0,0 +1,141 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type appendEvent struct {
+	Name  string `msgpack:"name"`
+	Count int    `msgpack:"count"`
+}
+
+func TestDecodeArrayReuse(t *testing.T) {
+	b, err := msgpack.Marshal([]appendEvent{{Name: "a"}, {Name: "b", Count: 2}})
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	t.Run("enough capacity", func(t *testing.T) {
+		list := make([]appendEvent, 3, 4)
+		list[0] = appendEvent{Name: "old", Count: 1}
+		backing := &list[:4][0]
+
+		if !assert.NoError(t, msgpack.Unmarshal(b, &list), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []appendEvent{{Name: "a"}, {Name: "b", Count: 2}}, list, "previous contents should not leak") {
+			return
+		}
+		if !assert.True(t, backing == &list[:4][0], "backing array should be reused") {
+			return
+		}
+	})
+	t.Run("not enough capacity", func(t *testing.T) {
+		list := make([]appendEvent, 0, 1)
+		backing := &list[:1][0]
+
+		if !assert.NoError(t, msgpack.Unmarshal(b, &list), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Len(t, list, 2, "list should grow") || !assert.False(t, backing == &list[0], "backing array should be replaced") {
+			return
+		}
+	})
+}
+
+func TestDecodeAppend(t *testing.T) {
+	var buf bytes.Buffer
+	e := msgpack.NewEncoder(&buf)
+	for _, batch := range [][]appendEvent{{{Name: "a"}}, nil, {{Name: "b"}, {Name: "c"}}} {
+		if !assert.NoError(t, e.Encode(batch), "Encode should succeed") {
+			return
+		}
+	}
+	if !assert.NoError(t, e.Encode([]interface{}{map[string]interface{}{"count": "not a number"}}), "Encode should succeed") {
+		return
+	}
+
+	var events []appendEvent
+	d := msgpack.NewDecoder(&buf)
+	for i := 0; i < 3; i++ {
+		if !assert.NoError(t, d.DecodeAppend(&events), "DecodeAppend should succeed") {
+			return
+		}
+	}
+	if !assert.Equal(t, []appendEvent{{Name: "a"}, {Name: "b"}, {Name: "c"}}, events, "elements should be appended") {
+		return
+	}
+
+	if !assert.Error(t, d.DecodeAppend(&events), "DecodeAppend should fail") {
+		return
+	}
+	if !assert.Len(t, events, 3, "slice should be left as it was") {
+		return
+	}
+
+	var notSlice int
+	if !assert.Error(t, d.DecodeAppend(&notSlice), "DecodeAppend should reject non-slices") {
+		return
+	}
+}
+
+func TestDecodeAppendNil(t *testing.T) {
+	b, err := msgpack.Marshal([]interface{}{nil, 1})
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	t.Run("pointer elements", func(t *testing.T) {
+		var decoded []*int
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+
+		// Reuse a backing array whose elements are not nil
+		one, two := 10, 20
+		reused := []*int{&one, &two}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &reused), "Unmarshal should succeed") {
+			return
+		}
+
+		var appended []*int
+		if !assert.NoError(t, msgpack.NewDecoder(bytes.NewReader(b)).DecodeAppend(&appended), "DecodeAppend should succeed") {
+			return
+		}
+
+		for _, list := range [][]*int{decoded, reused, appended} {
+			if !assert.Len(t, list, 2, "list should have 2 elements") {
+				return
+			}
+			if !assert.Nil(t, list[0], "nil element should be a nil pointer") {
+				return
+			}
+			if !assert.Equal(t, 1, *list[1], "value should match") {
+				return
+			}
+		}
+	})
+	t.Run("value elements", func(t *testing.T) {
+		var decoded []int
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+
+		appended := make([]int, 0, 2)
+		appended = append(appended, 5)[:0]
+		if !assert.NoError(t, msgpack.NewDecoder(bytes.NewReader(b)).DecodeAppend(&appended), "DecodeAppend should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, []int{0, 1}, decoded, "value should match") {
+			return
+		}
+		if !assert.Equal(t, decoded, appended, "DecodeAppend and DecodeArray should match") {
+			return
+		}
+	})
+}
@@ -0,0 +1,185 @@
+// Package rpc implements building blocks for msgpack-rpc
+// (https://github.com/msgpack-rpc/msgpack-rpc/blob/master/spec.md)
+// clients and servers.
+//
+// The msgpack-rpc specification leaves the contents of the error
+// field of a response up to implementations. This package encodes
+// errors as a map with "code", "message", and (optionally) "data"
+// keys, using the same codes as JSON-RPC for protocol level errors, so
+// that clients written in any language can handle them without
+// parsing free-form strings.
+package rpc
+
+import (
+	"strconv"
+	"sync"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+)
+
+// Codes for protocol level errors. Codes from -32768 to -32000 are
+// reserved for these, and cannot be registered via RegisterError
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+const (
+	minReservedCode = -32768
+	maxReservedCode = -32000
+)
+
+// Error is the wire representation of an error returned by a remote
+// procedure
+type Error struct {
+	Code    int
+	Message string
+	// Data holds additional, application specific information
+	Data map[string]interface{}
+}
+
+// NewError creates a new Error
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return "rpc: error " + strconv.Itoa(e.Code) + ": " + e.Message
+}
+
+// EncodeMsgpack encodes the error as a map
+func (e *Error) EncodeMsgpack(enc *msgpack.Encoder) error {
+	n := 2
+	if len(e.Data) > 0 {
+		n++
+	}
+	if err := msgpack.WriteMapHeader(enc.Writer(), n); err != nil {
+		return errors.Wrap(err, `rpc: failed to write error header`)
+	}
+
+	if err := enc.EncodeString("code"); err != nil {
+		return errors.Wrap(err, `rpc: failed to encode error code key`)
+	}
+	if err := enc.EncodeInt64(int64(e.Code)); err != nil {
+		return errors.Wrap(err, `rpc: failed to encode error code`)
+	}
+	if err := enc.EncodeString("message"); err != nil {
+		return errors.Wrap(err, `rpc: failed to encode error message key`)
+	}
+	if err := enc.EncodeString(e.Message); err != nil {
+		return errors.Wrap(err, `rpc: failed to encode error message`)
+	}
+	if len(e.Data) > 0 {
+		if err := enc.EncodeString("data"); err != nil {
+			return errors.Wrap(err, `rpc: failed to encode error data key`)
+		}
+		if err := enc.EncodeMap(e.Data); err != nil {
+			return errors.Wrap(err, `rpc: failed to encode error data`)
+		}
+	}
+	return nil
+}
+
+// DecodeMsgpack decodes an error encoded by EncodeMsgpack. For the
+// sake of interoperability with implementations that report errors
+// as plain strings, a string is accepted as well, and decoded as an
+// Error with CodeInternalError
+func (e *Error) DecodeMsgpack(dec *msgpack.Decoder) error {
+	var v msgpack.Value
+	if err := dec.DecodeValue(&v); err != nil {
+		return errors.Wrap(err, `rpc: failed to decode error`)
+	}
+
+	switch v.Kind() {
+	case msgpack.StringKind:
+		s, _ := v.Str()
+		*e = Error{Code: CodeInternalError, Message: s}
+		return nil
+	case msgpack.MapKind:
+	default:
+		return errors.Errorf(`rpc: expected map or string for error, got %s`, v.Kind())
+	}
+
+	code, err := v.Get("code").Int()
+	if err != nil {
+		return errors.Wrap(err, `rpc: failed to decode error code`)
+	}
+	message, err := v.Get("message").Str()
+	if err != nil {
+		return errors.Wrap(err, `rpc: failed to decode error message`)
+	}
+
+	*e = Error{Code: int(code), Message: message}
+	if data := v.Get("data"); data.Kind() == msgpack.MapKind {
+		e.Data = data.Interface().(map[string]interface{})
+	}
+	return nil
+}
+
+// RPCErrorer is implemented by application errors that know how to
+// represent themselves on the wire. See ToError
+type RPCErrorer interface {
+	RPCError() *Error
+}
+
+var muErrors sync.RWMutex
+var errorRegistry = make(map[int]func(*Error) error)
+
+// RegisterError registers a function that converts Errors with the
+// given application error code back to a typed Go error on the
+// client side. See FromError. Protocol level codes (-32768 to -32000)
+// cannot be registered
+func RegisterError(code int, fn func(*Error) error) error {
+	if code >= minReservedCode && code <= maxReservedCode {
+		return errors.Errorf(`rpc: error code %d is reserved`, code)
+	}
+
+	muErrors.Lock()
+	defer muErrors.Unlock()
+	if _, ok := errorRegistry[code]; ok {
+		return errors.Errorf(`rpc: error code %d is already registered`, code)
+	}
+	errorRegistry[code] = fn
+	return nil
+}
+
+// ToError converts an error returned by a procedure to its wire
+// representation. Errors that are (or wrap) an *Error or an RPCErrorer
+// are converted accordingly. Any other error is reported as
+// CodeInternalError, with its message. ToError returns nil for a nil
+// error
+func ToError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case *Error:
+		return cause
+	case RPCErrorer:
+		return cause.RPCError()
+	}
+	return &Error{Code: CodeInternalError, Message: err.Error()}
+}
+
+// FromError converts an Error received from a server to a Go error,
+// using the functions registered via RegisterError. If no function is
+// registered for its code, e itself is returned. FromError returns nil
+// for a nil *Error
+func FromError(e *Error) error {
+	if e == nil {
+		return nil
+	}
+
+	muErrors.RLock()
+	fn, ok := errorRegistry[e.Code]
+	muErrors.RUnlock()
+	if !ok {
+		return e
+	}
+	return fn(e)
+}
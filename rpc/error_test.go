@@ -0,0 +1,109 @@
+package rpc_test
+
+import (
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/lestrrat-go/msgpack/rpc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type quotaError struct {
+	limit int64
+}
+
+func (e *quotaError) Error() string {
+	return "quota exceeded"
+}
+
+func (e *quotaError) RPCError() *rpc.Error {
+	return &rpc.Error{
+		Code:    1001,
+		Message: e.Error(),
+		Data:    map[string]interface{}{"limit": e.limit},
+	}
+}
+
+func init() {
+	if err := rpc.RegisterError(1001, func(e *rpc.Error) error {
+		limit, _ := e.Data["limit"].(int64)
+		return &quotaError{limit: limit}
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestError(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		src := rpc.ToError(errors.Wrap(&quotaError{limit: 1000}, `failed to process request`))
+		data, err := msgpack.Marshal(src)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded rpc.Error
+		if !assert.NoError(t, msgpack.Unmarshal(data, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, *src, decoded, "errors should match") {
+			return
+		}
+
+		typed, ok := rpc.FromError(&decoded).(*quotaError)
+		if !assert.True(t, ok, "registered code should be mapped to a typed error") {
+			return
+		}
+		if !assert.Equal(t, int64(1000), typed.limit, "data should be available to the typed error") {
+			return
+		}
+	})
+	t.Run("compact encoding", func(t *testing.T) {
+		// As sent by an implementation that uses the smallest integer
+		// encoding: {"code": -32601, "message": "no such method"}
+		data := []byte{0x82, 0xa4, 'c', 'o', 'd', 'e', 0xd1, 0x80, 0xa7, 0xa7, 'm', 'e', 's', 's', 'a', 'g', 'e', 0xae}
+		data = append(data, "no such method"...)
+
+		var decoded rpc.Error
+		if !assert.NoError(t, msgpack.Unmarshal(data, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, rpc.Error{Code: rpc.CodeMethodNotFound, Message: "no such method"}, decoded, "errors should match") {
+			return
+		}
+		if !assert.Equal(t, &decoded, rpc.FromError(&decoded), "unregistered codes should be returned as is") {
+			return
+		}
+	})
+	t.Run("string error", func(t *testing.T) {
+		data, err := msgpack.Marshal("something went wrong")
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded rpc.Error
+		if !assert.NoError(t, msgpack.Unmarshal(data, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, rpc.Error{Code: rpc.CodeInternalError, Message: "something went wrong"}, decoded, "errors should match") {
+			return
+		}
+	})
+	t.Run("plain Go error", func(t *testing.T) {
+		e := rpc.ToError(errors.New(`boom`))
+		if !assert.Equal(t, &rpc.Error{Code: rpc.CodeInternalError, Message: "boom"}, e, "error should be reported as internal") {
+			return
+		}
+		if !assert.Nil(t, rpc.ToError(nil), "nil should be converted to nil") {
+			return
+		}
+	})
+	t.Run("registration", func(t *testing.T) {
+		if !assert.Error(t, rpc.RegisterError(rpc.CodeInternalError, nil), "reserved codes should be rejected") {
+			return
+		}
+		if !assert.Error(t, rpc.RegisterError(1001, nil), "duplicate codes should be rejected") {
+			return
+		}
+	})
+}
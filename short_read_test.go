@@ -0,0 +1,127 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+// shortReaders wrap an io.Reader so that data is delivered in
+// pieces, the way it would be when read from a network connection
+var shortReaders = []struct {
+	name string
+	wrap func(io.Reader) io.Reader
+}{
+	{name: "OneByteReader", wrap: iotest.OneByteReader},
+	{name: "HalfReader", wrap: iotest.HalfReader},
+	{name: "DataErrReader", wrap: iotest.DataErrReader},
+}
+
+func TestShortReads(t *testing.T) {
+	var list = []interface{}{
+		int8(-31),
+		int64(math.MaxInt64),
+		uint16(math.MaxUint16),
+		uint64(math.MaxUint64),
+		float32(math.MaxFloat32),
+		float64(math.MaxFloat64),
+		true,
+		"Hello, World!",
+		strings.Repeat("a", 300),
+		strings.Repeat("b", 70000),
+		[]byte("Hello, World!"),
+		[]byte(strings.Repeat("c", 70000)),
+		[]string{"uno", "dos", "tres"},
+		map[string]interface{}{"foo": "bar", "baz": []interface{}{"qux", int64(100)}},
+		dummyStruct{Message: "Hello, World!"},
+		time.Unix(1234567890, 123),
+		EventTime{Time: time.Unix(1234567890, 123).UTC()},
+	}
+
+	for _, data := range list {
+		b, err := msgpack.Marshal(data)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		b = append([]byte(nil), b...)
+
+		for _, sr := range shortReaders {
+			t.Run(reflect.TypeOf(data).String()+"/"+sr.name, func(t *testing.T) {
+				v := reflect.New(reflect.TypeOf(data))
+				dec := msgpack.NewDecoder(sr.wrap(bytes.NewReader(b)))
+				if !assert.NoError(t, dec.Decode(v.Interface()), "Decode should succeed") {
+					return
+				}
+				if !assert.Equal(t, data, v.Elem().Interface(), "values should match") {
+					return
+				}
+			})
+		}
+	}
+}
+
+func TestShortReadsValue(t *testing.T) {
+	v := map[string]interface{}{
+		"string": strings.Repeat("a", 300),
+		"array":  []interface{}{"foo", int64(1)},
+		"ext":    EventTime{Time: time.Unix(1234567890, 123).UTC()},
+	}
+	b, err := msgpack.Marshal(v)
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+	b = append([]byte(nil), b...)
+
+	expected, err := msgpack.ParseValue(b)
+	if !assert.NoError(t, err, "ParseValue should succeed") {
+		return
+	}
+
+	for _, sr := range shortReaders {
+		t.Run(sr.name, func(t *testing.T) {
+			var value msgpack.Value
+			dec := msgpack.NewDecoder(sr.wrap(bytes.NewReader(b)))
+			if !assert.NoError(t, dec.DecodeValue(&value), "DecodeValue should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected.Interface(), value.Interface(), "values should match") {
+				return
+			}
+		})
+	}
+}
+
+func TestShortReadsIndex(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for _, v := range []interface{}{"foo", strings.Repeat("a", 300), []string{"uno", "dos"}} {
+		if !assert.NoError(t, enc.Encode(v), "Encode should succeed") {
+			return
+		}
+	}
+
+	expected, err := msgpack.BuildIndex(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err, "BuildIndex should succeed") {
+		return
+	}
+
+	for _, sr := range shortReaders {
+		t.Run(sr.name, func(t *testing.T) {
+			idx, err := msgpack.BuildIndex(sr.wrap(bytes.NewReader(buf.Bytes())))
+			if !assert.NoError(t, err, "BuildIndex should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected, idx, "indices should match") {
+				return
+			}
+		})
+	}
+}
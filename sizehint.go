@@ -0,0 +1,44 @@
+package msgpack
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// pushPath records that the value for key is about to be decoded. It
+// is only called when ExpectedSizes is set
+func (d *Decoder) pushPath(key string) {
+	d.path = append(d.path, key)
+}
+
+// pathKey returns the path segment for a decoded map key
+func pathKey(key reflect.Value) string {
+	switch {
+	case !key.IsValid():
+		return "<nil>"
+	case key.Kind() == reflect.String:
+		return key.String()
+	}
+	return fmt.Sprint(key.Interface())
+}
+
+func (d *Decoder) popPath() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// mapCapacity returns the number of entries to allocate for a map that
+// holds size entries on the wire, at the current path. The wire size is
+// not trusted: maps are only pre-sized up to the size expected by the
+// application (see WithExpectedSizes)
+func (d *Decoder) mapCapacity(size int) int {
+	if d.options.ExpectedSizes == nil {
+		return 0
+	}
+
+	n := d.options.ExpectedSizes[strings.Join(d.path, ".")]
+	if n > size {
+		return size
+	}
+	return n
+}
@@ -0,0 +1,67 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithExpectedSizes(t *testing.T) {
+	type item struct {
+		Attrs map[string]int64
+	}
+	type message struct {
+		Headers map[string]string
+		Items   []item
+	}
+
+	headers := make(map[string]string)
+	attrs := make(map[string]int64)
+	for i := 0; i < 64; i++ {
+		headers["header"+strconv.Itoa(i)] = "value"
+		attrs["attr"+strconv.Itoa(i)] = int64(i)
+	}
+	v := message{Headers: headers, Items: []item{{Attrs: attrs}, {Attrs: attrs}}}
+
+	b, err := msgpack.Marshal(v)
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+	b = append([]byte(nil), b...)
+
+	decode := func(options ...msgpack.Option) func() {
+		var rdr bytes.Reader
+		dec := msgpack.NewDecoder(&rdr, options...)
+		return func() {
+			rdr.Reset(b)
+			var decoded message
+			if err := dec.Decode(&decoded); err != nil {
+				t.Fatalf("failed to decode: %s", err)
+			}
+		}
+	}
+
+	t.Run("values", func(t *testing.T) {
+		var decoded message
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded, msgpack.WithExpectedSizes(map[string]int{"Headers": 64, "Items.Attrs": 64})), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("fewer allocations", func(t *testing.T) {
+		if raceEnabled {
+			t.Skip("allocation counts are not reliable under the race detector")
+		}
+
+		without := testing.AllocsPerRun(10, decode())
+		with := testing.AllocsPerRun(10, decode(msgpack.WithExpectedSizes(map[string]int{"Headers": 64, "Items.Attrs": 64})))
+		if !assert.True(t, with < without, "hints should save allocations (%v with, %v without)", with, without) {
+			return
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package msgpack
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// EncodeSparseArray writes v, a slice or an array that is mostly made
+// of zero values (such as embedding vectors or rows of sparse
+// matrices), as an array of two elements: the length of v, and a map
+// of the indices of the non-zero elements to their values.
+//
+//	[]float64{0, 0, 1.5, 0, 0, 0, 2}  =>  [7, {2: 1.5, 6: 2}]
+//
+// Use DecodeSparseArray to reconstruct the dense slice
+func (e *Encoder) EncodeSparseArray(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+	default:
+		return errors.Errorf(`msgpack: argument to EncodeSparseArray must be an array or a slice (not %T)`, v)
+	}
+
+	zero := reflect.Zero(rv.Type().Elem()).Interface()
+	var indices []int
+	for i := 0; i < rv.Len(); i++ {
+		if !reflect.DeepEqual(rv.Index(i).Interface(), zero) {
+			indices = append(indices, i)
+		}
+	}
+
+	if err := e.EncodeArrayHeader(2); err != nil {
+		return err
+	}
+	if err := e.encodeCompactUint(uint64(rv.Len())); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write sparse array length`)
+	}
+	if err := WriteMapHeader(e.dst, len(indices)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
+	for _, i := range indices {
+		if err := e.encodeCompactUint(uint64(i)); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to write index %d`, i)
+		}
+		if err := e.Encode(rv.Index(i).Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode element %d`, i)
+		}
+	}
+	return nil
+}
+
+// DecodeSparseArray is the reverse of EncodeSparseArray: it decodes
+// the next value into v, a pointer to a slice that has the length that
+// was encoded, with the elements that were not encoded set to their
+// zero value. Nil is decoded as a nil slice.
+//
+// If WithMaxMessageBytes is in effect, the length may not exceed it,
+// so that a small message cannot make the decoder allocate a large
+// slice
+func (d *Decoder) DecodeSparseArray(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.Errorf(`msgpack: argument to DecodeSparseArray must be a pointer to a slice (not %T)`, v)
+	}
+	rv = rv.Elem()
+
+	if d.isNil() {
+		d.raw.ReadByte()
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	var size int
+	if err := d.DecodeArrayLength(&size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode array length`)
+	}
+	if size != 2 {
+		return errors.Errorf(`msgpack: expected sparse array to be an array of 2 elements, got %d`, size)
+	}
+
+	var length uint64
+	if err := d.DecodeUint64(&length); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode sparse array length`)
+	}
+	if length > uint64(maxInt) {
+		return errors.Errorf(`msgpack: sparse array length %d is too large`, length)
+	}
+	if limit := d.options.MaxMessageBytes; limit > 0 && length > uint64(limit) {
+		return errors.Wrapf(ErrMessageTooLarge, `msgpack: sparse array declares %d elements, but the limit is %d`, length, limit)
+	}
+
+	var count int
+	if err := d.DecodeMapLength(&count); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode map length`)
+	}
+
+	slice := reflect.MakeSlice(rv.Type(), int(length), int(length))
+	for i := 0; i < count; i++ {
+		var index uint64
+		if err := d.DecodeUint64(&index); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode index`)
+		}
+		if index >= length {
+			return errors.Errorf(`msgpack: index %d is out of range for sparse array of length %d`, index, length)
+		}
+
+		e := slice.Index(int(index))
+		if e.Kind() == reflect.Ptr {
+			e.Set(reflect.New(e.Type().Elem()))
+		} else {
+			e = e.Addr()
+		}
+		if err := d.Decode(e.Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode element %d`, index)
+		}
+	}
+
+	rv.Set(slice)
+	return nil
+}
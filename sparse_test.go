@@ -0,0 +1,79 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparseArray(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		v := make([]float64, 1000)
+		v[3] = 1.5
+		v[999] = -2
+
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeSparseArray(v), "EncodeSparseArray should succeed") {
+			return
+		}
+		if !assert.True(t, buf.Len() < 30, "encoded size should be small (got %d bytes)", buf.Len()) {
+			return
+		}
+
+		var decoded []float64
+		if !assert.NoError(t, msgpack.NewDecoder(&buf).DecodeSparseArray(&decoded), "DecodeSparseArray should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("wire format", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeSparseArray([4]string{"", "foo", "", ""}), "EncodeSparseArray should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.FixArray2.Byte(), 4, msgpack.FixMap1.Byte(), 1, msgpack.FixStr3.Byte(), 'f', 'o', 'o'}, buf.Bytes(), "output should match") {
+			return
+		}
+	})
+	t.Run("struct elements", func(t *testing.T) {
+		type cell struct {
+			Value int64
+		}
+		v := []*cell{nil, {Value: 1}, nil}
+
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeSparseArray(v), "EncodeSparseArray should succeed") {
+			return
+		}
+
+		var decoded []*cell
+		if !assert.NoError(t, msgpack.NewDecoder(&buf).DecodeSparseArray(&decoded), "DecodeSparseArray should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("index out of range", func(t *testing.T) {
+		b := []byte{msgpack.FixArray2.Byte(), 2, msgpack.FixMap1.Byte(), 5, 1}
+
+		var decoded []int64
+		if !assert.Error(t, msgpack.NewDecoder(bytes.NewReader(b)).DecodeSparseArray(&decoded), "DecodeSparseArray should fail") {
+			return
+		}
+	})
+	t.Run("length exceeds limit", func(t *testing.T) {
+		b := []byte{msgpack.FixArray2.Byte(), msgpack.Uint32.Byte(), 0x10, 0, 0, 0, msgpack.FixMap0.Byte()}
+
+		var decoded []int64
+		err := msgpack.NewDecoder(bytes.NewReader(b), msgpack.WithMaxMessageBytes(1024)).DecodeSparseArray(&decoded)
+		if !assert.Equal(t, msgpack.ErrMessageTooLarge, errors.Cause(err), "error should be ErrMessageTooLarge") {
+			return
+		}
+	})
+}
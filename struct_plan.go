@@ -0,0 +1,225 @@
+package msgpack
+
+import (
+	"container/list"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultStructPlanCacheSize is the default maximum number of struct
+// plans that are cached. See SetStructPlanCacheSize
+const DefaultStructPlanCacheSize = 1024
+
+// structField describes a single field of a struct, as seen by the
+// encoder and decoder
+type structField struct {
+	name      string
+	index     int
+	omitempty bool
+	// isZero is set for omitempty fields whose type has an IsZero
+	// method, which decides whether they are empty
+	isZero     bool
+	emptyAsNil bool
+	pairs      bool
+	// keyAsInt is set for fields tagged with keyasint, which use intKey
+	// as their key instead of name
+	keyAsInt bool
+	intKey   int64
+}
+
+// structPlan holds the result of inspecting the fields and struct tags
+// of a struct type, so that it does not need to be repeated for every
+// value that is encoded or decoded
+type structPlan struct {
+	fields []structField
+	// byName maps field names to struct field indices
+	byName map[string]int
+	// byInt maps the integer keys of the fields tagged with keyasint to
+	// struct field indices. It is nil if there are none
+	byInt map[int64]int
+	// emptyAsNil holds the struct field indices of the fields tagged
+	// with emptyasnil. It is nil if there are none
+	emptyAsNil map[int]struct{}
+	// pairs holds the struct field indices of the fields tagged with
+	// pairs. It is nil if there are none
+	pairs map[int]struct{}
+	// asArray is set for structs that have a blank field tagged with
+	// asarray, which are encoded as arrays of their fields
+	asArray bool
+	// decoders maps the struct field indices of the fields tagged with
+	// decoder=name to that name. It is nil if there are none
+	decoders map[int]string
+}
+
+type structPlanKey struct {
+	typ  reflect.Type
+	tags string
+}
+
+type structPlanEntry struct {
+	key  structPlanKey
+	plan *structPlan
+}
+
+// structPlanCache is an LRU cache of struct plans. The number of
+// distinct struct types is usually small, but programs that create
+// types dynamically (plugins, reflect.StructOf) could otherwise make
+// it grow without bounds
+type structPlanCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[structPlanKey]*list.Element
+	lru        *list.List
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+var structPlans = &structPlanCache{
+	maxEntries: DefaultStructPlanCacheSize,
+	entries:    make(map[structPlanKey]*list.Element),
+	lru:        list.New(),
+}
+
+// SetStructPlanCacheSize sets the maximum number of struct plans that
+// are cached. A struct plan describes the fields of a struct type for
+// a given set of struct tags, and is computed the first time a value
+// of that type is encoded or decoded. If n is zero or negative, plans
+// are not cached at all.
+//
+// The least recently used plans are evicted when the cache is full.
+// Use Internals to monitor the cache hit ratio
+func SetStructPlanCacheSize(n int) {
+	structPlans.mu.Lock()
+	defer structPlans.mu.Unlock()
+
+	structPlans.maxEntries = n
+	structPlans.evict()
+}
+
+// evict must be called while holding mu
+func (c *structPlanCache) evict() {
+	max := c.maxEntries
+	if max < 0 {
+		max = 0
+	}
+	for c.lru.Len() > max {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, elem.Value.(*structPlanEntry).key)
+		c.evictions++
+	}
+}
+
+func (c *structPlanCache) get(rt reflect.Type, tags []string) *structPlan {
+	key := structPlanKey{typ: rt}
+	if len(tags) > 0 {
+		key.tags = strings.Join(tags, ",")
+	}
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		c.hits++
+		c.mu.Unlock()
+		return elem.Value.(*structPlanEntry).plan
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Build the plan without holding the lock. Two goroutines may
+	// build the same plan concurrently, which is harmless
+	plan := newStructPlan(rt, tags)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxEntries <= 0 {
+		return plan
+	}
+	if elem, ok := c.entries[key]; ok {
+		return elem.Value.(*structPlanEntry).plan
+	}
+	c.entries[key] = c.lru.PushFront(&structPlanEntry{key: key, plan: plan})
+	c.evict()
+	return plan
+}
+
+func newStructPlan(rt reflect.Type, tags []string) *structPlan {
+	if len(tags) == 0 {
+		tags = defaultStructTags
+	}
+
+	plan := &structPlan{
+		byName: make(map[string]int),
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		ft := rt.Field(i)
+		if ft.Name == "_" {
+			if parseMsgpackTag(ft, tags).asArray {
+				plan.asArray = true
+			}
+			continue
+		}
+		if ft.PkgPath != "" {
+			continue
+		}
+
+		tag := parseMsgpackTag(ft, tags)
+		if tag.name == "-" {
+			continue
+		}
+
+		plan.byName[tag.name] = i
+		sf := structField{name: tag.name, index: i, omitempty: tag.omitempty, isZero: tag.omitempty && hasIsZero(ft.Type), emptyAsNil: tag.emptyAsNil, pairs: tag.pairs}
+		if tag.keyAsInt {
+			// keyasint is ignored if the name is not an integer, in
+			// which case the field keeps its string key
+			if k, err := strconv.ParseInt(tag.name, 10, 64); err == nil {
+				sf.keyAsInt = true
+				sf.intKey = k
+				if plan.byInt == nil {
+					plan.byInt = make(map[int64]int)
+				}
+				plan.byInt[k] = i
+			}
+		}
+		plan.fields = append(plan.fields, sf)
+		if tag.emptyAsNil {
+			if plan.emptyAsNil == nil {
+				plan.emptyAsNil = make(map[int]struct{})
+			}
+			plan.emptyAsNil[i] = struct{}{}
+		}
+		if tag.pairs {
+			if plan.pairs == nil {
+				plan.pairs = make(map[int]struct{})
+			}
+			plan.pairs[i] = struct{}{}
+		}
+		if tag.decoder != "" {
+			if plan.decoders == nil {
+				plan.decoders = make(map[int]string)
+			}
+			plan.decoders[i] = tag.decoder
+		}
+	}
+	return plan
+}
+
+// isEmptyAsNilType returns true for the types that the emptyasnil tag
+// applies to: *string and *time.Time
+func isEmptyAsNilType(rt reflect.Type) bool {
+	if rt.Kind() != reflect.Ptr {
+		return false
+	}
+	return rt.Elem().Kind() == reflect.String || rt.Elem() == timeType
+}
+
+// structPlanFor returns the plan for the struct type rt, using the
+// struct tags from o
+func (o *Options) structPlanFor(rt reflect.Type) *structPlan {
+	return structPlans.get(rt, o.StructTags)
+}
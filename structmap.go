@@ -0,0 +1,313 @@
+package msgpack
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+var stringInterfaceMapType = reflect.TypeOf(map[string]interface{}(nil))
+
+// ToMap converts a struct, or a pointer to a struct, into the map that
+// it would be encoded as, without going through the wire format. The
+// struct tags (see WithStructTags) and omitempty are honored, the
+// fields returned by MsgpackFielder are included, and nested structs,
+// including those in slices, arrays and maps, are converted too.
+// Other values, including time.Time and types that implement
+// EncodeMsgpacker, are stored as is.
+//
+// This is useful to feed structs to templates or structured loggers:
+//
+//	m, err := msgpack.ToMap(event)
+//	tmpl.Execute(w, m)
+func ToMap(v interface{}, options ...Option) (map[string]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, errors.Errorf(`msgpack: ToMap(nil %s)`, rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.Errorf(`msgpack: argument to ToMap must be a struct (not %T)`, v)
+	}
+
+	o := newOptions(options)
+	return o.structToMap(rv)
+}
+
+func (o *Options) structToMap(rv reflect.Value) (map[string]interface{}, error) {
+	rt := rv.Type()
+	plan := o.structPlanFor(rt)
+
+	m := make(map[string]interface{}, len(plan.fields))
+	for _, sf := range plan.fields {
+		field := rv.Field(sf.index)
+		if sf.omitempty {
+			if isEmptyValue(field, sf.isZero) {
+				continue
+			}
+		}
+
+		fv, err := o.projectValue(field)
+		if err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to convert field %s`, sf.name)
+		}
+		m[sf.name] = fv
+	}
+
+	if rv.CanAddr() {
+		rv = rv.Addr()
+	}
+	if fielder, ok := rv.Interface().(MsgpackFielder); ok {
+		for k, v := range fielder.MsgpackFields() {
+			if _, ok := plan.byName[k]; ok {
+				return nil, errors.Errorf(`msgpack: field %s returned by MsgpackFields conflicts with a field in %s`, k, rt)
+			}
+			m[k] = v
+		}
+	}
+	return m, nil
+}
+
+// projectValue converts the structs in rv into maps
+func (o *Options) projectValue(rv reflect.Value) (interface{}, error) {
+	if !rv.IsValid() {
+		return nil, nil
+	}
+
+	if isOpaqueForMap(rv.Type()) {
+		return rv.Interface(), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Kind() == reflect.Ptr && rv.Elem().Kind() != reflect.Struct {
+			return rv.Interface(), nil
+		}
+		return o.projectValue(rv.Elem())
+	case reflect.Struct:
+		return o.structToMap(rv)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil, nil
+		}
+		if !containsStruct(rv.Type().Elem()) {
+			return rv.Interface(), nil
+		}
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			v, err := o.projectValue(rv.Index(i))
+			if err != nil {
+				return nil, errors.Wrapf(err, `msgpack: failed to convert element %d`, i)
+			}
+			list[i] = v
+		}
+		return list, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Type().Key().Kind() != reflect.String || !containsStruct(rv.Type().Elem()) {
+			return rv.Interface(), nil
+		}
+		m := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			v, err := o.projectValue(rv.MapIndex(key))
+			if err != nil {
+				return nil, errors.Wrapf(err, `msgpack: failed to convert value for key %s`, key.String())
+			}
+			m[key.String()] = v
+		}
+		return m, nil
+	}
+	return rv.Interface(), nil
+}
+
+// isOpaqueForMap returns true for struct types that have their own
+// msgpack representation, and are therefore not converted into maps
+func isOpaqueForMap(rt reflect.Type) bool {
+	if rt == timeType {
+		return true
+	}
+	if _, ok := isExtType(rt); ok {
+		return true
+	}
+	return rt.Implements(encodeMsgpackerType) || reflect.PtrTo(rt).Implements(encodeMsgpackerType)
+}
+
+// containsStruct returns true if values of type rt may hold structs
+// that need to be converted
+func containsStruct(rt reflect.Type) bool {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	switch rt.Kind() {
+	case reflect.Struct:
+		return !isOpaqueForMap(rt)
+	case reflect.Interface:
+		return true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return containsStruct(rt.Elem())
+	}
+	return false
+}
+
+// FromMap is the reverse of ToMap: it fills the struct pointed to by v
+// with the values in m, matching keys to fields the same way that
+// decoding does. Nested maps are converted into structs, slices of
+// interface{} into typed slices, and numbers into the type of the
+// field, as long as they fit. Keys that do not correspond to a field
+// are ignored, or passed to SetMsgpackFields if the struct implements
+// MsgpackFieldSetter
+func FromMap(m map[string]interface{}, v interface{}, options ...Option) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.Errorf(`msgpack: argument to FromMap must be a non-nil pointer to a struct (not %T)`, v)
+	}
+
+	o := newOptions(options)
+	return o.mapToStruct(m, rv.Elem())
+}
+
+func (o *Options) mapToStruct(m map[string]interface{}, rv reflect.Value) error {
+	plan := o.structPlanFor(rv.Type())
+
+	setter, _ := rv.Addr().Interface().(MsgpackFieldSetter)
+	var extra map[string]interface{}
+	for k, v := range m {
+		fi, ok := plan.byName[k]
+		if !ok {
+			if setter != nil {
+				if extra == nil {
+					extra = make(map[string]interface{})
+				}
+				extra[k] = v
+			}
+			continue
+		}
+
+		if err := o.assignFromMap(rv.Field(fi), v); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to assign field %s`, k)
+		}
+	}
+
+	if setter != nil && extra != nil {
+		setter.SetMsgpackFields(extra)
+	}
+	return nil
+}
+
+// assignFromMap stores v, a value produced by ToMap or by decoding into
+// interface{}, in dst
+func (o *Options) assignFromMap(dst reflect.Value, v interface{}) error {
+	if v == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	src := reflect.ValueOf(v)
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(dst.Type().Elem())
+		if err := o.assignFromMap(elem.Elem(), v); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	case reflect.Struct:
+		if src.Type() == stringInterfaceMapType {
+			return o.mapToStruct(v.(map[string]interface{}), dst)
+		}
+	case reflect.Slice:
+		if src.Kind() == reflect.Slice || src.Kind() == reflect.Array {
+			list := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+			for i := 0; i < src.Len(); i++ {
+				if err := o.assignFromMap(list.Index(i), src.Index(i).Interface()); err != nil {
+					return errors.Wrapf(err, `msgpack: failed to assign element %d`, i)
+				}
+			}
+			dst.Set(list)
+			return nil
+		}
+	case reflect.Array:
+		if src.Kind() == reflect.Slice || src.Kind() == reflect.Array {
+			if src.Len() != dst.Len() {
+				return errors.Errorf(`msgpack: cannot assign %d elements to %s`, src.Len(), dst.Type())
+			}
+			for i := 0; i < src.Len(); i++ {
+				if err := o.assignFromMap(dst.Index(i), src.Index(i).Interface()); err != nil {
+					return errors.Wrapf(err, `msgpack: failed to assign element %d`, i)
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if src.Kind() == reflect.Map && src.Type().Key().ConvertibleTo(dst.Type().Key()) && src.Type().Key().Kind() == dst.Type().Key().Kind() {
+			mv := reflect.MakeMapWithSize(dst.Type(), src.Len())
+			for _, key := range src.MapKeys() {
+				elem := reflect.New(dst.Type().Elem()).Elem()
+				if err := o.assignFromMap(elem, src.MapIndex(key).Interface()); err != nil {
+					return errors.Wrapf(err, `msgpack: failed to assign value for key %v`, key.Interface())
+				}
+				mv.SetMapIndex(key.Convert(dst.Type().Key()), elem)
+			}
+			dst.Set(mv)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if !dst.OverflowInt(src.Int()) {
+				dst.SetInt(src.Int())
+				return nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if x := src.Uint(); x <= math.MaxInt64 && !dst.OverflowInt(int64(x)) {
+				dst.SetInt(int64(x))
+				return nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if x := src.Int(); x >= 0 && !dst.OverflowUint(uint64(x)) {
+				dst.SetUint(uint64(x))
+				return nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if !dst.OverflowUint(src.Uint()) {
+				dst.SetUint(src.Uint())
+				return nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch src.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(src.Float())
+			return nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			dst.SetFloat(float64(src.Int()))
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			dst.SetFloat(float64(src.Uint()))
+			return nil
+		}
+	}
+
+	// Named types of the same kind (type Color string, and so on)
+	if src.Kind() == dst.Kind() && src.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(src.Convert(dst.Type()))
+		return nil
+	}
+	return errors.Errorf(`msgpack: cannot assign %s to %s`, src.Type(), dst.Type())
+}
@@ -0,0 +1,105 @@
+package msgpack_test
+
+import (
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapAddress struct {
+	City string `msgpack:"city"`
+	Zip  string `msgpack:"zip,omitempty"`
+}
+
+type mapPerson struct {
+	Name      string           `msgpack:"name"`
+	Age       int              `msgpack:"age"`
+	Nickname  string           `msgpack:"nickname,omitempty"`
+	Secret    string           `msgpack:"-"`
+	Home      *mapAddress      `msgpack:"home"`
+	Previous  []mapAddress     `msgpack:"previous"`
+	Tags      []string         `msgpack:"tags"`
+	CreatedAt time.Time        `msgpack:"created_at"`
+	Scores    map[string]uint8 `msgpack:"scores"`
+}
+
+func TestToMap(t *testing.T) {
+	created := time.Unix(1000, 0)
+	p := mapPerson{
+		Name:      "alice",
+		Age:       30,
+		Secret:    "hidden",
+		Home:      &mapAddress{City: "Tokyo", Zip: "100"},
+		Previous:  []mapAddress{{City: "Osaka"}},
+		Tags:      []string{"a", "b"},
+		CreatedAt: created,
+		Scores:    map[string]uint8{"go": 9},
+	}
+
+	m, err := msgpack.ToMap(&p)
+	if !assert.NoError(t, err, "ToMap should succeed") {
+		return
+	}
+	expected := map[string]interface{}{
+		"name":       "alice",
+		"age":        30,
+		"home":       map[string]interface{}{"city": "Tokyo", "zip": "100"},
+		"previous":   []interface{}{map[string]interface{}{"city": "Osaka"}},
+		"tags":       []string{"a", "b"},
+		"created_at": created,
+		"scores":     map[string]uint8{"go": 9},
+	}
+	if !assert.Equal(t, expected, m, "map should match") {
+		return
+	}
+
+	t.Run("FromMap", func(t *testing.T) {
+		var p2 mapPerson
+		if !assert.NoError(t, msgpack.FromMap(m, &p2), "FromMap should succeed") {
+			return
+		}
+		p.Secret = ""
+		if !assert.Equal(t, p, p2, "struct should round trip") {
+			return
+		}
+	})
+	t.Run("FromMap with decoded values", func(t *testing.T) {
+		// Values as they come out of decoding into interface{}
+		var p2 mapPerson
+		err := msgpack.FromMap(map[string]interface{}{
+			"name":     "bob",
+			"age":      int8(42),
+			"previous": []interface{}{map[string]interface{}{"city": "Kyoto"}},
+			"tags":     []interface{}{"x"},
+			"scores":   map[string]interface{}{"go": int64(7)},
+			"unknown":  true,
+		}, &p2)
+		if !assert.NoError(t, err, "FromMap should succeed") {
+			return
+		}
+		if !assert.Equal(t, mapPerson{
+			Name:     "bob",
+			Age:      42,
+			Previous: []mapAddress{{City: "Kyoto"}},
+			Tags:     []string{"x"},
+			Scores:   map[string]uint8{"go": 7},
+		}, p2, "struct should match") {
+			return
+		}
+	})
+	t.Run("FromMap overflow", func(t *testing.T) {
+		var p2 mapPerson
+		err := msgpack.FromMap(map[string]interface{}{"scores": map[string]interface{}{"go": 1000}}, &p2)
+		if !assert.Error(t, err, "FromMap should fail") {
+			return
+		}
+	})
+	t.Run("ToMap non-struct", func(t *testing.T) {
+		_, err := msgpack.ToMap(1)
+		if !assert.Error(t, err, "ToMap should fail") {
+			return
+		}
+	})
+}
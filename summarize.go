@@ -0,0 +1,379 @@
+package msgpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// summaryStringLength is the maximum number of bytes of a string that
+// are included in the output of Summarize
+const summaryStringLength = 64
+
+// Summarize returns a short, human readable representation of v that
+// is suitable for logging. Containers deeper than maxDepth are elided,
+// at most maxElems elements of each array, slice, map, or struct are
+// shown, long strings are truncated, and the contents of []byte values
+// are never shown, only their length. Struct fields are named using
+// their msgpack struct tags, and fields tagged with "-" (which are
+// never encoded) are not shown either.
+//
+//	log.Printf("received %s", msgpack.Summarize(msg, 2, 5))
+//	// received {Attachment: <bin 1048576 bytes>, Name: "foo", Values: [1, 2, 3, 4, 5, ...(+95)]}
+func Summarize(v interface{}, maxDepth, maxElems int) string {
+	var b strings.Builder
+	summarize(&b, reflect.ValueOf(v), 0, maxDepth, maxElems)
+	return b.String()
+}
+
+func summarize(b *strings.Builder, rv reflect.Value, depth, maxDepth, maxElems int) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		b.WriteString("nil")
+		return
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		summarizeString(b, rv.String())
+		return
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			fmt.Fprintf(b, "<bin %d bytes>", rv.Len())
+			return
+		}
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		if depth >= maxDepth {
+			fmt.Fprintf(b, "[...(%d)]", rv.Len())
+			return
+		}
+
+		b.WriteByte('[')
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if i >= maxElems {
+				fmt.Fprintf(b, "...(+%d)", rv.Len()-i)
+				break
+			}
+			summarize(b, rv.Index(i), depth+1, maxDepth, maxElems)
+		}
+		b.WriteByte(']')
+		return
+	case reflect.Map:
+		if rv.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		if depth >= maxDepth {
+			fmt.Fprintf(b, "{...(%d)}", rv.Len())
+			return
+		}
+
+		keys := rv.MapKeys()
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = fmt.Sprint(key.Interface())
+		}
+		// Keep the output stable
+		sort.Sort(&summaryKeys{names: names, keys: keys})
+
+		b.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if i >= maxElems {
+				fmt.Fprintf(b, "...(+%d)", len(keys)-i)
+				break
+			}
+			b.WriteString(names[i])
+			b.WriteString(": ")
+			summarize(b, rv.MapIndex(key), depth+1, maxDepth, maxElems)
+		}
+		b.WriteByte('}')
+		return
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			b.WriteString(rv.Interface().(time.Time).String())
+			return
+		}
+
+		var names []string
+		var fields []reflect.Value
+		for _, sf := range structPlans.get(rv.Type(), nil).fields {
+			names = append(names, sf.name)
+			fields = append(fields, rv.Field(sf.index))
+		}
+
+		if depth >= maxDepth {
+			fmt.Fprintf(b, "{...(%d)}", len(fields))
+			return
+		}
+
+		b.WriteByte('{')
+		for i := range fields {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if i >= maxElems {
+				fmt.Fprintf(b, "...(+%d)", len(fields)-i)
+				break
+			}
+			b.WriteString(names[i])
+			b.WriteString(": ")
+			summarize(b, fields[i], depth+1, maxDepth, maxElems)
+		}
+		b.WriteByte('}')
+		return
+	}
+
+	fmt.Fprintf(b, "%v", rv.Interface())
+}
+
+func summarizeString(b *strings.Builder, s string) {
+	if len(s) <= summaryStringLength {
+		b.WriteString(strconv.Quote(s))
+		return
+	}
+
+	b.WriteString(strconv.Quote(truncateUTF8(s, summaryStringLength)))
+	fmt.Fprintf(b, "...(%d bytes)", len(s))
+}
+
+// truncateUTF8 truncates s to at most n bytes, without splitting a
+// multi-byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+type summaryKeys struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func (k *summaryKeys) Len() int           { return len(k.names) }
+func (k *summaryKeys) Less(i, j int) bool { return k.names[i] < k.names[j] }
+func (k *summaryKeys) Swap(i, j int) {
+	k.names[i], k.names[j] = k.names[j], k.names[i]
+	k.keys[i], k.keys[j] = k.keys[j], k.keys[i]
+}
+
+// TruncateEncoded returns a valid msgpack value of at most budget
+// bytes, built from the first value in data. Strings and binaries are
+// cut short, and arrays and maps lose their trailing elements, until
+// the value fits. The result is a prefix of data in traversal order:
+// once something has been cut, everything that follows it is dropped.
+//
+// If data already fits, it is returned as is. nil is returned if data
+// is not valid msgpack, or if not even a truncated value fits in budget
+func TruncateEncoded(data []byte, budget int) []byte {
+	if len(data) <= budget {
+		return data
+	}
+
+	var buf bytes.Buffer
+	d := NewDecoder(bytes.NewReader(data))
+	if _, err := d.truncateValue(&buf, budget); err != nil {
+		return nil
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// truncateValue copies the next value to dst, using at most budget
+// bytes. It reports whether the value had to be cut (or dropped)
+func (d *Decoder) truncateValue(dst *bytes.Buffer, budget int) (bool, error) {
+	var h valueHeader
+	if err := d.readValueHeader(&h); err != nil {
+		return false, err
+	}
+
+	if budget <= 0 {
+		if err := d.discard(h.size); err != nil {
+			return false, err
+		}
+		for i := int64(0); i < h.elements; i++ {
+			if err := d.skip(); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	switch {
+	case IsArrayFamily(h.code), IsMapFamily(h.code):
+		return d.truncateContainer(dst, &h, budget)
+	case IsStrFamily(h.code), IsBinFamily(h.code):
+		if int64(h.rawlen)+h.size <= int64(budget) {
+			dst.Write(h.raw[:h.rawlen])
+			_, err := io.CopyN(dst, d.raw, h.size)
+			return false, err
+		}
+
+		// Only the part of the payload that could possibly fit is read.
+		// The payload itself may fit, and only the header not
+		keep := h.size
+		if keep > int64(budget) {
+			keep = int64(budget)
+		}
+		payload := make([]byte, keep)
+		if _, err := io.ReadFull(d.raw, payload); err != nil {
+			return false, err
+		}
+		if err := d.discard(h.size - keep); err != nil {
+			return false, err
+		}
+
+		e := NewEncoder(dst)
+		if IsStrFamily(h.code) {
+			// Leave room for the header
+			s := string(payload)
+			for n := budget - 1; n >= 0; n-- {
+				s = truncateUTF8(s, n)
+				if stringHeaderSize(len(s))+len(s) <= budget {
+					return true, e.EncodeString(s)
+				}
+			}
+			return true, nil
+		}
+
+		n := budget - 2
+		if n > len(payload) {
+			n = len(payload)
+		}
+		for ; n >= 0; n-- {
+			if binHeaderSize(n)+n <= budget {
+				return true, e.EncodeBytes(payload[:n])
+			}
+		}
+		return true, nil
+	}
+
+	// Everything else cannot be cut
+	if int64(h.rawlen)+h.size > int64(budget) {
+		return true, d.discard(h.size)
+	}
+	dst.Write(h.raw[:h.rawlen])
+	_, err := io.CopyN(dst, d.raw, h.size)
+	return false, err
+}
+
+func (d *Decoder) truncateContainer(dst *bytes.Buffer, h *valueHeader, budget int) (bool, error) {
+	// The header for the truncated container can only be smaller than
+	// the original, so reserve that much
+	remaining := budget - h.rawlen
+
+	isMap := IsMapFamily(h.code)
+	var body bytes.Buffer
+	var count int
+	var consumed int64
+	truncated := remaining < 0
+	for consumed < h.elements && !truncated {
+		mark := body.Len()
+
+		cut, err := d.truncateValue(&body, remaining)
+		consumed++
+		if err != nil {
+			return false, err
+		}
+
+		if isMap {
+			if cut {
+				// A truncated key is useless
+				body.Truncate(mark)
+				break
+			}
+
+			valueMark := body.Len()
+			cut, err = d.truncateValue(&body, remaining-(valueMark-mark))
+			consumed++
+			if err != nil {
+				return false, err
+			}
+			if cut && body.Len() == valueMark {
+				body.Truncate(mark)
+				break
+			}
+		} else if cut && body.Len() == mark {
+			break
+		}
+
+		count++
+		remaining -= body.Len() - mark
+		truncated = cut
+	}
+
+	if consumed < h.elements {
+		truncated = true
+	}
+	for ; consumed < h.elements; consumed++ {
+		if err := d.skip(); err != nil {
+			return false, err
+		}
+	}
+
+	if remaining < 0 {
+		return true, nil
+	}
+
+	e := NewEncoder(dst)
+	var err error
+	if isMap {
+		err = e.writeCanonicalHeader(FixMap0, Map16, Map32, count)
+	} else {
+		err = e.writeCanonicalHeader(FixArray0, Array16, Array32, count)
+	}
+	if err != nil {
+		return false, err
+	}
+	dst.Write(body.Bytes())
+	return truncated, nil
+}
+
+func stringHeaderSize(n int) int {
+	switch {
+	case n < 32:
+		return 1
+	case n <= 0xff:
+		return 2
+	case n <= 0xffff:
+		return 3
+	}
+	return 5
+}
+
+func binHeaderSize(n int) int {
+	switch {
+	case n <= 0xff:
+		return 2
+	case n <= 0xffff:
+		return 3
+	}
+	return 5
+}
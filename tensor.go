@@ -0,0 +1,257 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Tensor is a dense, row-major array of float32 or float64 values,
+// such as a matrix or the output of a model. It is encoded the same way
+// that msgpack-numpy encodes numpy arrays, so that Go services can
+// exchange them with Python services without packing them by hand:
+//
+//	{"nd": true, "type": "<f8", "kind": "", "shape": [2, 3], "data": <48 bytes>}
+//
+// The keys, "kind" and "data" are Bin, and the values are stored in
+// little endian byte order. When decoding, str keys and big endian
+// (">f8") values are accepted as well, and numpy scalars ("nd": false)
+// are decoded as a Tensor with a nil Shape and a single value
+type Tensor struct {
+	// Shape holds the dimensions of the array. If nil, a Tensor is
+	// encoded as a one dimensional array
+	Shape []int
+	// Data holds the values, and is either a []float32 or a []float64.
+	// Its length must be the product of the dimensions in Shape
+	Data interface{}
+}
+
+// EncodeMsgpack writes t as a msgpack-numpy array
+func (t Tensor) EncodeMsgpack(e *Encoder) error {
+	var dtype string
+	var data []byte
+	var n int
+	switch v := t.Data.(type) {
+	case []float32:
+		dtype = "<f4"
+		n = len(v)
+		data = make([]byte, 4*n)
+		for i, f := range v {
+			binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(f))
+		}
+	case []float64:
+		dtype = "<f8"
+		n = len(v)
+		data = make([]byte, 8*n)
+		for i, f := range v {
+			binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(f))
+		}
+	default:
+		return errors.Errorf(`msgpack: tensor data must be []float32 or []float64 (not %T)`, t.Data)
+	}
+
+	shape := t.Shape
+	if shape == nil {
+		shape = []int{n}
+	}
+	size := 1
+	for _, dim := range shape {
+		if dim < 0 {
+			return errors.Errorf(`msgpack: invalid tensor dimension %d`, dim)
+		}
+		size *= dim
+	}
+	if size != n {
+		return errors.Errorf(`msgpack: tensor of shape %v cannot hold %d values`, shape, n)
+	}
+
+	if err := WriteMapHeader(e.dst, 5); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
+	if err := e.encodeTensorKey("nd"); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(true); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write tensor flag`)
+	}
+	if err := e.encodeTensorKey("type"); err != nil {
+		return err
+	}
+	if err := e.EncodeString(dtype); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write tensor type`)
+	}
+	if err := e.encodeTensorKey("kind"); err != nil {
+		return err
+	}
+	if err := e.EncodeBytes([]byte{}); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write tensor kind`)
+	}
+	if err := e.encodeTensorKey("shape"); err != nil {
+		return err
+	}
+	if err := e.EncodeArrayHeader(len(shape)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write tensor shape`)
+	}
+	for _, dim := range shape {
+		if err := e.encodeCompactUint(uint64(dim)); err != nil {
+			return errors.Wrap(err, `msgpack: failed to write tensor shape`)
+		}
+	}
+	if err := e.encodeTensorKey("data"); err != nil {
+		return err
+	}
+	if err := e.EncodeBytes(data); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write tensor data`)
+	}
+	return nil
+}
+
+func (e *Encoder) encodeTensorKey(key string) error {
+	if err := e.EncodeBytes([]byte(key)); err != nil {
+		return errors.Wrapf(err, `msgpack: failed to write tensor key %s`, key)
+	}
+	return nil
+}
+
+// DecodeMsgpack reads a msgpack-numpy array or scalar into t
+func (t *Tensor) DecodeMsgpack(d *Decoder) error {
+	var size int
+	if err := d.DecodeMapLength(&size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode tensor`)
+	}
+	if size == -1 {
+		*t = Tensor{}
+		return nil
+	}
+
+	var nd bool
+	var dtype string
+	var shape []int
+	var data []byte
+	var haveData bool
+	for i := 0; i < size; i++ {
+		key, err := d.decodeStrOrBin()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode tensor key`)
+		}
+
+		switch key {
+		case "nd":
+			if err := d.DecodeBool(&nd); err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode tensor flag`)
+			}
+		case "type":
+			if dtype, err = d.decodeStrOrBin(); err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode tensor type`)
+			}
+		case "shape":
+			var l int
+			if err := d.DecodeArrayLength(&l); err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode tensor shape`)
+			}
+			shape = make([]int, l)
+			for j := range shape {
+				var dim uint64
+				if err := d.DecodeUint64(&dim); err != nil {
+					return errors.Wrap(err, `msgpack: failed to decode tensor shape`)
+				}
+				if dim > uint64(maxInt) {
+					return errors.Errorf(`msgpack: tensor dimension %d is too large`, dim)
+				}
+				shape[j] = int(dim)
+			}
+		case "data":
+			s, err := d.decodeStrOrBin()
+			if err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode tensor data`)
+			}
+			data = []byte(s)
+			haveData = true
+		default:
+			if err := d.skip(); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to skip tensor field %s`, key)
+			}
+		}
+	}
+
+	if !haveData || len(dtype) != 3 {
+		return errors.Errorf(`msgpack: not a msgpack-numpy array (type %q)`, dtype)
+	}
+
+	var order binary.ByteOrder
+	switch dtype[0] {
+	case '<':
+		order = binary.LittleEndian
+	case '>':
+		order = binary.BigEndian
+	default:
+		return errors.Errorf(`msgpack: unsupported tensor type %q`, dtype)
+	}
+
+	var itemSize int
+	switch dtype[1:] {
+	case "f4":
+		itemSize = 4
+	case "f8":
+		itemSize = 8
+	default:
+		return errors.Errorf(`msgpack: unsupported tensor type %q`, dtype)
+	}
+
+	if !nd {
+		shape = nil
+	}
+	n := 1
+	for _, dim := range shape {
+		if dim != 0 && n > len(data)/dim {
+			return errors.Errorf(`msgpack: tensor of shape %v does not match %d bytes of data`, shape, len(data))
+		}
+		n *= dim
+	}
+	if n*itemSize != len(data) {
+		return errors.Errorf(`msgpack: tensor of shape %v does not match %d bytes of data`, shape, len(data))
+	}
+
+	switch itemSize {
+	case 4:
+		v := make([]float32, n)
+		for i := range v {
+			v[i] = math.Float32frombits(order.Uint32(data[4*i:]))
+		}
+		t.Data = v
+	default:
+		v := make([]float64, n)
+		for i := range v {
+			v[i] = math.Float64frombits(order.Uint64(data[8*i:]))
+		}
+		t.Data = v
+	}
+	t.Shape = shape
+	return nil
+}
+
+// decodeStrOrBin decodes the next value, which may be either a string
+// or a byte slice, as a string. This is needed to read data written by
+// Python, where keys and values may be either depending on the options
+// that were used
+func (d *Decoder) decodeStrOrBin() (string, error) {
+	code, err := d.PeekCode()
+	if err != nil {
+		return "", errors.Wrap(err, `msgpack: failed to peek code`)
+	}
+
+	if IsBinFamily(code) {
+		var b []byte
+		if err := d.DecodeBytes(&b); err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	var s string
+	if err := d.DecodeString(&s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
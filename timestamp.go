@@ -0,0 +1,110 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimestampExtType is the extension type of the timestamp extension
+// defined by the msgpack specification
+const TimestampExtType = -1
+
+// timestampExtByte is TimestampExtType as it appears on the wire
+const timestampExtByte = byte(0xff)
+
+// encodeTimestamp writes t using the timestamp extension, in the
+// smallest of the 32, 64 and 96 bit formats that can hold it
+func (e *Encoder) encodeTimestamp(t time.Time) error {
+	sec := t.Unix()
+	nsec := int64(t.Nanosecond())
+
+	if uint64(sec)>>34 == 0 {
+		if nsec == 0 && sec <= 0xffffffff {
+			if err := e.dst.WriteByteUint8(FixExt4.Byte(), timestampExtByte); err != nil {
+				return errors.Wrap(err, `msgpack: failed to write timestamp header`)
+			}
+			return e.dst.WriteUint32(uint32(sec))
+		}
+
+		if err := e.dst.WriteByteUint8(FixExt8.Byte(), timestampExtByte); err != nil {
+			return errors.Wrap(err, `msgpack: failed to write timestamp header`)
+		}
+		return e.dst.WriteUint64(uint64(nsec)<<34 | uint64(sec))
+	}
+
+	if err := e.dst.WriteByteUint8(Ext8.Byte(), 12); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write timestamp header`)
+	}
+	if err := e.dst.WriteByte(timestampExtByte); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write timestamp type`)
+	}
+	if err := e.dst.WriteUint32(uint32(nsec)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write timestamp nanoseconds`)
+	}
+	return e.dst.WriteUint64(uint64(sec))
+}
+
+// isNextTimestamp returns true if the next value in the stream is a
+// timestamp extension
+func (d *Decoder) isNextTimestamp() bool {
+	b, err := d.raw.Peek(2)
+	if err != nil {
+		return false
+	}
+
+	switch Code(b[0]) {
+	case FixExt4, FixExt8:
+		return b[1] == timestampExtByte
+	case Ext8:
+		b, err := d.raw.Peek(3)
+		return err == nil && b[1] == 12 && b[2] == timestampExtByte
+	}
+	return false
+}
+
+// decodeTimestamp reads a timestamp extension into v
+func (d *Decoder) decodeTimestamp(v *time.Time) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code for timestamp`)
+	}
+
+	var buf [15]byte
+	var payload []byte
+	switch code {
+	case FixExt4:
+		payload = buf[:1+4]
+	case FixExt8:
+		payload = buf[:1+8]
+	case Ext8:
+		payload = buf[:1+1+12]
+	default:
+		return d.invalidCode(code, errors.Errorf(`msgpack: expected timestamp extension, got %s`, code))
+	}
+	if _, err := io.ReadFull(d.raw, payload); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read timestamp`)
+	}
+	if code == Ext8 {
+		payload = payload[1:]
+	}
+	if payload[0] != timestampExtByte {
+		return errors.Errorf(`msgpack: expected timestamp extension, got extension type %d`, int8(payload[0]))
+	}
+	payload = payload[1:]
+
+	switch len(payload) {
+	case 4:
+		*v = time.Unix(int64(binary.BigEndian.Uint32(payload)), 0)
+	case 8:
+		x := binary.BigEndian.Uint64(payload)
+		*v = time.Unix(int64(x&(1<<34-1)), int64(x>>34))
+	default:
+		nsec := binary.BigEndian.Uint32(payload)
+		sec := int64(binary.BigEndian.Uint64(payload[4:]))
+		*v = time.Unix(sec, int64(nsec))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestamp(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    time.Time
+		expected []byte
+	}{
+		{
+			name:     "timestamp32",
+			value:    time.Unix(1, 0),
+			expected: []byte{0xd6, 0xff, 0, 0, 0, 1},
+		},
+		{
+			name:     "timestamp64",
+			value:    time.Unix(1, 1),
+			expected: []byte{0xd7, 0xff, 0, 0, 0, 0x04, 0, 0, 0, 1},
+		},
+		{
+			name:     "timestamp96",
+			value:    time.Unix(-1, 1),
+			expected: []byte{0xc7, 12, 0xff, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if !assert.NoError(t, msgpack.NewEncoder(&buf).Encode(tc.value), "Encode should succeed") {
+				return
+			}
+			if !assert.Equal(t, tc.expected, buf.Bytes(), "output should match") {
+				return
+			}
+
+			var v time.Time
+			if !assert.NoError(t, msgpack.Unmarshal(tc.expected, &v), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.True(t, tc.value.Equal(v), "time should round trip (got %s)", v) {
+				return
+			}
+
+			var iface interface{}
+			if !assert.NoError(t, msgpack.Unmarshal(tc.expected, &iface), "Unmarshal should succeed") {
+				return
+			}
+			decoded, ok := iface.(time.Time)
+			if !assert.True(t, ok, "interface{} should hold a time.Time (got %T)", iface) {
+				return
+			}
+			if !assert.True(t, tc.value.Equal(decoded), "time should round trip (got %s)", decoded) {
+				return
+			}
+		})
+	}
+	t.Run("WithTimeAsArray", func(t *testing.T) {
+		value := time.Unix(1234567890, 123)
+
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf, msgpack.WithTimeAsArray()).Encode(value), "Encode should succeed") {
+			return
+		}
+		if !assert.Equal(t, msgpack.FixArray2.Byte(), buf.Bytes()[0], "time should be encoded as an array") {
+			return
+		}
+
+		var s struct{ T time.Time }
+		if !assert.NoError(t, msgpack.Unmarshal(append([]byte{0x81, 0xa1, 'T'}, buf.Bytes()...), &s), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.True(t, value.Equal(s.T), "time should round trip (got %s)", s.T) {
+			return
+		}
+	})
+}
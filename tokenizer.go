@@ -0,0 +1,184 @@
+package msgpack
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Token describes a single msgpack value header on the wire, and the
+// range of bytes that its payload occupies. The elements of arrays and
+// maps are reported as separate tokens that follow the container
+type Token struct {
+	Code Code
+	// Offset is the position of the code in the stream
+	Offset int64
+	// PayloadOffset is the position of the first byte after the header
+	// (the code and the length bytes, if any)
+	PayloadOffset int64
+	// PayloadLen is the number of bytes of the payload. It is zero for
+	// arrays and maps, whose elements are separate tokens. For the ext
+	// family, the payload starts with the type byte
+	PayloadLen int64
+	// Elements is the number of elements of an array, or the number of
+	// entries of a map. Maps are followed by twice as many tokens, keys
+	// and values alternating
+	Elements int64
+	// Depth is the nesting level of the value. Top-level values have
+	// depth 0, their elements have depth 1, and so on
+	Depth int
+}
+
+// Tokenizer reads a msgpack stream as a sequence of Tokens, without
+// constructing any Go values. It is meant for scanners that only need
+// to look at part of the data, such as counting fields or sampling
+// values, and need to be fast.
+//
+//	tok := msgpack.NewTokenizer(r)
+//	var t msgpack.Token
+//	for {
+//	  if err := tok.Next(&t); err != nil {
+//	    if err == io.EOF {
+//	      break
+//	    }
+//	    return err
+//	  }
+//	  if msgpack.IsStrFamily(t.Code) {
+//	    s, _ := tok.Payload()
+//	    ...
+//	  }
+//	}
+type Tokenizer struct {
+	dec *Decoder
+	// remaining holds the number of values that are still expected at
+	// each level of nesting
+	remaining []int64
+	// unread is the number of payload bytes of the current token that
+	// have not been consumed yet
+	unread  int64
+	payload []byte
+	read    bool
+	// container is set if the current token is an array or a map with
+	// elements, whose count is at the top of remaining
+	container bool
+}
+
+// NewTokenizer creates a new Tokenizer that reads from r. Options that
+// apply to a Decoder (such as WithReadBufferSize) apply to the
+// Tokenizer as well
+func NewTokenizer(r io.Reader, options ...Option) *Tokenizer {
+	return &Tokenizer{
+		dec: NewDecoder(r, options...),
+	}
+}
+
+// Next reads the next token into tok. The payload of the previous token
+// is skipped if it has not been read via Payload. Next returns io.EOF
+// when the stream ends between top-level values, and
+// io.ErrUnexpectedEOF when it ends in the middle of a value
+func (t *Tokenizer) Next(tok *Token) error {
+	if err := t.dec.discard(t.unread); err != nil {
+		return errors.Wrap(err, `msgpack: failed to skip payload`)
+	}
+	t.unread = 0
+	t.read = false
+	t.container = false
+
+	for l := len(t.remaining); l > 0 && t.remaining[l-1] == 0; l-- {
+		t.remaining = t.remaining[:l-1]
+	}
+
+	depth := len(t.remaining)
+	if _, err := t.dec.raw.Peek(1); err != nil {
+		if err == io.EOF {
+			if depth > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return io.EOF
+		}
+		return errors.Wrap(err, `msgpack: failed to read token`)
+	}
+
+	offset := t.dec.consumed()
+	var h valueHeader
+	if err := t.dec.readValueHeader(&h); err != nil {
+		return errors.Wrapf(err, `msgpack: failed to read token at offset %d`, offset)
+	}
+
+	if depth > 0 {
+		t.remaining[depth-1]--
+	}
+	if h.elements > 0 {
+		t.remaining = append(t.remaining, h.elements)
+		t.container = true
+	}
+
+	elements := h.elements
+	if IsMapFamily(h.code) {
+		elements /= 2
+	}
+	*tok = Token{
+		Code:          h.code,
+		Offset:        offset,
+		PayloadOffset: offset + int64(h.rawlen),
+		PayloadLen:    h.size,
+		Elements:      elements,
+		Depth:         depth,
+	}
+	t.unread = h.size
+	return nil
+}
+
+// Payload reads the payload of the token that was last returned by
+// Next. The returned slice is only valid until the next call to Next
+// or Payload, and is nil for tokens without a payload
+func (t *Tokenizer) Payload() ([]byte, error) {
+	if t.read {
+		if len(t.payload) == 0 {
+			return nil, nil
+		}
+		return t.payload, nil
+	}
+
+	n := t.unread
+	if n > maxInt {
+		return nil, errors.Errorf(`msgpack: payload of %d bytes is too large`, n)
+	}
+	if int64(cap(t.payload)) < n {
+		t.payload = make([]byte, n)
+	}
+	t.payload = t.payload[:n]
+	if _, err := io.ReadFull(t.dec.raw, t.payload); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to read payload`)
+	}
+	t.unread = 0
+	t.read = true
+	if n == 0 {
+		return nil, nil
+	}
+	return t.payload, nil
+}
+
+// Skip skips the rest of the value of the token that was last returned
+// by Next: for arrays and maps, the tokens of the elements that have not
+// been read yet are skipped as well, so that the next call to Next
+// returns the token that follows the container
+func (t *Tokenizer) Skip() error {
+	if err := t.dec.discard(t.unread); err != nil {
+		return errors.Wrap(err, `msgpack: failed to skip payload`)
+	}
+	t.unread = 0
+
+	if !t.container {
+		return nil
+	}
+	t.container = false
+
+	l := len(t.remaining)
+	for ; t.remaining[l-1] > 0; t.remaining[l-1]-- {
+		if err := t.dec.skip(); err != nil {
+			return errors.Wrap(err, `msgpack: failed to skip element`)
+		}
+	}
+	return nil
+}
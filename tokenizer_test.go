@@ -0,0 +1,77 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenizer(t *testing.T) {
+	// {"foo": [1, "bar"]}, nil
+	data := []byte{0x81, 0xa3, 'f', 'o', 'o', 0x92, 0x01, 0xa3, 'b', 'a', 'r', 0xc0}
+
+	t.Run("tokens", func(t *testing.T) {
+		tok := msgpack.NewTokenizer(bytes.NewReader(data))
+		expected := []msgpack.Token{
+			{Code: msgpack.FixMap1, Offset: 0, PayloadOffset: 1, Elements: 1, Depth: 0},
+			{Code: msgpack.FixStr3, Offset: 1, PayloadOffset: 2, PayloadLen: 3, Depth: 1},
+			{Code: msgpack.FixArray2, Offset: 5, PayloadOffset: 6, Elements: 2, Depth: 1},
+			{Code: msgpack.Code(1), Offset: 6, PayloadOffset: 7, Depth: 2},
+			{Code: msgpack.FixStr3, Offset: 7, PayloadOffset: 8, PayloadLen: 3, Depth: 2},
+			{Code: msgpack.Nil, Offset: 11, PayloadOffset: 12, Depth: 0},
+		}
+		for i, e := range expected {
+			var tk msgpack.Token
+			if !assert.NoError(t, tok.Next(&tk), "Next should succeed (token %d)", i) {
+				return
+			}
+			if !assert.Equal(t, e, tk, "token %d should match", i) {
+				return
+			}
+			if i == 4 {
+				payload, err := tok.Payload()
+				if !assert.NoError(t, err, "Payload should succeed") {
+					return
+				}
+				if !assert.Equal(t, []byte("bar"), payload, "payload should match") {
+					return
+				}
+			}
+		}
+
+		var tk msgpack.Token
+		if !assert.Equal(t, io.EOF, tok.Next(&tk), "Next should return io.EOF") {
+			return
+		}
+	})
+	t.Run("Skip", func(t *testing.T) {
+		tok := msgpack.NewTokenizer(bytes.NewReader(data))
+		var tk msgpack.Token
+		if !assert.NoError(t, tok.Next(&tk), "Next should succeed") {
+			return
+		}
+		if !assert.NoError(t, tok.Skip(), "Skip should succeed") {
+			return
+		}
+		if !assert.NoError(t, tok.Next(&tk), "Next should succeed") {
+			return
+		}
+		if !assert.Equal(t, msgpack.Nil, tk.Code, "Skip should skip the whole map") {
+			return
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		tok := msgpack.NewTokenizer(bytes.NewReader(data[:5]))
+		var err error
+		for err == nil {
+			var tk msgpack.Token
+			err = tok.Next(&tk)
+		}
+		if !assert.Equal(t, io.ErrUnexpectedEOF, err, "Next should return io.ErrUnexpectedEOF") {
+			return
+		}
+	})
+}
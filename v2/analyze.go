@@ -0,0 +1,293 @@
+package msgpack
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AnalyzeTopN is the maximum number of entries in Report.TopKeys and
+// Report.Largest
+const AnalyzeTopN = 10
+
+// maxAnalyzedKeyLength is the maximum length of map keys that are
+// tracked by Analyze. Longer keys are truncated
+const maxAnalyzedKeyLength = 256
+
+// Report summarizes the composition of a msgpack stream, as returned
+// by Analyze
+type Report struct {
+	// Values is the number of top-level values in the stream
+	Values int64
+	// TotalBytes is the size of the stream
+	TotalBytes int64
+	// MaxDepth is the deepest level of nesting. A top-level scalar has
+	// depth 1, the elements of a top-level array or map have depth 2,
+	// and so on
+	MaxDepth int
+	// Types holds the statistics per wire type family ("nil", "bool",
+	// "int", "uint", "float", "str", "bin", "array", "map", and "ext").
+	// Only the header bytes are attributed to arrays and maps, so the
+	// byte counts of all types add up to TotalBytes
+	Types map[string]TypeStats
+	// TopKeys lists the most frequent map keys, in descending order of
+	// their count. Ties are broken by size, then by the key itself
+	TopKeys []KeyStats
+	// Largest lists the largest scalar values (strings, binaries,
+	// extensions, etc), in descending order of their size
+	Largest []ValueStats
+}
+
+// TypeStats holds the statistics for a single wire type family
+type TypeStats struct {
+	Count int64
+	Bytes int64
+}
+
+// KeyStats holds the statistics for a single map key. Only string
+// keys are tracked
+type KeyStats struct {
+	Key   string
+	Count int64
+	// Bytes is the total encoded size of the keys and their values
+	Bytes int64
+}
+
+// ValueStats describes a single value in the stream
+type ValueStats struct {
+	// Path is the location of the value, in the form `$[0].foo[3]`,
+	// where `$[0]` is the first top-level value
+	Path string
+	// Type is the wire type family of the value
+	Type string
+	// Offset is the position of the value in the stream
+	Offset int64
+	// Bytes is the encoded size of the value
+	Bytes int64
+}
+
+func typeFamily(code Code) string {
+	switch {
+	case code == Nil:
+		return "nil"
+	case code == True, code == False:
+		return "bool"
+	case IsPositiveFixNum(code), code == Uint8, code == Uint16, code == Uint32, code == Uint64:
+		return "uint"
+	case IsNegativeFixNum(code), code == Int8, code == Int16, code == Int32, code == Int64:
+		return "int"
+	case code == Float, code == Double:
+		return "float"
+	case IsStrFamily(code):
+		return "str"
+	case IsBinFamily(code):
+		return "bin"
+	case IsArrayFamily(code):
+		return "array"
+	case IsMapFamily(code):
+		return "map"
+	case IsExtFamily(code):
+		return "ext"
+	}
+	return "unknown"
+}
+
+// pathSegment is a single step in the path to a value: either a map
+// key or an array index
+type pathSegment struct {
+	key   string
+	index int64
+	isKey bool
+}
+
+type analyzer struct {
+	dec    *Decoder
+	offset int64
+	report Report
+	keys   map[string]*KeyStats
+	path   []pathSegment
+}
+
+// Analyze reads all values from r, and reports where the bytes go:
+// counts and sizes per wire type, the most frequent map keys, the
+// maximum nesting depth, and the largest values. Nothing is decoded
+// into Go values, so streams of any size can be analyzed using a
+// constant amount of memory (apart from the distinct map keys).
+//
+//	report, err := msgpack.Analyze(f)
+//	for _, k := range report.TopKeys {
+//	  fmt.Printf("%s: %d times, %d bytes\n", k.Key, k.Count, k.Bytes)
+//	}
+func Analyze(r io.Reader) (Report, error) {
+	a := analyzer{
+		dec:  NewDecoder(r),
+		keys: make(map[string]*KeyStats),
+	}
+	a.report.Types = make(map[string]TypeStats)
+
+	for {
+		if _, err := a.dec.raw.Peek(1); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return a.report, errors.Wrap(err, `msgpack: failed to read value`)
+		}
+
+		a.path = append(a.path[:0], pathSegment{index: a.report.Values})
+		if _, err := a.walk(1, nil); err != nil {
+			return a.report, errors.Wrapf(err, `msgpack: failed to analyze value %d`, a.report.Values)
+		}
+		a.report.Values++
+	}
+	a.report.TotalBytes = a.offset
+
+	for _, ks := range a.keys {
+		a.report.TopKeys = append(a.report.TopKeys, *ks)
+	}
+	sort.Slice(a.report.TopKeys, func(i, j int) bool {
+		ki, kj := a.report.TopKeys[i], a.report.TopKeys[j]
+		if ki.Count != kj.Count {
+			return ki.Count > kj.Count
+		}
+		if ki.Bytes != kj.Bytes {
+			return ki.Bytes > kj.Bytes
+		}
+		return ki.Key < kj.Key
+	})
+	if len(a.report.TopKeys) > AnalyzeTopN {
+		a.report.TopKeys = a.report.TopKeys[:AnalyzeTopN]
+	}
+	return a.report, nil
+}
+
+// mapKey receives the contents of a map key
+type mapKey struct {
+	s     string
+	isStr bool
+}
+
+// walk consumes the next value, and returns its encoded size. If key is
+// non-nil, the value is a map key, and its contents are stored in key
+// when it is a string
+func (a *analyzer) walk(depth int, key *mapKey) (int64, error) {
+	if depth > a.report.MaxDepth {
+		a.report.MaxDepth = depth
+	}
+
+	start := a.offset
+	var h valueHeader
+	if err := a.dec.readValueHeader(&h); err != nil {
+		return 0, err
+	}
+	a.offset += int64(h.rawlen)
+
+	family := typeFamily(h.code)
+	ts := a.report.Types[family]
+	ts.Count++
+	ts.Bytes += int64(h.rawlen)
+
+	payload := h.size
+	if key != nil && family == "str" {
+		// Guard against absurdly long keys: only their prefix is used
+		n := payload
+		if n > maxAnalyzedKeyLength {
+			n = maxAnalyzedKeyLength
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(a.dec.raw, buf); err != nil {
+			return 0, errors.Wrap(err, `msgpack: failed to read map key`)
+		}
+		key.s = string(buf)
+		key.isStr = true
+		payload -= n
+	}
+	if err := a.dec.discard(payload); err != nil {
+		return 0, errors.Wrapf(err, `msgpack: failed to skip payload for %s`, h.code)
+	}
+	a.offset += h.size
+
+	// Containers are only attributed their header bytes
+	if family != "array" && family != "map" {
+		ts.Bytes += h.size
+	}
+	a.report.Types[family] = ts
+
+	switch family {
+	case "array":
+		for i := int64(0); i < h.elements; i++ {
+			a.path = append(a.path, pathSegment{index: i})
+			_, err := a.walk(depth+1, nil)
+			a.path = a.path[:len(a.path)-1]
+			if err != nil {
+				return 0, errors.Wrapf(err, `msgpack: failed to analyze element %d`, i)
+			}
+		}
+	case "map":
+		for i := int64(0); i < h.elements; i += 2 {
+			var k mapKey
+			keySize, err := a.walk(depth+1, &k)
+			if err != nil {
+				return 0, errors.Wrap(err, `msgpack: failed to analyze map key`)
+			}
+
+			a.path = append(a.path, pathSegment{key: k.s, isKey: true})
+			valueSize, err := a.walk(depth+1, nil)
+			a.path = a.path[:len(a.path)-1]
+			if err != nil {
+				return 0, errors.Wrapf(err, `msgpack: failed to analyze value for %s`, k.s)
+			}
+
+			if !k.isStr {
+				continue
+			}
+			ks, ok := a.keys[k.s]
+			if !ok {
+				ks = &KeyStats{Key: k.s}
+				a.keys[k.s] = ks
+			}
+			ks.Count++
+			ks.Bytes += keySize + valueSize
+		}
+	default:
+		if key == nil {
+			a.recordLargest(family, start, a.offset-start)
+		}
+	}
+	return a.offset - start, nil
+}
+
+func (a *analyzer) recordLargest(family string, offset, size int64) {
+	largest := a.report.Largest
+	if len(largest) == AnalyzeTopN && largest[len(largest)-1].Bytes >= size {
+		return
+	}
+
+	i := sort.Search(len(largest), func(i int) bool { return largest[i].Bytes < size })
+	v := ValueStats{Path: a.pathString(), Type: family, Offset: offset, Bytes: size}
+	largest = append(largest, ValueStats{})
+	copy(largest[i+1:], largest[i:])
+	largest[i] = v
+	if len(largest) > AnalyzeTopN {
+		largest = largest[:AnalyzeTopN]
+	}
+	a.report.Largest = largest
+}
+
+func (a *analyzer) pathString() string {
+	var b strings.Builder
+	b.WriteByte('$')
+	for _, seg := range a.path {
+		if seg.isKey {
+			b.WriteByte('.')
+			b.WriteString(seg.key)
+		} else {
+			b.WriteByte('[')
+			b.WriteString(strconv.FormatInt(seg.index, 10))
+			b.WriteByte(']')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type analyzedEvent struct {
+	Name   string
+	Blob   []byte
+	Values []int64
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Run("empty stream", func(t *testing.T) {
+		report, err := msgpack.Analyze(bytes.NewReader(nil))
+		if !assert.NoError(t, err, "Analyze should succeed") {
+			return
+		}
+		if !assert.Equal(t, int64(0), report.Values, "there should be no values") {
+			return
+		}
+	})
+	t.Run("stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		for i := 0; i < 3; i++ {
+			ev := analyzedEvent{
+				Name:   "event",
+				Values: []int64{int64(i), 1000},
+			}
+			if i == 1 {
+				ev.Blob = bytes.Repeat([]byte{'x'}, 300)
+			}
+			if !assert.NoError(t, enc.Encode(ev), "Encode should succeed") {
+				return
+			}
+		}
+		if !assert.NoError(t, enc.Encode(strings.Repeat("a", 100)), "Encode should succeed") {
+			return
+		}
+
+		report, err := msgpack.Analyze(bytes.NewReader(buf.Bytes()))
+		if !assert.NoError(t, err, "Analyze should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, int64(4), report.Values, "Values should match") {
+			return
+		}
+		if !assert.Equal(t, int64(buf.Len()), report.TotalBytes, "TotalBytes should match") {
+			return
+		}
+		if !assert.Equal(t, 3, report.MaxDepth, "MaxDepth should match") {
+			return
+		}
+
+		var total int64
+		for _, ts := range report.Types {
+			total += ts.Bytes
+		}
+		if !assert.Equal(t, report.TotalBytes, total, "type byte counts should add up to the total") {
+			return
+		}
+		if !assert.Equal(t, int64(3), report.Types["map"].Count, "map count should match") {
+			return
+		}
+		// 9 keys, 3 names, 1 string
+		if !assert.Equal(t, int64(13), report.Types["str"].Count, "str count should match") {
+			return
+		}
+		// nil []byte values are encoded as empty binaries
+		if !assert.Equal(t, int64(3), report.Types["bin"].Count, "bin count should match") {
+			return
+		}
+
+		if !assert.Len(t, report.TopKeys, 3, "there should be 3 distinct keys") {
+			return
+		}
+		if !assert.Equal(t, "Blob", report.TopKeys[0].Key, "keys with the same count should be sorted by size") {
+			return
+		}
+		if !assert.Equal(t, int64(3), report.TopKeys[0].Count, "key count should match") {
+			return
+		}
+
+		if !assert.True(t, len(report.Largest) > 2, "largest values should be reported") {
+			return
+		}
+		if !assert.Equal(t, "$[1].Blob", report.Largest[0].Path, "largest value should be the blob") {
+			return
+		}
+		if !assert.Equal(t, "bin", report.Largest[0].Type, "largest value should be a bin") {
+			return
+		}
+		if !assert.Equal(t, int64(303), report.Largest[0].Bytes, "size should include the Bin16 header") {
+			return
+		}
+		if !assert.Equal(t, "$[3]", report.Largest[1].Path, "the top-level string should be second") {
+			return
+		}
+		blobOffset := int64(bytes.Index(buf.Bytes(), bytes.Repeat([]byte{'x'}, 300))) - 3
+		if !assert.Equal(t, blobOffset, report.Largest[0].Offset, "offset should match") {
+			return
+		}
+	})
+	t.Run("truncated stream", func(t *testing.T) {
+		b, err := msgpack.Marshal([]string{"foo", "bar"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		_, err = msgpack.Analyze(bytes.NewReader(b[:len(b)-1]))
+		if !assert.Error(t, err, "Analyze should fail") {
+			return
+		}
+	})
+}
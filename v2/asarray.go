@@ -0,0 +1,67 @@
+package msgpack
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// encodeStructAsArray encodes rv, a struct marked with asarray, as an
+// array of its fields in the order in which they are declared.
+// omitempty is ignored, as skipping a field would shift the ones that
+// follow it
+func (e *Encoder) encodeStructAsArray(rv reflect.Value, plan *structPlan, fielder MsgpackFielder) error {
+	if fielder != nil && len(fielder.MsgpackFields()) > 0 {
+		return errors.Errorf(`msgpack: MsgpackFields cannot be used with %s, which is encoded as an array`, rv.Type())
+	}
+
+	if err := e.EncodeArrayHeader(len(plan.fields)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write array header`)
+	}
+
+	for _, sf := range plan.fields {
+		field := rv.Field(sf.index)
+		if (sf.emptyAsNil || e.options.EmptyAsNil) && field.IsNil() && isEmptyAsNilType(field.Type()) {
+			// Write "" or the zero time instead of nil
+			field = reflect.Zero(field.Type().Elem())
+		}
+
+		if sf.pairs {
+			if err := e.encodeAsPairs(field); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to encode struct field %s`, sf.name)
+			}
+			continue
+		}
+		if err := e.encodeStructField(field); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode struct field %s`, sf.name)
+		}
+	}
+	return nil
+}
+
+// decodeStructAsArray decodes an array into rv, an addressable struct
+// marked with asarray, assigning the elements to its fields in the
+// order in which they are declared. Extra elements, written by a newer
+// version of the struct, are skipped, and missing ones leave the
+// fields that they would fill untouched
+func (d *Decoder) decodeStructAsArray(rv reflect.Value, plan *structPlan) error {
+	var size int
+	if err := d.DecodeArrayLength(&size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode array length`)
+	}
+
+	for i := 0; i < size; i++ {
+		if i >= len(plan.fields) {
+			if err := d.skip(); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to skip extra element %d for %s`, i, rv.Type())
+			}
+			continue
+		}
+
+		sf := plan.fields[i]
+		if err := d.decodeStructField(plan, rv.Field(sf.index), sf.index, sf.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
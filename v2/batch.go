@@ -0,0 +1,57 @@
+package msgpack
+
+import (
+	"github.com/pkg/errors"
+)
+
+// WrapAsArray returns a message holding an array whose elements are
+// msgs, each of which must be a single encoded msgpack value. The
+// messages are copied as is, so batching N pre-encoded events costs
+// O(total bytes) instead of decoding and re-encoding them. The messages
+// are not checked: use Validate first if they come from an untrusted
+// source
+func WrapAsArray(msgs ...[]byte) []byte {
+	size := 5
+	for _, msg := range msgs {
+		size += len(msg)
+	}
+
+	buf := AppendArrayHeader(make([]byte, 0, size), len(msgs))
+	for _, msg := range msgs {
+		buf = append(buf, msg...)
+	}
+	return buf
+}
+
+// UnwrapArray is the reverse of WrapAsArray: data must hold a single
+// array, and the raw encoded elements of that array are returned,
+// without decoding them. The returned slices point into data
+func UnwrapArray(data []byte) ([][]byte, error) {
+	size, elements, err := scanHeader(data)
+	if err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to read array header`)
+	}
+	if !IsArrayFamily(Code(data[0])) {
+		return nil, errors.Errorf(`msgpack: expected an array, got %s`, Code(data[0]))
+	}
+
+	off := size
+	// Every element takes at least one byte
+	if elements > uint64(len(data)-off) {
+		return nil, errors.Errorf(`msgpack: array of %d elements does not fit in %d bytes`, elements, len(data))
+	}
+
+	msgs := make([][]byte, elements)
+	for i := range msgs {
+		n, err := scanValue(data[off:])
+		if err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to read element %d`, i)
+		}
+		msgs[i] = data[off : off+n : off+n]
+		off += n
+	}
+	if off != len(data) {
+		return nil, &TrailingBytesError{Count: len(data) - off}
+	}
+	return msgs, nil
+}
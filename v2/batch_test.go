@@ -0,0 +1,89 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapAsArray(t *testing.T) {
+	values := []interface{}{
+		nil, true, int8(-5), uint16(300), int64(-1 << 40), float32(1.5), 2.5,
+		"foo", string(bytes.Repeat([]byte{'x'}, 300)), []byte{1, 2, 3},
+		[]interface{}{"a", []interface{}{int8(1), nil}},
+		map[string]interface{}{"foo": map[string]interface{}{"bar": "baz"}},
+		time.Unix(1500000000, 5).UTC(),
+		blobExt{Data: []byte{1, 2, 3}},
+		blobExt{Data: bytes.Repeat([]byte{1}, 16)},
+	}
+	// Enough messages for an Array16 header
+	for i := 0; i < 20; i++ {
+		values = append(values, int8(i))
+	}
+
+	msgs := make([][]byte, len(values))
+	for i, v := range values {
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		msgs[i] = b
+	}
+
+	wrapped := msgpack.WrapAsArray(msgs...)
+
+	var decoded []interface{}
+	if !assert.NoError(t, msgpack.Unmarshal(wrapped, &decoded), "Unmarshal should succeed") {
+		return
+	}
+	if !assert.Len(t, decoded, len(values), "array should hold all messages") {
+		return
+	}
+
+	unwrapped, err := msgpack.UnwrapArray(wrapped)
+	if !assert.NoError(t, err, "UnwrapArray should succeed") {
+		return
+	}
+	if !assert.Equal(t, msgs, unwrapped, "messages should round trip") {
+		return
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		wrapped := msgpack.WrapAsArray()
+		if !assert.Equal(t, []byte{msgpack.FixArray0.Byte()}, wrapped, "output should match") {
+			return
+		}
+		unwrapped, err := msgpack.UnwrapArray(wrapped)
+		if !assert.NoError(t, err, "UnwrapArray should succeed") {
+			return
+		}
+		if !assert.Len(t, unwrapped, 0, "there should be no messages") {
+			return
+		}
+	})
+	t.Run("invalid input", func(t *testing.T) {
+		inputs := map[string][]byte{
+			"empty":             {},
+			"not an array":      {msgpack.FixMap0.Byte()},
+			"truncated element": {msgpack.FixArray1.Byte(), msgpack.Str8.Byte(), 3, 'a'},
+			"missing elements":  {msgpack.Array32.Byte(), 0xff, 0xff, 0xff, 0xff, 0x01},
+			"nested truncation": {msgpack.FixArray1.Byte(), msgpack.FixMap1.Byte(), 0x01},
+			"reserved code":     {msgpack.FixArray1.Byte(), 0xc1},
+			"trailing bytes":    {msgpack.FixArray1.Byte(), 0x01, 0x02},
+		}
+		for name, data := range inputs {
+			if _, err := msgpack.UnwrapArray(data); !assert.Error(t, err, "UnwrapArray should fail for %s", name) {
+				return
+			}
+		}
+
+		_, err := msgpack.UnwrapArray([]byte{msgpack.FixArray1.Byte(), 0x01, 0x02})
+		if _, ok := errors.Cause(err).(*msgpack.TrailingBytesError); !assert.True(t, ok, "error should be a TrailingBytesError (got %v)", err) {
+			return
+		}
+	})
+}
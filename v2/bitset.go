@@ -0,0 +1,64 @@
+package msgpack
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Bitset is a []bool that is encoded compactly, 8 values per byte, as
+// the payload of an extension. Feature flags and masks encoded as
+// plain []bool take a byte per value.
+//
+// Bitset is opt-in: it must be registered via RegisterExt under an
+// extension type of your choosing, and both ends must agree on it:
+//
+//	msgpack.RegisterExt(42, msgpack.Bitset(nil))
+//
+// The payload is a byte holding the number of unused bits in the last
+// byte, followed by the values, least significant bit first
+type Bitset []bool
+
+// EncodeMsgpack writes the payload of the extension
+func (b Bitset) EncodeMsgpack(e *Encoder) error {
+	buf := make([]byte, 1+(len(b)+7)/8)
+	buf[0] = byte((8 - len(b)%8) % 8)
+	for i, set := range b {
+		if set {
+			buf[1+i/8] |= 1 << uint(i%8)
+		}
+	}
+
+	if _, err := e.Writer().Write(buf); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write bitset`)
+	}
+	return nil
+}
+
+// DecodeMsgpack reads the payload of the extension
+func (b *Bitset) DecodeMsgpack(d *Decoder) error {
+	if d.limit == nil {
+		return errors.New(`msgpack: Bitset can only be decoded as a registered extension`)
+	}
+
+	buf := make([]byte, int64(d.raw.Buffered())+d.limit.N)
+	if _, err := io.ReadFull(d.raw, buf); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read bitset`)
+	}
+	if len(buf) == 0 {
+		return errors.New(`msgpack: empty bitset payload`)
+	}
+
+	unused := int(buf[0])
+	packed := buf[1:]
+	if unused > 7 || (len(packed) == 0 && unused != 0) {
+		return errors.Errorf(`msgpack: invalid number of unused bits %d in bitset`, unused)
+	}
+
+	v := make(Bitset, len(packed)*8-unused)
+	for i := range v {
+		v[i] = packed[i/8]&(1<<uint(i%8)) != 0
+	}
+	*b = v
+	return nil
+}
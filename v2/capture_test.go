@@ -0,0 +1,138 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	var capture, wire bytes.Buffer
+	rec := msgpack.NewRecorder(&capture)
+
+	enc := rec.Encoder(&wire)
+	for _, s := range []string{"foo", "bar"} {
+		if !assert.NoError(t, enc.Encode(s), "Encode should succeed") {
+			return
+		}
+	}
+
+	dec := rec.Decoder(&wire)
+	for _, expected := range []string{"foo", "bar"} {
+		var s string
+		if !assert.NoError(t, dec.Decode(&s), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, expected, s, "values should match") {
+			return
+		}
+	}
+
+	r := msgpack.NewReplayer(bytes.NewReader(capture.Bytes()), msgpack.WithReplaySpeed(0))
+	var frames []msgpack.Frame
+	for {
+		var f msgpack.Frame
+		err := r.Next(context.Background(), &f)
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err, "Next should succeed") {
+			return
+		}
+		frames = append(frames, f)
+	}
+
+	if !assert.Len(t, frames, 4, "all frames should be captured") {
+		return
+	}
+	for i, f := range frames {
+		expected := msgpack.FrameSent
+		if i >= 2 {
+			expected = msgpack.FrameReceived
+		}
+		if !assert.Equal(t, expected, f.Direction, "direction should match (frame %d)", i) {
+			return
+		}
+
+		var s string
+		if !assert.NoError(t, msgpack.Unmarshal(f.Data, &s), "frame should hold a message") {
+			return
+		}
+		if !assert.Equal(t, []string{"foo", "bar"}[i%2], s, "frame should match the message") {
+			return
+		}
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	var capture bytes.Buffer
+	rec := msgpack.NewRecorder(&capture)
+
+	base := time.Now()
+	for i, s := range []string{"foo", "bar", "baz"} {
+		data, err := msgpack.Marshal(s)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		f := msgpack.Frame{
+			Time:      base.Add(time.Duration(i) * 200 * time.Millisecond),
+			Direction: msgpack.FrameReceived,
+			Data:      data,
+		}
+		if i == 1 {
+			f.Direction = msgpack.FrameSent
+		}
+		if !assert.NoError(t, rec.Record(f), "Record should succeed") {
+			return
+		}
+	}
+
+	t.Run("accelerated", func(t *testing.T) {
+		var out bytes.Buffer
+		r := msgpack.NewReplayer(bytes.NewReader(capture.Bytes()), msgpack.WithReplaySpeed(4))
+
+		start := time.Now()
+		n, err := r.ReplayTo(context.Background(), &out, msgpack.FrameReceived)
+		elapsed := time.Since(start)
+		if !assert.NoError(t, err, "ReplayTo should succeed") {
+			return
+		}
+		if !assert.Equal(t, 2, n, "only received frames should be replayed") {
+			return
+		}
+		// 400ms of traffic, 4 times faster
+		if !assert.True(t, elapsed >= 100*time.Millisecond, "original timing should be kept (%s)", elapsed) {
+			return
+		}
+		if !assert.True(t, elapsed < 400*time.Millisecond, "replay should be accelerated (%s)", elapsed) {
+			return
+		}
+
+		dec := msgpack.NewDecoder(&out)
+		for _, expected := range []string{"foo", "baz"} {
+			var s string
+			if !assert.NoError(t, dec.Decode(&s), "Decode should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected, s, "values should match") {
+				return
+			}
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		r := msgpack.NewReplayer(bytes.NewReader(capture.Bytes()))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := r.ReplayTo(ctx, ioutil.Discard, msgpack.FrameReceived)
+		if !assert.Equal(t, context.DeadlineExceeded, err, "ReplayTo should be cancelled") {
+			return
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package msgpack
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Snapshotter is an interface for containers that guard their contents
+// (e.g. with a mutex) and therefore cannot be traversed directly by
+// the encoder. MsgpackSnapshot should return a value that represents
+// the current contents of the container, which is then encoded in
+// place of the container itself.
+type Snapshotter interface {
+	MsgpackSnapshot() interface{}
+}
+
+// EncodeSyncMap encodes the contents of a sync.Map as a msgpack map.
+// All keys in the sync.Map must be strings.
+//
+// Since the number of entries must be known before the entries can be
+// written, a snapshot of the entries is taken first. Whatever entries
+// are stored or deleted concurrently while the snapshot is being taken
+// may or may not be included, as per the semantics of sync.Map.Range
+func (e *Encoder) EncodeSyncMap(m *sync.Map) error {
+	if m == nil {
+		return e.EncodeNil()
+	}
+
+	var keys []string
+	var values []interface{}
+	var err error
+	m.Range(func(k, v interface{}) bool {
+		s, ok := k.(string)
+		if !ok {
+			err = errors.Errorf(`msgpack: keys to sync.Map must be strings (not %T)`, k)
+			return false
+		}
+		keys = append(keys, s)
+		values = append(values, v)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := WriteMapHeader(e.dst, len(keys)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
+
+	for i, k := range keys {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode map key`)
+		}
+
+		if err := e.Encode(values[i]); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode map value for %s`, k)
+		}
+	}
+	return nil
+}
+
+// EncodeAtomicValue encodes the value currently stored in an
+// atomic.Value. If no value has been stored, a nil is encoded
+func (e *Encoder) EncodeAtomicValue(v *atomic.Value) error {
+	if v == nil {
+		return e.EncodeNil()
+	}
+	return e.Encode(v.Load())
+}
+
+// DecodeSyncMap decodes a msgpack map, and stores each of its entries
+// in the sync.Map. Existing entries with different keys are left
+// untouched
+func (d *Decoder) DecodeSyncMap(m *sync.Map) error {
+	var v map[string]interface{}
+	if err := d.DecodeMap(&v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode map for sync.Map`)
+	}
+
+	for k, x := range v {
+		m.Store(k, x)
+	}
+	return nil
+}
+
+// DecodeAtomicValue decodes a value, and stores it in the atomic.Value.
+// Because atomic.Value cannot hold nil, a nil value leaves the
+// atomic.Value untouched. Note that atomic.Value requires that all
+// stored values be of the same concrete type.
+func (d *Decoder) DecodeAtomicValue(v *atomic.Value) (err error) {
+	var x interface{}
+	if err := d.Decode(&x); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode value for atomic.Value`)
+	}
+
+	if x == nil {
+		return nil
+	}
+
+	// atomic.Value panics if the type of the value differs from
+	// whatever it was holding before
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf(`msgpack: failed to store %T in atomic.Value: %v`, x, r)
+		}
+	}()
+	v.Store(x)
+	return nil
+}
@@ -0,0 +1,2131 @@
+package msgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bufferpool "github.com/lestrrat-go/bufferpool"
+	"github.com/pkg/errors"
+)
+
+// NewDecoder creates a new Decoder that reads serialized data from
+// the specified io.Reader, configured with the given options
+func NewDecoder(r io.Reader, options ...Option) *Decoder {
+	d := &Decoder{
+		options: newOptions(options),
+	}
+
+	// Always count the bytes consumed, so that errors can report where
+	// in the stream they occurred
+	d.count.src = r
+	d.counter = &d.count
+
+	if d.options.ReadBufferSize > 0 {
+		d.raw = bufio.NewReaderSize(d.counter, d.options.ReadBufferSize)
+	} else {
+		d.raw = bufio.NewReader(d.counter)
+	}
+	d.src = newReader(d.raw)
+	return d
+}
+
+// Options returns a snapshot of the configuration of this Decoder
+func (d *Decoder) Options() Options {
+	return d.options.clone()
+}
+
+// Sub returns a Decoder that can read at most the next n bytes from d.
+// Reading past those n bytes results in an io.EOF error from the
+// sub-decoder, so that a buggy decoder cannot consume data that
+// belongs to the rest of the stream.
+//
+// Once done with the sub-decoder, call Finish to discard the bytes
+// that have not been consumed, so that d is positioned right after
+// the n bytes.
+//
+// This is used to isolate DecodeMsgpack implementations for registered
+// extensions, which receive a sub-decoder limited to the extension
+// payload.
+func (d *Decoder) Sub(n int) *Decoder {
+	if n < 0 {
+		n = 0
+	}
+	lr := &io.LimitedReader{R: d.raw, N: int64(n)}
+
+	// Avoid allocating a full sized buffer for small payloads.
+	// bufio will not read ahead past the limit anyway
+	size := n
+	if size > 4096 {
+		size = 4096
+	}
+	raw := bufio.NewReaderSize(lr, size)
+	return &Decoder{
+		raw:       raw,
+		src:       newReader(raw),
+		options:   d.options,
+		limit:     lr,
+		profiling: d.profiling,
+		depth:     d.depth,
+	}
+}
+
+// Finish discards whatever is left of the bytes that a sub-decoder
+// created via Sub is allowed to read. It returns an error if the
+// parent stream ended before all of the bytes could be read.
+// Finish is a no-op for decoders that were not created via Sub
+func (d *Decoder) Finish() error {
+	if d.limit == nil {
+		return nil
+	}
+
+	// Bytes that have been buffered, but not consumed
+	if _, err := d.raw.Discard(d.raw.Buffered()); err != nil {
+		return errors.Wrap(err, `msgpack: failed to discard buffered bytes`)
+	}
+
+	n, err := io.Copy(ioutil.Discard, d.limit)
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to discard remaining bytes`)
+	}
+	if d.limit.N > 0 {
+		return errors.Wrapf(io.ErrUnexpectedEOF, `msgpack: stream ended with %d bytes remaining (discarded %d)`, d.limit.N, n)
+	}
+	return nil
+}
+
+func (d *Decoder) Reader() Reader {
+	return d.src
+}
+
+// Reset makes the Decoder read from r, keeping its configuration and
+// its read buffer. Data that was buffered from the previous source is
+// discarded. This allows a Decoder to be reused instead of allocating a
+// new one, and a new read buffer, for every source, see also GetDecoder
+func (d *Decoder) Reset(r io.Reader) {
+	d.inMessage = false
+	d.path = d.path[:0]
+	d.depth = 0
+	if d.counter != nil {
+		*d.counter = countingReader{src: r}
+		r = d.counter
+	}
+	d.raw.Reset(r)
+}
+
+func (d *Decoder) ReadCode() (Code, error) {
+	b, err := d.raw.ReadByte()
+	if err != nil {
+		return Code(0), errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	return Code(b), nil
+}
+
+// reservedCode is the byte that the msgpack specification marks as
+// "never used"
+const reservedCode = 0xc1
+
+// invalidCode returns err, unless code is the reserved code, in which
+// case a *ReservedCodeError is returned instead. code must have just
+// been read
+func (d *Decoder) invalidCode(code Code, err error) error {
+	if code != reservedCode {
+		return err
+	}
+
+	e := &ReservedCodeError{Offset: -1}
+	if d.counter != nil {
+		e.Offset = d.consumed() - 1
+	}
+	if d.options.ResyncOnReservedCode {
+		for {
+			b, err := d.raw.Peek(1)
+			if err != nil || b[0] != reservedCode {
+				break
+			}
+			d.raw.Discard(1)
+			e.Skipped++
+		}
+	}
+	return e
+}
+
+func (d *Decoder) PeekCode() (Code, error) {
+	code, err := d.ReadCode()
+	if err != nil {
+		return code, errors.Wrap(err, `msgpack: failed to peek code`)
+	}
+
+	if err := d.raw.UnreadByte(); err != nil {
+		return Code(0), errors.Wrap(err, `msgpack: failed to unread code`)
+	}
+	return code, nil
+}
+
+// maxInt is the largest value that an int can hold on this platform
+const maxInt = int64(^uint(0) >> 1)
+
+// checkLength makes sure that a length read from the wire can be
+// represented as an int on the current platform. On 32-bit platforms
+// the lengths for the 32-bit variants (Str32, Bin32, Array32, Map32,
+// Ext32) may not fit in an int
+func checkLength(code Code, l int64) (int, error) {
+	if l < 0 || l > maxInt {
+		return 0, &LengthOverflowError{Code: code, Length: l}
+	}
+	return int(l), nil
+}
+
+// decodeFloatAsInteger reads the payload of a Float or a Double, whose
+// code has already been consumed, to be stored in an integer of the
+// given kind
+func (d *Decoder) decodeFloatAsInteger(code Code, kind reflect.Kind) (float64, error) {
+	var f float64
+	if code == Float {
+		x, err := d.src.ReadUint32()
+		if err != nil {
+			return 0, errors.Wrapf(err, `msgpack: failed to read payload for %s`, kind)
+		}
+		f = float64(math.Float32frombits(x))
+	} else {
+		x, err := d.src.ReadUint64()
+		if err != nil {
+			return 0, errors.Wrapf(err, `msgpack: failed to read payload for %s`, kind)
+		}
+		f = math.Float64frombits(x)
+	}
+	if d.options.StrictTypes {
+		return 0, &StrictTypeError{Code: code, Kind: kind}
+	}
+	return d.floatToInteger(f, kind)
+}
+
+// floatToInteger returns f, truncated if WithTruncateFloats is in
+// effect, if it can be converted to an integer of the given kind
+// without losing precision
+func (d *Decoder) floatToInteger(f float64, kind reflect.Kind) (float64, error) {
+	t := math.Trunc(f)
+	if t != f && !d.options.TruncateFloats {
+		return 0, &LossyConversionError{Value: f, Kind: kind}
+	}
+
+	var bits int
+	var signed bool
+	switch kind {
+	case reflect.Int8, reflect.Uint8:
+		bits = 8
+	case reflect.Int16, reflect.Uint16:
+		bits = 16
+	case reflect.Int32, reflect.Uint32:
+		bits = 32
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		bits = strconv.IntSize
+	default:
+		bits = 64
+	}
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		signed = true
+	}
+
+	// The bounds are powers of two, so they are exact. NaNs fail both
+	// comparisons
+	lower, upper := 0.0, math.Ldexp(1, bits)
+	if signed {
+		upper = math.Ldexp(1, bits-1)
+		lower = -upper
+	}
+	if !(t >= lower && t < upper) {
+		return 0, &LossyConversionError{Value: f, Kind: kind}
+	}
+	return t, nil
+}
+
+// Skip consumes and discards the next complete value in the stream,
+// including the elements of arrays and maps, without constructing any
+// Go values. Use it to skip data that is not needed, such as unknown
+// fields in a DecodeMsgpack implementation, instead of decoding it into
+// an interface{}
+func (d *Decoder) Skip() error {
+	if err := d.skip(); err != nil {
+		return errors.Wrap(err, `msgpack: failed to skip value`)
+	}
+	return nil
+}
+
+// skip consumes the next complete value in the stream without
+// constructing any Go values
+func (d *Decoder) skip() error {
+	return d.copyValue(nil)
+}
+
+// copyValue consumes the next complete value in the stream, and writes
+// its raw msgpack representation to w. If w is nil, the value is
+// discarded. Like Decode, it keeps track of how deep the value is
+// nested if MaxDepth is set, so that values that are skipped or copied
+// cannot be nested any deeper than those that are decoded
+func (d *Decoder) copyValue(w io.Writer) error {
+	var h valueHeader
+	if err := d.readValueHeader(&h); err != nil {
+		return err
+	}
+	if d.options.MaxDepth <= 0 {
+		return d.copyPayload(&h, w)
+	}
+
+	descended, err := d.descend(h.code)
+	if err != nil {
+		return err
+	}
+	err = d.copyPayload(&h, w)
+	if descended {
+		d.ascend()
+	}
+	return err
+}
+
+// copyPayload copies what follows the header h in the stream to w,
+// including the elements of arrays and maps. The elements are walked
+// iteratively rather than recursively, so that however deeply they are
+// nested, they cannot exhaust the stack
+func (d *Decoder) copyPayload(h *valueHeader, w io.Writer) error {
+	if err := d.copyRaw(h, w); err != nil {
+		return err
+	}
+	if h.elements == 0 {
+		return nil
+	}
+
+	var eh valueHeader
+	if d.options.MaxDepth <= 0 {
+		// Without a limit, it is enough to count the values left
+		for pending := h.elements; pending > 0; pending-- {
+			if err := d.readValueHeader(&eh); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to skip element of %s`, h.code)
+			}
+			if err := d.copyRaw(&eh, w); err != nil {
+				return err
+			}
+			pending += eh.elements
+		}
+		return nil
+	}
+
+	// levels holds the number of values left in each of the arrays and
+	// maps being copied, innermost last, so that their depth is known.
+	// h itself has already been counted by the caller
+	var stack [16]int64
+	levels := append(stack[:0], h.elements)
+	depth := d.depth
+	for len(levels) > 0 {
+		if err := d.readValueHeader(&eh); err != nil {
+			d.depth = depth
+			return errors.Wrapf(err, `msgpack: failed to skip element of %s`, h.code)
+		}
+		descended, err := d.descend(eh.code)
+		if err != nil {
+			d.depth = depth
+			return err
+		}
+		if err := d.copyRaw(&eh, w); err != nil {
+			d.depth = depth
+			return err
+		}
+
+		levels[len(levels)-1]--
+		if eh.elements > 0 {
+			levels = append(levels, eh.elements)
+		} else if descended {
+			d.ascend()
+		}
+		for len(levels) > 0 && levels[len(levels)-1] == 0 {
+			levels = levels[:len(levels)-1]
+			if len(levels) > 0 {
+				d.ascend()
+			}
+		}
+	}
+	return nil
+}
+
+// copyRaw copies the header h and the bytes that follow it in the
+// stream to w, but not the elements of arrays and maps. If w is nil,
+// the bytes are discarded
+func (d *Decoder) copyRaw(h *valueHeader, w io.Writer) error {
+	code := h.code
+	size := h.size
+	if w != nil {
+		// Copy the header, so that h does not escape to the heap when
+		// values are only skipped
+		raw := h.raw
+		if _, err := w.Write(raw[:h.rawlen]); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to copy header for %s`, code)
+		}
+		if _, err := io.CopyN(w, d.raw, size); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to copy payload for %s`, code)
+		}
+		return nil
+	}
+	if err := d.discard(size); err != nil {
+		return errors.Wrapf(err, `msgpack: failed to skip payload for %s`, code)
+	}
+	return nil
+}
+
+// discard consumes size bytes from the stream
+func (d *Decoder) discard(size int64) error {
+	for ; size > 0; size -= math.MaxInt32 {
+		n := size
+		if n > math.MaxInt32 {
+			n = math.MaxInt32
+		}
+		if _, err := d.raw.Discard(int(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueHeader describes the header of a single msgpack value
+type valueHeader struct {
+	code Code
+	// raw holds the code and the length bytes, if any
+	raw    [5]byte
+	rawlen int
+	// size is the number of bytes that follow the header, not
+	// including those of the elements of arrays and maps. For the ext
+	// family, this includes the type byte
+	size int64
+	// elements is the number of values that follow the header. For maps,
+	// this is twice the number of entries
+	elements int64
+}
+
+// readValueHeader consumes the header of the next value in the stream
+func (d *Decoder) readValueHeader(h *valueHeader) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	h.code = code
+	h.raw[0] = code.Byte()
+	h.rawlen = 1
+	h.size = 0
+	h.elements = 0
+
+	switch {
+	case IsFixNumFamily(code), code == Nil, code == True, code == False:
+	case code >= FixStr0 && code <= FixStr31:
+		h.size = int64(code.Byte() - FixStr0.Byte())
+	case code >= FixArray0 && code <= FixArray15:
+		h.elements = int64(code.Byte() - FixArray0.Byte())
+	case code >= FixMap0 && code <= FixMap15:
+		h.elements = 2 * int64(code.Byte()-FixMap0.Byte())
+	case code == Uint8, code == Int8:
+		h.size = 1
+	case code == Uint16, code == Int16:
+		h.size = 2
+	case code == Uint32, code == Int32, code == Float:
+		h.size = 4
+	case code == Uint64, code == Int64, code == Double:
+		h.size = 8
+	case code == FixExt1:
+		h.size = 1 + 1
+	case code == FixExt2:
+		h.size = 1 + 2
+	case code == FixExt4:
+		h.size = 1 + 4
+	case code == FixExt8:
+		h.size = 1 + 8
+	case code == FixExt16:
+		h.size = 1 + 16
+	case code == Str8, code == Bin8, code == Ext8:
+		l, err := d.src.ReadUint8()
+		if err != nil {
+			return errors.Wrapf(err, `msgpack: failed to read length for %s`, code)
+		}
+		h.raw[1] = l
+		h.rawlen = 2
+		h.size = int64(l)
+	case code == Str16, code == Bin16, code == Ext16:
+		l, err := d.src.ReadUint16()
+		if err != nil {
+			return errors.Wrapf(err, `msgpack: failed to read length for %s`, code)
+		}
+		binary.BigEndian.PutUint16(h.raw[1:], l)
+		h.rawlen = 3
+		h.size = int64(l)
+	case code == Str32, code == Bin32, code == Ext32:
+		l, err := d.src.ReadUint32()
+		if err != nil {
+			return errors.Wrapf(err, `msgpack: failed to read length for %s`, code)
+		}
+		binary.BigEndian.PutUint32(h.raw[1:], l)
+		h.rawlen = 5
+		h.size = int64(l)
+	case code == Array16, code == Map16:
+		l, err := d.src.ReadUint16()
+		if err != nil {
+			return errors.Wrapf(err, `msgpack: failed to read length for %s`, code)
+		}
+		binary.BigEndian.PutUint16(h.raw[1:], l)
+		h.rawlen = 3
+		h.elements = int64(l)
+	case code == Array32, code == Map32:
+		l, err := d.src.ReadUint32()
+		if err != nil {
+			return errors.Wrapf(err, `msgpack: failed to read length for %s`, code)
+		}
+		binary.BigEndian.PutUint32(h.raw[1:], l)
+		h.rawlen = 5
+		h.elements = int64(l)
+	default:
+		return d.invalidCode(code, errors.Errorf(`msgpack: invalid code %s`, code))
+	}
+
+	// the ext family has one extra byte for the type
+	if code == Ext8 || code == Ext16 || code == Ext32 {
+		h.size++
+	}
+
+	if code == Map16 || code == Map32 {
+		h.elements *= 2
+	}
+	return d.checkMessageBytes(code, h.size+h.elements)
+}
+
+// IsNextNil reports whether the next value is Nil, and if so, consumes
+// it. Otherwise nothing is consumed, so that the value can be decoded
+// next. This is the building block for optional values in hand-written
+// DecodeMsgpack implementations:
+//
+//	if isNil, err := d.IsNextNil(); err != nil {
+//		return err
+//	} else if !isNil {
+//		v.Name = new(string)
+//		if err := d.DecodeString(v.Name); err != nil {
+//			return err
+//		}
+//	}
+func (d *Decoder) IsNextNil() (bool, error) {
+	code, err := d.PeekCode()
+	if err != nil {
+		return false, err
+	}
+	if code != Nil {
+		return false, nil
+	}
+	d.raw.ReadByte()
+	return true, nil
+}
+
+// More reports whether there is another value to decode in the
+// stream, so that a stream of back-to-back values can be read like
+// this:
+//
+//	for dec.More() {
+//		var v Message
+//		if err := dec.Decode(&v); err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// More blocks until at least one byte is available. It returns false
+// at the end of the stream, and also when reading from the stream
+// fails, in which case the next call to Decode reports the error.
+// Decode itself returns io.EOF if the stream ends before the next value
+// starts, and io.ErrUnexpectedEOF (wrapped) if it ends in the middle of
+// a value
+func (d *Decoder) More() bool {
+	_, err := d.raw.Peek(1)
+	return err == nil
+}
+
+func (d *Decoder) isNil() bool {
+	code, err := d.PeekCode()
+	if err != nil {
+		return false
+	}
+	return code == Nil
+}
+
+func (d *Decoder) DecodeNil(v *interface{}) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+	if code != Nil {
+		return d.invalidCode(code, errors.Errorf(`msgpack: expected Nil, got %s`, code))
+	}
+	if v != nil {
+		*v = nil
+	}
+	return nil
+}
+
+func (d *Decoder) DecodeBool(b *bool) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	switch code {
+	case True:
+		*b = true
+		return nil
+	case False:
+		*b = false
+		return nil
+	default:
+		return d.invalidCode(code, errors.Errorf(`msgpack: expected True/False, got %s`, code))
+	}
+}
+
+func (d *Decoder) DecodeBytes(v *[]byte) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	var l int64
+	switch {
+	case d.options.LegacyRaw && code >= FixStr0 && code <= FixStr31:
+		l = int64(code.Byte() - FixStr0.Byte())
+	case code == Bin8, d.options.LegacyRaw && code == Str8:
+		v, err := d.src.ReadUint8()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read length for string/byte slice`)
+		}
+		l = int64(v)
+	case code == Bin16, d.options.LegacyRaw && code == Str16:
+		v, err := d.src.ReadUint16()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read length for string/byte slice`)
+		}
+		l = int64(v)
+	case code == Bin32, d.options.LegacyRaw && code == Str32:
+		v, err := d.src.ReadUint32()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read length for string/byte slice`)
+		}
+		l = int64(v)
+	default:
+		return d.invalidCode(code, errors.Errorf(`msgpack: invalid code: expected Bin8/Bin16/Bin32, got %s`, code))
+	}
+
+	// Sanity check
+	if l < 0 {
+		return errors.Errorf(`msgpack: invalid byte slice length %d`, l)
+	}
+
+	if _, err := checkLength(code, l); err != nil {
+		return err
+	}
+	if err := d.checkMessageBytes(code, l); err != nil {
+		return err
+	}
+
+	b, err := d.allocBytes(int(l))
+	if err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(d.raw, b); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read byte slice`)
+	}
+
+	*v = b
+	return nil
+}
+
+// DecodeBytesInto decodes the next value, which must be a byte slice,
+// into buf, and returns the number of bytes that were stored. This
+// allows protocols that carry a lot of binary data to manage their own
+// buffers, instead of allocating a new slice for every value.
+//
+// If buf is too small, nothing is consumed, and the length of the byte
+// slice is returned along with io.ErrShortBuffer, so that the caller
+// can retry with a larger buffer, or decode it with DecodeBytes
+func (d *Decoder) DecodeBytesInto(buf []byte) (int, error) {
+	header, err := d.raw.Peek(1)
+	if err != nil {
+		return 0, errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	code := Code(header[0])
+	var lsize int
+	switch {
+	case d.options.LegacyRaw && code >= FixStr0 && code <= FixStr31:
+	case code == Bin8, d.options.LegacyRaw && code == Str8:
+		lsize = 1
+	case code == Bin16, d.options.LegacyRaw && code == Str16:
+		lsize = 2
+	case code == Bin32, d.options.LegacyRaw && code == Str32:
+		lsize = 4
+	default:
+		d.raw.Discard(1)
+		return 0, d.invalidCode(code, errors.Errorf(`msgpack: invalid code: expected Bin8/Bin16/Bin32, got %s`, code))
+	}
+
+	header, err = d.raw.Peek(1 + lsize)
+	if err != nil {
+		return 0, errors.Wrap(err, `msgpack: failed to read length for byte slice`)
+	}
+	var l int64
+	switch lsize {
+	case 0:
+		l = int64(code.Byte() - FixStr0.Byte())
+	case 1:
+		l = int64(header[1])
+	case 2:
+		l = int64(binary.BigEndian.Uint16(header[1:]))
+	case 4:
+		l = int64(binary.BigEndian.Uint32(header[1:]))
+	}
+
+	n, err := checkLength(code, l)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.checkMessageBytes(code, l); err != nil {
+		return 0, err
+	}
+	if n > len(buf) {
+		return n, errors.Wrapf(io.ErrShortBuffer, `msgpack: byte slice of %d bytes does not fit in a buffer of %d bytes`, n, len(buf))
+	}
+
+	d.raw.Discard(1 + lsize)
+	if _, err := io.ReadFull(d.raw, buf[:n]); err != nil {
+		return 0, errors.Wrap(err, `msgpack: failed to read byte slice`)
+	}
+	return n, nil
+}
+
+// allocBytes returns a byte slice of length n to read a payload into.
+// Large payloads are allocated via the Allocator option, if any
+func (d *Decoder) allocBytes(n int) ([]byte, error) {
+	if d.options.Allocator == nil || n < d.options.AllocatorThreshold {
+		return make([]byte, n), nil
+	}
+
+	b := d.options.Allocator(n)
+	if cap(b) < n {
+		return nil, errors.Errorf(`msgpack: allocator returned %d bytes, but %d were requested`, cap(b), n)
+	}
+	return b[:n], nil
+}
+
+func (d *Decoder) DecodeString(s *string) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	var l int64
+	switch {
+	case code >= FixStr0 && code <= FixStr31:
+		l = int64(code.Byte() - FixStr0.Byte())
+	case code == Str8, d.options.LegacyRaw && code == Bin8:
+		v, err := d.src.ReadUint8()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read length for string/byte slice`)
+		}
+		l = int64(v)
+	case code == Str16, d.options.LegacyRaw && code == Bin16:
+		v, err := d.src.ReadUint16()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read length for string/byte slice`)
+		}
+		l = int64(v)
+	case code == Str32, d.options.LegacyRaw && code == Bin32:
+		v, err := d.src.ReadUint32()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read length for string/byte slice`)
+		}
+		l = int64(v)
+	default:
+		return d.invalidCode(code, errors.Errorf(`msgpack: invalid code: expected FixStr/Str8/Str16/Str32, got %s`, code))
+	}
+
+	// Sanity check
+	if l < 0 {
+		return errors.Errorf(`msgpack: invalid string length %d`, l)
+	}
+
+	if _, err := checkLength(code, l); err != nil {
+		return err
+	}
+	if err := d.checkMessageBytes(code, l); err != nil {
+		return err
+	}
+
+	// Read the contents of the string.
+	// Now, here's the tricky part: conversion from byte slice to string is
+	// just going to create a copy of b as an immutable string, and so this
+	// byte slice is just thrown away. It would be nice if we could reuse
+	// this memory later...
+	buf := bufferpool.Get()
+	defer bufferpool.Release(buf)
+
+	// Make sure we can write l bytes
+	buf.Grow(int(l))
+	b := buf.Bytes()
+	if _, err := io.ReadFull(d.raw, b[:l]); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read string`)
+	}
+
+	*s = string(b[:l])
+	return nil
+}
+
+func (d *Decoder) DecodeArrayLength(l *int) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	if code >= FixArray0 && code <= FixArray15 {
+		*l = int(code.Byte() - FixArray0.Byte())
+		return nil
+	}
+
+	switch code {
+	case Array16:
+		s, err := d.src.ReadUint16()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read array size for Array16`)
+		}
+		*l = int(s)
+	case Array32:
+		s, err := d.src.ReadUint32()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read array size for Array32`)
+		}
+		v, err := checkLength(code, int64(s))
+		if err != nil {
+			return err
+		}
+		*l = v
+	default:
+		return d.invalidCode(code, errors.Errorf(`msgpack: unsupported array type %s`, code))
+	}
+
+	// Each element takes at least a byte
+	return d.checkMessageBytes(code, int64(*l))
+}
+
+// DecodeArrayHeader reads the header of the next array and returns the
+// number of elements that follow it, so that DecodeMsgpack
+// implementations can decode the elements themselves:
+//
+//	n, err := d.DecodeArrayHeader()
+//	if err != nil {
+//		return err
+//	}
+//	v.Items = make([]string, n)
+//	for i := range v.Items {
+//		if err := d.DecodeString(&v.Items[i]); err != nil {
+//			return err
+//		}
+//	}
+//
+// Nil is consumed and reported as -1, as with DecodeMapHeader
+func (d *Decoder) DecodeArrayHeader() (int, error) {
+	isNil, err := d.IsNextNil()
+	if err != nil {
+		return 0, errors.Wrap(err, `msgpack: failed to read code`)
+	}
+	if isNil {
+		return -1, nil
+	}
+
+	var l int
+	if err := d.DecodeArrayLength(&l); err != nil {
+		return 0, err
+	}
+	return l, nil
+}
+
+// DecodeArray decodes the next array into v, which must be a pointer
+// to a slice. Each element is decoded directly into the element type
+// of the slice. Nil is decoded as a nil slice, and nil elements as the
+// zero value of the element type. If the slice has enough capacity,
+// its backing array is reused instead of allocating a new one. See
+// DecodeAppend to keep its elements
+func (d *Decoder) DecodeArray(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		return errors.Errorf(`msgpack: DecodeArray expected pointer to slice, got %s`, rv.Type())
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Slice {
+		return errors.Errorf(`msgpack: DecodeArray expected slice, got %s`, rv.Type())
+	}
+
+	if d.isNil() {
+		d.raw.ReadByte()
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	var size int
+	if err := d.DecodeArrayLength(&size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode array length`)
+	}
+
+	slice := reuseSlice(rv, size)
+	for i := 0; i < size; i++ {
+		if d.isNil() {
+			d.raw.ReadByte()
+			continue
+		}
+
+		e := slice.Index(i)
+		if e.Kind() == reflect.Ptr {
+			if e.IsNil() {
+				e.Set(reflect.New(e.Type().Elem()))
+			}
+		} else {
+			e = e.Addr()
+		}
+		if err := d.Decode(e.Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode array element %d`, i)
+		}
+	}
+
+	rv.Set(slice)
+	return nil
+}
+
+// decodeFixedArray decodes the next value into rv, a Go array. The
+// number of elements on the wire must match the length of the array,
+// unless WithTruncateArrays is in effect. Byte arrays are decoded from
+// Bin, as well as from arrays of integers
+func (d *Decoder) decodeFixedArray(rv reflect.Value) error {
+	code, err := d.PeekCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to peek code`)
+	}
+
+	if code == Nil {
+		d.raw.ReadByte()
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	if (IsBinFamily(code) || d.options.LegacyRaw && IsStrFamily(code)) && rv.Type().Elem().Kind() == reflect.Uint8 {
+		var b []byte
+		if err := d.DecodeBytes(&b); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode byte array`)
+		}
+		if len(b) != rv.Len() && !d.options.TruncateArrays {
+			return errors.Errorf(`msgpack: cannot decode %d bytes into %s`, len(b), rv.Type())
+		}
+		rv.Set(reflect.Zero(rv.Type()))
+		reflect.Copy(rv, reflect.ValueOf(b))
+		return nil
+	}
+
+	var size int
+	if err := d.DecodeArrayLength(&size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode array length`)
+	}
+	if size != rv.Len() && !d.options.TruncateArrays {
+		return errors.Errorf(`msgpack: cannot decode array of %d elements into %s`, size, rv.Type())
+	}
+
+	rv.Set(reflect.Zero(rv.Type()))
+	for i := 0; i < size; i++ {
+		if i >= rv.Len() {
+			if err := d.skip(); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to skip array element %d`, i)
+			}
+			continue
+		}
+		if err := d.Decode(rv.Index(i).Addr().Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode array element %d`, i)
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) DecodeMapLength(l *int) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	if code == Nil {
+		*l = -1
+		return nil
+	}
+
+	if code >= FixMap0 && code <= FixMap15 {
+		*l = int(code.Byte() - FixMap0.Byte())
+		return nil
+	}
+
+	switch code {
+	case Map16:
+		s, err := d.src.ReadUint16()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read array size for Map16`)
+		}
+		*l = int(s)
+	case Map32:
+		s, err := d.src.ReadUint32()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read array size for Map32`)
+		}
+		v, err := checkLength(code, int64(s))
+		if err != nil {
+			return err
+		}
+		*l = v
+	default:
+		return d.invalidCode(code, errors.Errorf(`msgpack: unsupported map type %s`, code))
+	}
+
+	// Each key and each value takes at least a byte
+	return d.checkMessageBytes(code, 2*int64(*l))
+}
+
+// DecodeMapHeader reads the header of the next map and returns the
+// number of key/value pairs that follow it. Each pair must then be
+// decoded as a key followed by its value. Nil is consumed and reported
+// as -1
+func (d *Decoder) DecodeMapHeader() (int, error) {
+	var l int
+	if err := d.DecodeMapLength(&l); err != nil {
+		return 0, err
+	}
+	return l, nil
+}
+
+func (d *Decoder) DecodeMap(v *map[string]interface{}) error {
+	size, pairs, err := d.decodeMapOrPairsLength()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode map length`)
+	}
+
+	if size == -1 {
+		*v = nil
+		return nil
+	}
+
+	m := make(map[string]interface{}, d.mapCapacity(size))
+	for i := 0; i < size; i++ {
+		if pairs {
+			if err := d.decodePairHeader(); err != nil {
+				return err
+			}
+		}
+		var s string
+		if err := d.DecodeString(&s); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode map key`)
+		}
+
+		if d.options.ExpectedSizes != nil {
+			d.pushPath(s)
+		}
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode map element for key %s`, s)
+		}
+		if d.options.ExpectedSizes != nil {
+			d.popPath()
+		}
+		m[s] = v
+	}
+	*v = m
+	return nil
+}
+
+// decodeTypedMap decodes the next map into rv, a Go map whose type is
+// not map[string]interface{}. Keys and values are decoded directly into
+// the key and element types of the map. String keys may also be Bin on
+// the wire. Nil is decoded as a nil map, and nil values as the zero
+// value of the element type
+func (d *Decoder) decodeTypedMap(rv reflect.Value) error {
+	rt := rv.Type()
+
+	size, pairs, err := d.decodeMapOrPairsLength()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode map length`)
+	}
+
+	if size == -1 {
+		rv.Set(reflect.Zero(rt))
+		return nil
+	}
+
+	m := reflect.MakeMapWithSize(rt, d.mapCapacity(size))
+	for i := 0; i < size; i++ {
+		if pairs {
+			if err := d.decodePairHeader(); err != nil {
+				return err
+			}
+		}
+		key, err := d.decodeMapKey(rt.Key())
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode map key`)
+		}
+
+		elem := reflect.New(rt.Elem()).Elem()
+		if d.isNil() {
+			d.raw.ReadByte()
+			m.SetMapIndex(key, elem)
+			continue
+		}
+
+		e := elem
+		if e.Kind() == reflect.Ptr {
+			e.Set(reflect.New(e.Type().Elem()))
+		} else {
+			e = e.Addr()
+		}
+		if d.options.ExpectedSizes != nil {
+			d.pushPath(pathKey(key))
+		}
+		if err := d.Decode(e.Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode map element for key %v`, key.Interface())
+		}
+		if d.options.ExpectedSizes != nil {
+			d.popPath()
+		}
+		m.SetMapIndex(key, elem)
+	}
+	rv.Set(m)
+	return nil
+}
+
+// decodeMapKey decodes the next value as a map key of type rt
+func (d *Decoder) decodeMapKey(rt reflect.Type) (reflect.Value, error) {
+	key := reflect.New(rt).Elem()
+	switch rt.Kind() {
+	case reflect.String:
+		s, err := d.decodeStrOrBin()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		key.SetString(s)
+	case reflect.Interface:
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return reflect.Value{}, err
+		}
+		v, err := hashableKey(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if v != nil {
+			kv := reflect.ValueOf(v)
+			if !kv.Type().AssignableTo(rt) {
+				return reflect.Value{}, errors.Errorf(`msgpack: cannot use %s as map key of type %s`, kv.Type(), rt)
+			}
+			key.Set(kv)
+		}
+	default:
+		if err := d.Decode(key.Addr().Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return key, nil
+}
+
+// hashableKey returns v, a decoded map key, in a form that can be used
+// as a key of a Go map. Byte slices are converted to strings
+func hashableKey(v interface{}) (interface{}, error) {
+	if b, ok := v.([]byte); ok {
+		return string(b), nil
+	}
+	if v != nil && !reflect.TypeOf(v).Comparable() {
+		return nil, errors.Errorf(`msgpack: %T cannot be used as a map key`, v)
+	}
+	return v, nil
+}
+
+// decodeMixedMap decodes the next map, which may have keys that are not
+// strings. If all keys are strings, the result is a
+// map[string]interface{}, otherwise it is a map[interface{}]interface{}.
+// See WithNonStringMapKeys
+func (d *Decoder) decodeMixedMap() (interface{}, error) {
+	var size int
+	if err := d.DecodeMapLength(&size); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to decode map length`)
+	}
+
+	if size == -1 {
+		return map[string]interface{}(nil), nil
+	}
+
+	m := make(map[string]interface{}, d.mapCapacity(size))
+	var mixed map[interface{}]interface{}
+	for i := 0; i < size; i++ {
+		var key interface{}
+		if err := d.Decode(&key); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode map key`)
+		}
+		key, err := hashableKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if d.options.ExpectedSizes != nil {
+			d.pushPath(pathKey(reflect.ValueOf(key)))
+		}
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to decode map element for key %v`, key)
+		}
+		if d.options.ExpectedSizes != nil {
+			d.popPath()
+		}
+
+		if mixed == nil {
+			if s, ok := key.(string); ok {
+				m[s] = v
+				continue
+			}
+
+			// First key that is not a string: switch to a map that can
+			// hold any key
+			mixed = make(map[interface{}]interface{}, len(m)+1)
+			for k, v := range m {
+				mixed[k] = v
+			}
+		}
+		mixed[key] = v
+	}
+
+	if mixed != nil {
+		return mixed, nil
+	}
+	return m, nil
+}
+
+// decodePointer decodes the next value into rv, a settable pointer,
+// such as the target of a **T passed to Decode, or a *T element of a
+// slice. Nil sets the pointer to nil. Otherwise the pointer is
+// allocated if it is nil, and the value is decoded into what it points
+// to, which handles any number of levels of indirection one at a time
+func (d *Decoder) decodePointer(rv reflect.Value) error {
+	isNil, err := d.IsNextNil()
+	if err != nil {
+		return err
+	}
+	if isNil {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	if rv.IsNil() {
+		rv.Set(reflect.New(rv.Type().Elem()))
+	}
+	return d.decode(rv.Interface())
+}
+
+// DecodeTime decodes a time.Time, encoded either using the timestamp
+// extension, or as an array of two integers (seconds and nanoseconds)
+func (d *Decoder) DecodeTime(v *time.Time) error {
+	if d.isNextTimestamp() {
+		return d.decodeTimestamp(v)
+	}
+
+	var size int
+	if err := d.DecodeArrayLength(&size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode array length for time.Time`)
+	}
+	if size != 2 {
+		return errors.Errorf(`msgpack: expected array of size 2 (got %d)`, size)
+	}
+
+	var seconds int64
+	if err := d.DecodeInt64(&seconds); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode seconds part for time.Time`)
+	}
+	var nanosecs int
+	if err := d.DecodeInt(&nanosecs); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode nanoseconds part for time.Time`)
+	}
+
+	*v = time.Unix(seconds, int64(nanosecs))
+	return nil
+}
+
+func (d *Decoder) DecodeStruct(v interface{}) error {
+	if v, ok := v.(DecodeMsgpacker); ok {
+		return d.DecodeExt(v)
+	}
+
+	if v, ok := v.(*time.Time); ok {
+		return d.DecodeTime(v)
+	}
+
+	var rv = reflect.ValueOf(v)
+	// You better be a pointer to a struct, damnit
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New(`msgpack: expected pointer to struct`)
+	}
+
+	var rt = rv.Elem().Type()
+	plan := d.options.structPlanFor(rt)
+	if plan.asArray {
+		if code, err := d.PeekCode(); err == nil && IsArrayFamily(code) {
+			return d.decodeStructAsArray(rv.Elem(), plan)
+		}
+	}
+
+	size, pairs, err := d.decodeMapOrPairsLength()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode map length`)
+	}
+
+	if size == -1 {
+		if rv.CanSet() {
+			rv.Set(reflect.Value{})
+		}
+		return nil
+	}
+
+	setter, _ := v.(MsgpackFieldSetter)
+	var extra map[string]interface{}
+	if setter != nil {
+		extra = make(map[string]interface{})
+	}
+
+	var key string
+	for i := 0; i < size; i++ {
+		if pairs {
+			if err := d.decodePairHeader(); err != nil {
+				return err
+			}
+		}
+		fi, ok, err := d.decodeStructKey(plan, &key)
+		if err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode struct key at index %d`, i)
+		}
+		if !ok {
+			if setter == nil {
+				if d.options.DisallowUnknownFields {
+					return &UnknownFieldError{Type: rt, Field: key}
+				}
+				if d.options.Logger != nil {
+					d.logDebug(`msgpack: skipped unknown field`, "type", rt, "field", key)
+				}
+				if err := d.skip(); err != nil {
+					return errors.Wrapf(err, `msgpack: failed to skip value for unknown key %s`, key)
+				}
+				continue
+			}
+			var fv interface{}
+			if err := d.Decode(&fv); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to decode extra field %s`, key)
+			}
+			extra[key] = fv
+			continue
+		}
+		if err := d.decodeStructField(plan, rv.Elem().Field(fi), fi, key); err != nil {
+			return err
+		}
+	}
+
+	if setter != nil {
+		setter.SetMsgpackFields(extra)
+	}
+
+	return nil
+}
+
+// decodeStructField decodes the next value into f, the field at index
+// fi of a struct described by plan, whose key (or name) is key
+func (d *Decoder) decodeStructField(plan *structPlan, f reflect.Value, fi int, key string) error {
+	if d.isNil() {
+		if err := d.DecodeNil(nil); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode nil field %s`, key)
+		}
+		return nil
+	}
+
+	if name, ok := plan.decoders[fi]; ok {
+		if err := d.decodeWithFieldDecoder(name, f); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode value for key %s`, key)
+		}
+		return nil
+	}
+
+	if _, ok := plan.pairs[fi]; ok {
+		if err := d.decodeAsPairs(f); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode value for key %s`, key)
+		}
+		return nil
+	}
+
+	if d.options.EmptyAsNil || plan.emptyAsNil != nil {
+		if _, tagged := plan.emptyAsNil[fi]; (tagged || d.options.EmptyAsNil) && isEmptyAsNilType(f.Type()) {
+			if err := d.decodeEmptyAsNil(f); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to decode value for key %s`, key)
+			}
+			return nil
+		}
+	}
+
+	if d.options.ExpectedSizes != nil {
+		d.pushPath(key)
+	}
+	if ptr, ok := existingPointer(f); ok {
+		if err := d.Decode(ptr.Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode value for key %s (existing %s)`, key, ptr.Type())
+		}
+	} else if f.Kind() == reflect.Slice {
+		r := reflect.New(f.Type()).Elem()
+		if err := d.Decode(r.Addr().Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode slice value for key %s`, key)
+		}
+		f.Set(r)
+	} else if f.Kind() == reflect.Struct {
+		if err := d.Decode(f.Addr().Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode struct value for key %s (struct)`, key)
+		}
+	} else if f.Kind() == reflect.Ptr && f.Type().Elem().Kind() == reflect.Struct {
+		r := reflect.New(f.Type().Elem())
+		if err := d.Decode(r.Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode struct value for key %s (pointer to struct)`, key)
+		}
+		f.Set(r)
+	} else {
+		var fv reflect.Value
+		if f.Kind() == reflect.Ptr {
+			fv = reflect.New(f.Type().Elem())
+		} else {
+			fv = reflect.New(f.Type())
+		}
+		if err := d.Decode(fv.Interface()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode struct value for key %s (not struct/pointer to struct)`, key)
+		}
+
+		if err := assignIfCompatible(f, fv.Elem()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to assign struct value for key %s`, key)
+		}
+	}
+	if d.options.ExpectedSizes != nil {
+		d.popPath()
+	}
+	return nil
+}
+
+// decodeEmptyAsNil decodes the next value into f, which is either a
+// *string or a *time.Time. Empty strings and zero times are stored as
+// nil. An empty string is also accepted in place of a time
+func (d *Decoder) decodeEmptyAsNil(f reflect.Value) error {
+	if f.Type().Elem() == timeType {
+		code, err := d.PeekCode()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to peek code`)
+		}
+		if code == FixStr0 {
+			d.raw.ReadByte()
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+
+		var t time.Time
+		if err := d.DecodeTime(&t); err != nil {
+			return err
+		}
+		if t.IsZero() {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		f.Set(reflect.ValueOf(&t))
+		return nil
+	}
+
+	var s string
+	if err := d.DecodeString(&s); err != nil {
+		return err
+	}
+	if s == "" {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	ptr := reflect.New(f.Type().Elem())
+	ptr.Elem().SetString(s)
+	f.Set(ptr)
+	return nil
+}
+
+// existingPointer returns the pointer held by rv, if rv is an
+// interface that holds a non-nil pointer
+func existingPointer(rv reflect.Value) (reflect.Value, bool) {
+	if rv.Kind() != reflect.Interface || rv.IsNil() {
+		return reflect.Value{}, false
+	}
+
+	ptr := rv.Elem()
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return reflect.Value{}, false
+	}
+	return ptr, true
+}
+
+// strictlyAssignable reports whether src can be stored in dst without
+// changing its kind or its value, for WithStrictTypes. Only values of
+// scalar kinds are checked
+func strictlyAssignable(dst, src reflect.Value) bool {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return !dst.OverflowInt(src.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			u := src.Uint()
+			return u <= math.MaxInt64 && !dst.OverflowInt(int64(u))
+		}
+		return false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i := src.Int()
+			return i >= 0 && !dst.OverflowUint(uint64(i))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return !dst.OverflowUint(src.Uint())
+		}
+		return false
+	case reflect.Float32:
+		return src.Kind() == reflect.Float32
+	case reflect.Float64:
+		return src.Kind() == reflect.Float32 || src.Kind() == reflect.Float64
+	case reflect.String:
+		return src.Kind() == reflect.String
+	case reflect.Bool:
+		return src.Kind() == reflect.Bool
+	}
+	return true
+}
+
+func assignIfCompatible(dst, src reflect.Value) (err error) {
+	// src will always be from result of a Decode. therefore
+	// we will have no pointers. But dst can be either a
+	// a pointer or the actual type
+	var dstlist = []reflect.Value{dst}
+	if dst.Kind() == reflect.Ptr {
+		if dst.Elem().IsValid() {
+			dstlist = append(dstlist, dst.Elem())
+		} else {
+			v := reflect.New(dst.Type().Elem())
+			dstlist = append(dstlist, v.Elem())
+			defer func() {
+				if err == nil {
+					dst.Set(v)
+				}
+			}()
+		}
+	}
+
+	for _, dst := range dstlist {
+		if !dst.IsValid() {
+			continue
+		}
+
+		if dst.Type() == emptyInterfaceType {
+			dst.Set(reflect.ValueOf(src.Interface()))
+			return nil
+		}
+
+		// Unmarshalers need to assign in case of pointers, too
+
+		if src.Type().AssignableTo(dst.Type()) {
+			dst.Set(src)
+			return nil
+		}
+
+		if src.Type().ConvertibleTo(dst.Type()) {
+			dst.Set(src.Convert(dst.Type()))
+			return nil
+		}
+
+		// We may have a container...
+		if dst.Kind() == reflect.Slice && src.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+			if dst.Type().Elem() == emptyInterfaceType {
+				// if this is the case, we can assign everything from
+				// src to dst
+				for i := 0; i < src.Len(); i++ {
+					dst.Index(i).Set(src.Index(i))
+				}
+				return nil
+			}
+
+			if src.Type().Elem() == emptyInterfaceType {
+				sliceElemType := dst.Type().Elem() // []string -> string
+				isSliceElemPtr := dst.Type().Elem().Kind() == reflect.Ptr
+
+				// See if we can install src's contents into dst
+			SLICE:
+				for i := 0; i < src.Len(); i++ {
+					e := src.Index(i)
+
+					var assignErr error
+					switch {
+					case sliceElemType == e.Elem().Type():
+						if assignErr = assignIfCompatible(slice.Index(i), e.Elem()); assignErr == nil {
+							continue SLICE
+						}
+					case isSliceElemPtr:
+						if sliceElemType.Elem() == e.Elem().Type() {
+							if assignErr = assignIfCompatible(slice.Index(i), e.Elem().Addr()); assignErr == nil {
+								continue SLICE
+							}
+						} else if e.Elem().Type().ConvertibleTo(sliceElemType.Elem()) {
+							v := reflect.New(sliceElemType.Elem())
+							v.Elem().Set(e.Elem().Convert(sliceElemType.Elem()))
+							if assignErr = assignIfCompatible(slice.Index(i), v); assignErr == nil {
+								continue SLICE
+							}
+						}
+					}
+
+					return errors.Wrapf(assignErr, `msgpack: cannot assign slice element on index %d (slice type = %s, element type = %s)`, i, dst.Type(), e.Elem().Type())
+				}
+				dst.Set(slice)
+				return nil
+			}
+		}
+	}
+	return errors.Errorf(`invalid type for assignment: dst = %s, src = %s`, dst.Type(), src.Type())
+}
+
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// DecodeAny decodes the next value into whatever Go value represents
+// it best (as Decode does for a pointer to an empty interface), and
+// returns it. Maps are decoded as map[string]interface{} (that is,
+// map[string]any), and arrays as []interface{}
+func (d *Decoder) DecodeAny() (interface{}, error) {
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Decode takes a pointer to a variable, and populates it with the value
+// that was unmarshaled from the stream.
+//
+// If the variable is a non-pointer or nil, an error is returned.
+func (d *Decoder) Decode(v interface{}) error {
+	if d.options.Profiler != nil && !d.profiling {
+		return d.decodeProfiled(v)
+	}
+	if d.counter != nil && !d.inMessage {
+		return d.decodeMessage(v)
+	}
+	if d.options.MaxDepth > 0 {
+		return d.decodeNested(v)
+	}
+	return d.decode(v)
+}
+
+// decode does the work of Decode. It is called directly instead of
+// Decode when following pointers, so that the value that they point to
+// is not counted twice against MaxDepth
+func (d *Decoder) decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	// The result of decoding must be assigned to v, and v
+	// should be a pointer
+	if rv.Kind() == reflect.Interface {
+		// if it's an interface, get the underlying type
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		// report error
+		var typ reflect.Type
+		if rv.IsValid() {
+			typ = rv.Type()
+		}
+		return &InvalidDecodeError{
+			Type: typ,
+		}
+	}
+
+	// First, try guessing what to do by checking the type of the
+	// incoming payload. These are the easy choices
+	switch v := v.(type) {
+	case *interface{}:
+		// If the interface already holds a non-nil pointer, decode into
+		// the value that it points to, like encoding/json does
+		if ptr, ok := existingPointer(reflect.ValueOf(v).Elem()); ok && !d.isNil() {
+			return d.decode(ptr.Interface())
+		}
+		goto FromCode
+	case *int:
+		return d.DecodeInt(v)
+	case *int8:
+		return d.DecodeInt8(v)
+	case *int16:
+		return d.DecodeInt16(v)
+	case *int32:
+		return d.DecodeInt32(v)
+	case *int64:
+		return d.DecodeInt64(v)
+	case *uint:
+		return d.DecodeUint(v)
+	case *uint8:
+		return d.DecodeUint8(v)
+	case *uint16:
+		return d.DecodeUint16(v)
+	case *uint32:
+		return d.DecodeUint32(v)
+	case *uint64:
+		return d.DecodeUint64(v)
+	case *float32:
+		return d.DecodeFloat32(v)
+	case *float64:
+		return d.DecodeFloat64(v)
+	case *time.Duration:
+		return d.DecodeDuration(v)
+	case *[]byte:
+		// Byte slices written by other encoders may be arrays of
+		// integers
+		if code, err := d.PeekCode(); err == nil && IsArrayFamily(code) {
+			return d.DecodeArray(v)
+		}
+		return d.DecodeBytes(v)
+	case *string:
+		return d.DecodeString(v)
+	case *map[string]interface{}:
+		return d.DecodeMap(v)
+	case *sync.Map:
+		return d.DecodeSyncMap(v)
+	case *atomic.Value:
+		return d.DecodeAtomicValue(v)
+	case DecodeMsgpacker:
+		// Registered extensions only decode their payload, so the
+		// extension header must be consumed first
+		if _, ok := isExtType(rv.Elem().Type()); ok {
+			return d.DecodeExt(v)
+		}
+		// If we know this object does its own decoding, we bypass everything
+		// and just let it handle itself
+		return v.DecodeMsgpack(d)
+	}
+
+	if err, ok := d.decodeForeign(v); ok {
+		return err
+	}
+
+	// Next up: try using reflect to find out the general family of
+	// the payload.
+	switch rv.Elem().Kind() {
+	case reflect.Struct:
+		return d.DecodeStruct(v)
+	case reflect.Slice:
+		// Decode in place, so that the backing array of the slice can
+		// be reused
+		if err := d.DecodeArray(v); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode array`)
+		}
+		return nil
+	case reflect.Array:
+		return d.decodeFixedArray(rv.Elem())
+	case reflect.Map:
+		return d.decodeTypedMap(rv.Elem())
+	case reflect.Ptr:
+		return d.decodePointer(rv.Elem())
+	}
+
+FromCode:
+	var code Code
+	if d.options.StrictTypes {
+		// Remember the code for StrictTypeError. If this fails,
+		// decodeInterface reports the error
+		code, _ = d.PeekCode()
+	}
+	decoded, err := d.decodeInterface(v)
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode interface value`)
+	}
+
+	// if decoded == nil, then we have a special case, where we need
+	// to assign a nil to v, but the type of the nil must match v
+	// (if you get what I mean)
+	if decoded == nil {
+		// Note: I wish I could just return without doing anything, but
+		// because the encoded value is explicitly nil, it's only right
+		// to properly assign a nil to whatever value that was passed to
+		// this method.
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+		return nil
+	}
+
+	dv := reflect.ValueOf(decoded)
+
+	// Since we know rv to be a pointer, we must set the new value
+	// to the destination of the pointer.
+	dst := rv.Elem()
+
+	if d.options.StrictTypes && !strictlyAssignable(dst, dv) {
+		return &StrictTypeError{Code: code, Kind: dst.Kind()}
+	}
+
+	// Converting a float to an integer type silently drops its
+	// fractional part, so check it the same way DecodeInt does
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if k := dv.Kind(); k == reflect.Float32 || k == reflect.Float64 {
+			f, err := d.floatToInteger(dv.Float(), dst.Kind())
+			if err != nil {
+				return err
+			}
+			dv = reflect.ValueOf(f)
+		}
+	}
+
+	// If it's assignable, assign, and we're done.
+	if err := assignIfCompatible(dst, dv); err == nil {
+		return nil
+	}
+
+	// This could only happen if we have a decoder that creates
+	// the value dynamically, such as in the case of struct
+	// decoder or extension decoder.
+	if reflect.PtrTo(dst.Type()) == dv.Type() {
+		dst.Set(dv.Elem())
+		return nil
+	}
+
+	return errors.Errorf(`msgpack: cannot assign %s to %s`, dv.Type(), dst.Type())
+}
+
+// Note: v is only used as a hint. do not assign to it inside this method
+func (d *Decoder) decodeInterface(v interface{}) (interface{}, error) {
+	code, err := d.PeekCode()
+	if err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to peek code`)
+	}
+
+	if d.options.InterfaceIntsAsInt64 {
+		switch code {
+		case Uint8, Uint16, Uint32, Uint64:
+			var x uint64
+			if err := d.DecodeUint64(&x); err != nil {
+				return nil, errors.Wrapf(err, `msgpack: failed to decode %s`, code)
+			}
+			if x > math.MaxInt64 {
+				return x, nil
+			}
+			return int64(x), nil
+		case Int8, Int16, Int32, Int64:
+			var x int64
+			if err := d.DecodeInt64(&x); err != nil {
+				return nil, errors.Wrapf(err, `msgpack: failed to decode %s`, code)
+			}
+			return x, nil
+		}
+		if IsFixNumFamily(code) {
+			d.raw.ReadByte()
+			return int64(int8(code)), nil
+		}
+	}
+
+	switch {
+	case IsExtFamily(code) && d.isNextTimestamp():
+		var t time.Time
+		if err := d.decodeTimestamp(&t); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode timestamp`)
+		}
+		return t, nil
+	case IsExtFamily(code):
+		var size int
+		if err := d.DecodeExtLength(&size); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to read extension sizes`)
+		}
+
+		var typ reflect.Type
+		if err := d.DecodeExtType(&typ); err != nil {
+			return nil, errors.Wrap(err, `msgpack: faied to read extension type`)
+		}
+
+		rv := reflect.New(typ).Interface().(DecodeMsgpacker)
+		if err := d.decodeExtPayload(rv, size); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode extension`)
+		}
+		return rv, nil
+	case IsFixNumFamily(code):
+		// The value is the code itself
+		d.raw.ReadByte()
+		return int8(code), nil
+	case code == Nil:
+		// Optimization: doesn't require any more handling than to
+		// throw away the code
+		d.raw.ReadByte()
+		return nil, nil
+	case code == True:
+		// Optimization: doesn't require any more handling than to
+		// throw away the code
+		d.raw.ReadByte()
+		return true, nil
+	case code == False:
+		// Optimization: doesn't require any more handling than to
+		// throw away the code
+		d.raw.ReadByte()
+		return false, nil
+	case code == Int8:
+		var x int8
+		if err := d.DecodeInt8(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Int8`)
+		}
+		return x, nil
+	case code == Int16:
+		var x int16
+		if err := d.DecodeInt16(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Int16`)
+		}
+		return x, nil
+	case code == Int32:
+		var x int32
+		if err := d.DecodeInt32(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Int32`)
+		}
+		return x, nil
+	case code == Int64:
+		var x int64
+		if err := d.DecodeInt64(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Int64`)
+		}
+		return x, nil
+	case code == Uint8:
+		var x uint8
+		if err := d.DecodeUint8(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Uint8`)
+		}
+		return x, nil
+	case code == Uint16:
+		var x uint16
+		if err := d.DecodeUint16(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Uint16`)
+		}
+		return x, nil
+	case code == Uint32:
+		var x uint32
+		if err := d.DecodeUint32(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Uint32`)
+		}
+		return x, nil
+	case code == Uint64:
+		var x uint64
+		if err := d.DecodeUint64(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Uint64`)
+		}
+		return x, nil
+	case code == Float:
+		var x float32
+		if err := d.DecodeFloat32(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Float`)
+		}
+		return x, nil
+	case code == Double:
+		var x float64
+		if err := d.DecodeFloat64(&x); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode Double`)
+		}
+		return x, nil
+	case IsBinFamily(code) && !d.options.LegacyRaw:
+		var b []byte
+		if err := d.DecodeBytes(&b); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to decode %s`, code)
+		}
+		return b, nil
+	case IsStrFamily(code), IsBinFamily(code):
+		// With WithLegacyRaw, Bin is read as a string, since old
+		// implementations cannot tell strings and byte slices apart
+		var s string
+		if err := d.DecodeString(&s); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to decode %s`, code)
+		}
+		return s, nil
+	case IsArrayFamily(code):
+		var l []interface{}
+		if err := d.DecodeArray(&l); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to decode %s`, code)
+		}
+		return l, nil
+	case IsMapFamily(code):
+		// Special case: If the object is a Map type, and the target object
+		// is a Struct, we do the struct decoding bit.
+		// could be &struct, interface{}(&struct{}), or interface{}(&interface{}(struct{}))
+		rv := reflect.ValueOf(v)
+		if rv.Type().Kind() == reflect.Interface {
+			rv = rv.Elem()
+		}
+
+		if rv.Kind() == reflect.Ptr {
+			rv = rv.Elem()
+			if rv.Kind() == reflect.Interface {
+				rv = rv.Elem()
+			}
+			if rv.Kind() == reflect.Struct {
+				v := reflect.New(rv.Type()).Interface()
+				if err := d.DecodeStruct(v); err != nil {
+					return nil, errors.Wrap(err, `msgpack: failed to decode struct`)
+				}
+				return reflect.ValueOf(v).Elem().Interface(), nil
+			}
+		}
+
+		if d.options.NonStringMapKeys {
+			v, err := d.decodeMixedMap()
+			if err != nil {
+				return nil, errors.Wrap(err, `msgpack: failed to decode map`)
+			}
+			return v, nil
+		}
+
+		var v = make(map[string]interface{})
+		if err := d.DecodeMap(&v); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode map`)
+		}
+		return v, nil
+	default:
+		if code == reservedCode {
+			// Consume the reserved byte, so that the decoder can resync
+			d.raw.ReadByte()
+		}
+		return nil, d.invalidCode(code, errors.Errorf(`msgpack: invalid code %s`, code))
+	}
+}
+
+func (d *Decoder) DecodeExtLength(l *int) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	var payloadSize int
+	switch code {
+	case FixExt1:
+		payloadSize = 1
+	case FixExt2:
+		payloadSize = 2
+	case FixExt4:
+		payloadSize = 4
+	case FixExt8:
+		payloadSize = 8
+	case FixExt16:
+		payloadSize = 16
+	case Ext8:
+		s, err := d.src.ReadUint8()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read size for ext8 value`)
+		}
+		payloadSize = int(s)
+	case Ext16:
+		s, err := d.src.ReadUint16()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read size for ext16 value`)
+		}
+		payloadSize = int(s)
+	case Ext32:
+		s, err := d.src.ReadUint32()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read size for ext32 value`)
+		}
+		payloadSize, err = checkLength(code, int64(s))
+		if err != nil {
+			return err
+		}
+	default:
+		return d.invalidCode(code, errors.Errorf(`msgpack: invalid ext code %s`, code))
+	}
+	// The payload is preceded by the type
+	if err := d.checkMessageBytes(code, int64(payloadSize)+1); err != nil {
+		return err
+	}
+	*l = payloadSize
+	return nil
+}
+
+// DecodeExtHeader reads the header of the next extension, and returns
+// its type and the length of the payload that follows it. Unlike
+// DecodeExt, the type does not need to be registered. The payload is
+// left for the caller to read, for example through Sub(length), which
+// also allows it to be discarded with Finish. The type is the signed
+// value from the format, so the timestamp extension is reported as
+// TimestampExtType
+func (d *Decoder) DecodeExtHeader() (typ int8, length int, err error) {
+	var l int
+	if err := d.DecodeExtLength(&l); err != nil {
+		return 0, 0, err
+	}
+	t, err := d.src.ReadUint8()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, `msgpack: failed to read type for extension`)
+	}
+	return int8(t), l, nil
+}
+
+func (d *Decoder) DecodeExt(v DecodeMsgpacker) error {
+	var size int
+	if err := d.DecodeExtLength(&size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read extension sizes`)
+	}
+
+	var typ reflect.Type
+	if err := d.DecodeExtType(&typ); err != nil {
+		return errors.Wrap(err, `msgpack: faied to read extension type`)
+	}
+
+	if rt := reflect.TypeOf(v); rt != reflect.PtrTo(typ) {
+		return errors.Errorf(`msgpack: extension should be %s, got %s`, typ, rt)
+	}
+
+	if err := d.decodeExtPayload(v, size); err != nil {
+		return errors.Wrap(err, `msgpack: failed to call DecodeMsgpack`)
+	}
+	return nil
+}
+
+// decodeExtPayload calls v.DecodeMsgpack with a sub-decoder that is
+// limited to the extension payload
+func (d *Decoder) decodeExtPayload(v DecodeMsgpacker, size int) error {
+	sub := d.Sub(size)
+	if err := v.DecodeMsgpack(sub); err != nil {
+		// Keep the stream in sync, even if the extension failed
+		sub.Finish()
+		return err
+	}
+	return sub.Finish()
+}
+
+func (d *Decoder) DecodeExtType(v *reflect.Type) error {
+	t, err := d.src.ReadUint8()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read type for extension`)
+	}
+
+	muExtDecode.Lock()
+	typ, ok := extDecodeRegistry[int8(t)]
+	muExtDecode.Unlock()
+
+	if !ok {
+		if d.options.Logger != nil {
+			d.logDebug(`msgpack: extension type is not registered`, "ext_type", int(int8(t)))
+		}
+		return errors.Errorf(`msgpack: type %d is not registered as an extension`, int8(t))
+	}
+
+	*v = typ
+	return nil
+}
@@ -0,0 +1,130 @@
+package msgpack
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DialOption is an option that can be passed to TCPDialer, TLSDialer,
+// and UnixDialer
+type DialOption func(*dialer)
+
+type dialer struct {
+	timeout   time.Duration
+	keepAlive time.Duration
+}
+
+// WithDialTimeout specifies the maximum amount of time that
+// establishing a connection may take, including the TLS handshake.
+// The default is 10s. Zero means no timeout
+func WithDialTimeout(d time.Duration) DialOption {
+	return func(dl *dialer) {
+		dl.timeout = d
+	}
+}
+
+// WithKeepAlive specifies the interval between TCP keep-alive probes.
+// Zero uses the default of the net package, and a negative value
+// disables keep-alives
+func WithKeepAlive(d time.Duration) DialOption {
+	return func(dl *dialer) {
+		dl.keepAlive = d
+	}
+}
+
+func newDialer(options []DialOption) *dialer {
+	dl := &dialer{timeout: 10 * time.Second}
+	for _, option := range options {
+		option(dl)
+	}
+	return dl
+}
+
+func (dl *dialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dl.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dl.timeout)
+		defer cancel()
+	}
+
+	d := net.Dialer{KeepAlive: dl.keepAlive}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, `msgpack: failed to dial %s %s`, network, addr)
+	}
+	return conn, nil
+}
+
+// TCPDialer returns a DialFunc that connects to addr over TCP
+func TCPDialer(addr string, options ...DialOption) DialFunc {
+	dl := newDialer(options)
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return dl.dial(ctx, "tcp", addr)
+	}
+}
+
+// UnixDialer returns a DialFunc that connects to the Unix domain
+// socket at path
+func UnixDialer(path string, options ...DialOption) DialFunc {
+	dl := newDialer(options)
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return dl.dial(ctx, "unix", path)
+	}
+}
+
+// TLSDialer returns a DialFunc that connects to addr over TCP, and
+// performs a TLS handshake using config. To authenticate with a client
+// certificate (as e.g. Fluentd's in_forward can require), set
+// config.Certificates. If config.ServerName is empty, the host part of
+// addr is used
+func TLSDialer(addr string, config *tls.Config, options ...DialOption) DialFunc {
+	dl := newDialer(options)
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		start := time.Now()
+		conn, err := dl.dial(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// The handshake shares the timeout with dialing. Handshake is
+		// not aware of contexts, so use a deadline instead
+		var deadline time.Time
+		if dl.timeout > 0 {
+			deadline = start.Add(dl.timeout)
+		}
+		if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, `msgpack: failed to set deadline for TLS handshake`)
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, `msgpack: TLS handshake with %s failed`, addr)
+		}
+		if err := tlsConn.SetDeadline(time.Time{}); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, `msgpack: failed to clear deadline after TLS handshake`)
+		}
+		return tlsConn, nil
+	}
+}
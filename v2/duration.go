@@ -0,0 +1,79 @@
+package msgpack
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EncodeDuration encodes a time.Duration as an integer holding the
+// number of nanoseconds. If the Encoder was created with
+// WithDurationAsSeconds, it is encoded as a float holding the number of
+// seconds instead, which is what Python's timedelta.total_seconds()
+// produces
+func (e *Encoder) EncodeDuration(v time.Duration) error {
+	if e.options.DurationAsSeconds {
+		if err := e.EncodeFloat64(v.Seconds()); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode time.Duration`)
+		}
+		return nil
+	}
+
+	if err := e.EncodeInt64(int64(v)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode time.Duration`)
+	}
+	return nil
+}
+
+// DecodeDuration decodes a time.Duration. Integers are read as a number
+// of nanoseconds, and floats as a number of seconds, so values written
+// with or without WithDurationAsSeconds can both be decoded
+func (d *Decoder) DecodeDuration(v *time.Duration) error {
+	code, err := d.PeekCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to peek code`)
+	}
+
+	switch code {
+	case Float, Double:
+		var seconds float64
+		if code == Float {
+			var f float32
+			if err := d.DecodeFloat32(&f); err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode time.Duration`)
+			}
+			seconds = float64(f)
+		} else {
+			if err := d.DecodeFloat64(&seconds); err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode time.Duration`)
+			}
+		}
+
+		nanos := math.Round(seconds * float64(time.Second))
+		if math.IsNaN(nanos) || nanos < math.MinInt64 || nanos >= math.MaxInt64 {
+			return errors.Errorf(`msgpack: %v seconds is out of range for time.Duration`, seconds)
+		}
+		*v = time.Duration(nanos)
+		return nil
+	case Uint8, Uint16, Uint32, Uint64:
+		// Other implementations write non-negative integers using the
+		// unsigned formats
+		var nanos uint64
+		if err := d.DecodeUint64(&nanos); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode time.Duration`)
+		}
+		if nanos > math.MaxInt64 {
+			return errors.Errorf(`msgpack: %d nanoseconds is out of range for time.Duration`, nanos)
+		}
+		*v = time.Duration(nanos)
+		return nil
+	}
+
+	var nanos int64
+	if err := d.DecodeInt64(&nanos); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode time.Duration`)
+	}
+	*v = time.Duration(nanos)
+	return nil
+}
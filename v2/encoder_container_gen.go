@@ -0,0 +1,299 @@
+package msgpack
+
+// Auto-generated by internal/cmd/gencontainer/gencontainer.go. DO NOT EDIT!
+
+import "github.com/pkg/errors"
+
+func (e *Encoder) encodeMapBool(in interface{}) error {
+	for k, v := range in.(map[string]bool) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapInt(in interface{}) error {
+	for k, v := range in.(map[string]int) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapInt8(in interface{}) error {
+	for k, v := range in.(map[string]int8) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapInt16(in interface{}) error {
+	for k, v := range in.(map[string]int16) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapInt32(in interface{}) error {
+	for k, v := range in.(map[string]int32) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapInt64(in interface{}) error {
+	for k, v := range in.(map[string]int64) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapUint(in interface{}) error {
+	for k, v := range in.(map[string]uint) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapUint8(in interface{}) error {
+	for k, v := range in.(map[string]uint8) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapUint16(in interface{}) error {
+	for k, v := range in.(map[string]uint16) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapUint32(in interface{}) error {
+	for k, v := range in.(map[string]uint32) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapUint64(in interface{}) error {
+	for k, v := range in.(map[string]uint64) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapFloat32(in interface{}) error {
+	for k, v := range in.(map[string]float32) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapFloat64(in interface{}) error {
+	for k, v := range in.(map[string]float64) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMapString(in interface{}) error {
+	for k, v := range in.(map[string]string) {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode key`)
+		}
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for %s`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayBool(in interface{}) error {
+	for k, v := range in.([]bool) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayInt(in interface{}) error {
+	for k, v := range in.([]int) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayInt8(in interface{}) error {
+	for k, v := range in.([]int8) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayInt16(in interface{}) error {
+	for k, v := range in.([]int16) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayInt32(in interface{}) error {
+	for k, v := range in.([]int32) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayInt64(in interface{}) error {
+	for k, v := range in.([]int64) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayUint(in interface{}) error {
+	for k, v := range in.([]uint) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayUint8(in interface{}) error {
+	for k, v := range in.([]uint8) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayUint16(in interface{}) error {
+	for k, v := range in.([]uint16) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayUint32(in interface{}) error {
+	for k, v := range in.([]uint32) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayUint64(in interface{}) error {
+	for k, v := range in.([]uint64) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayFloat32(in interface{}) error {
+	for k, v := range in.([]float32) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayFloat64(in interface{}) error {
+	for k, v := range in.([]float64) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeArrayString(in interface{}) error {
+	for k, v := range in.([]string) {
+		if err := e.Encode(v); err != nil {
+			return errors.Wrapf(err, `failed to encode value for element %d`, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package msgpack
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownSigner is returned from Verify when the verifier does not
+// know the signer that is named in the envelope
+var ErrUnknownSigner = errors.New(`msgpack: unknown signer`)
+
+// ErrInvalidSignature is returned from Verify when the signature in
+// the envelope does not match its payload
+var ErrInvalidSignature = errors.New(`msgpack: invalid signature`)
+
+// Signer signs payloads on behalf of a single signer
+type Signer interface {
+	// SignerID returns the identifier that is stored in the envelope,
+	// so that the receiver can look up the key needed for verification
+	SignerID() string
+	Sign(payload []byte) ([]byte, error)
+}
+
+// Verifier verifies signatures created by one or more signers.
+// Verify should return ErrUnknownSigner if it does not know the
+// signer, and ErrInvalidSignature if the signature does not match
+type Verifier interface {
+	Verify(signerID string, payload, signature []byte) error
+}
+
+// Sign encodes v, and wraps the result in an envelope that holds the
+// signature, the ID of the signer, and the encoded payload:
+//
+//	[signature (bin), signer ID (str), payload (bin)]
+//
+// The payload is stored as a binary, so that the receiver verifies the
+// exact bytes that were signed before anything is decoded
+func Sign(signer Signer, v interface{}) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := NewEncoder(&payload).Encode(v); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to encode payload`)
+	}
+
+	signature, err := signer.Sign(payload.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to sign payload`)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	if err := WriteArrayHeader(e.dst, 3); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to write envelope header`)
+	}
+	if err := e.EncodeBytes(signature); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to encode signature`)
+	}
+	if err := e.EncodeString(signer.SignerID()); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to encode signer ID`)
+	}
+	if err := e.EncodeBytes(payload.Bytes()); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to encode payload`)
+	}
+	return buf.Bytes(), nil
+}
+
+// Verify opens an envelope created by Sign. The signature is verified
+// using the given verifier, and only then the payload is decoded into v.
+// The ID of the signer is returned, so that the caller can decide what
+// the signer is allowed to do.
+//
+// If the signature cannot be verified, the error from the verifier
+// (e.g. ErrUnknownSigner or ErrInvalidSignature) is returned as is
+func Verify(verifier Verifier, data []byte, v interface{}) (string, error) {
+	d := NewDecoder(bytes.NewReader(data))
+
+	var l int
+	if err := d.DecodeArrayLength(&l); err != nil {
+		return "", errors.Wrap(err, `msgpack: failed to decode envelope header`)
+	}
+	if l != 3 {
+		return "", errors.Errorf(`msgpack: invalid envelope: expected 3 elements, got %d`, l)
+	}
+
+	var signature []byte
+	if err := d.DecodeBytes(&signature); err != nil {
+		return "", errors.Wrap(err, `msgpack: failed to decode signature`)
+	}
+	var signerID string
+	if err := d.DecodeString(&signerID); err != nil {
+		return "", errors.Wrap(err, `msgpack: failed to decode signer ID`)
+	}
+	var payload []byte
+	if err := d.DecodeBytes(&payload); err != nil {
+		return "", errors.Wrap(err, `msgpack: failed to decode payload`)
+	}
+
+	if err := verifier.Verify(signerID, payload, signature); err != nil {
+		return "", err
+	}
+
+	if err := Unmarshal(payload, v); err != nil {
+		return "", errors.Wrap(err, `msgpack: failed to decode payload`)
+	}
+	return signerID, nil
+}
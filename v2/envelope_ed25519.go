@@ -0,0 +1,48 @@
+//go:build go1.13
+// +build go1.13
+
+package msgpack
+
+import (
+	"crypto/ed25519"
+
+	"github.com/pkg/errors"
+)
+
+type ed25519Signer struct {
+	id  string
+	key ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a Signer that signs payloads using the
+// given ed25519 private key, on behalf of the signer identified by id
+func NewEd25519Signer(id string, key ed25519.PrivateKey) (Signer, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.Errorf(`msgpack: invalid ed25519 private key size (%d)`, len(key))
+	}
+	return &ed25519Signer{id: id, key: key}, nil
+}
+
+func (s *ed25519Signer) SignerID() string {
+	return s.id
+}
+
+func (s *ed25519Signer) Sign(payload []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, payload), nil
+}
+
+// Ed25519Verifier is a Verifier that holds the ed25519 public keys
+// of known signers, keyed by their IDs
+type Ed25519Verifier map[string]ed25519.PublicKey
+
+func (v Ed25519Verifier) Verify(signerID string, payload, signature []byte) error {
+	key, ok := v[signerID]
+	if !ok {
+		return ErrUnknownSigner
+	}
+
+	if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, payload, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build go1.13
+// +build go1.13
+
+package msgpack_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEd25519Envelope(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if !assert.NoError(t, err, "GenerateKey should succeed") {
+		return
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if !assert.NoError(t, err, "GenerateKey should succeed") {
+		return
+	}
+
+	signer, err := msgpack.NewEd25519Signer("producer-1", priv)
+	if !assert.NoError(t, err, "NewEd25519Signer should succeed") {
+		return
+	}
+
+	data, err := msgpack.Sign(signer, webhookEvent{Event: "push", ID: 1000})
+	if !assert.NoError(t, err, "Sign should succeed") {
+		return
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		var ev webhookEvent
+		id, err := msgpack.Verify(msgpack.Ed25519Verifier{"producer-1": pub}, data, &ev)
+		if !assert.NoError(t, err, "Verify should succeed") {
+			return
+		}
+		if !assert.Equal(t, "producer-1", id, "signer ID should match") {
+			return
+		}
+		if !assert.Equal(t, webhookEvent{Event: "push", ID: 1000}, ev, "payload should match") {
+			return
+		}
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		var ev webhookEvent
+		_, err := msgpack.Verify(msgpack.Ed25519Verifier{"producer-1": otherPub}, data, &ev)
+		if !assert.Equal(t, msgpack.ErrInvalidSignature, err, "Verify should fail") {
+			return
+		}
+	})
+	t.Run("unknown signer", func(t *testing.T) {
+		var ev webhookEvent
+		_, err := msgpack.Verify(msgpack.Ed25519Verifier{"producer-2": pub}, data, &ev)
+		if !assert.Equal(t, msgpack.ErrUnknownSigner, err, "Verify should fail") {
+			return
+		}
+	})
+	t.Run("invalid private key", func(t *testing.T) {
+		_, err := msgpack.NewEd25519Signer("producer-1", priv[:10])
+		if !assert.Error(t, err, "NewEd25519Signer should fail") {
+			return
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// hmacSigner is a Signer and a Verifier using a shared secret, to make
+// sure that custom signers can be plugged in
+type hmacSigner struct {
+	id     string
+	secret []byte
+}
+
+func (s *hmacSigner) SignerID() string {
+	return s.id
+}
+
+func (s *hmacSigner) Sign(payload []byte) ([]byte, error) {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write(payload)
+	return h.Sum(nil), nil
+}
+
+func (s *hmacSigner) Verify(signerID string, payload, signature []byte) error {
+	if signerID != s.id {
+		return msgpack.ErrUnknownSigner
+	}
+	expected, _ := s.Sign(payload)
+	if !hmac.Equal(expected, signature) {
+		return msgpack.ErrInvalidSignature
+	}
+	return nil
+}
+
+type webhookEvent struct {
+	Event string
+	ID    int64
+}
+
+func TestEnvelope(t *testing.T) {
+	signer := &hmacSigner{id: "webhooks", secret: []byte("secret")}
+
+	t.Run("sign and verify", func(t *testing.T) {
+		data, err := msgpack.Sign(signer, webhookEvent{Event: "push", ID: 1000})
+		if !assert.NoError(t, err, "Sign should succeed") {
+			return
+		}
+
+		var ev webhookEvent
+		id, err := msgpack.Verify(signer, data, &ev)
+		if !assert.NoError(t, err, "Verify should succeed") {
+			return
+		}
+		if !assert.Equal(t, "webhooks", id, "signer ID should match") {
+			return
+		}
+		if !assert.Equal(t, webhookEvent{Event: "push", ID: 1000}, ev, "payload should match") {
+			return
+		}
+	})
+	t.Run("envelope layout", func(t *testing.T) {
+		data, err := msgpack.Sign(signer, "Hello, World!")
+		if !assert.NoError(t, err, "Sign should succeed") {
+			return
+		}
+
+		var envelope []interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(data, &envelope), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Len(t, envelope, 3, "envelope should have 3 elements") {
+			return
+		}
+
+		payload, err := msgpack.Marshal("Hello, World!")
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		signature, _ := signer.Sign(payload)
+		if !assert.Equal(t, []interface{}{signature, "webhooks", payload}, envelope, "envelope should match") {
+			return
+		}
+	})
+	t.Run("tampered payload", func(t *testing.T) {
+		data, err := msgpack.Sign(signer, webhookEvent{Event: "push", ID: 1000})
+		if !assert.NoError(t, err, "Sign should succeed") {
+			return
+		}
+
+		i := bytes.Index(data, []byte("push"))
+		if !assert.True(t, i > 0, "payload should be found") {
+			return
+		}
+		copy(data[i:], "pull")
+
+		var ev webhookEvent
+		_, err = msgpack.Verify(signer, data, &ev)
+		if !assert.Equal(t, msgpack.ErrInvalidSignature, err, "Verify should fail") {
+			return
+		}
+		if !assert.Equal(t, webhookEvent{}, ev, "payload should not be decoded") {
+			return
+		}
+	})
+	t.Run("unknown signer", func(t *testing.T) {
+		data, err := msgpack.Sign(&hmacSigner{id: "intruder", secret: []byte("secret")}, "Hello, World!")
+		if !assert.NoError(t, err, "Sign should succeed") {
+			return
+		}
+
+		var s string
+		_, err = msgpack.Verify(signer, data, &s)
+		if !assert.Equal(t, msgpack.ErrUnknownSigner, err, "Verify should fail") {
+			return
+		}
+	})
+	t.Run("not an envelope", func(t *testing.T) {
+		data, err := msgpack.Marshal([]string{"foo"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var s string
+		_, err = msgpack.Verify(signer, data, &s)
+		if !assert.Error(t, err, "Verify should fail") {
+			return
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package msgpack
+
+import (
+	"reflect"
+	"strconv"
+)
+
+func (e *InvalidDecodeError) Error() string {
+	if e.Type == nil {
+		return "msgpack: Decode(nil): pass a pointer to the variable to decode into, such as &v"
+	}
+
+	if e.Type.Kind() != reflect.Ptr {
+		return "msgpack: Decode(non-pointer " + e.Type.String() + "): the decoded value could not be stored, pass a pointer to the variable instead, such as &v"
+	}
+	return "msgpack: Decode(nil " + e.Type.String() + "): the pointer must point to a value, such as new(" + e.Type.Elem().String() + ")"
+}
+
+func (e *LengthOverflowError) Error() string {
+	return "msgpack: length " + strconv.FormatInt(e.Length, 10) + " for " + e.Code.String() + " overflows int on this platform"
+}
+
+func (e *LossyConversionError) Error() string {
+	return "msgpack: cannot decode " + strconv.FormatFloat(e.Value, 'g', -1, 64) + " into " + e.Kind.String() + " without losing precision"
+}
+
+func (e *ReservedCodeError) Error() string {
+	msg := "msgpack: reserved code 0xc1"
+	if e.Offset >= 0 {
+		msg += " at offset " + strconv.FormatInt(e.Offset, 10)
+	}
+	if e.Skipped > 0 {
+		msg += " (skipped " + strconv.Itoa(e.Skipped) + " more)"
+	}
+	return msg
+}
+
+func (e *StrictTypeError) Error() string {
+	return "msgpack: cannot decode " + e.Code.String() + " into " + e.Kind.String() + " without conversion"
+}
+
+func (e *TrailingBytesError) Error() string {
+	return "msgpack: " + strconv.Itoa(e.Count) + " trailing bytes after value"
+}
+
+func (e *UnexpectedTypeError) Error() string {
+	return "msgpack: expected " + e.Expected.String() + ", got " + e.Actual.String() + " (" + e.Code.String() + ")"
+}
+
+func (e *UnknownFieldError) Error() string {
+	return "msgpack: unknown field " + strconv.Quote(e.Field) + " for " + e.Type.String()
+}
@@ -0,0 +1,320 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type extFieldStruct struct {
+	Name    string
+	Time    EventTime
+	TimePtr *EventTime
+	Times   []EventTime
+	Nested  []extFieldInner
+}
+
+type extFieldInner struct {
+	Time EventTime `msgpack:"time"`
+}
+
+func TestExtStructFields(t *testing.T) {
+	t1 := EventTime{Time: time.Unix(1234567890, 123).UTC()}
+	t2 := EventTime{Time: time.Unix(1234567891, 456).UTC()}
+
+	t.Run("struct fields", func(t *testing.T) {
+		v := extFieldStruct{
+			Name:    "foo",
+			Time:    t1,
+			TimePtr: &t2,
+			Times:   []EventTime{t1, t2},
+			Nested:  []extFieldInner{{Time: t2}, {Time: t1}},
+		}
+
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded extFieldStruct
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("inside map", func(t *testing.T) {
+		v := map[string]interface{}{
+			"time":   t1,
+			"nested": extFieldInner{Time: t2},
+		}
+
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, &t1, decoded["time"], "ext value should be decoded as the registered type") {
+			return
+		}
+		nested, ok := decoded["nested"].(map[string]interface{})
+		if !assert.True(t, ok, "nested value should be a map") {
+			return
+		}
+		if !assert.Equal(t, &t2, nested["time"], "nested ext value should be decoded as the registered type") {
+			return
+		}
+	})
+	t.Run("inside array", func(t *testing.T) {
+		v := []interface{}{t1, extFieldInner{Time: t2}}
+
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded []interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Len(t, decoded, 2, "decoded array should have 2 elements") {
+			return
+		}
+		if !assert.Equal(t, &t1, decoded[0], "ext value should be decoded as the registered type") {
+			return
+		}
+		if !assert.Equal(t, map[string]interface{}{"time": &t2}, decoded[1], "nested ext value should be decoded as the registered type") {
+			return
+		}
+	})
+}
+
+// greedyExt reads more than its payload
+type greedyExt struct {
+	Value uint64
+}
+
+func (v greedyExt) EncodeMsgpack(e *msgpack.Encoder) error {
+	return e.Writer().WriteUint32(uint32(v.Value))
+}
+
+func (v *greedyExt) DecodeMsgpack(d *msgpack.Decoder) error {
+	x, err := d.Reader().ReadUint64()
+	if err != nil {
+		return err
+	}
+	v.Value = x
+	return nil
+}
+
+// lazyExt reads less than its payload
+type lazyExt struct {
+	Value uint16
+}
+
+func (v lazyExt) EncodeMsgpack(e *msgpack.Encoder) error {
+	return e.Writer().WriteUint64(uint64(v.Value))
+}
+
+func (v *lazyExt) DecodeMsgpack(d *msgpack.Decoder) error {
+	x, err := d.Reader().ReadUint16()
+	if err != nil {
+		return err
+	}
+	v.Value = x
+	return nil
+}
+
+func init() {
+	if err := msgpack.RegisterExt(10, greedyExt{}); err != nil {
+		panic(err)
+	}
+	if err := msgpack.RegisterExt(11, lazyExt{}); err != nil {
+		panic(err)
+	}
+}
+
+func TestExtSubDecoder(t *testing.T) {
+	encode := func(values ...interface{}) []byte {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		for _, v := range values {
+			if err := enc.Encode(v); err != nil {
+				t.Fatalf("failed to encode %#v: %s", v, err)
+			}
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("over-reading extension", func(t *testing.T) {
+		dec := msgpack.NewDecoder(bytes.NewReader(encode(greedyExt{Value: 1}, "next")))
+
+		var v greedyExt
+		if !assert.Error(t, dec.Decode(&v), "Decode should fail") {
+			return
+		}
+
+		var s string
+		if !assert.NoError(t, dec.Decode(&s), "Decode of the next value should succeed") {
+			return
+		}
+		if !assert.Equal(t, "next", s, "next value should match") {
+			return
+		}
+	})
+	t.Run("under-reading extension", func(t *testing.T) {
+		dec := msgpack.NewDecoder(bytes.NewReader(encode(lazyExt{Value: 1}, "next")))
+
+		var v lazyExt
+		if !assert.NoError(t, dec.Decode(&v), "Decode should succeed") {
+			return
+		}
+
+		var s string
+		if !assert.NoError(t, dec.Decode(&s), "Decode of the next value should succeed") {
+			return
+		}
+		if !assert.Equal(t, "next", s, "next value should match") {
+			return
+		}
+	})
+	t.Run("Sub", func(t *testing.T) {
+		b := encode("foo", "bar", "baz")
+		dec := msgpack.NewDecoder(bytes.NewReader(b))
+
+		// "foo" and "bar" are 4 bytes each
+		sub := dec.Sub(8)
+		var s string
+		for _, expected := range []string{"foo", "bar"} {
+			if !assert.NoError(t, sub.Decode(&s), "Decode should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected, s, "value should match") {
+				return
+			}
+		}
+		if !assert.Error(t, sub.Decode(&s), "Decode past the limit should fail") {
+			return
+		}
+		if !assert.NoError(t, sub.Finish(), "Finish should succeed") {
+			return
+		}
+
+		if !assert.NoError(t, dec.Decode(&s), "Decode on the parent should succeed") {
+			return
+		}
+		if !assert.Equal(t, "baz", s, "value should match") {
+			return
+		}
+	})
+	t.Run("Finish with truncated stream", func(t *testing.T) {
+		dec := msgpack.NewDecoder(bytes.NewReader([]byte{1, 2, 3}))
+		if !assert.Error(t, dec.Sub(8).Finish(), "Finish should fail") {
+			return
+		}
+	})
+}
+
+// blobExt carries an arbitrary number of payload bytes, so that it can
+// be encoded with every code of the ext family
+type blobExt struct {
+	Data []byte
+}
+
+func (v blobExt) EncodeMsgpack(e *msgpack.Encoder) error {
+	_, err := e.Writer().Write(v.Data)
+	return err
+}
+
+func (v *blobExt) DecodeMsgpack(d *msgpack.Decoder) error {
+	var data []byte
+	for {
+		b, err := d.Reader().ReadByte()
+		if err != nil {
+			break
+		}
+		data = append(data, b)
+	}
+	v.Data = data
+	return nil
+}
+
+func init() {
+	if err := msgpack.RegisterExt(12, blobExt{}); err != nil {
+		panic(err)
+	}
+}
+
+func TestExtSizes(t *testing.T) {
+	testcases := []struct {
+		Size int
+		Code msgpack.Code
+	}{
+		{Size: 1, Code: msgpack.FixExt1},
+		{Size: 2, Code: msgpack.FixExt2},
+		{Size: 3, Code: msgpack.Ext8},
+		{Size: 4, Code: msgpack.FixExt4},
+		{Size: 8, Code: msgpack.FixExt8},
+		{Size: 16, Code: msgpack.FixExt16},
+		{Size: 17, Code: msgpack.Ext8},
+		{Size: 300, Code: msgpack.Ext16},
+		{Size: 70000, Code: msgpack.Ext32},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Code.String()+" "+strconv.Itoa(tc.Size), func(t *testing.T) {
+			v := blobExt{Data: bytes.Repeat([]byte{'x'}, tc.Size)}
+			b, err := msgpack.Marshal(v)
+			if !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, tc.Code, msgpack.Code(b[0]), "code should match") {
+				return
+			}
+
+			t.Run("direct", func(t *testing.T) {
+				var decoded blobExt
+				if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+					return
+				}
+				if !assert.Equal(t, v, decoded, "values should match") {
+					return
+				}
+			})
+			t.Run("interface{}", func(t *testing.T) {
+				var decoded interface{}
+				if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+					return
+				}
+				if !assert.Equal(t, &v, decoded, "values should match") {
+					return
+				}
+			})
+			t.Run("followed by another value", func(t *testing.T) {
+				var buf bytes.Buffer
+				enc := msgpack.NewEncoder(&buf)
+				if !assert.NoError(t, enc.Encode([]interface{}{v, "next"}), "Encode should succeed") {
+					return
+				}
+
+				var decoded []interface{}
+				if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &decoded), "Unmarshal should succeed") {
+					return
+				}
+				if !assert.Equal(t, []interface{}{&v, "next"}, decoded, "values should match") {
+					return
+				}
+			})
+		})
+	}
+}
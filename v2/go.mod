@@ -0,0 +1,9 @@
+module github.com/lestrrat-go/msgpack/v2
+
+go 1.12
+
+require (
+	github.com/lestrrat-go/bufferpool v0.0.0-20180220091733-e7784e1b3e37
+	github.com/pkg/errors v0.8.1
+	github.com/stretchr/testify v1.3.0
+)
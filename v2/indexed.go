@@ -0,0 +1,262 @@
+package msgpack
+
+import (
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// indexedMagic marks the end of an indexed msgpack file
+const indexedMagic = "MPIX"
+
+// trailer = Uint64 (footer offset) + FixStr4 (magic)
+const indexedTrailerSize = 9 + 1 + len(indexedMagic)
+
+// IndexedWriter writes a stream of msgpack messages, followed by
+// a footer that holds the offsets of each message (and optionally
+// a key index), which allows an IndexedReader to access any
+// record in O(1).
+//
+// The resulting file is still a valid stream of back-to-back msgpack
+// values: the records, the footer, the offset to the footer as an
+// Uint64, and the magic string "MPIX".
+type IndexedWriter struct {
+	dst    *countingWriter
+	enc    *Encoder
+	footer indexFooter
+	closed bool
+}
+
+// IndexedReader provides random access to the records in a file
+// created by an IndexedWriter
+type IndexedReader struct {
+	src    io.ReaderAt
+	footer indexFooter
+}
+
+type indexFooter struct {
+	offsets Index
+	keys    map[string]int
+	// size is the number of bytes that the footer occupies in the file.
+	// It is only used when decoding, to reject lengths that the footer
+	// cannot possibly hold before allocating for them
+	size int64
+}
+
+type countingWriter struct {
+	dst io.Writer
+	n   int64
+}
+
+func (w *countingWriter) Write(buf []byte) (int, error) {
+	n, err := w.dst.Write(buf)
+	w.n += int64(n)
+	return n, err
+}
+
+// NewIndexedWriter creates a new IndexedWriter that writes to w.
+// Close must be called to write the footer.
+func NewIndexedWriter(w io.Writer) *IndexedWriter {
+	dst := &countingWriter{dst: w}
+	return &IndexedWriter{
+		dst: dst,
+		enc: NewEncoder(dst),
+		footer: indexFooter{
+			keys: make(map[string]int),
+		},
+	}
+}
+
+// Encode writes v as the next record
+func (w *IndexedWriter) Encode(v interface{}) error {
+	if w.closed {
+		return errors.New(`msgpack: indexed writer has already been closed`)
+	}
+
+	off := w.dst.n
+	if err := w.enc.Encode(v); err != nil {
+		return errors.Wrapf(err, `msgpack: failed to encode record %d`, len(w.footer.offsets))
+	}
+	w.footer.offsets = append(w.footer.offsets, off)
+	return nil
+}
+
+// EncodeWithKey writes v as the next record, and registers it in
+// the key index so that it can be retrieved using IndexedReader.DecodeKey
+func (w *IndexedWriter) EncodeWithKey(key string, v interface{}) error {
+	if _, ok := w.footer.keys[key]; ok {
+		return errors.Errorf(`msgpack: duplicate key %s`, key)
+	}
+
+	if err := w.Encode(v); err != nil {
+		return err
+	}
+	w.footer.keys[key] = len(w.footer.offsets) - 1
+	return nil
+}
+
+// Close writes the footer. It does not close the underlying io.Writer
+func (w *IndexedWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	off := w.dst.n
+	if err := w.footer.EncodeMsgpack(w.enc); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write index footer`)
+	}
+
+	// The footer offset is always written as an Uint64 so that the
+	// trailer has a fixed size
+	if err := w.enc.Writer().WriteByteUint64(Uint64.Byte(), uint64(off)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write index footer offset`)
+	}
+
+	if err := w.enc.EncodeString(indexedMagic); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write index magic`)
+	}
+	return nil
+}
+
+func (f indexFooter) EncodeMsgpack(e *Encoder) error {
+	if err := e.EncodeArrayHeader(2); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode footer header`)
+	}
+
+	if err := e.EncodeArrayHeader(len(f.offsets)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode offsets header`)
+	}
+	for _, off := range f.offsets {
+		if err := e.EncodeInt64(off); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode offset`)
+		}
+	}
+
+	if err := WriteMapHeader(e.Writer(), len(f.keys)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode key index header`)
+	}
+	// Sort the keys so that the same records always produce the same file
+	keys := make([]string, 0, len(f.keys))
+	for key := range f.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := e.EncodeString(key); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode key`)
+		}
+		if err := e.EncodeInt(f.keys[key]); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to encode index for key %s`, key)
+		}
+	}
+	return nil
+}
+
+func (f *indexFooter) DecodeMsgpack(d *Decoder) error {
+	var l int
+	if err := d.DecodeArrayLength(&l); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode footer header`)
+	}
+	if l != 2 {
+		return errors.Errorf(`msgpack: invalid footer length %d (expected 2)`, l)
+	}
+
+	if err := d.DecodeArrayLength(&l); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode offsets header`)
+	}
+	// Each offset takes at least one byte
+	if l < 0 || int64(l) > f.size {
+		return errors.Errorf(`msgpack: invalid offsets length %d for a footer of %d bytes`, l, f.size)
+	}
+	f.offsets = make(Index, l)
+	for i := 0; i < l; i++ {
+		if err := d.DecodeInt64(&f.offsets[i]); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode offset %d`, i)
+		}
+	}
+
+	if err := d.DecodeMapLength(&l); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode key index header`)
+	}
+	// Each key takes at least one byte, and so does its index
+	if l < 0 || 2*int64(l) > f.size {
+		return errors.Errorf(`msgpack: invalid key index length %d for a footer of %d bytes`, l, f.size)
+	}
+	f.keys = make(map[string]int, l)
+	for i := 0; i < l; i++ {
+		var key string
+		if err := d.DecodeString(&key); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode key`)
+		}
+
+		var idx int
+		if err := d.DecodeInt(&idx); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode index for key %s`, key)
+		}
+		if idx < 0 || idx >= len(f.offsets) {
+			return errors.Errorf(`msgpack: index %d for key %s out of range`, idx, key)
+		}
+		f.keys[key] = idx
+	}
+	return nil
+}
+
+// NewIndexedReader reads the footer of an indexed file of the given
+// size, as written by an IndexedWriter
+func NewIndexedReader(ra io.ReaderAt, size int64) (*IndexedReader, error) {
+	if size < int64(indexedTrailerSize) {
+		return nil, errors.New(`msgpack: file too small to be an indexed file`)
+	}
+
+	trailer := make([]byte, indexedTrailerSize)
+	if _, err := ra.ReadAt(trailer, size-int64(indexedTrailerSize)); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to read index trailer`)
+	}
+
+	if trailer[0] != Uint64.Byte() || trailer[9] != FixStr0.Byte()+byte(len(indexedMagic)) || string(trailer[10:]) != indexedMagic {
+		return nil, errors.New(`msgpack: invalid index trailer`)
+	}
+
+	var off int64
+	for _, b := range trailer[1:9] {
+		off = off<<8 | int64(b)
+	}
+	if off < 0 || off > size-int64(indexedTrailerSize) {
+		return nil, errors.Errorf(`msgpack: invalid index footer offset %d`, off)
+	}
+
+	r := &IndexedReader{src: ra}
+	r.footer.size = size - int64(indexedTrailerSize) - off
+	if err := NewReaderAtDecoder(ra, off).Decode(&r.footer); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to decode index footer`)
+	}
+	return r, nil
+}
+
+// Len returns the number of records in the file
+func (r *IndexedReader) Len() int {
+	return len(r.footer.offsets)
+}
+
+// Index returns the offsets of each record in the file
+func (r *IndexedReader) Index() Index {
+	idx := make(Index, len(r.footer.offsets))
+	copy(idx, r.footer.offsets)
+	return idx
+}
+
+// Decode decodes the i-th record into v
+func (r *IndexedReader) Decode(i int, v interface{}) error {
+	return r.footer.offsets.Decode(r.src, i, v)
+}
+
+// DecodeKey decodes the record that was registered with key into v
+func (r *IndexedReader) DecodeKey(key string, v interface{}) error {
+	i, ok := r.footer.keys[key]
+	if !ok {
+		return errors.Errorf(`msgpack: key %s not found in index`, key)
+	}
+	return r.Decode(i, v)
+}
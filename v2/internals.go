@@ -0,0 +1,59 @@
+package msgpack
+
+import "sync/atomic"
+
+// Counters for the pool of buffers used by Marshal. These are only
+// ever accessed atomically
+var (
+	marshalBufferAllocs int64
+	marshalBufferGets   int64
+)
+
+// InternalStats is a snapshot of the sizes of the internal caches and
+// pools of this package, as returned by Internals. It is meant to be
+// exported to monitoring systems (see the msgpackexpvar package), so
+// operators can confirm that they stay bounded in production
+type InternalStats struct {
+	// ExtEncodeTypes and ExtDecodeTypes are the number of entries in
+	// the registries populated via RegisterExt
+	ExtEncodeTypes int
+	ExtDecodeTypes int
+	// MarshalBufferGets is the number of buffers that have been taken
+	// from the pool used by Marshal, and MarshalBufferAllocs the number
+	// of those that had to be allocated because the pool was empty
+	MarshalBufferGets   int64
+	MarshalBufferAllocs int64
+	// StructPlans is the number of cached struct plans (see
+	// SetStructPlanCacheSize). StructPlanHits and StructPlanMisses count
+	// the lookups in that cache, and StructPlanEvictions the plans that
+	// were evicted to keep it within its maximum size
+	StructPlans         int
+	StructPlanHits      int64
+	StructPlanMisses    int64
+	StructPlanEvictions int64
+}
+
+// Internals returns a snapshot of the sizes of the internal caches and
+// pools of this package
+func Internals() InternalStats {
+	var stats InternalStats
+
+	muExtEncode.RLock()
+	stats.ExtEncodeTypes = len(extEncodeRegistry)
+	muExtEncode.RUnlock()
+
+	muExtDecode.RLock()
+	stats.ExtDecodeTypes = len(extDecodeRegistry)
+	muExtDecode.RUnlock()
+
+	stats.MarshalBufferGets = atomic.LoadInt64(&marshalBufferGets)
+	stats.MarshalBufferAllocs = atomic.LoadInt64(&marshalBufferAllocs)
+
+	structPlans.mu.Lock()
+	stats.StructPlans = structPlans.lru.Len()
+	stats.StructPlanHits = structPlans.hits
+	stats.StructPlanMisses = structPlans.misses
+	stats.StructPlanEvictions = structPlans.evictions
+	structPlans.mu.Unlock()
+	return stats
+}
@@ -0,0 +1,29 @@
+package msgpack_test
+
+import (
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInternals(t *testing.T) {
+	before := msgpack.Internals()
+	for i := 0; i < 10; i++ {
+		if _, err := msgpack.Marshal("Hello, World!"); !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+	}
+	after := msgpack.Internals()
+
+	if !assert.Equal(t, before.MarshalBufferGets+10, after.MarshalBufferGets, "buffer gets should be counted") {
+		return
+	}
+	if !assert.True(t, after.MarshalBufferAllocs <= after.MarshalBufferGets, "allocations should not exceed gets") {
+		return
+	}
+	// EventTime is registered in msgpack_example_test.go
+	if !assert.True(t, after.ExtEncodeTypes > 0, "ext registry should not be empty") {
+		return
+	}
+}
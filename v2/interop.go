@@ -0,0 +1,106 @@
+package msgpack
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Marshaler is implemented by types that can produce their own msgpack
+// representation as a byte slice. The method signature is the same as
+// that of vmihailenco/msgpack's Marshaler, so types written for that
+// package can be used with this package without modification.
+//
+// The returned bytes must contain exactly one complete msgpack value,
+// and are written to the output verbatim
+type Marshaler interface {
+	MarshalMsgpack() ([]byte, error)
+}
+
+// Unmarshaler is the decoding counterpart of Marshaler. It receives the
+// raw bytes of one complete msgpack value. The method signature is the
+// same as that of vmihailenco/msgpack's Unmarshaler
+type Unmarshaler interface {
+	UnmarshalMsgpack([]byte) error
+}
+
+// MsgpMarshaler is the interface implemented by code generated by
+// github.com/tinylib/msgp. MarshalMsg appends the msgpack representation
+// of the value to b
+type MsgpMarshaler interface {
+	MarshalMsg(b []byte) ([]byte, error)
+}
+
+// MsgpUnmarshaler is the decoding counterpart of MsgpMarshaler, as
+// generated by github.com/tinylib/msgp. UnmarshalMsg returns the bytes
+// left over after decoding one value
+type MsgpUnmarshaler interface {
+	UnmarshalMsg(b []byte) ([]byte, error)
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+var msgpMarshalerType = reflect.TypeOf((*MsgpMarshaler)(nil)).Elem()
+
+// encodeForeign handles values that implement one of the foreign
+// marshaling interfaces. It returns false if rv does not implement
+// any of them
+func (e *Encoder) encodeForeign(rv reflect.Value) (error, bool) {
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil, false
+	}
+
+	var b []byte
+	var err error
+	switch t := rv.Type(); {
+	case t.Implements(marshalerType):
+		b, err = rv.Interface().(Marshaler).MarshalMsgpack()
+	case t.Implements(msgpMarshalerType):
+		b, err = rv.Interface().(MsgpMarshaler).MarshalMsg(nil)
+	default:
+		return nil, false
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, `msgpack: failed to marshal %s`, rv.Type()), true
+	}
+
+	if _, err := e.dst.Write(b); err != nil {
+		return errors.Wrapf(err, `msgpack: failed to write marshaled %s`, rv.Type()), true
+	}
+	return nil, true
+}
+
+// decodeForeign reads the raw bytes of the next value, and passes them
+// to the foreign unmarshaling interface implemented by v. It returns
+// false if v does not implement any of them
+func (d *Decoder) decodeForeign(v interface{}) (error, bool) {
+	switch v.(type) {
+	case Unmarshaler, MsgpUnmarshaler:
+	default:
+		return nil, false
+	}
+
+	// Decode has already counted the value against MaxDepth, so only
+	// its elements are counted while copying it
+	var h valueHeader
+	if err := d.readValueHeader(&h); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read raw value`), true
+	}
+	var buf bytes.Buffer
+	if err := d.copyPayload(&h, &buf); err != nil {
+		return errors.Wrap(err, `msgpack: failed to read raw value`), true
+	}
+
+	switch v := v.(type) {
+	case Unmarshaler:
+		if err := v.UnmarshalMsgpack(buf.Bytes()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to unmarshal %T`, v), true
+		}
+	case MsgpUnmarshaler:
+		if _, err := v.UnmarshalMsg(buf.Bytes()); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to unmarshal %T`, v), true
+		}
+	}
+	return nil, true
+}
@@ -0,0 +1,122 @@
+package msgpack_test
+
+import (
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// point implements the vmihailenco/msgpack style Marshaler/Unmarshaler,
+// and serializes itself as a 2 element array
+type point struct {
+	X, Y int64
+}
+
+func (p point) MarshalMsgpack() ([]byte, error) {
+	return msgpack.Marshal([]int64{p.X, p.Y})
+}
+
+func (p *point) UnmarshalMsgpack(b []byte) error {
+	var l []int64
+	if err := msgpack.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	if len(l) != 2 {
+		return errors.Errorf(`expected 2 elements, got %d`, len(l))
+	}
+	p.X, p.Y = l[0], l[1]
+	return nil
+}
+
+// flag implements the tinylib/msgp style interfaces, and serializes
+// itself as a bool
+type flag struct {
+	On bool
+}
+
+func (f flag) MarshalMsg(b []byte) ([]byte, error) {
+	if f.On {
+		return append(b, msgpack.True.Byte()), nil
+	}
+	return append(b, msgpack.False.Byte()), nil
+}
+
+func (f *flag) UnmarshalMsg(b []byte) ([]byte, error) {
+	if len(b) < 1 {
+		return nil, errors.New(`empty input`)
+	}
+	f.On = b[0] == msgpack.True.Byte()
+	return b[1:], nil
+}
+
+type interopStruct struct {
+	Name   string
+	Point  point
+	Points []point
+	Flag   flag
+}
+
+func TestInterop(t *testing.T) {
+	t.Run("Marshaler", func(t *testing.T) {
+		b, err := msgpack.Marshal(point{X: 1000, Y: 2000})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		expected, err := msgpack.Marshal([]int64{1000, 2000})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, expected, b, "output should match") {
+			return
+		}
+
+		var p point
+		if !assert.NoError(t, msgpack.Unmarshal(b, &p), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, point{X: 1000, Y: 2000}, p, "values should match") {
+			return
+		}
+	})
+	t.Run("MsgpMarshaler", func(t *testing.T) {
+		b, err := msgpack.Marshal(&flag{On: true})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.True.Byte()}, b, "output should match") {
+			return
+		}
+
+		var f flag
+		if !assert.NoError(t, msgpack.Unmarshal(b, &f), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.True(t, f.On, "value should match") {
+			return
+		}
+	})
+	t.Run("nested", func(t *testing.T) {
+		v := interopStruct{
+			Name:   "foo",
+			Point:  point{X: 1000, Y: 2000},
+			Points: []point{{X: 3000, Y: 4000}},
+			Flag:   flag{On: true},
+		}
+
+		b, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded interopStruct
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "values should match") {
+			return
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// EncodeJSONValue encodes values from the encoding/json package while
+// preserving their JSON semantics: json.RawMessage is parsed and
+// transcoded into the equivalent msgpack value (instead of being written
+// out as a byte sequence), json.Number is written as a numeric value,
+// and map[string]json.RawMessage is written as a map of transcoded values.
+//
+// Any other value is handed to Encode
+func (e *Encoder) EncodeJSONValue(v interface{}) error {
+	switch v := v.(type) {
+	case json.RawMessage:
+		return e.encodeJSONRawMessage(v)
+	case json.Number:
+		return e.encodeJSONNumber(v)
+	case map[string]json.RawMessage:
+		return e.encodeJSONRawMessageMap(v)
+	}
+	return e.Encode(v)
+}
+
+func (e *Encoder) encodeJSONNumber(n json.Number) error {
+	s := n.String()
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return e.EncodeInt64(i)
+	}
+
+	// Integers larger than math.MaxInt64 still fit in an uint64
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return e.EncodeUint64(u)
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return errors.Errorf(`msgpack: invalid json.Number %q`, s)
+	}
+	return e.EncodeFloat64(f)
+}
+
+func (e *Encoder) encodeJSONRawMessage(m json.RawMessage) error {
+	if len(bytes.TrimSpace(m)) == 0 {
+		return e.EncodeNil()
+	}
+
+	// UseNumber is required so that we do not lose the distinction
+	// between integers and floating point numbers
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(m))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to parse json.RawMessage`)
+	}
+
+	// A json.RawMessage holds a single JSON value: anything other than
+	// whitespace after it is an error, as it is for json.Unmarshal
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New(`msgpack: invalid json.RawMessage: trailing data after JSON value`)
+	}
+
+	if err := e.Encode(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to transcode json.RawMessage`)
+	}
+	return nil
+}
+
+func (e *Encoder) encodeJSONRawMessageMap(m map[string]json.RawMessage) error {
+	if m == nil {
+		return e.EncodeNil()
+	}
+
+	if err := WriteMapHeader(e.dst, len(m)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write map header`)
+	}
+
+	for k, v := range m {
+		if err := e.EncodeString(k); err != nil {
+			return errors.Wrap(err, `failed to encode map key`)
+		}
+
+		if err := e.encodeJSONRawMessage(v); err != nil {
+			return errors.Wrapf(err, `failed to encode map value for %s`, k)
+		}
+	}
+	return nil
+}
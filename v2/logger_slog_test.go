@@ -0,0 +1,28 @@
+//go:build go1.21
+// +build go1.21
+
+package msgpack_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLoggerSlog(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	dec := msgpack.NewDecoder(bytes.NewReader([]byte{msgpack.Str8.Byte()}), msgpack.WithLogger(logger))
+	var s string
+	if !assert.Error(t, dec.Decode(&s), "Decode should fail") {
+		return
+	}
+	if !assert.True(t, strings.Contains(out.String(), `msg="msgpack: failed to decode value" type=*string start=0`), "failure should be logged via slog: %s", out.String()) {
+		return
+	}
+}
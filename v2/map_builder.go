@@ -0,0 +1,190 @@
+package msgpack
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type mapEntryKind int
+
+const (
+	mapEntryValue mapEntryKind = iota
+	mapEntryString
+	mapEntryInt64
+	mapEntryBytes
+	mapEntryNil
+	mapEntryRaw
+)
+
+// mapEntry holds a single key/value pair. Typed entries store their
+// value in the corresponding field, so that they do not need to be
+// boxed in an interface{}
+type mapEntry struct {
+	key  string
+	kind mapEntryKind
+	s    string
+	i    int64
+	b    []byte
+	v    interface{}
+}
+
+type mapBuilder struct {
+	entries []mapEntry
+}
+
+func NewMapBuilder() MapBuilder {
+	return &mapBuilder{}
+}
+
+func (b *mapBuilder) Reset() {
+	b.entries = b.entries[:0]
+}
+
+// Add adds a value of an arbitrary type. A nil value, including a nil
+// pointer, map, slice or interface, is encoded as nil
+func (b *mapBuilder) Add(key string, value interface{}) {
+	b.entries = append(b.entries, mapEntry{key: key, kind: mapEntryValue, v: value})
+}
+
+func (b *mapBuilder) AddString(key string, value string) {
+	b.entries = append(b.entries, mapEntry{key: key, kind: mapEntryString, s: value})
+}
+
+func (b *mapBuilder) AddInt64(key string, value int64) {
+	b.entries = append(b.entries, mapEntry{key: key, kind: mapEntryInt64, i: value})
+}
+
+// AddBytes adds a value that is encoded as a msgpack binary. The
+// slice is not copied, so it must not be modified until Encode is called
+func (b *mapBuilder) AddBytes(key string, value []byte) {
+	b.entries = append(b.entries, mapEntry{key: key, kind: mapEntryBytes, b: value})
+}
+
+func (b *mapBuilder) AddNil(key string) {
+	b.entries = append(b.entries, mapEntry{key: key, kind: mapEntryNil})
+}
+
+// AddRaw adds a value that is already msgpack encoded. The data is
+// written as is, so it must contain exactly one complete msgpack value.
+// The slice is not copied, so it must not be modified until Encode is
+// called
+func (b *mapBuilder) AddRaw(key string, value []byte) {
+	b.entries = append(b.entries, mapEntry{key: key, kind: mapEntryRaw, b: value})
+}
+
+func (b *mapBuilder) Count() int {
+	return len(b.entries)
+}
+
+func WriteMapHeader(dst io.Writer, c int) error {
+	var w Writer
+	var ok bool
+	if w, ok = dst.(Writer); !ok {
+		w = newWriter(dst)
+	}
+
+	var err error
+	switch {
+	case c < 16:
+		err = w.WriteByte(FixMap0.Byte() + byte(c))
+	case c < math.MaxUint16:
+		err = w.WriteByteUint16(Map16.Byte(), uint16(c))
+	case int64(c) < math.MaxUint32:
+		err = w.WriteByteUint32(Map32.Byte(), uint32(c))
+	default:
+		return errors.Errorf(`map builder: map element count out of range (%d)`, c)
+	}
+	if err != nil {
+		return errors.Wrap(err, `map builder: failed to write map header`)
+	}
+	return nil
+}
+
+// isNilValue reports if v is nil, or a nil pointer, map, slice or
+// interface wrapped in an interface{}
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// checkMapValue returns an error for values that can never be encoded,
+// so that Encode can fail before anything is written
+func checkMapValue(v interface{}) error {
+	rt := reflect.TypeOf(v)
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	switch rt.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return errors.Errorf(`map builder: unsupported value type %s`, reflect.TypeOf(v))
+	}
+	return nil
+}
+
+func (b *mapBuilder) Encode(dst io.Writer) error {
+	for _, entry := range b.entries {
+		if entry.kind != mapEntryValue || isNilValue(entry.v) {
+			continue
+		}
+		if err := checkMapValue(entry.v); err != nil {
+			return errors.Wrapf(err, `map builder: invalid value for key %s`, entry.key)
+		}
+	}
+
+	e := NewEncoder(dst)
+	if err := WriteMapHeader(e.dst, b.Count()); err != nil {
+		return errors.Wrap(err, `map builder: failed to write map header`)
+	}
+
+	for _, entry := range b.entries {
+		if err := e.EncodeString(entry.key); err != nil {
+			return errors.Wrapf(err, `map builder: failed to encode map key %s`, entry.key)
+		}
+
+		var err error
+		switch entry.kind {
+		case mapEntryString:
+			err = e.EncodeString(entry.s)
+		case mapEntryInt64:
+			err = e.EncodeInt64(entry.i)
+		case mapEntryBytes:
+			err = e.EncodeBytes(entry.b)
+		case mapEntryNil:
+			err = e.EncodeNil()
+		case mapEntryRaw:
+			_, err = e.dst.Write(entry.b)
+		default:
+			if isNilValue(entry.v) {
+				err = e.EncodeNil()
+			} else {
+				err = e.Encode(entry.v)
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, `map builder: failed to encode map element for %s`, entry.key)
+		}
+	}
+	return nil
+}
+
+func (b *mapBuilder) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := b.Encode(&buf); err != nil {
+		return nil, errors.Wrap(err, `map builder: failed to write map`)
+	}
+
+	return buf.Bytes(), nil
+}
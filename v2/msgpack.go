@@ -0,0 +1,134 @@
+//go:generate stringer -type Code
+//go:generate go run internal/cmd/gencontainer/gencontainer.go - encoder_container_gen.go
+//go:generate go run internal/cmd/gendecoder-numeric/gendecoder-numeric.go - decoder_numeric_gen.go
+//go:generate go run internal/cmd/genencoder-numeric/genencoder-numeric.go - encoder_numeric_gen.go
+
+// Package msgpack is version 2 of github.com/lestrrat-go/msgpack. It
+// is a module of its own, which does not depend on v1. The differences
+// with v1 are:
+//
+//   - extension types are int8, as in the msgpack specification: in
+//     RegisterExt, DecodeExtHeader, Value.ExtType, and the
+//     TimestampExtType and ConnControlExtType constants. v1 takes an
+//     int, which it truncates when encoding, and looks up the types
+//     that it decodes as unsigned bytes
+//   - Marshal takes options, like Unmarshal and NewEncoder do
+//   - errors returned by Marshal start with "msgpack:", like all the
+//     other errors of the package
+//   - NewReader and NewWriter are gone: the low level Reader and Writer
+//     are obtained from a Decoder or an Encoder
+//
+// The v1compat package provides the v1 forms of these functions, to
+// switch the imports of a program first, and its call sites later
+package msgpack
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// maxPooledBufferSize is the capacity above which the buffers used by
+// Marshal are not returned to the pool, so that a single large value
+// does not keep a large buffer alive
+const maxPooledBufferSize = 64 * 1024
+
+// marshalState is what Marshal keeps in its pool: the buffer that
+// values are encoded into, and the Encoder that writes to it
+type marshalState struct {
+	buf appendingWriter
+	enc Encoder
+}
+
+var pool = sync.Pool{
+	New: allocMarshalState,
+}
+
+func allocMarshalState() interface{} {
+	atomic.AddInt64(&marshalBufferAllocs, 1)
+	s := &marshalState{}
+	s.buf.buf = make([]byte, 0, 9)
+	s.enc.dst = &s.buf
+	return s
+}
+
+func releaseMarshalState(s *marshalState) {
+	if cap(s.buf.buf) > maxPooledBufferSize {
+		return
+	}
+	s.buf.buf = s.buf.buf[0:0]
+	// Drop the references to the options
+	s.enc.options = Options{}
+	pool.Put(s)
+}
+
+// unmarshalState is what Unmarshal keeps in its pool: a Decoder and
+// the reader over the data it decodes, so that the read buffer of the
+// Decoder is reused
+type unmarshalState struct {
+	data bytes.Reader
+	dec  *Decoder
+}
+
+var unmarshalPool = sync.Pool{
+	New: func() interface{} {
+		s := &unmarshalState{}
+		s.dec = NewDecoder(&s.data)
+		return s
+	},
+}
+
+func releaseUnmarshalState(s *unmarshalState) {
+	// Drop the references to the data and the options
+	s.data.Reset(nil)
+	s.dec.Reset(&s.data)
+	s.dec.options = Options{}
+	unmarshalPool.Put(s)
+}
+
+// Marshal takes a Go value and serializes it in msgpack format,
+// according to options. The Encoder and the buffer that are used are
+// taken from a pool, and the returned slice is a copy that the caller
+// owns
+func Marshal(v interface{}, options ...Option) ([]byte, error) {
+	atomic.AddInt64(&marshalBufferGets, 1)
+	s := pool.Get().(*marshalState)
+	defer releaseMarshalState(s)
+	s.enc.options = newOptions(options)
+	s.enc.Reset(&s.buf)
+	if err := s.enc.Encode(v); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to marshal`)
+	}
+
+	b := make([]byte, len(s.buf.buf))
+	copy(b, s.buf.buf)
+	return b, nil
+}
+
+// Unmarshal takes a byte slice and a pointer to a Go value and
+// deserializes the Go value from the data in msgpack format. The
+// Decoder that is used is taken from a pool.
+//
+// data must contain exactly one value: if there are bytes left after
+// it, a *TrailingBytesError is returned, unless WithAllowTrailingBytes
+// is specified
+func Unmarshal(data []byte, v interface{}, options ...Option) error {
+	s := unmarshalPool.Get().(*unmarshalState)
+	defer releaseUnmarshalState(s)
+
+	s.data.Reset(data)
+	dec := s.dec
+	dec.options = newOptions(options)
+	dec.Reset(&s.data)
+	if err := dec.Decode(v); err != nil {
+		return errors.Wrap(err, `failed to unmarshal`)
+	}
+	if !dec.options.AllowTrailingBytes {
+		if n := dec.raw.Buffered() + s.data.Len(); n > 0 {
+			return &TrailingBytesError{Count: n}
+		}
+	}
+	return nil
+}
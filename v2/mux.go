@@ -0,0 +1,627 @@
+package msgpack
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStreamClosed is returned from Stream.Send after the Stream has
+// been closed via Stream.Close
+var ErrStreamClosed = errors.New(`msgpack: stream closed`)
+
+// Each frame exchanged by a Mux is a msgpack array of 3 elements:
+// [stream ID, kind, body]. The body is the message itself for data
+// frames, the number of messages that the sender may send for window
+// frames, and nil for close frames
+const muxFrameFields = 3
+
+const (
+	muxData int64 = iota + 1
+	muxWindow
+	muxClose
+)
+
+// maxEarlyStreams is the number of streams that the peer may open
+// before they are opened locally. A Mux keeps the credit that the peer
+// granted for each of them, and fails once the peer opens more
+const maxEarlyStreams = 1024
+
+// Mux carries several independent logical streams of messages over a
+// single io.ReadWriter, such as a control stream and a bulk data
+// stream sharing one TCP connection. Streams are identified by
+// numbers that both peers agree upon, and are opened by calling Stream
+// on both ends.
+//
+// Each stream has its own flow control: a peer only sends as many
+// messages as the receiving side has room for (see WithStreamWindow),
+// so a stream whose consumer is slow never holds up the others.
+//
+// Once both sides have closed a stream, the Mux forgets about it, and
+// its ID must not be used again. Frames for streams that neither side
+// has opened are a protocol error, and stop the Mux.
+//
+// Like Conn, Mux is safe to use from multiple goroutines.
+type Mux struct {
+	rw              io.ReadWriter
+	dec             *Decoder
+	window          int
+	maxMessageBytes int64
+
+	// wsem is a semaphore that guards writes, like in Conn
+	wsem chan struct{}
+	wbuf bytes.Buffer
+	enc  *Encoder
+
+	muStreams sync.Mutex
+	streams   map[uint32]*Stream
+	// early holds the streams that the peer has opened, but that have
+	// not been opened locally yet
+	early map[uint32]*earlyStream
+	// stopped is set once the read loop has exited
+	stopped bool
+
+	// Window frames are written by a single goroutine. windows holds the
+	// credit waiting to be granted for each stream, and wakeWindows
+	// tells the goroutine that there is some. muControl is held while
+	// writing window and close frames, so that a close frame is never
+	// written before the window frames that were queued for the stream
+	muWindows   sync.Mutex
+	windows     map[uint32]int
+	wakeWindows chan struct{}
+	muControl   sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	muErr sync.Mutex
+	err   error
+}
+
+// MuxOption is an option that can be passed to NewMux
+type MuxOption func(*Mux)
+
+// WithStreamWindow specifies the number of messages that the peer may
+// send on each stream before they are consumed by Stream.Recv. The
+// default is 16
+func WithStreamWindow(n int) MuxOption {
+	return func(m *Mux) {
+		if n < 1 {
+			n = 1
+		}
+		m.window = n
+	}
+}
+
+// WithMuxMaxMessageBytes limits the size of a single frame read from
+// the peer, including the message that it carries, like
+// WithMaxMessageBytes does for a Decoder. A peer that sends a larger
+// frame causes the Mux to stop with an error whose cause is
+// ErrMessageTooLarge. If n is zero, there is no limit. The default is
+// DefaultMaxMessageBytes
+func WithMuxMaxMessageBytes(n int64) MuxOption {
+	return func(m *Mux) {
+		m.maxMessageBytes = n
+	}
+}
+
+// Stream is a single logical stream of messages carried by a Mux
+type Stream struct {
+	mux      *Mux
+	id       uint32
+	incoming chan []byte
+
+	mu sync.Mutex
+	// credit is the number of messages that we may send, and notify is
+	// closed (and replaced) whenever credit is added
+	credit int
+	notify chan struct{}
+	// peerWindow is the credit that the peer granted when it opened the
+	// stream, sent is the number of messages that we have sent, and
+	// granted the credit that the peer granted since then. Together,
+	// they tell whether the peer may still send window frames
+	peerWindow int
+	sent       int
+	granted    int
+	// consumed is the number of messages received since the last
+	// window frame was sent to the peer
+	consumed     int
+	localClosed  bool
+	remoteClosed bool
+	// sending is the number of data frames being written. Close waits
+	// on idle until it drops to zero, so that the close frame is never
+	// written before a data frame
+	sending int
+	idle    chan struct{}
+}
+
+// earlyStream records what the peer sent for a stream that has not
+// been opened locally yet
+type earlyStream struct {
+	credit int
+	closed bool
+}
+
+// NewMux creates a new Mux, and starts the goroutine that reads frames
+// from rw. The goroutine exits when rw returns an error (including
+// io.EOF), or when Close is called
+func NewMux(rw io.ReadWriter, options ...MuxOption) *Mux {
+	m := &Mux{
+		rw:              rw,
+		window:          16,
+		maxMessageBytes: DefaultMaxMessageBytes,
+		wsem:            make(chan struct{}, 1),
+		streams:         make(map[uint32]*Stream),
+		early:           make(map[uint32]*earlyStream),
+		windows:         make(map[uint32]int),
+		wakeWindows:     make(chan struct{}, 1),
+		done:            make(chan struct{}),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	m.dec = NewDecoder(rw, WithMaxMessageBytes(m.maxMessageBytes))
+	m.enc = NewEncoder(&m.wbuf)
+
+	go m.readLoop()
+	go m.windowLoop()
+	return m
+}
+
+// Stream opens the stream with the given ID, and allows the peer to
+// start sending messages on it. Calling Stream again with the same ID
+// returns the same Stream, until both sides have closed it
+func (m *Mux) Stream(id uint32) *Stream {
+	m.muStreams.Lock()
+	s, ok := m.streams[id]
+	if ok {
+		m.muStreams.Unlock()
+		return s
+	}
+
+	s = &Stream{
+		mux:      m,
+		id:       id,
+		incoming: make(chan []byte, m.window),
+		notify:   make(chan struct{}),
+	}
+	if early, ok := m.early[id]; ok {
+		delete(m.early, id)
+		s.credit = early.credit
+		s.peerWindow = early.credit
+		s.remoteClosed = early.closed
+	}
+	if m.stopped || s.remoteClosed {
+		close(s.incoming)
+	}
+	m.streams[id] = s
+	m.muStreams.Unlock()
+
+	m.queueWindow(id, m.window)
+	return s
+}
+
+// queueWindow queues a window frame granting credit for the stream
+func (m *Mux) queueWindow(id uint32, credit int) {
+	m.muWindows.Lock()
+	m.windows[id] += credit
+	m.muWindows.Unlock()
+
+	select {
+	case m.wakeWindows <- struct{}{}:
+	default:
+	}
+}
+
+// windowLoop writes the window frames queued via queueWindow, so that
+// granting credit never blocks, and never starts a goroutine of its own
+func (m *Mux) windowLoop() {
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-m.wakeWindows:
+		}
+
+		m.muControl.Lock()
+		m.muWindows.Lock()
+		windows := m.windows
+		m.windows = make(map[uint32]int)
+		m.muWindows.Unlock()
+
+		for id, credit := range windows {
+			if err := m.writeFrame(context.Background(), id, muxWindow, int64(credit)); err != nil {
+				break
+			}
+		}
+		m.muControl.Unlock()
+	}
+}
+
+// lookup returns the Stream for id, or nil if it is not open
+func (m *Mux) lookup(id uint32) *Stream {
+	m.muStreams.Lock()
+	defer m.muStreams.Unlock()
+	return m.streams[id]
+}
+
+// forget removes s from the Mux, once both sides have closed it and the
+// peer cannot send any more window frames for it: the peer grants
+// credit for every (window+1)/2 messages that it receives (see grant),
+// so it does not once fewer than that are left ungranted
+func (m *Mux) forget(s *Stream) {
+	s.mu.Lock()
+	finished := s.localClosed && s.remoteClosed && s.sent-s.granted < (s.peerWindow+1)/2
+	s.mu.Unlock()
+	if !finished {
+		return
+	}
+
+	m.muStreams.Lock()
+	if m.streams[s.id] == s {
+		delete(m.streams, s.id)
+	}
+	m.muStreams.Unlock()
+}
+
+func (m *Mux) readLoop() {
+	defer func() {
+		m.muStreams.Lock()
+		m.stopped = true
+		for _, s := range m.streams {
+			s.mu.Lock()
+			if !s.remoteClosed {
+				close(s.incoming)
+			}
+			s.mu.Unlock()
+		}
+		m.muStreams.Unlock()
+	}()
+
+	for {
+		if _, err := m.dec.raw.Peek(1); err != nil {
+			m.setErr(err)
+			return
+		}
+
+		if err := m.dec.startMessage(); err != nil {
+			m.setErr(err)
+			return
+		}
+		// finishMessage reports truncated frames as io.ErrUnexpectedEOF
+		if err := m.dec.finishMessage(m.readFrame()); err != nil {
+			m.setErr(err)
+			return
+		}
+	}
+}
+
+func (m *Mux) readFrame() error {
+	var l int
+	if err := m.dec.DecodeArrayLength(&l); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode frame header`)
+	}
+	if l != muxFrameFields {
+		return errors.Errorf(`msgpack: invalid number of fields in frame (%d)`, l)
+	}
+
+	var id uint32
+	if err := m.dec.DecodeUint32(&id); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode stream ID`)
+	}
+	var kind int64
+	if err := m.dec.DecodeInt64(&kind); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode frame kind`)
+	}
+
+	switch kind {
+	case muxData:
+		var buf bytes.Buffer
+		if err := m.dec.copyValue(&buf); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to read message for stream %d`, id)
+		}
+		s := m.lookup(id)
+		if s == nil {
+			return errors.Errorf(`msgpack: received message for stream %d, which is not open`, id)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.remoteClosed {
+			return errors.Errorf(`msgpack: received message for stream %d, which is not open`, id)
+		}
+		select {
+		case s.incoming <- buf.Bytes():
+		default:
+			return errors.Errorf(`msgpack: peer exceeded the window for stream %d`, id)
+		}
+	case muxWindow:
+		var credit int64
+		if err := m.dec.DecodeInt64(&credit); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode window for stream %d`, id)
+		}
+		if credit < 1 || credit > math.MaxInt32 {
+			return errors.Errorf(`msgpack: invalid window %d for stream %d`, credit, id)
+		}
+
+		m.muStreams.Lock()
+		s, ok := m.streams[id]
+		if !ok {
+			// The peer opened a stream that is not open locally yet
+			defer m.muStreams.Unlock()
+			if _, ok := m.early[id]; ok {
+				return errors.Errorf(`msgpack: peer opened stream %d twice`, id)
+			}
+			if len(m.early) >= maxEarlyStreams {
+				return errors.Errorf(`msgpack: peer opened more than %d streams that are not open`, maxEarlyStreams)
+			}
+			m.early[id] = &earlyStream{credit: int(credit)}
+			return nil
+		}
+		m.muStreams.Unlock()
+
+		s.mu.Lock()
+		if s.peerWindow == 0 {
+			s.peerWindow = int(credit)
+		} else {
+			s.granted += int(credit)
+		}
+		s.credit += int(credit)
+		close(s.notify)
+		s.notify = make(chan struct{})
+		s.mu.Unlock()
+		m.forget(s)
+	case muxClose:
+		if err := m.dec.DecodeNil(nil); err != nil {
+			return errors.Wrapf(err, `msgpack: failed to decode close frame for stream %d`, id)
+		}
+
+		m.muStreams.Lock()
+		s, ok := m.streams[id]
+		if !ok {
+			defer m.muStreams.Unlock()
+			early, ok := m.early[id]
+			if !ok {
+				return errors.Errorf(`msgpack: received close frame for stream %d, which is not open`, id)
+			}
+			early.closed = true
+			return nil
+		}
+		m.muStreams.Unlock()
+
+		s.mu.Lock()
+		if !s.remoteClosed {
+			s.remoteClosed = true
+			close(s.incoming)
+		}
+		s.mu.Unlock()
+		m.forget(s)
+	default:
+		return errors.Errorf(`msgpack: invalid frame kind %d for stream %d`, kind, id)
+	}
+	return nil
+}
+
+// writeFrame encodes and writes a single frame. body is encoded as is,
+// except for data frames, where it holds the encoded message
+func (m *Mux) writeFrame(ctx context.Context, id uint32, kind int64, body interface{}) error {
+	select {
+	case <-m.done:
+		return ErrConnClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case m.wsem <- struct{}{}:
+	}
+	defer func() { <-m.wsem }()
+
+	m.wbuf.Reset()
+	if err := m.enc.EncodeArrayHeader(muxFrameFields); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode frame header`)
+	}
+	if err := m.enc.EncodeUint32(id); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode stream ID`)
+	}
+	if err := m.enc.EncodeInt64(kind); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode frame kind`)
+	}
+	if msg, ok := body.([]byte); ok && kind == muxData {
+		m.wbuf.Write(msg)
+	} else if err := m.enc.Encode(body); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode frame body`)
+	}
+
+	if _, err := m.rw.Write(m.wbuf.Bytes()); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write frame`)
+	}
+	return nil
+}
+
+func (m *Mux) setErr(err error) {
+	m.muErr.Lock()
+	if m.err == nil {
+		m.err = err
+	}
+	m.muErr.Unlock()
+}
+
+// Err returns the error that caused the read loop to stop, if any.
+// If the peer closed the connection cleanly, io.EOF is returned
+func (m *Mux) Err() error {
+	m.muErr.Lock()
+	defer m.muErr.Unlock()
+	return m.err
+}
+
+// Close stops the Mux, and all of its streams. If the underlying
+// io.ReadWriter is also an io.Closer, it is closed as well
+func (m *Mux) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		if closer, ok := m.rw.(io.Closer); ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
+
+// ID returns the ID of the stream
+func (s *Stream) ID() uint32 {
+	return s.id
+}
+
+// Send encodes v, and sends it on the stream. If the peer has no room
+// for more messages on this stream, Send waits until it does, or
+// until the context is cancelled
+func (s *Stream) Send(ctx context.Context, v interface{}) error {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode message`)
+	}
+
+	for {
+		s.mu.Lock()
+		if s.localClosed {
+			s.mu.Unlock()
+			return ErrStreamClosed
+		}
+		if s.credit > 0 {
+			s.credit--
+			s.sent++
+			s.sending++
+			s.mu.Unlock()
+			break
+		}
+		notify := s.notify
+		s.mu.Unlock()
+
+		select {
+		case <-s.mux.done:
+			return ErrConnClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-notify:
+		}
+	}
+
+	err := s.mux.writeFrame(ctx, s.id, muxData, buf.Bytes())
+	s.mu.Lock()
+	if err != nil {
+		// The message was not sent, so give the credit back
+		s.credit++
+		s.sent--
+	}
+	s.sending--
+	if s.sending == 0 && s.idle != nil {
+		close(s.idle)
+		s.idle = nil
+	}
+	s.mu.Unlock()
+	if err != nil {
+		s.mux.forget(s)
+	}
+	return err
+}
+
+// Recv waits for the next message on the stream, and decodes it into
+// v. Once the peer has closed the stream, and all of the messages sent
+// before that have been received, io.EOF is returned. If the Mux has
+// stopped, the error that caused it to stop is returned
+func (s *Stream) Recv(ctx context.Context, v interface{}) error {
+	select {
+	case <-s.mux.done:
+		return ErrConnClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case msg, ok := <-s.incoming:
+		if !ok {
+			s.mu.Lock()
+			remoteClosed := s.remoteClosed
+			s.mu.Unlock()
+			if remoteClosed {
+				return io.EOF
+			}
+			return s.mux.Err()
+		}
+
+		s.grant()
+		if err := NewDecoder(bytes.NewReader(msg)).Decode(v); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode message`)
+		}
+		return nil
+	}
+}
+
+// grant gives the peer room for more messages, once half of the
+// window has been consumed
+func (s *Stream) grant() {
+	s.mu.Lock()
+	s.consumed++
+	var credit int
+	if s.consumed >= (s.mux.window+1)/2 {
+		credit = s.consumed
+		s.consumed = 0
+	}
+	s.mu.Unlock()
+
+	if credit > 0 {
+		s.mux.queueWindow(s.id, credit)
+	}
+}
+
+// Close tells the peer that no more messages will be sent on this
+// stream, once the messages that are being sent have been written.
+// Other calls to Send return ErrStreamClosed. Messages can still be
+// received until the peer closes its side as well
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	if s.localClosed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.localClosed = true
+	// Wake up the calls to Send that are waiting for credit, so that
+	// they see that the stream is closed
+	close(s.notify)
+	s.notify = make(chan struct{})
+	var idle chan struct{}
+	if s.sending > 0 {
+		idle = make(chan struct{})
+		s.idle = idle
+	}
+	s.mu.Unlock()
+
+	// No data frame can be started anymore, but the ones that are
+	// being written must reach the peer before the close frame
+	m := s.mux
+	if idle != nil {
+		select {
+		case <-m.done:
+			return ErrConnClosed
+		case <-idle:
+		}
+	}
+
+	// Write the window frames queued for the stream first, so that the
+	// peer does not receive them after the close frame
+	m.muControl.Lock()
+	defer m.muControl.Unlock()
+	m.muWindows.Lock()
+	credit, ok := m.windows[s.id]
+	delete(m.windows, s.id)
+	m.muWindows.Unlock()
+	if ok {
+		if err := m.writeFrame(context.Background(), s.id, muxWindow, int64(credit)); err != nil {
+			return err
+		}
+	}
+	if err := m.writeFrame(context.Background(), s.id, muxClose, nil); err != nil {
+		return err
+	}
+	m.forget(s)
+	return nil
+}
@@ -0,0 +1,79 @@
+package msgpack
+
+import "reflect"
+
+// isZeroer is implemented by types such as time.Time, whose zero values
+// cannot be told apart by comparing them with the zero value of the type
+type isZeroer interface {
+	IsZero() bool
+}
+
+var isZeroerType = reflect.TypeOf((*isZeroer)(nil)).Elem()
+
+// hasIsZero reports whether values of rt, or pointers to them, have an
+// IsZero method
+func hasIsZero(rt reflect.Type) bool {
+	return rt.Implements(isZeroerType) || reflect.PtrTo(rt).Implements(isZeroerType)
+}
+
+// isEmptyValue reports whether rv, the value of a struct field tagged
+// with omitempty, should be omitted: nil pointers, interfaces, maps and
+// slices are empty, as are values whose IsZero method (if isZero is set)
+// returns true, and zero values
+func isEmptyValue(rv reflect.Value, isZero bool) bool {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		if rv.IsNil() {
+			return true
+		}
+	}
+
+	if isZero {
+		// Calling the method through a pointer avoids copying the
+		// value to the heap
+		if rv.CanAddr() {
+			return rv.Addr().Interface().(isZeroer).IsZero()
+		}
+		if rv.Type().Implements(isZeroerType) {
+			return rv.Interface().(isZeroer).IsZero()
+		}
+	}
+	return isZeroValue(rv)
+}
+
+// isZeroValue reports whether rv is the zero value of its type. It
+// gives the same answer as comparing rv with the zero value using
+// reflect.DeepEqual, without allocating
+func isZeroValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		return rv.Complex() == 0
+	case reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return rv.IsNil()
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if !isZeroValue(rv.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if !isZeroValue(rv.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,455 @@
+package msgpack
+
+import "time"
+
+// defaultStructTags are the struct tags that are consulted for field
+// names. We support both msg and msgpack tags, the former is used by
+// tinylib/msgp, and the latter vmihailenco/msgpack
+var defaultStructTags = []string{`msgpack`, `msg`}
+
+// Options is a snapshot of the configuration of an Encoder or a
+// Decoder. Fields that only make sense for one of them are ignored
+// by the other.
+//
+// Options can be obtained from an existing Encoder or Decoder via
+// their Options method, and can be used to configure new ones via
+// WithOptionsFrom or WithOptions.
+type Options struct {
+	// StructTags is the list of struct tags that are consulted, in
+	// order, to determine the name of a struct field. The first tag
+	// that is present is used. If empty, "msgpack" and "msg" are used
+	StructTags []string
+
+	// ReadBufferSize is the size of the read buffer used by a Decoder.
+	// If zero, the default buffer size of bufio is used (Decoder only)
+	ReadBufferSize int
+
+	// MaxMessageBytes is the maximum number of bytes that a single call
+	// to Decode may consume. If zero, there is no limit (Decoder only)
+	MaxMessageBytes int64
+
+	// Allocator, if non-nil, allocates the byte slices that hold Bin
+	// and extension payloads of at least AllocatorThreshold bytes
+	// (Decoder only)
+	Allocator          func(n int) []byte
+	AllocatorThreshold int
+
+	// ExpectedSizes maps the paths of maps to the number of entries
+	// that they are expected to hold (Decoder only)
+	ExpectedSizes map[string]int
+
+	// Logger, if non-nil, receives diagnostic messages (Decoder only)
+	Logger Logger
+
+	// ResyncOnReservedCode makes the decoder skip the run of reserved
+	// 0xc1 bytes that it encounters (Decoder only)
+	ResyncOnReservedCode bool
+
+	// TruncateFloats makes floats that are decoded into integer types
+	// be truncated toward zero, instead of failing if they have a
+	// fractional part (Decoder only)
+	TruncateFloats bool
+
+	// StrictTypes makes values that would need a conversion to be
+	// stored in their target be an error (Decoder only)
+	StrictTypes bool
+
+	// InterfaceIntsAsInt64 makes integers decoded into interface{} be
+	// int64, whatever their width on the wire (Decoder only)
+	InterfaceIntsAsInt64 bool
+
+	// MaxDepth is the maximum number of arrays and maps that a value
+	// may be nested in. If zero, there is no limit (Decoder only)
+	MaxDepth int
+
+	// DisallowUnknownFields makes keys that do not match any field of
+	// the struct being decoded be an error (Decoder only)
+	DisallowUnknownFields bool
+
+	// EmptyAsNil makes *string and *time.Time struct fields treat empty
+	// strings and zero times as nil (Encoder and Decoder)
+	EmptyAsNil bool
+
+	// LegacyRaw makes strings and byte slices be written and read using
+	// the raw type of the msgpack specification from before 2013, which
+	// has no Str8 and no Bin family (Encoder and Decoder)
+	LegacyRaw bool
+
+	// NonStringMapKeys makes maps whose keys are not all strings be
+	// decoded as map[interface{}]interface{} when decoding into
+	// interface{}, instead of failing (Decoder only)
+	NonStringMapKeys bool
+
+	// MapsAsPairs makes maps and structs be written as arrays of
+	// [key, value] pairs, and such arrays be accepted when decoding
+	// into maps and structs (Encoder and Decoder)
+	MapsAsPairs bool
+
+	// SortMapKeys makes the keys of maps be written in sorted order, so
+	// that the output is deterministic (Encoder only)
+	SortMapKeys bool
+
+	// CompactInts makes integers be written in the smallest
+	// representation that holds their value, instead of using the
+	// width of their Go type (Encoder only)
+	CompactInts bool
+
+	// NilEmptyCollections makes empty (and nil) slices and maps be
+	// written as Nil (Encoder only)
+	NilEmptyCollections bool
+
+	// TimestampResolution, if positive, is the resolution that
+	// time.Time values are truncated to before being written (Encoder
+	// only)
+	TimestampResolution time.Duration
+
+	// TimeAsArray makes time.Time values be encoded as an array of
+	// seconds and nanoseconds, instead of using the timestamp extension
+	// (Encoder only)
+	TimeAsArray bool
+
+	// DurationAsSeconds makes time.Duration values be encoded as a float
+	// holding the number of seconds, instead of an integer holding the
+	// number of nanoseconds (Encoder only)
+	DurationAsSeconds bool
+
+	// ByteArrayAsArray makes fixed-size byte arrays ([N]byte) be
+	// encoded as an array of integers, instead of as Bin (Encoder only)
+	ByteArrayAsArray bool
+
+	// TruncateArrays allows the number of elements on the wire to
+	// differ from the length of the Go array that they are decoded
+	// into (Decoder only)
+	TruncateArrays bool
+
+	// RollbackBufferSize, if positive, is the number of bytes of each
+	// value that are held back until the value has been encoded in
+	// full, so that they can be dropped if it fails (Encoder only)
+	RollbackBufferSize int
+
+	// PoisonOnPartialValue makes a value that fails to be encoded after
+	// part of it was written fail the Encoder for good (Encoder only)
+	PoisonOnPartialValue bool
+
+	// AllowTrailingBytes makes Unmarshal ignore the bytes that follow
+	// the first complete value (Unmarshal only)
+	AllowTrailingBytes bool
+
+	// Profiler, if non-nil, records the types of the values that are
+	// encoded or decoded. It is shared, not copied, by clones of these
+	// Options
+	Profiler *Profiler
+}
+
+// Option configures an Encoder or a Decoder
+type Option func(*Options)
+
+// OptionsSource is implemented by Encoder and Decoder
+type OptionsSource interface {
+	Options() Options
+}
+
+// WithOptions replaces the whole configuration with opts. Options that
+// are specified after this one are applied on top of opts
+func WithOptions(opts Options) Option {
+	return func(o *Options) {
+		*o = opts.clone()
+	}
+}
+
+// WithOptionsFrom copies the configuration of an existing Encoder or
+// Decoder. Options that are specified after this one are applied on
+// top of the copied configuration, so a tuned base configuration can
+// be cloned with per-instance overrides:
+//
+//	enc := msgpack.NewEncoder(w, msgpack.WithOptionsFrom(base), msgpack.WithStructTags("json"))
+func WithOptionsFrom(src OptionsSource) Option {
+	return WithOptions(src.Options())
+}
+
+// WithStructTags specifies the struct tags that are consulted, in
+// order, to determine the name of a struct field
+func WithStructTags(tags ...string) Option {
+	return func(o *Options) {
+		o.StructTags = append([]string(nil), tags...)
+	}
+}
+
+// WithReadBufferSize specifies the size of the read buffer used by a
+// Decoder
+func WithReadBufferSize(n int) Option {
+	return func(o *Options) {
+		o.ReadBufferSize = n
+	}
+}
+
+// WithAllocator makes a Decoder call alloc to allocate the byte slices
+// that hold Bin payloads (decoded into []byte or interface{}) and
+// extension payloads (decoded into Value) of threshold bytes or more,
+// instead of using make. This gives applications that decode multi-MB
+// blobs control over where they live, such as in memory mapped files
+// or slabs. alloc must return a slice with a capacity of at least n.
+// The decoder does not keep a reference to the slice once the value
+// has been decoded, so releasing it is up to the application
+func WithAllocator(threshold int, alloc func(n int) []byte) Option {
+	return func(o *Options) {
+		o.Allocator = alloc
+		o.AllocatorThreshold = threshold
+	}
+}
+
+// WithExpectedSizes specifies how many entries the maps of a known
+// message shape are expected to hold, so that they can be allocated
+// with the right size upfront instead of growing as they are filled.
+// Paths are the keys (or struct field names) that lead to the map from
+// the top-level value, joined by dots, with arrays being transparent:
+//
+//	// {"headers": {...}, "items": [{"attrs": {...}}, ...]}
+//	msgpack.WithExpectedSizes(map[string]int{"headers": 16, "items.attrs": 4})
+//
+// The empty path refers to the top-level value. Maps are never
+// allocated for more entries than they hold on the wire. Slices do not
+// need hints, as they are always allocated with the length on the wire
+func WithExpectedSizes(sizes map[string]int) Option {
+	return func(o *Options) {
+		o.ExpectedSizes = make(map[string]int, len(sizes))
+		for path, n := range sizes {
+			o.ExpectedSizes[path] = n
+		}
+	}
+}
+
+// WithResyncOnReservedCode makes a Decoder that encounters the
+// reserved 0xc1 byte also skip the run of 0xc1 bytes that follows it,
+// such as padding left by a faulty writer. Decode still returns a
+// *ReservedCodeError, but the next call to Decode starts right after
+// the reserved bytes, instead of failing on the next one
+func WithResyncOnReservedCode() Option {
+	return func(o *Options) {
+		o.ResyncOnReservedCode = true
+	}
+}
+
+// WithTruncateFloats makes a Decoder truncate floats that are decoded
+// into integer types toward zero, like a Go conversion does, so that
+// 3.7 is decoded as 3 and -3.7 as -3. By default such values cause a
+// *LossyConversionError. Floats that are out of range for the integer
+// type, and NaNs, are rejected either way
+func WithTruncateFloats() Option {
+	return func(o *Options) {
+		o.TruncateFloats = true
+	}
+}
+
+// WithStrictTypes makes a Decoder refuse to convert values between
+// types when storing them: floats are not decoded into integers, nor
+// integers into floats or strings, and integers that do not fit in
+// their target, such as 300 into an int8 or -1 into a uint, are
+// rejected instead of wrapping around. Such values cause a
+// *StrictTypeError. Named types are still accepted for values of their
+// underlying kind, and anything can be decoded into interface{}
+func WithStrictTypes() Option {
+	return func(o *Options) {
+		o.StrictTypes = true
+	}
+}
+
+// WithInterfaceIntsAsInt64 makes a Decoder store integers that are
+// decoded into interface{} as int64, instead of using the Go type that
+// matches their representation on the wire (int8 for FixNum, uint16
+// for Uint16, and so on). This saves type switches over every integer
+// type in code that inspects decoded maps and slices. Uint64 values
+// that are larger than math.MaxInt64 are still stored as uint64
+func WithInterfaceIntsAsInt64() Option {
+	return func(o *Options) {
+		o.InterfaceIntsAsInt64 = true
+	}
+}
+
+// WithDisallowUnknownFields makes a Decoder return an
+// *UnknownFieldError when a map that is decoded into a struct has a key
+// that does not match any of the struct fields, like the method of the
+// same name of encoding/json. Structs implementing MsgpackFieldSetter
+// still receive their unknown fields instead
+func WithDisallowUnknownFields() Option {
+	return func(o *Options) {
+		o.DisallowUnknownFields = true
+	}
+}
+
+// WithEmptyAsNil applies the emptyasnil struct tag option to all
+// *string and *time.Time struct fields: when decoding, an empty string
+// or a zero time is stored as nil (an empty string is also accepted for
+// times), and when encoding, a nil pointer is written as an empty
+// string or a zero time. This helps talking to producers that send empty strings where
+// Go code expects nil
+func WithEmptyAsNil() Option {
+	return func(o *Options) {
+		o.EmptyAsNil = true
+	}
+}
+
+// WithLegacyRaw makes an Encoder or a Decoder speak the msgpack
+// specification from before 2013, for peers such as old PHP or Ruby
+// implementations that do not know about the Str8 and Bin codes. Strings
+// and byte slices are both written as raw (FixStr, Str16 and Str32), and
+// when decoding, Bin values are read as strings when decoding into
+// interface{}, and raw values may be decoded into byte slices.
+// Extension types, including timestamps, are not affected
+func WithLegacyRaw() Option {
+	return func(o *Options) {
+		o.LegacyRaw = true
+	}
+}
+
+// WithNonStringMapKeys makes a Decoder accept maps with keys that are
+// not strings, such as those written by Python or Ruby, when decoding
+// into interface{}. Maps whose keys are all strings are still decoded
+// as map[string]interface{}, and other maps as
+// map[interface{}]interface{}, with Bin keys converted to strings.
+// Decoding into a typed map, such as map[int]string, does not need
+// this option
+func WithNonStringMapKeys() Option {
+	return func(o *Options) {
+		o.NonStringMapKeys = true
+	}
+}
+
+// WithMapsAsPairs makes an Encoder or a Decoder speak the
+// representation of maps used by some producers, where a map is an
+// array of [key, value] pairs:
+//
+//	{"a": 1, "b": 2} <=> [["a", 1], ["b", 2]]
+//
+// Encoders write Go maps and structs as arrays of pairs. Decoders accept
+// both arrays of pairs and regular maps when decoding into maps and
+// structs, but decoding into interface{} still yields an array. The
+// pairs struct tag option does the same for a single field and the
+// values within it
+func WithMapsAsPairs() Option {
+	return func(o *Options) {
+		o.MapsAsPairs = true
+	}
+}
+
+// WithSortedMapKeys makes an Encoder write the keys of maps in sorted
+// order, instead of in the random order of Go map iteration, so that
+// encoding the same map always produces the same bytes. Strings are
+// sorted byte-wise, numbers by value and booleans false first. Keys of
+// other types, such as interfaces holding mixed types, are sorted by
+// their %#v representation. Struct fields are written in declaration
+// order either way. See also CanonicalizeStruct
+func WithSortedMapKeys() Option {
+	return func(o *Options) {
+		o.SortMapKeys = true
+	}
+}
+
+// WithCompactInts makes an Encoder write integers of any Go type in the
+// smallest representation that holds their value, like
+// EncodeCompactInt and EncodeCompactUint do, so that int64(1) takes one
+// byte instead of nine. Signed types stay in the int family, so that
+// they can be decoded back into signed types
+func WithCompactInts() Option {
+	return func(o *Options) {
+		o.CompactInts = true
+	}
+}
+
+// WithNilEmptyCollections makes an Encoder write empty slices and maps,
+// including nil ones, as Nil instead of as empty arrays and maps, for
+// peers that expect a missing value rather than an empty collection.
+// Byte slices are not affected
+func WithNilEmptyCollections() Option {
+	return func(o *Options) {
+		o.NilEmptyCollections = true
+	}
+}
+
+// WithTimestampResolution makes an Encoder truncate time.Time values to
+// a multiple of d before writing them. With a resolution of a second,
+// times use the 4 byte form of the timestamp extension instead of the 8
+// byte form, and peers that cannot store nanoseconds receive what they
+// can represent
+func WithTimestampResolution(d time.Duration) Option {
+	return func(o *Options) {
+		o.TimestampResolution = d
+	}
+}
+
+// WithTimeAsArray makes an Encoder write time.Time values as an array
+// of two integers (seconds and nanoseconds), which is how versions of
+// this package before the timestamp extension was supported encoded
+// them. Decoders accept both forms
+func WithTimeAsArray() Option {
+	return func(o *Options) {
+		o.TimeAsArray = true
+	}
+}
+
+// WithDurationAsSeconds makes an Encoder write time.Duration values as
+// a float holding the number of seconds, for peers such as Python
+// programs that expect timedelta.total_seconds(). Decoders accept both
+// forms
+func WithDurationAsSeconds() Option {
+	return func(o *Options) {
+		o.DurationAsSeconds = true
+	}
+}
+
+// WithByteArrayAsArray makes an Encoder write fixed-size byte arrays,
+// such as [16]byte UUIDs or [32]byte hashes, as an array of integers,
+// one per byte, instead of as a single Bin value. Decoders accept both
+// forms
+func WithByteArrayAsArray() Option {
+	return func(o *Options) {
+		o.ByteArrayAsArray = true
+	}
+}
+
+// WithTruncateArrays makes a Decoder accept arrays whose length does
+// not match the length of the Go array ([N]T) that they are decoded
+// into: extra elements are skipped, and missing elements are left as
+// zero values. Without this option, such arrays are an error
+func WithTruncateArrays() Option {
+	return func(o *Options) {
+		o.TruncateArrays = true
+	}
+}
+
+// WithAllowTrailingBytes makes Unmarshal ignore the bytes that follow
+// the first complete value, instead of returning a *TrailingBytesError
+func WithAllowTrailingBytes() Option {
+	return func(o *Options) {
+		o.AllowTrailingBytes = true
+	}
+}
+
+func newOptions(options []Option) Options {
+	// Avoid the allocation caused by &o escaping in the common case
+	if len(options) == 0 {
+		return Options{}
+	}
+
+	var o Options
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// clone returns a deep copy of o, so that snapshots handed out by
+// Options methods cannot be used to modify a live Encoder/Decoder
+func (o Options) clone() Options {
+	if o.StructTags != nil {
+		o.StructTags = append([]string(nil), o.StructTags...)
+	}
+	if o.ExpectedSizes != nil {
+		sizes := make(map[string]int, len(o.ExpectedSizes))
+		for path, n := range o.ExpectedSizes {
+			sizes[path] = n
+		}
+		o.ExpectedSizes = sizes
+	}
+	return o
+}
@@ -0,0 +1,85 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type jsonTaggedStruct struct {
+	Name  string `json:"name" msgpack:"msgpack_name"`
+	Count int64  `json:"count"`
+}
+
+func TestOptions(t *testing.T) {
+	t.Run("snapshot", func(t *testing.T) {
+		enc := msgpack.NewEncoder(&bytes.Buffer{}, msgpack.WithStructTags("json", "msgpack"))
+		opts := enc.Options()
+		if !assert.Equal(t, []string{"json", "msgpack"}, opts.StructTags, "StructTags should match") {
+			return
+		}
+
+		// Modifying the snapshot must not affect the encoder
+		opts.StructTags[0] = "foo"
+		if !assert.Equal(t, []string{"json", "msgpack"}, enc.Options().StructTags, "snapshot should be a copy") {
+			return
+		}
+	})
+	t.Run("WithOptionsFrom", func(t *testing.T) {
+		base := msgpack.NewDecoder(&bytes.Buffer{}, msgpack.WithStructTags("json"), msgpack.WithReadBufferSize(128))
+
+		derived := msgpack.NewDecoder(&bytes.Buffer{}, msgpack.WithOptionsFrom(base), msgpack.WithReadBufferSize(256))
+		if !assert.Equal(t, msgpack.Options{StructTags: []string{"json"}, ReadBufferSize: 256}, derived.Options(), "options should be inherited and overridden") {
+			return
+		}
+		if !assert.Equal(t, 128, base.Options().ReadBufferSize, "base should be untouched") {
+			return
+		}
+
+		// Encoder configuration can be copied from a decoder, and vice versa
+		enc := msgpack.NewEncoder(&bytes.Buffer{}, msgpack.WithOptionsFrom(base))
+		if !assert.Equal(t, []string{"json"}, enc.Options().StructTags, "options should be inherited") {
+			return
+		}
+	})
+	t.Run("struct tags", func(t *testing.T) {
+		v := jsonTaggedStruct{Name: "foo", Count: 100}
+
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf, msgpack.WithStructTags("json")).Encode(v), "Encode should succeed") {
+			return
+		}
+
+		var m map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &m), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, map[string]interface{}{"name": "foo", "count": int64(100)}, m, "keys should use json tags") {
+			return
+		}
+
+		var decoded jsonTaggedStruct
+		if !assert.NoError(t, msgpack.NewDecoder(&buf, msgpack.WithStructTags("json")).Decode(&decoded), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, v, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("default struct tags", func(t *testing.T) {
+		b, err := msgpack.Marshal(jsonTaggedStruct{Name: "foo", Count: 100})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var m map[string]interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &m), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, map[string]interface{}{"msgpack_name": "foo", "Count": int64(100)}, m, "keys should use msgpack tags") {
+			return
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package msgpack
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// writeMapHeader writes the header of a map of n entries, or of an
+// array of n pairs if the Encoder was created with WithMapsAsPairs. Each
+// entry must then be preceded by a call to writePairHeader
+func (e *Encoder) writeMapHeader(n int) error {
+	if e.options.MapsAsPairs {
+		return e.EncodeArrayHeader(n)
+	}
+	return WriteMapHeader(e.dst, n)
+}
+
+// writePairHeader writes the header of the [key, value] array that
+// holds a map entry, if the Encoder was created with WithMapsAsPairs
+func (e *Encoder) writePairHeader() error {
+	if !e.options.MapsAsPairs {
+		return nil
+	}
+	if err := e.dst.WriteByte(FixArray0.Byte() + byte(2)); err != nil {
+		return errors.Wrap(err, `msgpack: failed to write pair header`)
+	}
+	return nil
+}
+
+// encodeAsPairs encodes rv, the value of a struct field tagged with
+// pairs, with the maps within it written as arrays of pairs
+func (e *Encoder) encodeAsPairs(rv reflect.Value) error {
+	saved := e.options.MapsAsPairs
+	e.options.MapsAsPairs = true
+	defer func() { e.options.MapsAsPairs = saved }()
+	return e.encodeStructField(rv)
+}
+
+// decodeMapOrPairsLength reads the header of the next value that is
+// decoded into a map or a struct. If the Decoder was created with
+// WithMapsAsPairs, an array of [key, value] pairs is accepted as well
+// as a map, and pairs reports which of the two was read. Nil is
+// reported as -1, as with DecodeMapLength
+func (d *Decoder) decodeMapOrPairsLength() (size int, pairs bool, err error) {
+	if d.options.MapsAsPairs {
+		code, err := d.PeekCode()
+		if err != nil {
+			return 0, false, errors.Wrap(err, `msgpack: failed to read code`)
+		}
+		if IsArrayFamily(code) {
+			if err := d.DecodeArrayLength(&size); err != nil {
+				return 0, false, err
+			}
+			return size, true, nil
+		}
+	}
+
+	if err := d.DecodeMapLength(&size); err != nil {
+		return 0, false, err
+	}
+	return size, false, nil
+}
+
+// decodePairHeader reads the header of the [key, value] array that
+// holds a map entry, which must have exactly two elements
+func (d *Decoder) decodePairHeader() error {
+	var l int
+	if err := d.DecodeArrayLength(&l); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode pair header`)
+	}
+	if l != 2 {
+		return errors.Errorf(`msgpack: expected pair of size 2 (got %d)`, l)
+	}
+	return nil
+}
+
+// decodeAsPairs decodes the next value into f, a struct field tagged
+// with pairs, accepting arrays of pairs in place of the maps within it.
+// f must be addressable
+func (d *Decoder) decodeAsPairs(f reflect.Value) error {
+	saved := d.options.MapsAsPairs
+	d.options.MapsAsPairs = true
+	defer func() { d.options.MapsAsPairs = saved }()
+
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		return d.Decode(f.Interface())
+	}
+	return d.Decode(f.Addr().Interface())
+}
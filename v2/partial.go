@@ -0,0 +1,237 @@
+package msgpack
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStreamPoisoned is the cause of the errors returned by an Encoder
+// created with WithPoisonOnPartialValue, once a value failed to be
+// encoded after part of it was written. The destination then holds an
+// incomplete value, and anything written after it would be misread by
+// the peer
+var ErrStreamPoisoned = errors.New(`msgpack: stream poisoned`)
+
+// WithRollbackBuffer makes an Encoder hold back the output of each
+// call to Encode, up to n bytes, until the value has been encoded in
+// full, so that nothing is written if it fails: typically, because an
+// EncodeMsgpack method returned an error after writing part of its
+// output. The bytes of values that do not fit are written as they are
+// produced, as they would be without a buffer, so that the memory used
+// by the Encoder stays bounded. See also WithPoisonOnPartialValue
+func WithRollbackBuffer(n int) Option {
+	return func(o *Options) {
+		o.RollbackBufferSize = n
+	}
+}
+
+// WithPoisonOnPartialValue makes an Encoder fail all further writes
+// once a call to Encode failed after part of the value reached the
+// destination, instead of letting the stream go on with an incomplete
+// value in it. The errors have ErrStreamPoisoned as their cause. Reset
+// makes the Encoder usable again
+func WithPoisonOnPartialValue() Option {
+	return func(o *Options) {
+		o.PoisonOnPartialValue = true
+	}
+}
+
+// Err returns the reason why the Encoder was poisoned, or nil. See
+// WithPoisonOnPartialValue
+func (e *Encoder) Err() error {
+	return e.poisoned
+}
+
+// encodeGuarded encodes v through a rollbackWriter, according to
+// WithRollbackBuffer and WithPoisonOnPartialValue. Nested values are
+// part of v, and are not guarded on their own
+func (e *Encoder) encodeGuarded(v interface{}) error {
+	if e.poisoned != nil {
+		return e.poisoned
+	}
+
+	if e.rollback == nil {
+		e.rollback = &rollbackWriter{}
+	}
+	w := e.rollback
+	dst := e.dst
+	w.reset(dst, e.options.RollbackBufferSize)
+
+	e.dst = w
+	e.guarding = true
+	err := e.Encode(v)
+	e.guarding = false
+	e.dst = dst
+
+	if err == nil {
+		err = w.flush()
+	}
+	// Whatever is still buffered is dropped
+	w.buf = w.buf[:0]
+	if err != nil && w.written > 0 && e.options.PoisonOnPartialValue {
+		e.poisoned = errors.Wrapf(ErrStreamPoisoned, `msgpack: failed to encode %T after writing %d bytes (%s)`, v, w.written, err)
+		e.dst = poisonedWriter{err: e.poisoned}
+		return e.poisoned
+	}
+	return err
+}
+
+// rollbackWriter holds the output of a value, until it is complete or
+// until there is more than limit bytes of it. It then writes through to
+// dst, counting the bytes written
+type rollbackWriter struct {
+	dst         Writer
+	limit       int
+	buf         []byte
+	passthrough bool
+	written     int
+	scratch     [9]byte
+}
+
+func (w *rollbackWriter) reset(dst Writer, limit int) {
+	w.dst = dst
+	w.limit = limit
+	w.buf = w.buf[:0]
+	w.passthrough = false
+	w.written = 0
+}
+
+func (w *rollbackWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	n, err := w.dst.Write(w.buf)
+	w.written += n
+	w.buf = w.buf[:0]
+	return err
+}
+
+func (w *rollbackWriter) Write(p []byte) (int, error) {
+	if !w.passthrough {
+		if len(w.buf)+len(p) <= w.limit {
+			w.buf = append(w.buf, p...)
+			return len(p), nil
+		}
+		w.passthrough = true
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.dst.Write(p)
+	w.written += n
+	return n, err
+}
+
+func (w *rollbackWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *rollbackWriter) WriteByte(v byte) error {
+	w.scratch[0] = v
+	_, err := w.Write(w.scratch[:1])
+	return err
+}
+
+func (w *rollbackWriter) WriteUint8(v uint8) error {
+	return w.WriteByte(byte(v))
+}
+
+func (w *rollbackWriter) WriteUint16(v uint16) error {
+	binary.BigEndian.PutUint16(w.scratch[:2], v)
+	_, err := w.Write(w.scratch[:2])
+	return err
+}
+
+func (w *rollbackWriter) WriteUint32(v uint32) error {
+	binary.BigEndian.PutUint32(w.scratch[:4], v)
+	_, err := w.Write(w.scratch[:4])
+	return err
+}
+
+func (w *rollbackWriter) WriteUint64(v uint64) error {
+	binary.BigEndian.PutUint64(w.scratch[:8], v)
+	_, err := w.Write(w.scratch[:8])
+	return err
+}
+
+func (w *rollbackWriter) WriteByteUint8(b byte, v uint8) error {
+	w.scratch[0] = b
+	w.scratch[1] = byte(v)
+	_, err := w.Write(w.scratch[:2])
+	return err
+}
+
+func (w *rollbackWriter) WriteByteUint16(b byte, v uint16) error {
+	w.scratch[0] = b
+	binary.BigEndian.PutUint16(w.scratch[1:3], v)
+	_, err := w.Write(w.scratch[:3])
+	return err
+}
+
+func (w *rollbackWriter) WriteByteUint32(b byte, v uint32) error {
+	w.scratch[0] = b
+	binary.BigEndian.PutUint32(w.scratch[1:5], v)
+	_, err := w.Write(w.scratch[:5])
+	return err
+}
+
+func (w *rollbackWriter) WriteByteUint64(b byte, v uint64) error {
+	w.scratch[0] = b
+	binary.BigEndian.PutUint64(w.scratch[1:9], v)
+	_, err := w.Write(w.scratch[:9])
+	return err
+}
+
+// poisonedWriter replaces the destination of a poisoned Encoder, so
+// that writing to it fails, including through the low level methods
+type poisonedWriter struct {
+	err error
+}
+
+func (w poisonedWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func (w poisonedWriter) WriteString(string) (int, error) {
+	return 0, w.err
+}
+
+func (w poisonedWriter) WriteByte(byte) error {
+	return w.err
+}
+
+func (w poisonedWriter) WriteUint8(uint8) error {
+	return w.err
+}
+
+func (w poisonedWriter) WriteUint16(uint16) error {
+	return w.err
+}
+
+func (w poisonedWriter) WriteUint32(uint32) error {
+	return w.err
+}
+
+func (w poisonedWriter) WriteUint64(uint64) error {
+	return w.err
+}
+
+func (w poisonedWriter) WriteByteUint8(byte, uint8) error {
+	return w.err
+}
+
+func (w poisonedWriter) WriteByteUint16(byte, uint16) error {
+	return w.err
+}
+
+func (w poisonedWriter) WriteByteUint32(byte, uint32) error {
+	return w.err
+}
+
+func (w poisonedWriter) WriteByteUint64(byte, uint64) error {
+	return w.err
+}
+
+var _ Writer = &rollbackWriter{}
+var _ Writer = poisonedWriter{}
@@ -0,0 +1,67 @@
+package msgpack
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+var decoderPool = sync.Pool{
+	New: func() interface{} {
+		return NewDecoder(nil)
+	},
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return NewEncoder(nil)
+	},
+}
+
+// GetDecoder returns a Decoder that reads from r, configured with the
+// given options, like NewDecoder does. The Decoder is taken from a
+// pool, so that its read buffer is reused: use it for per-request
+// decoding, where allocating a new buffer for every request shows up
+// in profiles.
+//
+// Return the Decoder with PutDecoder once done with it
+func GetDecoder(r io.Reader, options ...Option) *Decoder {
+	d := decoderPool.Get().(*Decoder)
+	d.options = newOptions(options)
+	if size := d.options.ReadBufferSize; size > 0 && size != d.raw.Size() {
+		d.raw = bufio.NewReaderSize(d.counter, size)
+		d.src = newReader(d.raw)
+	}
+	d.Reset(r)
+	return d
+}
+
+// PutDecoder returns d, which must have been obtained via GetDecoder,
+// to the pool. d must not be used afterwards
+func PutDecoder(d *Decoder) {
+	// Drop the references to the source and the options
+	d.Reset(nil)
+	d.options = Options{}
+	decoderPool.Put(d)
+}
+
+// GetEncoder returns an Encoder that writes to w, configured with the
+// given options, like NewEncoder does. The Encoder is taken from a
+// pool.
+//
+// Return the Encoder with PutEncoder once done with it
+func GetEncoder(w io.Writer, options ...Option) *Encoder {
+	e := encoderPool.Get().(*Encoder)
+	e.options = newOptions(options)
+	e.Reset(w)
+	return e
+}
+
+// PutEncoder returns e, which must have been obtained via GetEncoder,
+// to the pool. e must not be used afterwards
+func PutEncoder(e *Encoder) {
+	// Drop the references to the destination and the options
+	e.Reset(nil)
+	e.options = Options{}
+	encoderPool.Put(e)
+}
@@ -0,0 +1,76 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeRaw(t *testing.T) {
+	t.Run("wrap fragments", func(t *testing.T) {
+		msgs := make([][]byte, 0, 3)
+		for _, v := range []interface{}{"foo", map[string]interface{}{"bar": int8(1)}, []interface{}{true, nil}} {
+			b, err := msgpack.Marshal(v)
+			if !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+			msgs = append(msgs, b)
+		}
+
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		if !assert.NoError(t, enc.EncodeArrayHeader(len(msgs)), "EncodeArrayHeader should succeed") {
+			return
+		}
+		for _, msg := range msgs {
+			if !assert.NoError(t, enc.EncodeRaw(msg), "EncodeRaw should succeed") {
+				return
+			}
+		}
+
+		var decoded []interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &decoded), "Unmarshal should succeed") {
+			return
+		}
+		expected := []interface{}{"foo", map[string]interface{}{"bar": int8(1)}, []interface{}{true, nil}}
+		if !assert.Equal(t, expected, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("invalid fragments", func(t *testing.T) {
+		inputs := map[string][]byte{
+			"empty":     {},
+			"truncated": {msgpack.FixArray2.Byte(), 0x01},
+			"payload":   {msgpack.Str8.Byte(), 5, 'f', 'o'},
+			"trailing":  {0x01, 0x02},
+			"reserved":  {0xc1},
+		}
+		for name, b := range inputs {
+			var buf bytes.Buffer
+			if !assert.Error(t, msgpack.NewEncoder(&buf).EncodeRaw(b), "EncodeRaw should fail for %s fragments", name) {
+				return
+			}
+			if !assert.Equal(t, 0, buf.Len(), "nothing should be written for %s fragments", name) {
+				return
+			}
+		}
+
+		var buf bytes.Buffer
+		_, ok := errors.Cause(msgpack.NewEncoder(&buf).EncodeRaw([]byte{0x01, 0x02})).(*msgpack.TrailingBytesError)
+		if !assert.True(t, ok, "error should be a TrailingBytesError") {
+			return
+		}
+	})
+	t.Run("trusted", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, msgpack.NewEncoder(&buf).EncodeRawTrusted([]byte{0x01, 0x02}), "EncodeRawTrusted should not check its input") {
+			return
+		}
+		if !assert.Equal(t, []byte{0x01, 0x02}, buf.Bytes(), "output should match") {
+			return
+		}
+	})
+}
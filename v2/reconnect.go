@@ -0,0 +1,463 @@
+package msgpack
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSendBufferFull is returned from ReconnectingConn.Send when the
+// connection is down, and the buffer for unsent messages is full
+var ErrSendBufferFull = errors.New(`msgpack: send buffer full`)
+
+// DialFunc establishes a new connection for a ReconnectingConn
+type DialFunc func(ctx context.Context) (io.ReadWriteCloser, error)
+
+// ReconnectingConn is a client side Conn that transparently
+// re-establishes the connection when it is lost, backing off
+// exponentially between dial attempts.
+//
+// Messages passed to Send while the connection is down (including
+// before it is first established) are buffered, and sent in order
+// once it is back up. Messages that were being written when the
+// connection broke are sent again, so the peer may see a message more
+// than once.
+//
+// Like Conn, ReconnectingConn is safe to use from multiple goroutines.
+type ReconnectingConn struct {
+	dial        DialFunc
+	initial     time.Duration
+	max         time.Duration
+	maxAttempts int
+	maxPending  int
+	resume      func(context.Context, *Conn) error
+	deadLetter  func([]byte, error)
+	connOptions []ConnOption
+	clock       Clock
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// wsem guards pending, and serializes sends with flushing the
+	// pending messages, so that messages are written in order
+	wsem    chan struct{}
+	pending [][]byte
+
+	// mu guards conn, err, draining, and changed. changed is closed
+	// (and replaced) whenever conn changes
+	mu       sync.Mutex
+	conn     *Conn
+	err      error
+	draining bool
+	changed  chan struct{}
+
+	closeOnce sync.Once
+}
+
+// ReconnectOption is an option that can be passed to
+// NewReconnectingConn
+type ReconnectOption func(*ReconnectingConn)
+
+// WithReconnectBackoff specifies the delay before the first redial,
+// and the maximum delay between attempts. The delay doubles after each
+// failed attempt, and is reset once a connection is established. The
+// defaults are 100ms and 30s
+func WithReconnectBackoff(initial, max time.Duration) ReconnectOption {
+	return func(r *ReconnectingConn) {
+		r.initial = initial
+		r.max = max
+	}
+}
+
+// WithMaxDialAttempts specifies how many consecutive dial attempts may
+// fail before ReconnectingConn gives up. Once it does, Send and Recv
+// return the last dial error. The default is 0, which means to retry
+// forever
+func WithMaxDialAttempts(n int) ReconnectOption {
+	return func(r *ReconnectingConn) {
+		r.maxAttempts = n
+	}
+}
+
+// WithSendBuffer specifies how many unsent messages are buffered while
+// the connection is down. The default is 64
+func WithSendBuffer(n int) ReconnectOption {
+	return func(r *ReconnectingConn) {
+		r.maxPending = n
+	}
+}
+
+// WithResumeFunc specifies a function that is called every time the
+// connection is re-established, before the buffered messages are
+// sent. It can be used to send a resume token to the peer, so that it
+// can restore the session. If the function returns an error, the
+// connection is dropped and dialed again
+func WithResumeFunc(fn func(ctx context.Context, conn *Conn) error) ReconnectOption {
+	return func(r *ReconnectingConn) {
+		r.resume = fn
+	}
+}
+
+// WithDeadLetter specifies a function that is called with each
+// message that is dropped, along with the reason: because the send
+// buffer was full, or because the ReconnectingConn was closed (or gave
+// up dialing) before the message could be sent. It allows operators to
+// persist undeliverable messages instead of losing them.
+//
+// Like RetryWriter's drop handler, when a dead letter function is
+// given, Send hands messages that do not fit in the buffer over to it,
+// and reports success
+func WithDeadLetter(fn func(msg []byte, err error)) ReconnectOption {
+	return func(r *ReconnectingConn) {
+		r.deadLetter = fn
+	}
+}
+
+// WithConnOptions specifies the options used to create the Conn for
+// each connection
+func WithConnOptions(options ...ConnOption) ReconnectOption {
+	return func(r *ReconnectingConn) {
+		r.connOptions = options
+	}
+}
+
+// WithReconnectClock specifies the Clock used to back off between
+// dial attempts. It is also used by each Conn, unless WithConnOptions
+// specifies otherwise. The default is SystemClock
+func WithReconnectClock(clock Clock) ReconnectOption {
+	return func(r *ReconnectingConn) {
+		r.clock = clock
+	}
+}
+
+// NewReconnectingConn creates a new ReconnectingConn, and starts the
+// goroutine that establishes (and re-establishes) the connection
+// using dial.
+func NewReconnectingConn(dial DialFunc, options ...ReconnectOption) *ReconnectingConn {
+	r := &ReconnectingConn{
+		dial:       dial,
+		initial:    100 * time.Millisecond,
+		max:        30 * time.Second,
+		maxPending: 64,
+		wsem:       make(chan struct{}, 1),
+		changed:    make(chan struct{}),
+		clock:      SystemClock,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	r.connOptions = append([]ConnOption{WithConnClock(r.clock)}, r.connOptions...)
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	go r.run()
+	return r
+}
+
+func (r *ReconnectingConn) run() {
+	for reconnect := false; ; reconnect = true {
+		conn, err := r.connect(reconnect)
+		if err != nil {
+			r.setConn(nil, err)
+			return
+		}
+
+		select {
+		case <-r.ctx.Done():
+			conn.Close()
+			return
+		case <-conn.readDone:
+		}
+
+		r.setConn(nil, nil)
+		// Only close the underlying connection, so that messages that
+		// have already been read can still be received from conn
+		if closer, ok := conn.rw.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// connect dials until a connection is established, and flushes the
+// pending messages
+func (r *ReconnectingConn) connect(reconnect bool) (*Conn, error) {
+	delay := r.initial
+	for attempt := 1; ; attempt++ {
+		conn, err := r.tryConnect(reconnect)
+		if err == nil {
+			return conn, nil
+		}
+		if r.ctx.Err() != nil {
+			return nil, ErrConnClosed
+		}
+		if r.maxAttempts > 0 && attempt >= r.maxAttempts {
+			return nil, err
+		}
+
+		t := r.clock.NewTimer(delay)
+		select {
+		case <-r.ctx.Done():
+			t.Stop()
+			return nil, ErrConnClosed
+		case <-t.C():
+		}
+
+		delay *= 2
+		if delay > r.max {
+			delay = r.max
+		}
+		reconnect = true
+	}
+}
+
+func (r *ReconnectingConn) tryConnect(reconnect bool) (*Conn, error) {
+	rw, err := r.dial(r.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to dial`)
+	}
+	conn := NewConn(rw, r.connOptions...)
+
+	if reconnect && r.resume != nil {
+		if err := r.resume(r.ctx, conn); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, `msgpack: failed to resume`)
+		}
+	}
+
+	select {
+	case <-r.ctx.Done():
+		conn.Close()
+		return nil, ErrConnClosed
+	case r.wsem <- struct{}{}:
+	}
+	defer func() { <-r.wsem }()
+
+	// Writes are not aware of contexts, so close the connection to
+	// unblock them if we are closed while flushing
+	flushed := make(chan struct{})
+	defer close(flushed)
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			conn.Close()
+		case <-flushed:
+		}
+	}()
+
+	for len(r.pending) > 0 {
+		if err := conn.sendEncoded(r.ctx, r.pending[0]); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, `msgpack: failed to send buffered message`)
+		}
+		r.pending = r.pending[1:]
+	}
+
+	// Publish the connection while still holding wsem, so that no
+	// Send can slip in before the pending messages
+	r.setConn(conn, nil)
+	return conn, nil
+}
+
+func (r *ReconnectingConn) setConn(conn *Conn, err error) {
+	r.mu.Lock()
+	r.conn = conn
+	if err != nil {
+		r.err = err
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+	r.mu.Unlock()
+}
+
+func (r *ReconnectingConn) current() (*Conn, chan struct{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn, r.changed, r.err
+}
+
+// Send encodes v, and sends it over the current connection. If the
+// connection is down, the message is buffered, and sent once the
+// connection is re-established. ErrSendBufferFull is returned if
+// there is no room left in the buffer
+func (r *ReconnectingConn) Send(ctx context.Context, v interface{}) error {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode message`)
+	}
+
+	select {
+	case <-r.ctx.Done():
+		return ErrConnClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case r.wsem <- struct{}{}:
+	}
+	defer func() { <-r.wsem }()
+
+	conn, _, err := r.current()
+	if err != nil {
+		return err
+	}
+	if r.isDraining() {
+		return ErrConnClosed
+	}
+
+	if conn != nil {
+		err := conn.sendEncoded(ctx, buf.Bytes())
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if r.ctx.Err() != nil {
+			return ErrConnClosed
+		}
+
+		// The connection is broken. Close it so that the read loop
+		// notices, and keep the message for the next connection
+		if closer, ok := conn.rw.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+
+	if len(r.pending) >= r.maxPending {
+		if r.deadLetter != nil {
+			r.deadLetter(buf.Bytes(), ErrSendBufferFull)
+			return nil
+		}
+		return ErrSendBufferFull
+	}
+	r.pending = append(r.pending, buf.Bytes())
+	return nil
+}
+
+// Recv waits for the next message, and decodes it into v. If the
+// connection is lost, Recv waits for it to be re-established
+func (r *ReconnectingConn) Recv(ctx context.Context, v interface{}) error {
+	for {
+		conn, changed, err := r.current()
+		if err != nil {
+			return err
+		}
+
+		if conn != nil {
+			err := conn.Recv(ctx, v)
+			if err == nil || ctx.Err() != nil || conn.Err() == nil {
+				return err
+			}
+			if r.ctx.Err() != nil {
+				return ErrConnClosed
+			}
+
+			// The connection was lost. Wait for it to be replaced
+			r.mu.Lock()
+			if r.conn == conn {
+				changed = r.changed
+			} else {
+				changed = nil
+			}
+			r.mu.Unlock()
+			if changed == nil {
+				continue
+			}
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return ErrConnClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (r *ReconnectingConn) isDraining() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.draining
+}
+
+// Shutdown gracefully stops the ReconnectingConn. New calls to Send
+// are rejected, and Shutdown waits until the buffered messages have
+// been sent (which may require the connection to be re-established),
+// before calling Close. If the context is cancelled first, or the
+// connection cannot be re-established, the messages that are still
+// buffered are dropped.
+//
+// Shutdown returns the number of dropped messages, and ctx.Err() if
+// the context was cancelled before all messages were sent
+func (r *ReconnectingConn) Shutdown(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	r.draining = true
+	r.mu.Unlock()
+
+	var err error
+	for err == nil {
+		var pending int
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			continue
+		case r.wsem <- struct{}{}:
+			pending = len(r.pending)
+			<-r.wsem
+		}
+
+		_, changed, connErr := r.current()
+		if pending == 0 || connErr != nil || r.ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-r.ctx.Done():
+		case <-changed:
+		}
+	}
+
+	reason := err
+	if reason == nil {
+		reason = ErrConnClosed
+	}
+	return r.close(reason), err
+}
+
+// Close stops reconnecting, and closes the current connection.
+// Buffered messages that have not been sent yet are dropped (see
+// WithDeadLetter). Use Shutdown to send them first
+func (r *ReconnectingConn) Close() error {
+	r.close(ErrConnClosed)
+	return nil
+}
+
+// close stops the ReconnectingConn, and drops the pending messages
+// with the given reason, unless dialing failed for good, in which case
+// the dial error is reported instead. It returns the number of dropped
+// messages
+func (r *ReconnectingConn) close(reason error) int {
+	var dropped int
+	r.closeOnce.Do(func() {
+		r.cancel()
+
+		if _, _, err := r.current(); err != nil && err != ErrConnClosed {
+			reason = err
+		}
+
+		// Once cancelled, writes that are in progress fail fast, so
+		// this does not block for long
+		r.wsem <- struct{}{}
+		defer func() { <-r.wsem }()
+
+		dropped = len(r.pending)
+		if r.deadLetter != nil {
+			for _, msg := range r.pending {
+				r.deadLetter(msg, reason)
+			}
+		}
+		r.pending = nil
+	})
+	return dropped
+}
@@ -0,0 +1,272 @@
+package msgpack_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnectingConn(t *testing.T) {
+	t.Run("reconnect and resume", func(t *testing.T) {
+		servers := make(chan *msgpack.Conn, 1)
+		dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+			left, right := net.Pipe()
+			servers <- msgpack.NewConn(right, msgpack.WithMaxInflight(4))
+			return left, nil
+		}
+
+		var resumed int
+		c := msgpack.NewReconnectingConn(dial,
+			msgpack.WithReconnectBackoff(time.Millisecond, 10*time.Millisecond),
+			msgpack.WithResumeFunc(func(ctx context.Context, conn *msgpack.Conn) error {
+				resumed++
+				return conn.Send(ctx, "resume-token")
+			}),
+		)
+		defer c.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if !assert.NoError(t, c.Send(ctx, "foo"), "Send should succeed") {
+			return
+		}
+
+		server := <-servers
+		var s string
+		if !assert.NoError(t, server.Recv(ctx, &s), "Recv should succeed") {
+			return
+		}
+		if !assert.Equal(t, "foo", s, "message should be delivered") {
+			return
+		}
+
+		// Drop the connection from the server side
+		server.Close()
+
+		server = <-servers
+		if !assert.NoError(t, c.Send(ctx, "bar"), "Send should succeed") {
+			return
+		}
+		for _, expected := range []string{"resume-token", "bar"} {
+			if !assert.NoError(t, server.Recv(ctx, &s), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected, s, "messages should be delivered in order") {
+				return
+			}
+		}
+		if !assert.Equal(t, 1, resumed, "resume function should be called once") {
+			return
+		}
+
+		if !assert.NoError(t, server.Send(ctx, "baz"), "Send should succeed") {
+			return
+		}
+		if !assert.NoError(t, c.Recv(ctx, &s), "Recv should succeed") {
+			return
+		}
+		if !assert.Equal(t, "baz", s, "message should be received over the new connection") {
+			return
+		}
+	})
+	t.Run("buffer while disconnected", func(t *testing.T) {
+		allow := make(chan struct{})
+		servers := make(chan *msgpack.Conn, 1)
+		dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+			select {
+			case <-allow:
+			default:
+				return nil, errors.New(`connection refused`)
+			}
+			left, right := net.Pipe()
+			servers <- msgpack.NewConn(right, msgpack.WithMaxInflight(4))
+			return left, nil
+		}
+
+		c := msgpack.NewReconnectingConn(dial,
+			msgpack.WithReconnectBackoff(time.Millisecond, 10*time.Millisecond),
+			msgpack.WithSendBuffer(2),
+		)
+		defer c.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		for _, s := range []string{"foo", "bar"} {
+			if !assert.NoError(t, c.Send(ctx, s), "Send should buffer the message") {
+				return
+			}
+		}
+		if !assert.Equal(t, msgpack.ErrSendBufferFull, c.Send(ctx, "baz"), "Send should fail once the buffer is full") {
+			return
+		}
+
+		close(allow)
+		server := <-servers
+		for _, expected := range []string{"foo", "bar"} {
+			var s string
+			if !assert.NoError(t, server.Recv(ctx, &s), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected, s, "buffered messages should be delivered in order") {
+				return
+			}
+		}
+	})
+	t.Run("give up", func(t *testing.T) {
+		dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return nil, errors.New(`connection refused`)
+		}
+
+		c := msgpack.NewReconnectingConn(dial,
+			msgpack.WithReconnectBackoff(time.Millisecond, time.Millisecond),
+			msgpack.WithMaxDialAttempts(3),
+		)
+		defer c.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var v interface{}
+		err := c.Recv(ctx, &v)
+		if !assert.Error(t, err, "Recv should fail") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), "connection refused", "dial error should be returned") {
+			return
+		}
+	})
+}
+
+func TestReconnectingConnShutdown(t *testing.T) {
+	t.Run("flush buffered messages", func(t *testing.T) {
+		allow := make(chan struct{})
+		servers := make(chan *msgpack.Conn, 1)
+		dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+			select {
+			case <-allow:
+			default:
+				return nil, errors.New(`connection refused`)
+			}
+			left, right := net.Pipe()
+			servers <- msgpack.NewConn(right, msgpack.WithMaxInflight(4))
+			return left, nil
+		}
+
+		c := msgpack.NewReconnectingConn(dial, msgpack.WithReconnectBackoff(time.Millisecond, 10*time.Millisecond))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		for _, s := range []string{"foo", "bar"} {
+			if !assert.NoError(t, c.Send(ctx, s), "Send should buffer the message") {
+				return
+			}
+		}
+
+		type result struct {
+			dropped int
+			err     error
+		}
+		done := make(chan result, 1)
+		go func() {
+			dropped, err := c.Shutdown(ctx)
+			done <- result{dropped, err}
+		}()
+
+		close(allow)
+		server := <-servers
+		for _, expected := range []string{"foo", "bar"} {
+			var s string
+			if !assert.NoError(t, server.Recv(ctx, &s), "Recv should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected, s, "buffered messages should be delivered before shutting down") {
+				return
+			}
+		}
+
+		res := <-done
+		if !assert.NoError(t, res.err, "Shutdown should succeed") {
+			return
+		}
+		if !assert.Equal(t, 0, res.dropped, "no messages should be dropped") {
+			return
+		}
+		if !assert.Equal(t, msgpack.ErrConnClosed, c.Send(ctx, "baz"), "Send should fail after Shutdown") {
+			return
+		}
+	})
+	t.Run("deadline", func(t *testing.T) {
+		dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return nil, errors.New(`connection refused`)
+		}
+
+		c := msgpack.NewReconnectingConn(dial, msgpack.WithReconnectBackoff(time.Millisecond, 10*time.Millisecond))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		for _, s := range []string{"foo", "bar", "baz"} {
+			if !assert.NoError(t, c.Send(ctx, s), "Send should buffer the message") {
+				return
+			}
+		}
+
+		dropped, err := c.Shutdown(ctx)
+		if !assert.Equal(t, context.DeadlineExceeded, err, "Shutdown should give up at the deadline") {
+			return
+		}
+		if !assert.Equal(t, 3, dropped, "unsent messages should be reported") {
+			return
+		}
+	})
+}
+
+func TestReconnectingConnDeadLetter(t *testing.T) {
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return nil, errors.New(`connection refused`)
+	}
+
+	type deadLetter struct {
+		msg string
+		err error
+	}
+	var dead []deadLetter
+	c := msgpack.NewReconnectingConn(dial,
+		msgpack.WithReconnectBackoff(time.Millisecond, 10*time.Millisecond),
+		msgpack.WithSendBuffer(1),
+		msgpack.WithDeadLetter(func(msg []byte, err error) {
+			var s string
+			msgpack.Unmarshal(msg, &s)
+			dead = append(dead, deadLetter{s, err})
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, s := range []string{"foo", "bar"} {
+		if !assert.NoError(t, c.Send(ctx, s), "Send should succeed") {
+			return
+		}
+	}
+	if !assert.NoError(t, c.Close(), "Close should succeed") {
+		return
+	}
+
+	expected := []deadLetter{
+		{"bar", msgpack.ErrSendBufferFull},
+		{"foo", msgpack.ErrConnClosed},
+	}
+	if !assert.Equal(t, expected, dead, "dropped messages should be handed to the dead letter function") {
+		return
+	}
+}
@@ -0,0 +1,194 @@
+package msgpack
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrRetryWriterClosed is returned from RetryWriter.Write after the
+// RetryWriter has been closed
+var ErrRetryWriterClosed = errors.New(`msgpack: retry writer closed`)
+
+// RetryWriter is an io.Writer that retries writes that fail with a
+// transient error (such as a timeout talking to a broker), backing off
+// exponentially between attempts. Since the caller is blocked while
+// RetryWriter backs off, a struggling destination naturally slows
+// down the producer instead of having messages pile up.
+//
+// RetryWriter must see each message as a single call to Write, so
+// that a message that could not be written can be dropped as a whole
+// without corrupting the stream. Encode into a buffer first, and write
+// the buffer:
+//
+//	w := msgpack.NewRetryWriter(conn, msgpack.WithDropHandler(func(msg []byte, err error) {
+//	  log.Printf("dropped %d bytes: %s", len(msg), err)
+//	}))
+//	var buf bytes.Buffer
+//	msgpack.NewEncoder(&buf).Encode(v)
+//	w.Write(buf.Bytes())
+type RetryWriter struct {
+	dst         io.Writer
+	maxRetries  int
+	initial     time.Duration
+	max         time.Duration
+	isTransient func(error) bool
+	onDrop      func([]byte, error)
+	clock       Clock
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// RetryOption is an option that can be passed to NewRetryWriter
+type RetryOption func(*RetryWriter)
+
+// WithMaxRetries specifies how many times a write is retried before
+// giving up. The default is 5
+func WithMaxRetries(n int) RetryOption {
+	return func(w *RetryWriter) {
+		if n < 0 {
+			n = 0
+		}
+		w.maxRetries = n
+	}
+}
+
+// WithBackoff specifies the delay before the first retry, and the
+// maximum delay between retries. The delay doubles after each failed
+// attempt. The defaults are 10ms and 1s
+func WithBackoff(initial, max time.Duration) RetryOption {
+	return func(w *RetryWriter) {
+		w.initial = initial
+		w.max = max
+	}
+}
+
+// WithTransientFunc specifies the function that decides if an error is
+// transient, and the write should be retried. By default, errors that
+// report themselves as temporary or as a timeout (as net.Error does)
+// are considered to be transient
+func WithTransientFunc(fn func(error) bool) RetryOption {
+	return func(w *RetryWriter) {
+		w.isTransient = fn
+	}
+}
+
+// WithDropHandler specifies a function that is called when a message
+// is dropped because it could not be written. When a drop handler is
+// given, Write reports success for dropped messages, so that callers
+// such as telemetry exporters keep running through transient outages
+func WithDropHandler(fn func(msg []byte, err error)) RetryOption {
+	return func(w *RetryWriter) {
+		w.onDrop = fn
+	}
+}
+
+// WithRetryClock specifies the Clock used to back off between
+// retries. The default is SystemClock
+func WithRetryClock(clock Clock) RetryOption {
+	return func(w *RetryWriter) {
+		w.clock = clock
+	}
+}
+
+// isTransientError is the default for WithTransientFunc
+func isTransientError(err error) bool {
+	cause := errors.Cause(err)
+	if t, ok := cause.(interface{ Timeout() bool }); ok && t.Timeout() {
+		return true
+	}
+	if t, ok := cause.(interface{ Temporary() bool }); ok && t.Temporary() {
+		return true
+	}
+	return false
+}
+
+// NewRetryWriter creates a new RetryWriter that writes to w
+func NewRetryWriter(w io.Writer, options ...RetryOption) *RetryWriter {
+	rw := &RetryWriter{
+		dst:         w,
+		maxRetries:  5,
+		initial:     10 * time.Millisecond,
+		max:         time.Second,
+		isTransient: isTransientError,
+		clock:       SystemClock,
+		done:        make(chan struct{}),
+	}
+	for _, option := range options {
+		option(rw)
+	}
+	return rw
+}
+
+// Write writes msg to the underlying io.Writer, retrying transient
+// errors. If the message cannot be written, it is dropped: the drop
+// handler is called, and Write returns len(msg) and no error. Without
+// a drop handler, the error is returned.
+//
+// A message is only dropped if none of it has been written. If the
+// underlying io.Writer accepted part of the message before failing,
+// the stream is corrupted, and the error is always returned
+func (w *RetryWriter) Write(msg []byte) (int, error) {
+	var written int
+	delay := w.initial
+	var failures int
+	for {
+		select {
+		case <-w.done:
+			return written, ErrRetryWriterClosed
+		default:
+		}
+
+		n, err := w.dst.Write(msg[written:])
+		written += n
+		if err == nil && written < len(msg) {
+			if n > 0 {
+				continue
+			}
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			return written, nil
+		}
+
+		if failures >= w.maxRetries || !w.isTransient(err) {
+			return w.drop(msg, written, err)
+		}
+
+		t := w.clock.NewTimer(delay)
+		select {
+		case <-w.done:
+			t.Stop()
+			return written, ErrRetryWriterClosed
+		case <-t.C():
+		}
+
+		failures++
+		delay *= 2
+		if delay > w.max {
+			delay = w.max
+		}
+	}
+}
+
+func (w *RetryWriter) drop(msg []byte, written int, err error) (int, error) {
+	if w.onDrop == nil || written > 0 {
+		return written, errors.Wrap(err, `msgpack: failed to write message`)
+	}
+
+	w.onDrop(msg, err)
+	return len(msg), nil
+}
+
+// Close stops the RetryWriter. Writes that are backing off return
+// ErrRetryWriterClosed immediately. The underlying io.Writer is not
+// closed
+func (w *RetryWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+	return nil
+}
@@ -0,0 +1,168 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Validate makes sure that data holds exactly one well-formed msgpack
+// value, without decoding it or allocating. It only checks the
+// structure of the value: that every code is valid, and that the
+// lengths of strings, byte slices, arrays, maps and extensions match
+// the data. It does not check the contents of strings or extensions.
+// This makes it a cheap gate for untrusted input before a full decode.
+//
+// A *TrailingBytesError is returned if there are bytes after the
+// value, and a *ReservedCodeError if the reserved code 0xc1 is found
+func Validate(data []byte) error {
+	n, err := scanValue(data)
+	if err != nil {
+		return errors.Wrap(err, `msgpack: invalid value`)
+	}
+	if n != len(data) {
+		return &TrailingBytesError{Count: len(data) - n}
+	}
+	return nil
+}
+
+// Valid reports whether data holds exactly one well-formed msgpack
+// value. See Validate
+func Valid(data []byte) bool {
+	return Validate(data) == nil
+}
+
+// ScanHeader parses the header of the msgpack value at the start of b,
+// without decoding the value. It returns the number of bytes taken by
+// the header (the code, the length if there is one, and the type of
+// extensions), the number of bytes of payload that follow it, and the
+// number of values that come after that: the elements of arrays, and
+// the keys and values of maps. io.ErrUnexpectedEOF is returned if b
+// ends before the header or the payload does
+func ScanHeader(b []byte) (int, int, uint64, error) {
+	if len(b) == 0 {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+
+	code := Code(b[0])
+	switch {
+	case IsFixNumFamily(code), code == Nil, code == True, code == False:
+		return 1, 0, 0, nil
+	case code >= FixMap0 && code <= FixMap15:
+		return 1, 0, 2 * uint64(code-FixMap0), nil
+	case code >= FixArray0 && code <= FixArray15:
+		return 1, 0, uint64(code - FixArray0), nil
+	case code >= FixStr0 && code <= FixStr31:
+		size := int(code - FixStr0)
+		if 1+size > len(b) {
+			return 0, 0, 0, io.ErrUnexpectedEOF
+		}
+		return 1, size, 0, nil
+	}
+
+	// The remaining codes are followed by a length (or a payload of a
+	// fixed size), which may itself be truncated, and by the type for
+	// extensions
+	var lsize, typ, fixed int
+	switch code {
+	case Uint8, Int8:
+		fixed = 1
+	case Uint16, Int16:
+		fixed = 2
+	case Uint32, Int32, Float:
+		fixed = 4
+	case Uint64, Int64, Double:
+		fixed = 8
+	case FixExt1:
+		typ, fixed = 1, 1
+	case FixExt2:
+		typ, fixed = 1, 2
+	case FixExt4:
+		typ, fixed = 1, 4
+	case FixExt8:
+		typ, fixed = 1, 8
+	case FixExt16:
+		typ, fixed = 1, 16
+	case Bin8, Str8:
+		lsize = 1
+	case Bin16, Str16, Array16, Map16:
+		lsize = 2
+	case Bin32, Str32, Array32, Map32:
+		lsize = 4
+	case Ext8:
+		lsize, typ = 1, 1
+	case Ext16:
+		lsize, typ = 2, 1
+	case Ext32:
+		lsize, typ = 4, 1
+	case reservedCode:
+		return 0, 0, 0, &ReservedCodeError{}
+	default:
+		return 0, 0, 0, errors.Errorf(`msgpack: invalid code %s`, code)
+	}
+
+	if len(b) < 1+lsize {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	var l uint64
+	switch lsize {
+	case 1:
+		l = uint64(b[1])
+	case 2:
+		l = uint64(binary.BigEndian.Uint16(b[1:]))
+	case 4:
+		l = uint64(binary.BigEndian.Uint32(b[1:]))
+	}
+
+	switch code {
+	case Array16, Array32:
+		return 1 + lsize, 0, l, nil
+	case Map16, Map32:
+		return 1 + lsize, 0, 2 * l, nil
+	}
+
+	hdr := 1 + lsize + typ
+	size := uint64(fixed) + l
+	if uint64(hdr)+size > uint64(len(b)) {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	return hdr, int(size), 0, nil
+}
+
+// scanHeader is like ScanHeader, but returns the number of bytes taken
+// by the header and the payload together
+func scanHeader(b []byte) (int, uint64, error) {
+	hdr, size, elements, err := ScanHeader(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return hdr + size, elements, nil
+}
+
+// scanValue returns the number of bytes taken by the complete value at
+// the start of b, without decoding it or allocating. Nested values are
+// tracked with a counter instead of recursion, so that deeply nested
+// input cannot exhaust the stack
+func scanValue(b []byte) (int, error) {
+	var off int
+	pending := uint64(1)
+	for pending > 0 {
+		// Every value takes at least one byte, which bounds the number
+		// of values that b can still hold
+		if pending > uint64(len(b)-off) {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		size, elements, err := scanHeader(b[off:])
+		if err != nil {
+			if rerr, ok := err.(*ReservedCodeError); ok {
+				rerr.Offset = int64(off)
+			}
+			return 0, err
+		}
+		off += size
+		pending = pending - 1 + elements
+	}
+	return off, nil
+}
@@ -0,0 +1,264 @@
+package msgpack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// ErrFrameAuthentication is returned from SealedDecoder.Decode when a
+// frame fails authentication. This happens when the frame has been
+// tampered with, replayed, reordered, or dropped, or when the key does
+// not match the one used to seal the stream
+var ErrFrameAuthentication = errors.New(`msgpack: failed to authenticate sealed frame`)
+
+// MaxSealedFrameSize is the maximum size of a single sealed frame,
+// including the AEAD overhead. Larger frames are rejected by both
+// SealedEncoder and SealedDecoder, so that a corrupted length prefix
+// cannot make the decoder allocate an arbitrary amount of memory
+const MaxSealedFrameSize = 16 * 1024 * 1024
+
+// counterSize is the number of bytes of the nonce that hold the frame
+// counter. The rest of the nonce is a random per-stream prefix
+const counterSize = 8
+
+// SealedEncoder encrypts and authenticates each encoded value as a
+// separate frame, for use over transports that are not otherwise
+// protected (e.g. no TLS).
+//
+// The stream starts with a random nonce prefix, written in the clear.
+// Each frame after that is a 4 byte big-endian length, followed by the
+// sealed msgpack value. The nonce of each frame is the prefix followed
+// by a frame counter, and both the counter and the length prefix are
+// authenticated, so frames cannot be replayed, reordered, or dropped
+// within a stream without SealedDecoder noticing.
+//
+// Replay protection only covers frames within a single stream: an
+// attacker could replay a whole recorded stream. If that matters, use
+// a separate key per session.
+//
+// Truncation is only detected within a frame. A stream that is cut off
+// at a frame boundary looks the same as one that ended there, and
+// SealedDecoder returns io.EOF for both. If the receiver needs to know
+// that it got everything, end the stream with a value of your own that
+// says so, such as a count of the values sent.
+//
+// Once writing a frame fails, the SealedEncoder refuses to encode any
+// more values, as the destination may hold part of a frame, and
+// sealing the value again would reuse its nonce.
+type SealedEncoder struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	options []Option
+	prefix  []byte
+	counter uint64
+	started bool
+	err     error
+	buf     bytes.Buffer
+	frame   []byte
+}
+
+// SealedDecoder reads frames written by a SealedEncoder, and decodes
+// them after they have been authenticated
+type SealedDecoder struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	options []Option
+	prefix  []byte
+	counter uint64
+	frame   []byte
+	plain   []byte
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to create cipher`)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to create AEAD`)
+	}
+	return aead, nil
+}
+
+// NewSealedEncoder creates a SealedEncoder that seals frames using
+// AES-GCM. The key must be 16, 24, or 32 bytes long. The options are
+// used to configure the Encoder that encodes each value.
+//
+// To use a different AEAD, such as chacha20poly1305 from
+// golang.org/x/crypto, use NewSealedEncoderAEAD
+func NewSealedEncoder(w io.Writer, key []byte, options ...Option) (*SealedEncoder, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewSealedEncoderAEAD(w, aead, options...)
+}
+
+// NewSealedEncoderAEAD creates a SealedEncoder that seals frames using
+// the given AEAD. The nonce size of the AEAD must be larger than 8 bytes
+func NewSealedEncoderAEAD(w io.Writer, aead cipher.AEAD, options ...Option) (*SealedEncoder, error) {
+	if aead.NonceSize() <= counterSize {
+		return nil, errors.Errorf(`msgpack: nonce size of AEAD is too small (%d)`, aead.NonceSize())
+	}
+
+	prefix := make([]byte, aead.NonceSize()-counterSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to generate nonce prefix`)
+	}
+
+	return &SealedEncoder{
+		dst:     w,
+		aead:    aead,
+		options: options,
+		prefix:  prefix,
+	}, nil
+}
+
+// NewSealedDecoder creates a SealedDecoder that opens frames using
+// AES-GCM. The key must be the same as the one given to NewSealedEncoder.
+// The options are used to configure the Decoder that decodes each value
+func NewSealedDecoder(r io.Reader, key []byte, options ...Option) (*SealedDecoder, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewSealedDecoderAEAD(r, aead, options...)
+}
+
+// NewSealedDecoderAEAD creates a SealedDecoder that opens frames using
+// the given AEAD
+func NewSealedDecoderAEAD(r io.Reader, aead cipher.AEAD, options ...Option) (*SealedDecoder, error) {
+	if aead.NonceSize() <= counterSize {
+		return nil, errors.Errorf(`msgpack: nonce size of AEAD is too small (%d)`, aead.NonceSize())
+	}
+
+	return &SealedDecoder{
+		src:     r,
+		aead:    aead,
+		options: options,
+	}, nil
+}
+
+// sealedFrameNonce writes the nonce for the frame with the given
+// counter into dst
+func sealedFrameNonce(dst, prefix []byte, counter uint64) []byte {
+	dst = append(dst[:0], prefix...)
+	var b [counterSize]byte
+	binary.BigEndian.PutUint64(b[:], counter)
+	return append(dst, b[:]...)
+}
+
+// Encode encodes v, and writes it as a single sealed frame
+func (e *SealedEncoder) Encode(v interface{}) error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.counter == math.MaxUint64 {
+		return errors.New(`msgpack: frame counter exhausted, use a new key`)
+	}
+
+	e.buf.Reset()
+	if err := NewEncoder(&e.buf, e.options...).Encode(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to encode value`)
+	}
+
+	size := e.buf.Len() + e.aead.Overhead()
+	if size > MaxSealedFrameSize {
+		return errors.Errorf(`msgpack: sealed frame is too large (%d bytes)`, size)
+	}
+
+	// The frame is assembled in a single buffer so that it is written
+	// with a single call, and we never leave a partial frame behind
+	// because of an error on our side
+	var frame []byte
+	if !e.started {
+		frame = append(e.frame[:0], e.prefix...)
+	} else {
+		frame = e.frame[:0]
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(size))
+	frame = append(frame, length[:]...)
+
+	// The counter is used up before the frame is written, so that its
+	// nonce is never used to seal anything else, whatever Write does
+	counter := e.counter
+	e.counter++
+	nonce := sealedFrameNonce(make([]byte, 0, e.aead.NonceSize()), e.prefix, counter)
+	frame = e.aead.Seal(frame, nonce, e.buf.Bytes(), length[:])
+	e.frame = frame
+
+	n, err := e.dst.Write(frame)
+	if err == nil && n < len(frame) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		e.err = errors.Wrap(err, `msgpack: failed to write sealed frame`)
+		return e.err
+	}
+	e.started = true
+	return nil
+}
+
+// Decode reads the next frame, authenticates it, and decodes its
+// contents into v. io.EOF is returned if the stream ends cleanly
+// before the next frame
+func (d *SealedDecoder) Decode(v interface{}) error {
+	if d.prefix == nil {
+		prefix := make([]byte, d.aead.NonceSize()-counterSize)
+		if _, err := io.ReadFull(d.src, prefix); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return errors.Wrap(err, `msgpack: failed to read nonce prefix`)
+			}
+			return err
+		}
+		d.prefix = prefix
+	}
+
+	var length [4]byte
+	if _, err := io.ReadFull(d.src, length[:]); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return errors.Wrap(err, `msgpack: failed to read sealed frame length`)
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > MaxSealedFrameSize {
+		return errors.Errorf(`msgpack: sealed frame is too large (%d bytes)`, size)
+	}
+
+	if cap(d.frame) < int(size) {
+		d.frame = make([]byte, size)
+	}
+	d.frame = d.frame[:size]
+	if _, err := io.ReadFull(d.src, d.frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return errors.Wrap(err, `msgpack: failed to read sealed frame`)
+	}
+
+	nonce := sealedFrameNonce(make([]byte, 0, d.aead.NonceSize()), d.prefix, d.counter)
+	plain, err := d.aead.Open(d.plain[:0], nonce, d.frame, length[:])
+	if err != nil {
+		return ErrFrameAuthentication
+	}
+	d.plain = plain
+	d.counter++
+
+	if err := NewDecoder(bytes.NewReader(plain), d.options...).Decode(v); err != nil {
+		return errors.Wrap(err, `msgpack: failed to decode sealed frame`)
+	}
+	return nil
+}
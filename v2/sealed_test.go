@@ -0,0 +1,240 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var sealedKey = []byte("0123456789abcdef0123456789abcdef")
+
+type sealedMessage struct {
+	Host  string
+	Value float64
+}
+
+// sealedFrames encodes each value using a SealedEncoder, and returns
+// the resulting stream
+func sealedFrames(t *testing.T, values ...interface{}) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc, err := msgpack.NewSealedEncoder(&buf, sealedKey)
+	if err != nil {
+		t.Fatalf("NewSealedEncoder failed: %s", err)
+	}
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode failed: %s", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// failOnceWriter writes half of the first buffer that it is given, and
+// fails. Later writes succeed
+type failOnceWriter struct {
+	buf    bytes.Buffer
+	failed bool
+}
+
+func (w *failOnceWriter) Write(p []byte) (int, error) {
+	if !w.failed {
+		w.failed = true
+		n, _ := w.buf.Write(p[:len(p)/2])
+		return n, errors.New(`write failed`)
+	}
+	return w.buf.Write(p)
+}
+
+func TestSealed(t *testing.T) {
+	// The stream starts with a 4 byte nonce prefix (AES-GCM uses 12 byte
+	// nonces, 8 of which are used for the frame counter)
+	const prefixSize = 4
+
+	t.Run("round trip", func(t *testing.T) {
+		stream := sealedFrames(t, sealedMessage{Host: "foo", Value: 1.5}, sealedMessage{Host: "bar", Value: 2.5})
+		if !assert.False(t, bytes.Contains(stream, []byte("foo")), "payload should be encrypted") {
+			return
+		}
+
+		dec, err := msgpack.NewSealedDecoder(bytes.NewReader(stream), sealedKey)
+		if !assert.NoError(t, err, "NewSealedDecoder should succeed") {
+			return
+		}
+
+		for _, expected := range []sealedMessage{{Host: "foo", Value: 1.5}, {Host: "bar", Value: 2.5}} {
+			var msg sealedMessage
+			if !assert.NoError(t, dec.Decode(&msg), "Decode should succeed") {
+				return
+			}
+			if !assert.Equal(t, expected, msg, "message should match") {
+				return
+			}
+		}
+
+		var msg sealedMessage
+		if !assert.Equal(t, io.EOF, dec.Decode(&msg), "Decode should return io.EOF at the end of the stream") {
+			return
+		}
+	})
+	t.Run("tampered frame", func(t *testing.T) {
+		stream := sealedFrames(t, "Hello, World!")
+		stream[len(stream)-1] ^= 0xff
+
+		dec, err := msgpack.NewSealedDecoder(bytes.NewReader(stream), sealedKey)
+		if !assert.NoError(t, err, "NewSealedDecoder should succeed") {
+			return
+		}
+		var s string
+		if !assert.Equal(t, msgpack.ErrFrameAuthentication, dec.Decode(&s), "Decode should fail") {
+			return
+		}
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		stream := sealedFrames(t, "Hello, World!")
+
+		dec, err := msgpack.NewSealedDecoder(bytes.NewReader(stream), []byte("fedcba9876543210fedcba9876543210"))
+		if !assert.NoError(t, err, "NewSealedDecoder should succeed") {
+			return
+		}
+		var s string
+		if !assert.Equal(t, msgpack.ErrFrameAuthentication, dec.Decode(&s), "Decode should fail") {
+			return
+		}
+	})
+	t.Run("replayed frame", func(t *testing.T) {
+		stream := sealedFrames(t, "Hello, World!")
+		frame := stream[prefixSize:]
+
+		// Send the same frame twice
+		replayed := append(append([]byte(nil), stream...), frame...)
+
+		dec, err := msgpack.NewSealedDecoder(bytes.NewReader(replayed), sealedKey)
+		if !assert.NoError(t, err, "NewSealedDecoder should succeed") {
+			return
+		}
+		var s string
+		if !assert.NoError(t, dec.Decode(&s), "first Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, msgpack.ErrFrameAuthentication, dec.Decode(&s), "replayed frame should be rejected") {
+			return
+		}
+	})
+	t.Run("reordered frames", func(t *testing.T) {
+		stream := sealedFrames(t, "one", "two")
+		body := stream[prefixSize:]
+		// Both frames have the same size, as the payloads do
+		frameSize := len(body) / 2
+		if !assert.Equal(t, len(body), frameSize*2, "frames should have the same size") {
+			return
+		}
+
+		var reordered []byte
+		reordered = append(reordered, stream[:prefixSize]...)
+		reordered = append(reordered, body[frameSize:]...)
+		reordered = append(reordered, body[:frameSize]...)
+
+		dec, err := msgpack.NewSealedDecoder(bytes.NewReader(reordered), sealedKey)
+		if !assert.NoError(t, err, "NewSealedDecoder should succeed") {
+			return
+		}
+		var s string
+		if !assert.Equal(t, msgpack.ErrFrameAuthentication, dec.Decode(&s), "reordered frame should be rejected") {
+			return
+		}
+	})
+	t.Run("truncated frame", func(t *testing.T) {
+		stream := sealedFrames(t, "Hello, World!")
+
+		dec, err := msgpack.NewSealedDecoder(bytes.NewReader(stream[:len(stream)-1]), sealedKey)
+		if !assert.NoError(t, err, "NewSealedDecoder should succeed") {
+			return
+		}
+		var s string
+		err = dec.Decode(&s)
+		if !assert.Error(t, err, "Decode should fail") {
+			return
+		}
+		if !assert.NotEqual(t, io.EOF, err, "error should not be a clean EOF") {
+			return
+		}
+	})
+	t.Run("failed write", func(t *testing.T) {
+		var w failOnceWriter
+		enc, err := msgpack.NewSealedEncoder(&w, sealedKey)
+		if !assert.NoError(t, err, "NewSealedEncoder should succeed") {
+			return
+		}
+		if !assert.Error(t, enc.Encode("Hello, World!"), "Encode should fail") {
+			return
+		}
+		written := w.buf.Len()
+
+		// Retrying would seal another value with the same nonce, after
+		// part of a frame
+		if !assert.Error(t, enc.Encode("Hello, World!"), "Encode should fail once a write failed") {
+			return
+		}
+		if !assert.Equal(t, written, w.buf.Len(), "nothing should be written once a write failed") {
+			return
+		}
+	})
+	t.Run("oversized frame", func(t *testing.T) {
+		stream := []byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}
+
+		dec, err := msgpack.NewSealedDecoder(bytes.NewReader(stream), sealedKey)
+		if !assert.NoError(t, err, "NewSealedDecoder should succeed") {
+			return
+		}
+		var s string
+		if !assert.Error(t, dec.Decode(&s), "Decode should fail") {
+			return
+		}
+	})
+	t.Run("custom AEAD", func(t *testing.T) {
+		block, err := aes.NewCipher(sealedKey[:16])
+		if !assert.NoError(t, err, "aes.NewCipher should succeed") {
+			return
+		}
+		aead, err := cipher.NewGCM(block)
+		if !assert.NoError(t, err, "cipher.NewGCM should succeed") {
+			return
+		}
+
+		var buf bytes.Buffer
+		enc, err := msgpack.NewSealedEncoderAEAD(&buf, aead)
+		if !assert.NoError(t, err, "NewSealedEncoderAEAD should succeed") {
+			return
+		}
+		if !assert.NoError(t, enc.Encode("Hello, World!"), "Encode should succeed") {
+			return
+		}
+
+		dec, err := msgpack.NewSealedDecoderAEAD(&buf, aead)
+		if !assert.NoError(t, err, "NewSealedDecoderAEAD should succeed") {
+			return
+		}
+		var s string
+		if !assert.NoError(t, dec.Decode(&s), "Decode should succeed") {
+			return
+		}
+		if !assert.Equal(t, "Hello, World!", s, "value should match") {
+			return
+		}
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := msgpack.NewSealedEncoder(ioutil.Discard, []byte("short"))
+		if !assert.Error(t, err, "NewSealedEncoder should fail") {
+			return
+		}
+	})
+}
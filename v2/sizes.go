@@ -0,0 +1,83 @@
+package msgpack
+
+import "math"
+
+// Limits of the msgpack format, for code generators and hand-written
+// codecs that need to pick a representation, or to check that a value
+// can be encoded at all, without hardcoding the numbers. The largest
+// values fit in a uint32, so compare against them with int64 on 32-bit
+// platforms
+const (
+	// MaxPositiveFixInt and MinNegativeFixInt bound the integers that
+	// fit in a single byte (positive and negative FixNum)
+	MaxPositiveFixInt = 127
+	MinNegativeFixInt = -32
+
+	// MaxFixStrLen is the length of the longest string that fits in a
+	// FixStr. Longer strings use Str8, Str16 or Str32
+	MaxFixStrLen = 31
+	MaxStr8Len   = math.MaxUint8
+	MaxStr16Len  = math.MaxUint16
+	MaxStr32Len  = math.MaxUint32
+	MaxStrLen    = MaxStr32Len
+
+	MaxBin8Len  = math.MaxUint8
+	MaxBin16Len = math.MaxUint16
+	MaxBin32Len = math.MaxUint32
+	MaxBinLen   = MaxBin32Len
+
+	// MaxFixArrayElements is the number of elements of the largest array
+	// that fits in a FixArray. Larger arrays use Array16 or Array32
+	MaxFixArrayElements = 15
+	MaxArray16Elements  = math.MaxUint16
+	MaxArray32Elements  = math.MaxUint32
+	MaxArrayElements    = MaxArray32Elements
+
+	// MaxFixMapElements is the number of key/value pairs of the largest
+	// map that fits in a FixMap. Larger maps use Map16 or Map32
+	MaxFixMapElements = 15
+	MaxMap16Elements  = math.MaxUint16
+	MaxMap32Elements  = math.MaxUint32
+	MaxMapElements    = MaxMap32Elements
+
+	// Extension payloads of 1, 2, 4, 8 and 16 bytes use FixExt1 to
+	// FixExt16. Other lengths use Ext8, Ext16 or Ext32
+	MaxExt8Len  = math.MaxUint8
+	MaxExt16Len = math.MaxUint16
+	MaxExt32Len = math.MaxUint32
+	MaxExtLen   = MaxExt32Len
+)
+
+// FitsFixInt reports whether i can be encoded as a single byte, as a
+// positive or negative FixNum
+func FitsFixInt(i int64) bool {
+	return i >= MinNegativeFixInt && i <= MaxPositiveFixInt
+}
+
+// FitsFixStr reports whether a string of n bytes can be encoded as a
+// FixStr, with the length in the header byte
+func FitsFixStr(n int) bool {
+	return n >= 0 && n <= MaxFixStrLen
+}
+
+// FitsFixArray reports whether an array of n elements can be encoded
+// with a FixArray header
+func FitsFixArray(n int) bool {
+	return n >= 0 && n <= MaxFixArrayElements
+}
+
+// FitsFixMap reports whether a map of n key/value pairs can be encoded
+// with a FixMap header
+func FitsFixMap(n int) bool {
+	return n >= 0 && n <= MaxFixMapElements
+}
+
+// FitsFixExt reports whether an extension payload of n bytes can be
+// encoded with one of the FixExt headers
+func FitsFixExt(n int) bool {
+	switch n {
+	case 1, 2, 4, 8, 16:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizes(t *testing.T) {
+	t.Run("integers", func(t *testing.T) {
+		for _, i := range []int64{msgpack.MinNegativeFixInt, -1, 0, msgpack.MaxPositiveFixInt} {
+			if !assert.True(t, msgpack.FitsFixInt(i), "%d should fit in a FixNum", i) {
+				return
+			}
+			if !assert.Len(t, msgpack.AppendInt(nil, i), 1, "%d should be encoded in a single byte", i) {
+				return
+			}
+		}
+		for _, i := range []int64{msgpack.MinNegativeFixInt - 1, msgpack.MaxPositiveFixInt + 1} {
+			if !assert.False(t, msgpack.FitsFixInt(i), "%d should not fit in a FixNum", i) {
+				return
+			}
+			if !assert.NotEqual(t, 1, len(msgpack.AppendInt(nil, i)), "%d should not be encoded in a single byte", i) {
+				return
+			}
+		}
+	})
+	t.Run("strings", func(t *testing.T) {
+		inputs := []struct {
+			length int
+			code   msgpack.Code
+		}{
+			{msgpack.MaxFixStrLen, msgpack.FixStr31},
+			{msgpack.MaxFixStrLen + 1, msgpack.Str8},
+			{msgpack.MaxStr8Len, msgpack.Str8},
+			{msgpack.MaxStr8Len + 1, msgpack.Str16},
+			{msgpack.MaxStr16Len, msgpack.Str16},
+			{msgpack.MaxStr16Len + 1, msgpack.Str32},
+		}
+		for _, input := range inputs {
+			b, err := msgpack.Marshal(string(bytes.Repeat([]byte{'x'}, input.length)))
+			if !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, input.code.Byte(), b[0], "string of %d bytes should use %s", input.length, input.code) {
+				return
+			}
+			if !assert.Equal(t, input.length <= msgpack.MaxFixStrLen, msgpack.FitsFixStr(input.length), "FitsFixStr should match for %d bytes", input.length) {
+				return
+			}
+		}
+	})
+	t.Run("containers", func(t *testing.T) {
+		inputs := []struct {
+			length int
+			array  msgpack.Code
+			m      msgpack.Code
+		}{
+			{msgpack.MaxFixArrayElements, msgpack.FixArray15, msgpack.FixMap15},
+			{msgpack.MaxFixArrayElements + 1, msgpack.Array16, msgpack.Map16},
+			{msgpack.MaxArray16Elements, msgpack.Array16, msgpack.Map16},
+			{msgpack.MaxArray16Elements + 1, msgpack.Array32, msgpack.Map32},
+		}
+		for _, input := range inputs {
+			if !assert.Equal(t, input.array.Byte(), msgpack.AppendArrayHeader(nil, input.length)[0], "array of %d elements should use %s", input.length, input.array) {
+				return
+			}
+			if !assert.Equal(t, input.m.Byte(), msgpack.AppendMapHeader(nil, input.length)[0], "map of %d elements should use %s", input.length, input.m) {
+				return
+			}
+			if !assert.Equal(t, input.length <= msgpack.MaxFixArrayElements, msgpack.FitsFixArray(input.length), "FitsFixArray should match for %d elements", input.length) {
+				return
+			}
+			if !assert.Equal(t, input.length <= msgpack.MaxFixMapElements, msgpack.FitsFixMap(input.length), "FitsFixMap should match for %d elements", input.length) {
+				return
+			}
+		}
+		if !assert.False(t, msgpack.FitsFixArray(-1), "negative lengths should not fit") {
+			return
+		}
+	})
+	t.Run("extensions", func(t *testing.T) {
+		for n := 0; n <= 17; n++ {
+			code := msgpack.AppendExtHeader(nil, 1, n)[0]
+			fixed := code >= msgpack.FixExt1.Byte() && code <= msgpack.FixExt16.Byte()
+			if !assert.Equal(t, fixed, msgpack.FitsFixExt(n), "FitsFixExt should match for %d bytes", n) {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package msgpack_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStructPlanCache(t *testing.T) {
+	defer msgpack.SetStructPlanCacheSize(msgpack.DefaultStructPlanCacheSize)
+
+	// Dynamically created types, as a plugin or codegen-heavy
+	// application would produce
+	makeValue := func(i int) interface{} {
+		rt := reflect.StructOf([]reflect.StructField{
+			{
+				Name: "Foo" + strconv.Itoa(i),
+				Type: reflect.TypeOf(""),
+				Tag:  reflect.StructTag(`msgpack:"foo"`),
+			},
+		})
+		rv := reflect.New(rt)
+		rv.Elem().Field(0).SetString("bar")
+		return rv.Interface()
+	}
+
+	t.Run("Eviction", func(t *testing.T) {
+		msgpack.SetStructPlanCacheSize(2)
+		if !assert.True(t, msgpack.Internals().StructPlans <= 2, "cache should be shrunk") {
+			return
+		}
+
+		before := msgpack.Internals()
+		for i := 0; i < 5; i++ {
+			v := makeValue(i)
+			buf, err := msgpack.Marshal(v)
+			if !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+			buf = append([]byte(nil), buf...)
+
+			decoded := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+			if !assert.NoError(t, msgpack.Unmarshal(buf, decoded), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, v, decoded, "values should match") {
+				return
+			}
+		}
+		after := msgpack.Internals()
+
+		if !assert.Equal(t, 2, after.StructPlans, "cache should stay within its maximum size") {
+			return
+		}
+		// Each type misses once on Marshal, and hits on Unmarshal
+		if !assert.Equal(t, before.StructPlanMisses+5, after.StructPlanMisses, "misses should be counted") {
+			return
+		}
+		if !assert.Equal(t, before.StructPlanHits+5, after.StructPlanHits, "hits should be counted") {
+			return
+		}
+		evicted := int64(before.StructPlans + 5 - 2)
+		if !assert.Equal(t, before.StructPlanEvictions+evicted, after.StructPlanEvictions, "evictions should be counted") {
+			return
+		}
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		msgpack.SetStructPlanCacheSize(0)
+		if !assert.Equal(t, 0, msgpack.Internals().StructPlans, "cache should be emptied") {
+			return
+		}
+
+		v := makeValue(0)
+		before := msgpack.Internals()
+		for i := 0; i < 2; i++ {
+			if _, err := msgpack.Marshal(v); !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+		}
+		after := msgpack.Internals()
+
+		if !assert.Equal(t, 0, after.StructPlans, "nothing should be cached") {
+			return
+		}
+		if !assert.Equal(t, before.StructPlanMisses+2, after.StructPlanMisses, "every lookup should miss") {
+			return
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type summarizedMessage struct {
+	Name     string
+	Password string `msgpack:"-"`
+	Blob     []byte `msgpack:"blob"`
+	Values   []int
+	Nested   map[string]interface{}
+}
+
+func TestSummarize(t *testing.T) {
+	msg := summarizedMessage{
+		Name:     "foo",
+		Password: "hunter2",
+		Blob:     bytes.Repeat([]byte{'x'}, 1024*1024),
+		Values:   []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		Nested: map[string]interface{}{
+			"b": map[string]interface{}{"deep": true},
+			"a": strings.Repeat("long", 100),
+		},
+	}
+
+	t.Run("bounded", func(t *testing.T) {
+		s := msgpack.Summarize(&msg, 2, 3)
+		expected := `{Name: "foo", blob: <bin 1048576 bytes>, Values: [1, 2, 3, ...(+7)], ...(+1)}`
+		if !assert.Equal(t, expected, s, "summary should match") {
+			return
+		}
+		if !assert.NotContains(t, s, "hunter2", "fields that are never encoded should not be shown") {
+			return
+		}
+	})
+	t.Run("depth", func(t *testing.T) {
+		s := msgpack.Summarize(msg.Nested, 1, 10)
+		expected := `{a: "` + strings.Repeat("long", 16) + `"...(400 bytes), b: {...(1)}}`
+		if !assert.Equal(t, expected, s, "summary should match") {
+			return
+		}
+	})
+	t.Run("nil", func(t *testing.T) {
+		if !assert.Equal(t, "nil", msgpack.Summarize(nil, 1, 1), "summary should match") {
+			return
+		}
+		var p *summarizedMessage
+		if !assert.Equal(t, "nil", msgpack.Summarize(p, 1, 1), "summary should match") {
+			return
+		}
+	})
+}
+
+// assertSingleValue checks that data holds exactly one valid msgpack value
+func assertSingleValue(t *testing.T, data []byte) bool {
+	t.Helper()
+	report, err := msgpack.Analyze(bytes.NewReader(data))
+	if !assert.NoError(t, err, "output should be valid msgpack") {
+		return false
+	}
+	return assert.Equal(t, int64(1), report.Values, "output should hold a single value")
+}
+
+func TestTruncateEncoded(t *testing.T) {
+	v := map[string]interface{}{
+		"name":   strings.Repeat("日本語", 20),
+		"blob":   bytes.Repeat([]byte{'x'}, 300),
+		"values": []interface{}{int64(1000), int64(2000), "foo", []interface{}{"bar", "baz"}},
+	}
+	data, err := msgpack.Marshal(v)
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+	data = append([]byte(nil), data...)
+
+	t.Run("fits", func(t *testing.T) {
+		if !assert.Equal(t, data, msgpack.TruncateEncoded(data, len(data)), "data should be returned as is") {
+			return
+		}
+	})
+	t.Run("every budget", func(t *testing.T) {
+		for budget := 0; budget < len(data)+10; budget++ {
+			out := msgpack.TruncateEncoded(data, budget)
+			if out == nil {
+				if !assert.True(t, budget < 1, "only a zero budget should produce nil (budget = %d)", budget) {
+					return
+				}
+				continue
+			}
+			if !assert.True(t, len(out) <= budget, "output should fit in budget (%d > %d)", len(out), budget) {
+				return
+			}
+			if !assertSingleValue(t, out) {
+				return
+			}
+		}
+	})
+	t.Run("strings are cut", func(t *testing.T) {
+		data, err := msgpack.Marshal(strings.Repeat("日本語", 20))
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var s string
+		if !assert.NoError(t, msgpack.Unmarshal(msgpack.TruncateEncoded(data, 11), &s), "Unmarshal should succeed") {
+			return
+		}
+		// A FixStr header, plus 3 characters of 3 bytes each
+		if !assert.Equal(t, "日本語", s, "string should be cut at a character boundary") {
+			return
+		}
+	})
+	t.Run("payload fits but header does not", func(t *testing.T) {
+		data, err := msgpack.Marshal(bytes.Repeat([]byte{'x'}, 300))
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var b []byte
+		if !assert.NoError(t, msgpack.Unmarshal(msgpack.TruncateEncoded(data, 301), &b), "Unmarshal should succeed") {
+			return
+		}
+		// A Bin16 header, plus 298 bytes
+		if !assert.Len(t, b, 298, "binary should be cut to fit its header") {
+			return
+		}
+	})
+	t.Run("arrays lose trailing elements", func(t *testing.T) {
+		data, err := msgpack.Marshal([]string{"foo", "bar", "baz"})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var l []string
+		if !assert.NoError(t, msgpack.Unmarshal(msgpack.TruncateEncoded(data, 11), &l), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []string{"foo", "bar", "b"}, l, "elements should be dropped") {
+			return
+		}
+	})
+	t.Run("invalid data", func(t *testing.T) {
+		if !assert.Nil(t, msgpack.TruncateEncoded([]byte{msgpack.Array16.Byte(), 0, 5, 0xc1}, 3), "invalid data should produce nil") {
+			return
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// numpyArray builds what msgpack-numpy produces for an array of
+// float64 values
+func numpyArray(keyCode msgpack.Code, dtype string, order binary.ByteOrder, shape []byte, values ...float64) []byte {
+	key := func(buf *bytes.Buffer, k string) {
+		if keyCode == msgpack.Bin8 {
+			buf.Write([]byte{msgpack.Bin8.Byte(), byte(len(k))})
+		} else {
+			buf.WriteByte(msgpack.FixStr0.Byte() | byte(len(k)))
+		}
+		buf.WriteString(k)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(msgpack.FixMap5.Byte())
+	key(&buf, "nd")
+	buf.WriteByte(msgpack.True.Byte())
+	key(&buf, "type")
+	buf.WriteByte(msgpack.FixStr3.Byte())
+	buf.WriteString(dtype)
+	key(&buf, "kind")
+	buf.Write([]byte{msgpack.Bin8.Byte(), 0})
+	key(&buf, "shape")
+	buf.WriteByte(msgpack.FixArray0.Byte() | byte(len(shape)))
+	buf.Write(shape)
+	key(&buf, "data")
+	buf.Write([]byte{msgpack.Bin8.Byte(), byte(8 * len(values))})
+	for _, v := range values {
+		var b [8]byte
+		order.PutUint64(b[:], math.Float64bits(v))
+		buf.Write(b[:])
+	}
+	return buf.Bytes()
+}
+
+func TestTensor(t *testing.T) {
+	t.Run("encode matches msgpack-numpy", func(t *testing.T) {
+		b, err := msgpack.Marshal(msgpack.Tensor{Shape: []int{2, 2}, Data: []float64{1, 2, 3, 4}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, numpyArray(msgpack.Bin8, "<f8", binary.LittleEndian, []byte{2, 2}, 1, 2, 3, 4), b, "output should match") {
+			return
+		}
+	})
+	t.Run("round trip", func(t *testing.T) {
+		for _, v := range []msgpack.Tensor{
+			{Shape: []int{2, 3}, Data: []float32{1, 2, 3, 4, 5, 6}},
+			{Shape: []int{3}, Data: []float64{0.5, -1, math.Inf(1)}},
+			{Shape: []int{0, 4}, Data: []float64{}},
+		} {
+			b, err := msgpack.Marshal(v)
+			if !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+
+			var decoded msgpack.Tensor
+			if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+				return
+			}
+			if !assert.Equal(t, v, decoded, "values should match") {
+				return
+			}
+		}
+	})
+	t.Run("nil shape", func(t *testing.T) {
+		b, err := msgpack.Marshal(msgpack.Tensor{Data: []float64{1, 2}})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		var decoded msgpack.Tensor
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, msgpack.Tensor{Shape: []int{2}, Data: []float64{1, 2}}, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("str keys and big endian values", func(t *testing.T) {
+		var decoded msgpack.Tensor
+		b := numpyArray(msgpack.FixStr0, ">f8", binary.BigEndian, []byte{1, 2}, 1, 2)
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, msgpack.Tensor{Shape: []int{1, 2}, Data: []float64{1, 2}}, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("shape mismatch", func(t *testing.T) {
+		_, err := msgpack.Marshal(msgpack.Tensor{Shape: []int{2, 2}, Data: []float64{1, 2, 3}})
+		if !assert.Error(t, err, "Marshal should fail") {
+			return
+		}
+
+		var decoded msgpack.Tensor
+		b := numpyArray(msgpack.Bin8, "<f8", binary.LittleEndian, []byte{3}, 1, 2)
+		if !assert.Error(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should fail") {
+			return
+		}
+	})
+	t.Run("unsupported type", func(t *testing.T) {
+		var decoded msgpack.Tensor
+		b := numpyArray(msgpack.Bin8, "<i8", binary.LittleEndian, []byte{1}, 1)
+		if !assert.Error(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should fail") {
+			return
+		}
+	})
+}
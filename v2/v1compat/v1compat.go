@@ -0,0 +1,46 @@
+// Package v1compat provides the functions of
+// github.com/lestrrat-go/msgpack whose signatures changed in v2, in
+// their v1 form, implemented on top of v2. A program can switch its
+// imports to v2 first, use this package for the calls that no longer
+// compile, and move them to the v2 forms one at a time:
+//
+//	v1                              v2
+//	msgpack.RegisterExt(typ, v)     msgpack.RegisterExt(int8(typ), v)
+//	msgpack.Marshal(v)              msgpack.Marshal(v, options...)
+//	msgpack.NewReader(r)            msgpack.NewDecoder(r).Reader()
+//	msgpack.NewWriter(w)            msgpack.NewEncoder(w).Writer()
+package v1compat
+
+import (
+	"io"
+	"math"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/pkg/errors"
+)
+
+// RegisterExt is the v1 form of msgpack.RegisterExt. typ must fit in a
+// byte: v1 accepted any int, and silently truncated it when encoding.
+// Types from 128 to 255 are taken as the unsigned form of negative
+// types, which v1 required for them to be decoded
+func RegisterExt(typ int, v interface{}) error {
+	if typ < math.MinInt8 || typ > math.MaxUint8 {
+		return errors.Errorf(`msgpack: extension type %d is not in range (255 >= x >= -128)`, typ)
+	}
+	return msgpack.RegisterExt(int8(typ), v)
+}
+
+// Marshal is the v1 form of msgpack.Marshal, which takes no options
+func Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// NewReader is the v1 form of msgpack.NewDecoder(r).Reader()
+func NewReader(r io.Reader) msgpack.Reader {
+	return msgpack.NewDecoder(r).Reader()
+}
+
+// NewWriter is the v1 form of msgpack.NewEncoder(w).Writer()
+func NewWriter(w io.Writer) msgpack.Writer {
+	return msgpack.NewEncoder(w).Writer()
+}
@@ -0,0 +1,95 @@
+package v1compat_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/lestrrat-go/msgpack/v2/v1compat"
+	"github.com/stretchr/testify/assert"
+)
+
+type flagExt struct {
+	On bool
+}
+
+func (v flagExt) EncodeMsgpack(e *msgpack.Encoder) error {
+	return e.EncodeBool(v.On)
+}
+
+func (v *flagExt) DecodeMsgpack(d *msgpack.Decoder) error {
+	return d.DecodeBool(&v.On)
+}
+
+// negativeExt is a distinct type, as a type can only be registered
+// once
+type negativeExt flagExt
+
+func (v negativeExt) EncodeMsgpack(e *msgpack.Encoder) error {
+	return e.EncodeBool(v.On)
+}
+
+func (v *negativeExt) DecodeMsgpack(d *msgpack.Decoder) error {
+	return d.DecodeBool(&v.On)
+}
+
+func TestV1Compat(t *testing.T) {
+	t.Run("RegisterExt", func(t *testing.T) {
+		for _, typ := range []int{256, -129, 300} {
+			if !assert.Error(t, v1compat.RegisterExt(typ, flagExt{}), "RegisterExt(%d) should fail", typ) {
+				return
+			}
+		}
+		if !assert.NoError(t, v1compat.RegisterExt(20, flagExt{}), "RegisterExt should succeed") {
+			return
+		}
+
+		b, err := v1compat.Marshal(flagExt{On: true})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.FixExt1.Byte(), 20, msgpack.True.Byte()}, b, "output should match") {
+			return
+		}
+
+		// 250 is how v1 programs registered the type -6
+		if !assert.NoError(t, v1compat.RegisterExt(250, negativeExt{}), "RegisterExt should succeed") {
+			return
+		}
+		b, err = v1compat.Marshal(negativeExt{On: true})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.FixExt1.Byte(), 0xfa, msgpack.True.Byte()}, b, "output should match") {
+			return
+		}
+		var decoded interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, &negativeExt{On: true}, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("Reader and Writer", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := v1compat.NewWriter(&buf)
+		if !assert.NoError(t, w.WriteByteUint16(msgpack.Uint16.Byte(), 0x1234), "WriteByteUint16 should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.Uint16.Byte(), 0x12, 0x34}, buf.Bytes(), "output should match") {
+			return
+		}
+
+		code, v, err := v1compat.NewReader(&buf).ReadByteUint16()
+		if !assert.NoError(t, err, "ReadByteUint16 should succeed") {
+			return
+		}
+		if !assert.Equal(t, msgpack.Uint16.Byte(), code, "code should match") {
+			return
+		}
+		if !assert.Equal(t, uint16(0x1234), v, "value should match") {
+			return
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package msgpack_test
+
+import (
+	"testing"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// tagExt is encoded as a single byte extension payload
+type tagExt struct {
+	Tag byte
+}
+
+func (v tagExt) EncodeMsgpack(e *msgpack.Encoder) error {
+	return e.Writer().WriteByte(v.Tag)
+}
+
+func (v *tagExt) DecodeMsgpack(d *msgpack.Decoder) error {
+	b, err := d.Reader().ReadByte()
+	if err != nil {
+		return err
+	}
+	v.Tag = b
+	return nil
+}
+
+func init() {
+	if err := msgpack.RegisterExt(-5, tagExt{}); err != nil {
+		panic(err)
+	}
+}
+
+func TestV2(t *testing.T) {
+	t.Run("ext types are int8", func(t *testing.T) {
+		b, err := msgpack.Marshal(tagExt{Tag: 1})
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.FixExt1.Byte(), 0xfb, 0x01}, b, "output should match") {
+			return
+		}
+
+		var decoded interface{}
+		if !assert.NoError(t, msgpack.Unmarshal(b, &decoded), "Unmarshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, &tagExt{Tag: 1}, decoded, "values should match") {
+			return
+		}
+	})
+	t.Run("marshal options", func(t *testing.T) {
+		b, err := msgpack.Marshal(int64(1))
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{msgpack.Int64.Byte(), 0, 0, 0, 0, 0, 0, 0, 1}, b, "output should match") {
+			return
+		}
+
+		b, err = msgpack.Marshal(int64(1), msgpack.WithCompactInts())
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, []byte{0x01}, b, "output should use the smallest form") {
+			return
+		}
+	})
+	t.Run("marshal errors", func(t *testing.T) {
+		_, err := msgpack.Marshal(make(chan int))
+		if !assert.Error(t, err, "Marshal should fail") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), "msgpack: failed to marshal", "error should be prefixed") {
+			return
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValue(t *testing.T) {
+	src := map[string]interface{}{
+		"string": "Hello, World!",
+		"int":    int8(-1),
+		"uint":   uint16(300),
+		"float":  float64(1.5),
+		"bool":   true,
+		"nil":    nil,
+		"bytes":  []byte("foo"),
+		"array":  []interface{}{"foo", "bar"},
+		"map":    map[string]interface{}{"baz": "quux"},
+	}
+
+	b, err := msgpack.Marshal(src)
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	v, err := msgpack.ParseValue(b)
+	if !assert.NoError(t, err, "ParseValue should succeed") {
+		return
+	}
+
+	if !assert.Equal(t, msgpack.MapKind, v.Kind(), "Kind should be map") {
+		return
+	}
+
+	if !assert.Equal(t, len(src), v.Len(), "Len should match") {
+		return
+	}
+
+	expected := map[string]interface{}{
+		"string": "Hello, World!",
+		"int":    int64(-1),
+		"uint":   uint64(300),
+		"float":  float64(1.5),
+		"bool":   true,
+		"nil":    nil,
+		"bytes":  []byte("foo"),
+		"array":  []interface{}{"foo", "bar"},
+		"map":    map[string]interface{}{"baz": "quux"},
+	}
+
+	t.Run("Interface returns copies", func(t *testing.T) {
+		m := v.Interface().(map[string]interface{})
+		if !assert.Equal(t, expected, m, "Interface should match") {
+			return
+		}
+
+		m["string"] = "modified"
+		m["bytes"].([]byte)[0] = 'x'
+		if !assert.Equal(t, expected, v.Interface(), "Value should not be affected by modifications to copies") {
+			return
+		}
+	})
+	t.Run("concurrent readers", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					v.Interface()
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	t.Run("re-encode", func(t *testing.T) {
+		encoded, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+
+		v2, err := msgpack.ParseValue(encoded)
+		if !assert.NoError(t, err, "ParseValue should succeed") {
+			return
+		}
+
+		if !assert.Equal(t, expected, v2.Interface(), "value should match") {
+			return
+		}
+	})
+}
+
+func TestDecodeValueExt(t *testing.T) {
+	b, err := msgpack.Marshal(EventTime{})
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	var v msgpack.Value
+	if !assert.NoError(t, msgpack.Unmarshal(b, &v), "Unmarshal should succeed") {
+		return
+	}
+
+	if !assert.Equal(t, msgpack.ExtKind, v.Kind(), "Kind should be ext") {
+		return
+	}
+
+	if !assert.Equal(t, int8(0), v.ExtType(), "ExtType should match") {
+		return
+	}
+
+	if !assert.Equal(t, 8, v.Len(), "Len should match") {
+		return
+	}
+}
+
+func TestDecodeValueUntrusted(t *testing.T) {
+	t.Run("forged length", func(t *testing.T) {
+		// An array that declares 268M elements, and holds none
+		_, err := msgpack.ParseValue([]byte{0xdd, 0x0f, 0xff, 0xff, 0xff})
+		if !assert.Error(t, err, "ParseValue should fail") {
+			return
+		}
+	})
+	t.Run("WithMaxDepth", func(t *testing.T) {
+		b := append(bytes.Repeat([]byte{msgpack.FixArray1.Byte()}, 1<<20), 0x01)
+		_, err := msgpack.ParseValue(b, msgpack.WithMaxDepth(100))
+		if !assert.Equal(t, msgpack.ErrMaxDepth, errors.Cause(err), "ParseValue should honor WithMaxDepth") {
+			return
+		}
+	})
+	t.Run("negative ext type", func(t *testing.T) {
+		b, err := msgpack.Marshal(time.Unix(1500000000, 0))
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		v, err := msgpack.ParseValue(b)
+		if !assert.NoError(t, err, "ParseValue should succeed") {
+			return
+		}
+		if !assert.Equal(t, int8(-1), v.ExtType(), "ExtType should be signed") {
+			return
+		}
+		encoded, err := msgpack.Marshal(v)
+		if !assert.NoError(t, err, "Marshal should succeed") {
+			return
+		}
+		if !assert.Equal(t, b, encoded, "the value should be re-encoded as is") {
+			return
+		}
+	})
+}
+
+func TestValueAccessors(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"name":  "lestrrat",
+		"count": uint8(200),
+		"ratio": float32(0.5),
+		"ok":    true,
+		"tags":  []string{"foo", "bar", "baz"},
+		"nested": map[string]interface{}{
+			"depth": int16(-300),
+		},
+	})
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	v, err := msgpack.ParseValue(b)
+	if !assert.NoError(t, err, "ParseValue should succeed") {
+		return
+	}
+
+	t.Run("scalars", func(t *testing.T) {
+		s, err := v.Get("name").Str()
+		if !assert.NoError(t, err, "Str should succeed") {
+			return
+		}
+		if !assert.Equal(t, "lestrrat", s, "Str should match") {
+			return
+		}
+
+		i, err := v.Get("count").Int()
+		if !assert.NoError(t, err, "Int should succeed") {
+			return
+		}
+		if !assert.Equal(t, int64(200), i, "Int should match") {
+			return
+		}
+
+		f, err := v.Get("ratio").Float()
+		if !assert.NoError(t, err, "Float should succeed") {
+			return
+		}
+		if !assert.Equal(t, float64(0.5), f, "Float should match") {
+			return
+		}
+
+		ok, err := v.Get("ok").Bool()
+		if !assert.NoError(t, err, "Bool should succeed") {
+			return
+		}
+		if !assert.True(t, ok, "Bool should match") {
+			return
+		}
+	})
+	t.Run("kind mismatch", func(t *testing.T) {
+		_, err := v.Get("name").Int()
+		if !assert.Error(t, err, "Int on a string should fail") {
+			return
+		}
+		_, err = v.Get("nested").Get("depth").Uint()
+		if !assert.Error(t, err, "Uint on a negative number should fail") {
+			return
+		}
+	})
+	t.Run("chaining", func(t *testing.T) {
+		s, err := v.Get("tags").Index(1).Str()
+		if !assert.NoError(t, err, "Str should succeed") {
+			return
+		}
+		if !assert.Equal(t, "bar", s, "Str should match") {
+			return
+		}
+
+		i, err := v.Get("nested").Get("depth").Int()
+		if !assert.NoError(t, err, "Int should succeed") {
+			return
+		}
+		if !assert.Equal(t, int64(-300), i, "Int should match") {
+			return
+		}
+
+		missing := v.Get("nested").Get("nope").Index(3)
+		if !assert.False(t, missing.Exists(), "missing value should not exist") {
+			return
+		}
+		if !assert.Equal(t, msgpack.InvalidKind, missing.Kind(), "missing value should be invalid") {
+			return
+		}
+	})
+	t.Run("Range", func(t *testing.T) {
+		var tags []string
+		v.Get("tags").Range(func(_ string, elem *msgpack.Value) bool {
+			s, err := elem.Str()
+			if !assert.NoError(t, err, "Str should succeed") {
+				return false
+			}
+			tags = append(tags, s)
+			return true
+		})
+		if !assert.Equal(t, []string{"foo", "bar", "baz"}, tags, "Range should visit all elements in order") {
+			return
+		}
+
+		var count int
+		v.Range(func(key string, _ *msgpack.Value) bool {
+			count++
+			return count < 2
+		})
+		if !assert.Equal(t, 2, count, "Range should stop when fn returns false") {
+			return
+		}
+	})
+}
+
+func TestLookupKeys(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"level":   "error",
+		"message": "something went wrong",
+		"payload": map[string]interface{}{"huge": []string{"a", "b", "c"}},
+	})
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	found, err := msgpack.LookupKeys(b, "level", "nonexistent")
+	if !assert.NoError(t, err, "LookupKeys should succeed") {
+		return
+	}
+
+	if !assert.Len(t, found, 1, "only existing keys should be returned") {
+		return
+	}
+
+	s, err := found["level"].Str()
+	if !assert.NoError(t, err, "Str should succeed") {
+		return
+	}
+	if !assert.Equal(t, "error", s, "value should match") {
+		return
+	}
+
+	b, err = msgpack.Marshal([]string{"not", "a", "map"})
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+	_, err = msgpack.LookupKeys(b, "level")
+	if !assert.Error(t, err, "LookupKeys should fail for non-maps") {
+		return
+	}
+}
@@ -0,0 +1,77 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyWriter accepts at most max bytes per call to Write, and
+// reports a short count without an error, like some custom
+// io.Writers do
+type flakyWriter struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		p = p[:w.max]
+	}
+	return w.buf.Write(p)
+}
+
+type stuckWriter struct{}
+
+func (stuckWriter) Write(p []byte) (int, error) {
+	return 0, nil
+}
+
+func TestWriterPartialWrite(t *testing.T) {
+	var list = []interface{}{
+		int64(-12345678),
+		uint64(12345678),
+		float64(3.14),
+		"Hello, World!",
+		strings.Repeat("a", 300),
+		[]byte(strings.Repeat("b", 70000)),
+		[]string{"uno", "dos", "tres"},
+		map[string]interface{}{"foo": "bar"},
+		dummyStruct{Message: "Hello, World!"},
+		time.Unix(1234567890, 123),
+	}
+
+	for _, max := range []int{1, 2, 3, 7} {
+		for _, v := range list {
+			expected, err := msgpack.Marshal(v)
+			if !assert.NoError(t, err, "Marshal should succeed") {
+				return
+			}
+			expected = append([]byte(nil), expected...)
+
+			w := &flakyWriter{max: max}
+			if !assert.NoError(t, msgpack.NewEncoder(w).Encode(v), "Encode should succeed (max = %d)", max) {
+				return
+			}
+			if !assert.Equal(t, expected, w.buf.Bytes(), "output should match (max = %d, %T)", max, v) {
+				return
+			}
+		}
+	}
+
+	t.Run("no progress", func(t *testing.T) {
+		err := msgpack.NewEncoder(stuckWriter{}).Encode("Hello, World!")
+		if !assert.Error(t, err, "Encode should fail") {
+			return
+		}
+		if !assert.Equal(t, io.ErrShortWrite, errors.Cause(err), "error should be io.ErrShortWrite") {
+			return
+		}
+	})
+}
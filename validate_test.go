@@ -0,0 +1,134 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	msgpack "github.com/lestrrat-go/msgpack"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	v := map[string]interface{}{
+		"nil":    nil,
+		"bool":   true,
+		"ints":   []interface{}{int8(-1), uint8(200), int16(-300), uint32(70000), int64(-1 << 40), uint64(1 << 63)},
+		"floats": []interface{}{float32(1.5), 2.5},
+		"str":    string(bytes.Repeat([]byte{'x'}, 300)),
+		"bin":    bytes.Repeat([]byte{1}, 70000),
+		"time":   time.Unix(1500000000, 5),
+		"ext":    blobExt{Data: []byte{1, 2, 3}},
+		"nested": map[string]interface{}{"foo": []interface{}{map[string]interface{}{}}},
+	}
+	data, err := msgpack.Marshal(v)
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+
+	if !assert.NoError(t, msgpack.Validate(data), "Validate should succeed") {
+		return
+	}
+	if !assert.True(t, msgpack.Valid(data), "Valid should return true") {
+		return
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		for i := 0; i < len(data); i++ {
+			if !assert.False(t, msgpack.Valid(data[:i]), "Valid should return false for the first %d bytes", i) {
+				return
+			}
+		}
+	})
+	t.Run("trailing bytes", func(t *testing.T) {
+		err := msgpack.Validate(append(append([]byte(nil), data...), 0x01))
+		terr, ok := errors.Cause(err).(*msgpack.TrailingBytesError)
+		if !assert.True(t, ok, "error should be a TrailingBytesError (got %v)", err) {
+			return
+		}
+		if !assert.Equal(t, 1, terr.Count, "there should be 1 trailing byte") {
+			return
+		}
+	})
+	t.Run("invalid input", func(t *testing.T) {
+		inputs := map[string][]byte{
+			"empty":         {},
+			"reserved code": {msgpack.FixArray2.Byte(), 0x01, 0xc1},
+			"huge array":    {msgpack.Array32.Byte(), 0xff, 0xff, 0xff, 0xff},
+			"huge map":      {msgpack.Map32.Byte(), 0xff, 0xff, 0xff, 0xff, 0x01, 0x01},
+			"huge ext":      {msgpack.Ext32.Byte(), 0xff, 0xff, 0xff, 0xff, 0x01},
+			"missing value": {msgpack.FixMap1.Byte(), 0x01},
+		}
+		for name, data := range inputs {
+			if !assert.False(t, msgpack.Valid(data), "Valid should return false for %s", name) {
+				return
+			}
+		}
+
+		err := msgpack.Validate([]byte{msgpack.FixArray2.Byte(), 0x01, 0xc1})
+		rerr, ok := errors.Cause(err).(*msgpack.ReservedCodeError)
+		if !assert.True(t, ok, "error should be a ReservedCodeError (got %v)", err) {
+			return
+		}
+		if !assert.Equal(t, int64(2), rerr.Offset, "offset should match") {
+			return
+		}
+	})
+	t.Run("deep nesting", func(t *testing.T) {
+		const depth = 1000000
+		deep := append(bytes.Repeat([]byte{msgpack.FixArray1.Byte()}, depth), msgpack.Nil.Byte())
+		if !assert.NoError(t, msgpack.Validate(deep), "Validate should succeed") {
+			return
+		}
+		if !assert.False(t, msgpack.Valid(deep[:depth]), "Valid should return false when the innermost value is missing") {
+			return
+		}
+	})
+	t.Run("scan header", func(t *testing.T) {
+		testcases := []struct {
+			Name     string
+			Data     []byte
+			Header   int
+			Payload  int
+			Elements uint64
+		}{
+			{Name: "fixnum", Data: []byte{0x01}, Header: 1},
+			{Name: "uint16", Data: []byte{0xcd, 0x01, 0x00}, Header: 1, Payload: 2},
+			{Name: "fixstr", Data: []byte{0xa2, 'h', 'i'}, Header: 1, Payload: 2},
+			{Name: "bin8", Data: []byte{0xc4, 0x02, 0x01, 0x02}, Header: 2, Payload: 2},
+			{Name: "fixext1", Data: []byte{0xd4, 0x05, 0x01}, Header: 2, Payload: 1},
+			{Name: "ext8", Data: []byte{0xc7, 0x02, 0x05, 0x01, 0x02}, Header: 3, Payload: 2},
+			{Name: "fixarray", Data: []byte{0x92, 0x01, 0x02}, Header: 1, Elements: 2},
+			{Name: "map16", Data: []byte{0xde, 0x00, 0x01, 0x01, 0x02}, Header: 3, Elements: 2},
+		}
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				hdr, size, elements, err := msgpack.ScanHeader(tc.Data)
+				if !assert.NoError(t, err, "ScanHeader should succeed") {
+					return
+				}
+				if !assert.Equal(t, []interface{}{tc.Header, tc.Payload, tc.Elements}, []interface{}{hdr, size, elements}, "sizes should match") {
+					return
+				}
+				if _, _, _, err := msgpack.ScanHeader(tc.Data[:hdr+size-1]); !assert.Equal(t, io.ErrUnexpectedEOF, err, "ScanHeader should fail on truncated input") {
+					return
+				}
+			})
+		}
+	})
+	t.Run("allocations", func(t *testing.T) {
+		if raceEnabled {
+			t.Skip("allocation counts are not reliable under the race detector")
+		}
+
+		allocs := testing.AllocsPerRun(100, func() {
+			msgpack.Valid(data)
+		})
+		if !assert.Equal(t, float64(0), allocs, "Valid should not allocate") {
+			return
+		}
+	})
+}
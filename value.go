@@ -0,0 +1,589 @@
+package msgpack
+
+import (
+	"bytes"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// ValueKind describes the coarse type of a Value
+type ValueKind int
+
+const (
+	InvalidKind ValueKind = iota
+	NilKind
+	BoolKind
+	IntKind
+	UintKind
+	FloatKind
+	StringKind
+	BytesKind
+	ArrayKind
+	MapKind
+	ExtKind
+)
+
+func (k ValueKind) String() string {
+	switch k {
+	case NilKind:
+		return "nil"
+	case BoolKind:
+		return "bool"
+	case IntKind:
+		return "int"
+	case UintKind:
+		return "uint"
+	case FloatKind:
+		return "float"
+	case StringKind:
+		return "string"
+	case BytesKind:
+		return "bytes"
+	case ArrayKind:
+		return "array"
+	case MapKind:
+		return "map"
+	case ExtKind:
+		return "ext"
+	default:
+		return "invalid"
+	}
+}
+
+// Value is a generic, decoded representation of a msgpack value.
+//
+// Once it has been decoded, a Value is never modified: all accessors
+// return copies of the underlying data (copy-on-read), so that a single
+// Value can be decoded once and then handed out to multiple goroutines
+// that read it concurrently, as is the case in fan-out broadcast servers.
+type Value struct {
+	kind    ValueKind
+	code    Code
+	b       bool
+	i       int64
+	u       uint64
+	f       float64
+	s       string
+	raw     []byte
+	exttyp  int8
+	list    []*Value
+	mapkeys []string
+}
+
+// maxValuePrealloc is the number of elements that DecodeValue makes
+// room for up front. Arrays and maps that declare more grow as their
+// elements are decoded, so that a forged length in a short message
+// cannot make the decoder allocate a large amount of memory
+const maxValuePrealloc = 1024
+
+// ParseValue decodes a single msgpack value from data into a Value.
+// The options are used to configure the Decoder: when data comes from
+// an untrusted peer, use WithMaxDepth to bound how deeply the value may
+// be nested
+func ParseValue(data []byte, options ...Option) (*Value, error) {
+	var v Value
+	if err := Unmarshal(data, &v, options...); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to parse value`)
+	}
+	return &v, nil
+}
+
+// LookupKeys decodes the values associated with the given keys from
+// the msgpack map in data. Values that are associated with other keys
+// are skipped over without being decoded, which makes this much cheaper
+// than decoding the entire map when only a few keys are of interest.
+//
+// Keys that do not exist in the map are not included in the result
+func LookupKeys(data []byte, keys ...string) (map[string]*Value, error) {
+	wanted := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		wanted[key] = struct{}{}
+	}
+
+	d := NewDecoder(bytes.NewReader(data))
+	var size int
+	if err := d.DecodeMapLength(&size); err != nil {
+		return nil, errors.Wrap(err, `msgpack: failed to decode map length`)
+	}
+
+	found := make(map[string]*Value, len(keys))
+	for i := 0; i < size && len(found) < len(wanted); i++ {
+		var key string
+		if err := d.DecodeString(&key); err != nil {
+			return nil, errors.Wrap(err, `msgpack: failed to decode map key`)
+		}
+
+		if _, ok := wanted[key]; !ok {
+			if err := d.skip(); err != nil {
+				return nil, errors.Wrapf(err, `msgpack: failed to skip map element for key %s`, key)
+			}
+			continue
+		}
+
+		var v Value
+		if err := d.DecodeValue(&v); err != nil {
+			return nil, errors.Wrapf(err, `msgpack: failed to decode map element for key %s`, key)
+		}
+		found[key] = &v
+	}
+	return found, nil
+}
+
+// Kind returns the coarse type of the value. Accessors such as Get and
+// Index return nil when the requested element does not exist, and calling
+// Kind on such a nil Value returns InvalidKind, which makes it safe
+// to chain calls
+func (v *Value) Kind() ValueKind {
+	if v == nil {
+		return InvalidKind
+	}
+	return v.kind
+}
+
+// Exists returns true if the value is not nil
+func (v *Value) Exists() bool {
+	return v != nil
+}
+
+// IsNil returns true if the value is a msgpack Nil
+func (v *Value) IsNil() bool {
+	return v.Kind() == NilKind
+}
+
+func (v *Value) kindError(expected string) error {
+	return errors.Errorf(`msgpack: expected %s value, got %s`, expected, v.Kind())
+}
+
+// Bool returns the value as a bool
+func (v *Value) Bool() (bool, error) {
+	if v.Kind() != BoolKind {
+		return false, v.kindError(`bool`)
+	}
+	return v.b, nil
+}
+
+// Int returns the value as an int64. Unsigned values are accepted
+// as long as they fit in an int64
+func (v *Value) Int() (int64, error) {
+	switch v.Kind() {
+	case IntKind:
+		return v.i, nil
+	case UintKind:
+		if v.u > math.MaxInt64 {
+			return 0, errors.Errorf(`msgpack: value %d overflows int64`, v.u)
+		}
+		return int64(v.u), nil
+	}
+	return 0, v.kindError(`integer`)
+}
+
+// Uint returns the value as an uint64. Signed values are accepted
+// as long as they are not negative
+func (v *Value) Uint() (uint64, error) {
+	switch v.Kind() {
+	case UintKind:
+		return v.u, nil
+	case IntKind:
+		if v.i < 0 {
+			return 0, errors.Errorf(`msgpack: negative value %d cannot be converted to uint64`, v.i)
+		}
+		return uint64(v.i), nil
+	}
+	return 0, v.kindError(`unsigned integer`)
+}
+
+// Float returns the value as a float64. Integer values are
+// converted to float64
+func (v *Value) Float() (float64, error) {
+	switch v.Kind() {
+	case FloatKind:
+		return v.f, nil
+	case IntKind:
+		return float64(v.i), nil
+	case UintKind:
+		return float64(v.u), nil
+	}
+	return 0, v.kindError(`numeric`)
+}
+
+// Str returns the value as a string.
+func (v *Value) Str() (string, error) {
+	if v.Kind() != StringKind {
+		return "", v.kindError(`string`)
+	}
+	return v.s, nil
+}
+
+// Get returns the element associated with key in a map value.
+// If the value is not a map or the key does not exist, nil is returned
+func (v *Value) Get(key string) *Value {
+	if v.Kind() != MapKind {
+		return nil
+	}
+
+	for i, k := range v.mapkeys {
+		if k == key {
+			return v.list[i]
+		}
+	}
+	return nil
+}
+
+// Index returns the i-th element of an array value. If the value
+// is not an array or i is out of range, nil is returned
+func (v *Value) Index(i int) *Value {
+	if v.Kind() != ArrayKind || i < 0 || i >= len(v.list) {
+		return nil
+	}
+	return v.list[i]
+}
+
+// Keys returns the keys of a map value, in the order that they
+// appeared on the wire
+func (v *Value) Keys() []string {
+	if v.Kind() != MapKind {
+		return nil
+	}
+
+	keys := make([]string, len(v.mapkeys))
+	copy(keys, v.mapkeys)
+	return keys
+}
+
+// Range calls fn for each element of a map or an array value, in the
+// order that they appeared on the wire. For arrays, the key is always
+// the empty string. Iteration stops when fn returns false
+func (v *Value) Range(fn func(string, *Value) bool) {
+	switch v.Kind() {
+	case MapKind:
+		for i, elem := range v.list {
+			if !fn(v.mapkeys[i], elem) {
+				return
+			}
+		}
+	case ArrayKind:
+		for _, elem := range v.list {
+			if !fn("", elem) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of elements for arrays and maps, and the
+// number of bytes for strings, byte slices and extensions. For all
+// other kinds, 0 is returned
+func (v *Value) Len() int {
+	switch v.Kind() {
+	case ArrayKind, MapKind:
+		return len(v.list)
+	case StringKind:
+		return len(v.s)
+	case BytesKind, ExtKind:
+		return len(v.raw)
+	}
+	return 0
+}
+
+// Bytes returns a copy of the payload for byte slices and extensions
+func (v *Value) Bytes() []byte {
+	switch v.Kind() {
+	case BytesKind, ExtKind:
+		return copyBytes(v.raw)
+	}
+	return nil
+}
+
+// ExtType returns the extension type of the value, from -128 to 127.
+// The result is meaningless unless Kind() returns ExtKind
+func (v *Value) ExtType() int {
+	if v == nil {
+		return 0
+	}
+	return int(v.exttyp)
+}
+
+// Interface returns the value as a fresh Go value using the same types
+// that the Decoder produces for interface{} targets. Because a new
+// value is created on every call, callers are free to modify the result
+func (v *Value) Interface() interface{} {
+	switch v.Kind() {
+	case BoolKind:
+		return v.b
+	case IntKind:
+		return v.i
+	case UintKind:
+		return v.u
+	case FloatKind:
+		return v.f
+	case StringKind:
+		return v.s
+	case BytesKind, ExtKind:
+		return copyBytes(v.raw)
+	case ArrayKind:
+		l := make([]interface{}, len(v.list))
+		for i, e := range v.list {
+			l[i] = e.Interface()
+		}
+		return l
+	case MapKind:
+		m := make(map[string]interface{}, len(v.list))
+		for i, e := range v.list {
+			m[v.mapkeys[i]] = e.Interface()
+		}
+		return m
+	}
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	ret := make([]byte, len(b))
+	copy(ret, b)
+	return ret
+}
+
+// decodeValueElement decodes an element of an array or a map into e,
+// keeping track of how deep it is nested if MaxDepth is set
+func (d *Decoder) decodeValueElement(e *Value) error {
+	if d.options.MaxDepth > 0 {
+		code, err := d.PeekCode()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to peek code`)
+		}
+		descended, err := d.descend(code)
+		if err != nil {
+			return err
+		}
+		if descended {
+			defer d.ascend()
+		}
+	}
+	return d.DecodeValue(e)
+}
+
+// DecodeValue decodes the next value in the stream into a Value
+func (d *Decoder) DecodeValue(v *Value) error {
+	code, err := d.PeekCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to peek code`)
+	}
+
+	*v = Value{code: code}
+	switch {
+	case code == Nil:
+		v.kind = NilKind
+		return d.DecodeNil(nil)
+	case code == True || code == False:
+		v.kind = BoolKind
+		return d.DecodeBool(&v.b)
+	case IsPositiveFixNum(code):
+		d.raw.ReadByte()
+		v.kind = IntKind
+		v.i = int64(code)
+		return nil
+	case IsNegativeFixNum(code):
+		d.raw.ReadByte()
+		v.kind = IntKind
+		v.i = int64(int8(code))
+		return nil
+	case code == Int8 || code == Int16 || code == Int32 || code == Int64:
+		v.kind = IntKind
+		return d.decodeValueInt(v)
+	case code == Uint8 || code == Uint16 || code == Uint32 || code == Uint64:
+		v.kind = UintKind
+		return d.DecodeUint64(&v.u)
+	case code == Float:
+		var f float32
+		if err := d.DecodeFloat32(&f); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode float value`)
+		}
+		v.kind = FloatKind
+		v.f = float64(f)
+		return nil
+	case code == Double:
+		v.kind = FloatKind
+		return d.DecodeFloat64(&v.f)
+	case IsStrFamily(code):
+		v.kind = StringKind
+		return d.DecodeString(&v.s)
+	case IsBinFamily(code):
+		v.kind = BytesKind
+		return d.DecodeBytes(&v.raw)
+	case IsArrayFamily(code):
+		var size int
+		if err := d.DecodeArrayLength(&size); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode array length`)
+		}
+		v.kind = ArrayKind
+		v.list = make([]*Value, 0, preallocValues(size))
+		for i := 0; i < size; i++ {
+			var e Value
+			if err := d.decodeValueElement(&e); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to decode array element %d`, i)
+			}
+			v.list = append(v.list, &e)
+		}
+		return nil
+	case IsMapFamily(code):
+		var size int
+		if err := d.DecodeMapLength(&size); err != nil {
+			return errors.Wrap(err, `msgpack: failed to decode map length`)
+		}
+		v.kind = MapKind
+		v.mapkeys = make([]string, 0, preallocValues(size))
+		v.list = make([]*Value, 0, preallocValues(size))
+		for i := 0; i < size; i++ {
+			var key string
+			if err := d.DecodeString(&key); err != nil {
+				return errors.Wrap(err, `msgpack: failed to decode map key`)
+			}
+
+			var e Value
+			if err := d.decodeValueElement(&e); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to decode map element for key %s`, key)
+			}
+			v.mapkeys = append(v.mapkeys, key)
+			v.list = append(v.list, &e)
+		}
+		return nil
+	case IsExtFamily(code):
+		var size int
+		if err := d.DecodeExtLength(&size); err != nil {
+			return errors.Wrap(err, `msgpack: failed to read extension size`)
+		}
+
+		typ, err := d.src.ReadUint8()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read extension type`)
+		}
+
+		v.kind = ExtKind
+		v.exttyp = int8(typ)
+		if v.raw, err = d.allocBytes(size); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(d.raw, v.raw); err != nil {
+			return errors.Wrap(err, `msgpack: failed to read extension payload`)
+		}
+		return nil
+	}
+	if code == reservedCode {
+		// Consume the reserved byte, so that the decoder can resync
+		d.raw.ReadByte()
+	}
+	return d.invalidCode(code, errors.Errorf(`msgpack: invalid code %s`, code))
+}
+
+// preallocValues returns the number of elements to make room for in an
+// array or a map that declares size elements
+func preallocValues(size int) int {
+	if size > maxValuePrealloc {
+		return maxValuePrealloc
+	}
+	return size
+}
+
+func (d *Decoder) decodeValueInt(v *Value) error {
+	code, err := d.ReadCode()
+	if err != nil {
+		return errors.Wrap(err, `msgpack: failed to read code`)
+	}
+
+	switch code {
+	case Int8:
+		x, err := d.src.ReadUint8()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read payload for Int8`)
+		}
+		v.i = int64(int8(x))
+	case Int16:
+		x, err := d.src.ReadUint16()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read payload for Int16`)
+		}
+		v.i = int64(int16(x))
+	case Int32:
+		x, err := d.src.ReadUint32()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read payload for Int32`)
+		}
+		v.i = int64(int32(x))
+	case Int64:
+		x, err := d.src.ReadUint64()
+		if err != nil {
+			return errors.Wrap(err, `msgpack: failed to read payload for Int64`)
+		}
+		v.i = int64(x)
+	}
+	return nil
+}
+
+// DecodeMsgpack implements the DecodeMsgpacker interface, so that
+// a Value can be passed to Decode and Unmarshal
+func (v *Value) DecodeMsgpack(d *Decoder) error {
+	return d.DecodeValue(v)
+}
+
+// EncodeMsgpack implements the EncodeMsgpacker interface, so that
+// a Value can be re-encoded as-is
+func (v Value) EncodeMsgpack(e *Encoder) error {
+	switch v.kind {
+	case NilKind:
+		return e.EncodeNil()
+	case BoolKind:
+		return e.EncodeBool(v.b)
+	case IntKind:
+		return e.EncodeInt64(v.i)
+	case UintKind:
+		return e.EncodeUint64(v.u)
+	case FloatKind:
+		if v.code == Float && float64(float32(v.f)) == v.f {
+			return e.EncodeFloat32(float32(v.f))
+		}
+		return e.EncodeFloat64(v.f)
+	case StringKind:
+		return e.EncodeString(v.s)
+	case BytesKind:
+		return e.EncodeBytes(v.raw)
+	case ArrayKind:
+		if err := e.EncodeArrayHeader(len(v.list)); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode array header`)
+		}
+		for i, elem := range v.list {
+			if err := elem.EncodeMsgpack(e); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to encode array element %d`, i)
+			}
+		}
+		return nil
+	case MapKind:
+		if err := WriteMapHeader(e.dst, len(v.list)); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode map header`)
+		}
+		for i, elem := range v.list {
+			if err := e.EncodeString(v.mapkeys[i]); err != nil {
+				return errors.Wrap(err, `msgpack: failed to encode map key`)
+			}
+			if err := elem.EncodeMsgpack(e); err != nil {
+				return errors.Wrapf(err, `msgpack: failed to encode map element for key %s`, v.mapkeys[i])
+			}
+		}
+		return nil
+	case ExtKind:
+		if err := e.EncodeExtHeader(len(v.raw)); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode extension header`)
+		}
+		if err := e.dst.WriteByte(byte(v.exttyp)); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode extension type`)
+		}
+		if _, err := e.dst.Write(v.raw); err != nil {
+			return errors.Wrap(err, `msgpack: failed to encode extension payload`)
+		}
+		return nil
+	}
+	return errors.Errorf(`msgpack: cannot encode value of kind %s`, v.kind)
+}
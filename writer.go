@@ -21,8 +21,24 @@ func NewWriter(w io.Writer) Writer {
 	}
 }
 
+// Write writes all of buf to the underlying io.Writer. Some io.Writers
+// return a short count without reporting an error: in that case we
+// keep writing the remaining bytes, so that the output is never
+// silently truncated. If the io.Writer makes no progress at all,
+// io.ErrShortWrite is returned
 func (w writer) Write(buf []byte) (int, error) {
-	return w.dst.Write(buf)
+	var written int
+	for written < len(buf) {
+		n, err := w.dst.Write(buf[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n <= 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
 }
 
 func (w writer) WriteString(s string) (int, error) {